@@ -67,6 +67,7 @@ NORETURN void doexit_thread(int status)
 #if SYZ_EXECUTOR || SYZ_MULTI_PROC || SYZ_REPEAT && SYZ_CGROUPS ||         \
     SYZ_NET_DEVICES || __NR_syz_mount_image || __NR_syz_read_part_table || \
     __NR_syz_usb_connect || __NR_syz_usb_connect_ath9k ||                  \
+    __NR_syz_bpf_prog_load ||                                              \
     (GOOS_freebsd || GOOS_darwin || GOOS_openbsd || GOOS_netbsd) && SYZ_NET_INJECTION
 static unsigned long long procid;
 #endif
@@ -198,7 +199,7 @@ static void sleep_ms(uint64 ms)
 #endif
 
 #if SYZ_EXECUTOR || SYZ_THREADED || SYZ_REPEAT && SYZ_EXECUTOR_USES_FORK_SERVER || \
-    SYZ_LEAK
+    SYZ_LEAK || __NR_syz_bpf_map_consume
 #include <time.h>
 
 static uint64 current_time_ms(void)
@@ -427,7 +428,7 @@ static int event_timedwait(event_t* ev, uint64 timeout)
 			       (((type)(val) << (bf_off)) & BITMASK((bf_off), (bf_len))))
 #endif
 
-#if SYZ_EXECUTOR || SYZ_USE_CHECKSUMS
+#if SYZ_EXECUTOR || SYZ_USE_CHECKSUMS || __NR_syz_bpf_prog_load
 struct csum_inet {
 	uint32 acc;
 };
@@ -122,7 +122,8 @@ static bool write_file(const char* file, const char* what, ...)
 #endif
 
 #if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_NET_INJECTION || SYZ_DEVLINK_PCI || SYZ_WIFI || SYZ_802154 || \
-    __NR_syz_genetlink_get_family_id || __NR_syz_80211_inject_frame || __NR_syz_80211_join_ibss
+    __NR_syz_genetlink_get_family_id || __NR_syz_80211_inject_frame || __NR_syz_80211_join_ibss || \
+    __NR_syz_bpf_prog_load
 #include <arpa/inet.h>
 #include <net/if.h>
 #include <netinet/in.h>
@@ -170,7 +171,7 @@ static void netlink_attr(struct nlmsg* nlmsg, int typ,
 	nlmsg->pos += NLMSG_ALIGN(attr->nla_len);
 }
 
-#if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_802154
+#if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_802154 || __NR_syz_bpf_prog_load
 static void netlink_nest(struct nlmsg* nlmsg, int typ)
 {
 	struct nlattr* attr = (struct nlattr*)nlmsg->pos;
@@ -244,7 +245,7 @@ static int netlink_send_ext(struct nlmsg* nlmsg, int sock,
 }
 
 #if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_NET_INJECTION || SYZ_DEVLINK_PCI || SYZ_WIFI || SYZ_802154 || \
-    __NR_syz_80211_join_ibss || __NR_syz_80211_inject_frame
+    __NR_syz_80211_join_ibss || __NR_syz_80211_inject_frame || __NR_syz_bpf_prog_load
 static int netlink_send(struct nlmsg* nlmsg, int sock)
 {
 	return netlink_send_ext(nlmsg, sock, 0, NULL, true);
@@ -294,7 +295,7 @@ static int netlink_next_msg(struct nlmsg* nlmsg, unsigned int offset,
 }
 #endif
 
-#if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_802154
+#if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_802154 || __NR_syz_bpf_prog_load
 static void netlink_add_device_impl(struct nlmsg* nlmsg, const char* type,
 				    const char* name)
 {
@@ -308,7 +309,7 @@ static void netlink_add_device_impl(struct nlmsg* nlmsg, const char* type,
 }
 #endif
 
-#if SYZ_EXECUTOR || SYZ_NET_DEVICES
+#if SYZ_EXECUTOR || SYZ_NET_DEVICES || __NR_syz_bpf_prog_load
 static void netlink_add_device(struct nlmsg* nlmsg, int sock, const char* type,
 			       const char* name)
 {
@@ -437,7 +438,7 @@ static void netlink_add_ipvlan(struct nlmsg* nlmsg, int sock, const char* name,
 }
 #endif
 
-#if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_NET_INJECTION || SYZ_DEVLINK_PCI || SYZ_802154
+#if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_NET_INJECTION || SYZ_DEVLINK_PCI || SYZ_802154 || __NR_syz_bpf_prog_load
 static void netlink_device_change(struct nlmsg* nlmsg, int sock, const char* name, bool up,
 				  const char* master, const void* mac, int macsize,
 				  const char* new_name)
@@ -463,7 +464,7 @@ static void netlink_device_change(struct nlmsg* nlmsg, int sock, const char* nam
 }
 #endif
 
-#if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_NET_INJECTION
+#if SYZ_EXECUTOR || SYZ_NET_DEVICES || SYZ_NET_INJECTION || __NR_syz_bpf_prog_load
 static int netlink_add_addr(struct nlmsg* nlmsg, int sock, const char* dev,
 			    const void* addr, int addrsize)
 {
@@ -502,7 +503,7 @@ static void netlink_add_addr6(struct nlmsg* nlmsg, int sock,
 }
 #endif
 
-#if SYZ_EXECUTOR || SYZ_NET_INJECTION
+#if SYZ_EXECUTOR || SYZ_NET_INJECTION || __NR_syz_bpf_prog_load
 static void netlink_add_neigh(struct nlmsg* nlmsg, int sock, const char* name,
 			      const void* addr, int addrsize, const void* mac, int macsize)
 {
@@ -4457,6 +4458,10 @@ static void reset_loop()
 #include <sys/prctl.h>
 #include <unistd.h>
 
+#if SYZ_EXECUTOR || __NR_syz_bpf_prog_load
+static void brf_setup_test(void);
+#endif
+
 #define SYZ_HAVE_SETUP_TEST 1
 static void setup_test()
 {
@@ -4467,6 +4472,11 @@ static void setup_test()
 #endif
 	// It's the leaf test process we want to be always killed first.
 	write_file("/proc/self/oom_score_adj", "1000");
+#if SYZ_EXECUTOR || __NR_syz_bpf_prog_load
+	// Threads of the test attach programs to the cgroups of the test concurrently, so they
+	// are built before any thread starts.
+	brf_setup_test();
+#endif
 #if SYZ_EXECUTOR || SYZ_NET_INJECTION
 	// Read all remaining packets from tun to better
 	// isolate consequently executing programs.
@@ -5307,7 +5317,15 @@ static long syz_clone3(volatile long a0, volatile long a1)
 
 #include <linux/pkt_sched.h>
 #include <linux/pkt_cls.h>
+#include <linux/if_ether.h>
+#include <linux/if_packet.h>
 #include <linux/lwtunnel.h>
+#include <linux/seg6_local.h>
+#include <netinet/in.h>
+#include <sched.h>
+#include <sys/socket.h>
+#include <sys/stat.h>
+#include <sys/wait.h>
 //#include <bpf/bpf.h>
 //#include <bpf/libbpf.h>
 
@@ -5347,384 +5365,407 @@ long perf_event_open(struct perf_event_attr* event_attr, pid_t pid, int cpu,
     return syscall(__NR_perf_event_open, event_attr, pid, cpu, group_fd, flags);
 }
 
-#define NLMSG_TAIL(nmsg) \
-	((struct rtattr *) (((void *) (nmsg)) + NLMSG_ALIGN((nmsg)->nlmsg_len)))
-
-#define RTA_TAIL(rta) \
-		((struct rtattr *) (((void *) (rta)) + \
-				    RTA_ALIGN((rta)->rta_len)))
-
-int addattr_l(struct nlmsghdr *n, int maxlen, int type, const void *data,
-	      int alen)
-{
-	int len = RTA_LENGTH(alen);
-	struct rtattr *rta;
-
-	if ((int)(NLMSG_ALIGN(n->nlmsg_len) + RTA_ALIGN(len)) > maxlen) {
-		fprintf(stderr,
-			"addattr_l ERROR: message exceeded bound of %d\n",
-			maxlen);
-		return -1;
-	}
-	rta = NLMSG_TAIL(n);
-	rta->rta_type = type;
-	rta->rta_len = len;
-	if (alen)
-		memcpy(RTA_DATA(rta), data, alen);
-	n->nlmsg_len = NLMSG_ALIGN(n->nlmsg_len) + RTA_ALIGN(len);
-	return 0;
-}
-
-int addraw_l(struct nlmsghdr *n, int maxlen, const void *data, int len)
-{
-	if ((int)(NLMSG_ALIGN(n->nlmsg_len) + NLMSG_ALIGN(len)) > maxlen) {
-		fprintf(stderr,
-			"addraw_l ERROR: message exceeded bound of %d\n",
-			maxlen);
-		return -1;
-	}
+// The network of a test lives in a namespace of its own, so that the packets of the triggers
+// only traverse the programs of the test:
+//
+//   brf0 <-veth-> brf1 -+- brfbr0 -+- brf2 <-veth-> brf3
+//
+// XDP and TC programs are attached to the bridge port brf1. They see the frames sent out of brf0
+// on ingress, and the frames sent out of brf3 and forwarded by the bridge on egress. LWT programs
+// are attached to the route to 10.78.0.0/24 through brf3, and seg6local End.BPF programs to the
+// route to fc00:78::2. Frames sent out of brf0 to these destinations are routed when they reach
+// brf3, and datagrams sent from a socket to them go through the output paths.
+#define BRF_NET_ATTACH_DEV "brf1"
+#define BRF_NET_ROUTE_DEV "brf3"
 
-	memcpy(NLMSG_TAIL(n), data, len);
-	memset((void *) NLMSG_TAIL(n) + len, 0, NLMSG_ALIGN(len) - len);
-	n->nlmsg_len = NLMSG_ALIGN(n->nlmsg_len) + NLMSG_ALIGN(len);
-	return 0;
-}
+static const uint8_t brf_net_mac0[ETH_ALEN] = {0xaa, 0xaa, 0xaa, 0xaa, 0x77, 0x00};
+static const uint8_t brf_net_mac3[ETH_ALEN] = {0xaa, 0xaa, 0xaa, 0xaa, 0x77, 0x03};
 
-int addattr32(struct nlmsghdr *n, int maxlen, int type, __u32 data)
-{
-	return addattr_l(n, maxlen, type, &data, sizeof(__u32));
-}
+static int brf_netns = -1;
 
-int addattrstrz(struct nlmsghdr *n, int maxlen, int type, const char *str)
+static void brf_write_sysctl(const char* file, const char* val)
 {
-	return addattr_l(n, maxlen, type, str, strlen(str)+1);
+	int fd = open(file, O_WRONLY);
+	if (fd < 0 || write(fd, val, strlen(val)) < 0)
+		fprintf(stderr, "brf_write_sysctl: failed to write %s, errno %d\n", file, errno);
+	if (fd >= 0)
+		close(fd);
 }
 
-int rta_addattr32(struct rtattr *rta, int maxlen, int type, __u32 data)
+// Starts a request adding or replacing the route to dst/prefixlen through BRF_NET_ROUTE_DEV, via
+// gateway gw if not NULL. The caller may add the encapsulation of the route before sending it.
+static void brf_route_init(struct nlmsg* nlmsg, int family, const char* dst, int prefixlen, const char* gw)
 {
-	int len = RTA_LENGTH(4);
-	struct rtattr *subrta;
-
-	if ((int)(RTA_ALIGN(rta->rta_len) + len) > maxlen) {
-		fprintf(stderr,
-			"rta_addattr32: Error! max allowed bound %d exceeded\n",
-			maxlen);
-		return -1;
+	struct rtmsg hdr;
+	memset(&hdr, 0, sizeof(hdr));
+	hdr.rtm_family = family;
+	hdr.rtm_dst_len = prefixlen;
+	hdr.rtm_table = RT_TABLE_MAIN;
+	hdr.rtm_protocol = RTPROT_BOOT;
+	hdr.rtm_scope = gw ? RT_SCOPE_UNIVERSE : RT_SCOPE_LINK;
+	hdr.rtm_type = RTN_UNICAST;
+	netlink_init(nlmsg, RTM_NEWROUTE, NLM_F_CREATE | NLM_F_REPLACE, &hdr, sizeof(hdr));
+	int size = family == AF_INET ? 4 : 16;
+	char addr[16];
+	inet_pton(family, dst, addr);
+	netlink_attr(nlmsg, RTA_DST, addr, size);
+	if (gw) {
+		inet_pton(family, gw, addr);
+		netlink_attr(nlmsg, RTA_GATEWAY, addr, size);
+	}
+	int oif = if_nametoindex(BRF_NET_ROUTE_DEV);
+	netlink_attr(nlmsg, RTA_OIF, &oif, sizeof(oif));
+}
+
+// Points the route to 10.78.0.0/24 to the LWT program prog_fd at the hook attr (LWT_BPF_IN,
+// LWT_BPF_OUT or LWT_BPF_XMIT), or to no program if prog_fd is -1.
+static int brf_route_lwt(struct nlmsg* nlmsg, int sock, int prog_fd, int attr)
+{
+	brf_route_init(nlmsg, AF_INET, "10.78.0.0", 24, "10.77.0.3");
+	if (prog_fd >= 0) {
+		uint16_t type = LWTUNNEL_ENCAP_BPF;
+		netlink_attr(nlmsg, RTA_ENCAP_TYPE, &type, sizeof(type));
+		netlink_nest(nlmsg, RTA_ENCAP);
+		netlink_nest(nlmsg, attr);
+		netlink_attr(nlmsg, LWT_BPF_PROG_FD, &prog_fd, sizeof(prog_fd));
+		netlink_attr(nlmsg, LWT_BPF_PROG_NAME, "func", strlen("func") + 1);
+		netlink_done(nlmsg);
+		netlink_done(nlmsg);
 	}
-	subrta = (struct rtattr *)(((char *)rta) + RTA_ALIGN(rta->rta_len));
-	subrta->rta_type = type;
-	subrta->rta_len = len;
-	memcpy(RTA_DATA(subrta), &data, 4);
-	rta->rta_len = NLMSG_ALIGN(rta->rta_len) + len;
-	return 0;
+	return netlink_send(nlmsg, sock);
 }
 
-int rta_addattr_l(struct rtattr *rta, int maxlen, int type,
-		  const void *data, int alen)
+// Points the route to dst to a seg6local End action, or to an End.BPF action running prog_fd if
+// prog_fd is not -1.
+static int brf_route_seg6local(struct nlmsg* nlmsg, int sock, const char* dst, int prog_fd)
 {
-	struct rtattr *subrta;
-	int len = RTA_LENGTH(alen);
-
-	if ((int)(RTA_ALIGN(rta->rta_len) + RTA_ALIGN(len)) > maxlen) {
-		fprintf(stderr,
-			"rta_addattr_l: Error! max allowed bound %d exceeded\n",
-			maxlen);
-		return -1;
+	brf_route_init(nlmsg, AF_INET6, dst, 128, NULL);
+	uint16_t type = LWTUNNEL_ENCAP_SEG6_LOCAL;
+	netlink_attr(nlmsg, RTA_ENCAP_TYPE, &type, sizeof(type));
+	netlink_nest(nlmsg, RTA_ENCAP);
+	uint32_t action = prog_fd >= 0 ? SEG6_LOCAL_ACTION_END_BPF : SEG6_LOCAL_ACTION_END;
+	netlink_attr(nlmsg, SEG6_LOCAL_ACTION, &action, sizeof(action));
+	if (prog_fd >= 0) {
+		netlink_nest(nlmsg, SEG6_LOCAL_BPF);
+		netlink_attr(nlmsg, SEG6_LOCAL_BPF_PROG, &prog_fd, sizeof(prog_fd));
+		netlink_attr(nlmsg, SEG6_LOCAL_BPF_PROG_NAME, "func", strlen("func") + 1);
+		netlink_done(nlmsg);
 	}
-	subrta = (struct rtattr *)(((char *)rta) + RTA_ALIGN(rta->rta_len));
-	subrta->rta_type = type;
-	subrta->rta_len = len;
-	if (alen)
-		memcpy(RTA_DATA(subrta), data, alen);
-	rta->rta_len = NLMSG_ALIGN(rta->rta_len) + RTA_ALIGN(len);
-	return 0;
-}
-
-int rta_addattr16(struct rtattr *rta, int maxlen, int type, __u16 data)
-{
-	return rta_addattr_l(rta, maxlen, type, &data, sizeof(__u16));
-}
-
-struct rtattr *rta_nest(struct rtattr *rta, int maxlen, int type)
-{
-	struct rtattr *nest = RTA_TAIL(rta);
-
-	rta_addattr_l(rta, maxlen, type, NULL, 0);
-	nest->rta_type |= NLA_F_NESTED;
-
-	return nest;
+	netlink_done(nlmsg);
+	return netlink_send(nlmsg, sock);
 }
 
-int rta_nest_end(struct rtattr *rta, struct rtattr *nest)
+// Adds the clsact qdisc to the device, which TC programs are attached to.
+static int brf_add_clsact(struct nlmsg* nlmsg, int sock, const char* dev)
 {
-	nest->rta_len = (uintptr_t)RTA_TAIL(rta) - (uintptr_t)nest;
-
-	return rta->rta_len;
+	struct tcmsg hdr;
+	memset(&hdr, 0, sizeof(hdr));
+	hdr.tcm_family = AF_UNSPEC;
+	hdr.tcm_ifindex = if_nametoindex(dev);
+	hdr.tcm_handle = TC_H_MAKE(TC_H_CLSACT, 0);
+	hdr.tcm_parent = TC_H_CLSACT;
+	netlink_init(nlmsg, RTM_NEWQDISC, NLM_F_CREATE | NLM_F_EXCL, &hdr, sizeof(hdr));
+	netlink_attr(nlmsg, TCA_KIND, "clsact", strlen("clsact") + 1);
+	return netlink_send(nlmsg, sock);
 }
 
-static int lwt_parse_bpf(struct rtattr *rta, size_t len, int prog_fd,
-			 int attr, const enum bpf_prog_type bpf_type)
+// Builds the network of the test, see above. It is called once per test process from
+// brf_net_enter, when a program is first attached to or triggered through the network, as
+// most tests do not use it. The namespace of the network of the previous test of the proc
+// went away with its process.
+static void brf_setup_net(void)
 {
-	struct rtattr *nest;
-	const char *annotation = "func";
-
-	nest = rta_nest(rta, len, attr);
-	rta_addattr32(rta, len, LWT_BPF_PROG_FD, prog_fd);
-	rta_addattr_l(rta, len, LWT_BPF_PROG_NAME, annotation,
-		      strlen(annotation) + 1);
-	rta_nest_end(rta, nest);
-	return 0;
-}
-
-struct rtnl_handle {
-        int                     fd;
-        struct sockaddr_nl      local;
-        struct sockaddr_nl      peer;
-        __u32                   seq;
-        __u32                   dump;
-        int                     proto;
-        FILE                   *dump_fp;
-#define RTNL_HANDLE_F_LISTEN_ALL_NSID           0x01
-#define RTNL_HANDLE_F_SUPPRESS_NLERR            0x02
-#define RTNL_HANDLE_F_STRICT_CHK                0x04
-        int                     flags;
-};
-
-struct rtnl_handle rth = { .fd = -1 };
+	struct nlmsg nlmsg;
+	int orig = open("/proc/thread-self/ns/net", O_RDONLY);
+	if (orig < 0 || unshare(CLONE_NEWNET)) {
+		fprintf(stderr, "brf_setup_net: failed to create netns, errno %d\n", errno);
+		if (orig >= 0)
+			close(orig);
+		return;
+	}
+	brf_netns = open("/proc/thread-self/ns/net", O_RDONLY);
 
-static int __rtnl_talk_iov(struct rtnl_handle *rtnl, struct iovec *iov,
-			   size_t iovlen, struct nlmsghdr **answer,
-			   bool show_rtnl_err)
-{
-	struct sockaddr_nl nladdr = { .nl_family = AF_NETLINK };
-	struct msghdr msg = {
-		.msg_name = &nladdr,
-		.msg_namelen = sizeof(nladdr),
-		.msg_iov = iov,
-		.msg_iovlen = iovlen,
-	};
-	unsigned int seq = 0;
-	struct nlmsghdr *h;
-	size_t i;
-	int status;
+	// Devices inherit the defaults, so set them before creating the devices.
+	brf_write_sysctl("/proc/sys/net/ipv4/ip_forward", "1");
+	brf_write_sysctl("/proc/sys/net/ipv4/conf/all/accept_local", "1");
+	brf_write_sysctl("/proc/sys/net/ipv4/conf/default/accept_local", "1");
+	brf_write_sysctl("/proc/sys/net/ipv6/conf/all/forwarding", "1");
+	brf_write_sysctl("/proc/sys/net/ipv6/conf/all/seg6_enabled", "1");
+	brf_write_sysctl("/proc/sys/net/ipv6/conf/default/seg6_enabled", "1");
+	brf_write_sysctl("/proc/sys/net/ipv6/conf/default/accept_dad", "0");
 
-	for (i = 0; i < iovlen; i++) {
-		h = (struct nlmsghdr*)iov[i].iov_base;
-		h->nlmsg_seq = seq = ++rtnl->seq;
-		if (answer == NULL)
-			h->nlmsg_flags |= NLM_F_ACK;
+	int sock = socket(AF_NETLINK, SOCK_RAW, NETLINK_ROUTE);
+	if (sock < 0) {
+		fprintf(stderr, "brf_setup_net: failed to open rtnetlink, errno %d\n", errno);
+		goto out;
+	}
+	netlink_add_veth(&nlmsg, sock, "brf0", "brf1");
+	netlink_add_veth(&nlmsg, sock, "brf3", "brf2");
+	netlink_add_device(&nlmsg, sock, "bridge", "brfbr0");
+	netlink_device_change(&nlmsg, sock, "lo", true, NULL, NULL, 0, NULL);
+	netlink_device_change(&nlmsg, sock, "brfbr0", true, NULL, NULL, 0, NULL);
+	netlink_device_change(&nlmsg, sock, "brf0", true, NULL, brf_net_mac0, ETH_ALEN, NULL);
+	netlink_device_change(&nlmsg, sock, "brf1", true, "brfbr0", NULL, 0, NULL);
+	netlink_device_change(&nlmsg, sock, "brf2", true, "brfbr0", NULL, 0, NULL);
+	netlink_device_change(&nlmsg, sock, "brf3", true, NULL, brf_net_mac3, ETH_ALEN, NULL);
+	netlink_add_addr4(&nlmsg, sock, "brf0", "10.77.0.1");
+	netlink_add_addr6(&nlmsg, sock, "brf0", "fc00:77::1");
+	netlink_add_addr4(&nlmsg, sock, "brf3", "10.77.0.2");
+	netlink_add_addr6(&nlmsg, sock, "brf3", "fc00:77::2");
+
+	// Resolved neighbours let fib lookups from the programs succeed. 10.77.0.3 is the gateway of
+	// the route to 10.78.0.0/24 and leads back to brf0.
+	struct in_addr in_addr;
+	struct in6_addr in6_addr;
+	inet_pton(AF_INET, "10.77.0.2", &in_addr);
+	netlink_add_neigh(&nlmsg, sock, "brf0", &in_addr, sizeof(in_addr), brf_net_mac3, ETH_ALEN);
+	inet_pton(AF_INET6, "fc00:77::2", &in6_addr);
+	netlink_add_neigh(&nlmsg, sock, "brf0", &in6_addr, sizeof(in6_addr), brf_net_mac3, ETH_ALEN);
+	inet_pton(AF_INET, "10.77.0.3", &in_addr);
+	netlink_add_neigh(&nlmsg, sock, "brf3", &in_addr, sizeof(in_addr), brf_net_mac0, ETH_ALEN);
+	inet_pton(AF_INET6, "fc00:77::1", &in6_addr);
+	netlink_add_neigh(&nlmsg, sock, "brf3", &in6_addr, sizeof(in6_addr), brf_net_mac0, ETH_ALEN);
+
+	if (brf_route_lwt(&nlmsg, sock, -1, 0))
+		fprintf(stderr, "brf_setup_net: failed to add lwt route, errno %d\n", errno);
+	if (brf_route_seg6local(&nlmsg, sock, "fc00:78::1", -1))
+		fprintf(stderr, "brf_setup_net: failed to add seg6local route, errno %d\n", errno);
+	if (brf_add_clsact(&nlmsg, sock, BRF_NET_ATTACH_DEV))
+		fprintf(stderr, "brf_setup_net: failed to add clsact qdisc, errno %d\n", errno);
+	close(sock);
+out:
+	if (setns(orig, CLONE_NEWNET))
+		fprintf(stderr, "brf_setup_net: failed to leave netns, errno %d\n", errno);
+	close(orig);
+}
+
+// Moves the calling thread to the network namespace of the test and returns the namespace to
+// move it back to with brf_net_leave, or -1 on failure. The network is built on first use,
+// threads of the test entering it meanwhile wait until it is built.
+static int brf_net_enter(void)
+{
+	static int state; // 0: not built, 1: being built, 2: built
+	int expected = 0;
+	if (__atomic_compare_exchange_n(&state, &expected, 1, false, __ATOMIC_ACQ_REL, __ATOMIC_ACQUIRE)) {
+		brf_setup_net();
+		__atomic_store_n(&state, 2, __ATOMIC_RELEASE);
+	} else {
+		while (__atomic_load_n(&state, __ATOMIC_ACQUIRE) != 2)
+			usleep(100);
 	}
-
-	status = sendmsg(rtnl->fd, &msg, 0);
-	if (status < 0) {
-		perror("Cannot talk to rtnetlink");
+	if (brf_netns < 0)
+		return -1;
+	int orig = open("/proc/thread-self/ns/net", O_RDONLY);
+	if (orig < 0 || setns(brf_netns, CLONE_NEWNET)) {
+		fprintf(stderr, "brf_net_enter: failed to enter netns, errno %d\n", errno);
+		if (orig >= 0)
+			close(orig);
 		return -1;
 	}
-	return 0;
-}
-
-static int __rtnl_talk(struct rtnl_handle *rtnl, struct nlmsghdr *n,
-		       struct nlmsghdr **answer,
-		       bool show_rtnl_err)
-{
-	struct iovec iov = {
-		.iov_base = n,
-		.iov_len = n->nlmsg_len
-	};
-
-	return __rtnl_talk_iov(rtnl, &iov, 1, answer, show_rtnl_err);
+	return orig;
+}
+
+static void brf_net_leave(int orig)
+{
+	if (setns(orig, CLONE_NEWNET))
+		fprintf(stderr, "brf_net_leave: failed to leave netns, errno %d\n", errno);
+	close(orig);
+}
+
+// Sends a UDP datagram from src to dst in an Ethernet frame from smac to dmac out of dev, with a
+// TTL of 2 so that frames routed in circles die quickly. Datagrams to the seg6local routes carry
+// a segment routing header with fc00:77::1 as the final segment.
+static void brf_net_send(const char* dev, const uint8_t* smac, const uint8_t* dmac, int family,
+			 const char* src, const char* dst)
+{
+	uint8_t frame[256] = {};
+	const size_t udp_len = 8 + 16;
+	uint16_t proto = htons(family == AF_INET ? ETH_P_IP : ETH_P_IPV6);
+	memcpy(frame, dmac, ETH_ALEN);
+	memcpy(frame + ETH_ALEN, smac, ETH_ALEN);
+	memcpy(frame + 2 * ETH_ALEN, &proto, sizeof(proto));
+	uint8_t* ip = frame + ETH_HLEN;
+	uint8_t* final_dst;
+	size_t addr_len, off;
+	if (family == AF_INET) {
+		addr_len = 4;
+		off = ETH_HLEN + 20;
+		ip[0] = 0x45;
+		*(uint16_t*)&ip[2] = htons(20 + udp_len);
+		ip[8] = 2;
+		ip[9] = IPPROTO_UDP;
+		inet_pton(AF_INET, src, &ip[12]);
+		inet_pton(AF_INET, dst, &ip[16]);
+		final_dst = &ip[16];
+		struct csum_inet csum;
+		csum_inet_init(&csum);
+		csum_inet_update(&csum, ip, 20);
+		*(uint16_t*)&ip[10] = csum_inet_digest(&csum);
+	} else {
+		addr_len = 16;
+		off = ETH_HLEN + 40;
+		ip[0] = 0x60;
+		ip[6] = IPPROTO_UDP;
+		ip[7] = 2;
+		inet_pton(AF_INET6, src, &ip[8]);
+		inet_pton(AF_INET6, dst, &ip[24]);
+		final_dst = &ip[24];
+		if (strncmp(dst, "fc00:78::", 9) == 0) {
+			uint8_t* srh = frame + off;
+			srh[0] = IPPROTO_UDP;
+			srh[1] = 4; // two segments of 16 bytes in 8-byte units
+			srh[2] = 4; // IPV6_SRCRT_TYPE_4
+			srh[3] = 1; // segments left
+			srh[4] = 1; // last entry
+			inet_pton(AF_INET6, "fc00:77::1", &srh[8]);
+			memcpy(&srh[24], &ip[24], 16);
+			ip[6] = IPPROTO_ROUTING;
+			final_dst = &srh[8];
+			off += 8 + 32;
+		}
+		*(uint16_t*)&ip[4] = htons(off - ETH_HLEN - 40 + udp_len);
+	}
+	uint8_t* udp = frame + off;
+	*(uint16_t*)&udp[0] = htons(20000);
+	*(uint16_t*)&udp[2] = htons(20000);
+	*(uint16_t*)&udp[4] = htons(udp_len);
+	struct csum_inet csum;
+	csum_inet_init(&csum);
+	csum_inet_update(&csum, family == AF_INET ? &ip[12] : &ip[8], addr_len);
+	csum_inet_update(&csum, final_dst, addr_len);
+	uint16_t pseudo[2] = {htons(IPPROTO_UDP), htons(udp_len)};
+	csum_inet_update(&csum, (const uint8*)pseudo, sizeof(pseudo));
+	csum_inet_update(&csum, udp, udp_len);
+	*(uint16_t*)&udp[6] = csum_inet_digest(&csum);
+
+	int sock = socket(AF_PACKET, SOCK_RAW, 0);
+	if (sock < 0)
+		return;
+	struct sockaddr_ll addr = {};
+	addr.sll_family = AF_PACKET;
+	addr.sll_ifindex = if_nametoindex(dev);
+	addr.sll_halen = ETH_ALEN;
+	memcpy(addr.sll_addr, dmac, ETH_ALEN);
+	sendto(sock, frame, off + udp_len, 0, (struct sockaddr*)&addr, sizeof(addr));
+	close(sock);
 }
 
-int rtnl_talk(struct rtnl_handle *rtnl, struct nlmsghdr *n,
-	      struct nlmsghdr **answer)
+// Sends a UDP datagram to dst from a socket, so that it takes the output paths of the routes.
+static void brf_net_send_sock(int family, const char* dst)
 {
-	return __rtnl_talk(rtnl, n, answer, true);
+	struct sockaddr_storage addr = {};
+	socklen_t addrlen;
+	if (family == AF_INET) {
+		struct sockaddr_in* sin = (struct sockaddr_in*)&addr;
+		sin->sin_family = AF_INET;
+		sin->sin_port = htons(20000);
+		inet_pton(AF_INET, dst, &sin->sin_addr);
+		addrlen = sizeof(*sin);
+	} else {
+		struct sockaddr_in6* sin6 = (struct sockaddr_in6*)&addr;
+		sin6->sin6_family = AF_INET6;
+		sin6->sin6_port = htons(20000);
+		inet_pton(AF_INET6, dst, &sin6->sin6_addr);
+		addrlen = sizeof(*sin6);
+	}
+	int sock = socket(family, SOCK_DGRAM, 0);
+	if (sock < 0)
+		return;
+	int ttl = 2;
+	if (family == AF_INET)
+		setsockopt(sock, IPPROTO_IP, IP_TTL, &ttl, sizeof(ttl));
+	else
+		setsockopt(sock, IPPROTO_IPV6, IPV6_UNICAST_HOPS, &ttl, sizeof(ttl));
+	char buf[16] = {};
+	sendto(sock, buf, sizeof(buf), MSG_DONTWAIT, (struct sockaddr*)&addr, addrlen);
+	close(sock);
 }
 
-void rtnl_close(struct rtnl_handle *rth)
+// Sends packets through all the paths of the network of the test that programs are attached to.
+static void brf_net_trigger(void)
 {
-	if (rth->fd >= 0) {
-		close(rth->fd);
-		rth->fd = -1;
-	}
-}
-
-int rcvbuf = 1024 * 1024;
-
-int rtnl_open_byproto(struct rtnl_handle *rth, unsigned int subscriptions,
-		      int protocol)
-{
-	socklen_t addr_len;
-	int sndbuf = 32768;
-	int one = 1;
-
-	memset(rth, 0, sizeof(*rth));
-
-	rth->proto = protocol;
-	rth->fd = socket(AF_NETLINK, SOCK_RAW | SOCK_CLOEXEC, protocol);
-	if (rth->fd < 0) {
-		perror("Cannot open netlink socket");
+	int orig = brf_net_enter();
+	if (orig < 0)
+		return;
+	// Ingress of brf1, then bridged to brf3 and delivered or routed there.
+	brf_net_send("brf0", brf_net_mac0, brf_net_mac3, AF_INET, "10.77.0.1", "10.77.0.2");
+	brf_net_send("brf0", brf_net_mac0, brf_net_mac3, AF_INET6, "fc00:77::1", "fc00:77::2");
+	brf_net_send("brf0", brf_net_mac0, brf_net_mac3, AF_INET, "10.77.0.1", "10.78.0.1");
+	brf_net_send("brf0", brf_net_mac0, brf_net_mac3, AF_INET6, "fc00:77::1", "fc00:78::1");
+	brf_net_send("brf0", brf_net_mac0, brf_net_mac3, AF_INET6, "fc00:77::1", "fc00:78::2");
+	// Egress of brf1.
+	brf_net_send("brf3", brf_net_mac3, brf_net_mac0, AF_INET, "10.77.0.2", "10.77.0.1");
+	// Output paths of the LWT route.
+	brf_net_send_sock(AF_INET, "10.78.0.1");
+	brf_net_leave(orig);
+}
+
+// Attaches the TC program to the clsact qdisc of BRF_NET_ATTACH_DEV on egress or ingress.
+static int brf_attach_tc(int prog_fd, bool egress)
+{
+	int orig = brf_net_enter();
+	if (orig < 0)
 		return -1;
+	int err = -1;
+	struct nlmsg nlmsg;
+	int sock = socket(AF_NETLINK, SOCK_RAW, NETLINK_ROUTE);
+	if (sock >= 0) {
+		struct tcmsg hdr;
+		memset(&hdr, 0, sizeof(hdr));
+		hdr.tcm_family = AF_UNSPEC;
+		hdr.tcm_ifindex = if_nametoindex(BRF_NET_ATTACH_DEV);
+		hdr.tcm_parent = TC_H_MAKE(TC_H_CLSACT, egress ? TC_H_MIN_EGRESS : TC_H_MIN_INGRESS);
+		// Priority 0 makes the kernel pick one, so the programs of a test stack up.
+		hdr.tcm_info = TC_H_MAKE(0, htons(ETH_P_ALL));
+		netlink_init(&nlmsg, RTM_NEWTFILTER, NLM_F_CREATE | NLM_F_EXCL, &hdr, sizeof(hdr));
+		netlink_attr(&nlmsg, TCA_KIND, "bpf", strlen("bpf") + 1);
+		netlink_nest(&nlmsg, TCA_OPTIONS);
+		netlink_attr(&nlmsg, TCA_BPF_FD, &prog_fd, sizeof(prog_fd));
+		netlink_attr(&nlmsg, TCA_BPF_NAME, "func", strlen("func") + 1);
+		uint32_t flags = TCA_BPF_FLAG_ACT_DIRECT;
+		netlink_attr(&nlmsg, TCA_BPF_FLAGS, &flags, sizeof(flags));
+		netlink_done(&nlmsg);
+		err = netlink_send(&nlmsg, sock);
+		close(sock);
 	}
-
-	if (setsockopt(rth->fd, SOL_SOCKET, SO_SNDBUF,
-		       &sndbuf, sizeof(sndbuf)) < 0) {
-		perror("SO_SNDBUF");
-		goto err;
-	}
-
-	if (setsockopt(rth->fd, SOL_SOCKET, SO_RCVBUF,
-		       &rcvbuf, sizeof(rcvbuf)) < 0) {
-		perror("SO_RCVBUF");
-		goto err;
-	}
-
-	/* Older kernels may no support extended ACK reporting */
-	setsockopt(rth->fd, SOL_NETLINK, NETLINK_EXT_ACK,
-		   &one, sizeof(one));
-
-	memset(&rth->local, 0, sizeof(rth->local));
-	rth->local.nl_family = AF_NETLINK;
-	rth->local.nl_groups = subscriptions;
-
-	if (bind(rth->fd, (struct sockaddr *)&rth->local,
-		 sizeof(rth->local)) < 0) {
-		perror("Cannot bind netlink socket");
-		goto err;
-	}
-	addr_len = sizeof(rth->local);
-	if (getsockname(rth->fd, (struct sockaddr *)&rth->local,
-			&addr_len) < 0) {
-		perror("Cannot getsockname");
-		goto err;
-	}
-	if (addr_len != sizeof(rth->local)) {
-		fprintf(stderr, "Wrong address length %d\n", addr_len);
-		goto err;
-	}
-	if (rth->local.nl_family != AF_NETLINK) {
-		fprintf(stderr, "Wrong address family %d\n",
-			rth->local.nl_family);
-		goto err;
-	}
-	rth->seq = time(NULL);
-	return 0;
-err:
-	rtnl_close(rth);
-	return -1;
-}
-
-int rtnl_open(struct rtnl_handle *rth, unsigned int subscriptions)
-{
-	return rtnl_open_byproto(rth, subscriptions, NETLINK_ROUTE);
+	brf_net_leave(orig);
+	return err;
 }
 
-//#define MAX_MSG 16384
-#define MAX_MSG 8192
-
-static int bpf_program__attach_tc(int prog_fd, const char* file)
+// Attaches the LWT program from section sec to the route of its kind.
+static int brf_attach_lwt(int prog_fd, const char* sec)
 {
-	if (rtnl_open(&rth, 0) < 0) {
-		fprintf(stderr, "Cannot open rtnetlink\n");
+	int orig = brf_net_enter();
+	if (orig < 0)
 		return -1;
+	int err = -1;
+	struct nlmsg nlmsg;
+	int sock = socket(AF_NETLINK, SOCK_RAW, NETLINK_ROUTE);
+	if (sock >= 0) {
+		if (strcmp(sec, "lwt_seg6local") == 0)
+			err = brf_route_seg6local(&nlmsg, sock, "fc00:78::2", prog_fd);
+		else if (strcmp(sec, "lwt_in") == 0)
+			err = brf_route_lwt(&nlmsg, sock, prog_fd, LWT_BPF_IN);
+		else if (strcmp(sec, "lwt_out") == 0)
+			err = brf_route_lwt(&nlmsg, sock, prog_fd, LWT_BPF_OUT);
+		else
+			err = brf_route_lwt(&nlmsg, sock, prog_fd, LWT_BPF_XMIT);
+		close(sock);
 	}
-
-	struct {
-		struct nlmsghdr	n;
-		struct tcmsg		t;
-		char			buf[MAX_MSG];
-	} req;
-
-	__u32 prio = 0;
-	__u32 protocol = htons(ETH_P_ALL);
-
-	req.n.nlmsg_len = NLMSG_LENGTH(sizeof(struct tcmsg)),
-	req.n.nlmsg_flags = NLM_F_REQUEST | NLM_F_EXCL | NLM_F_CREATE,
-	req.n.nlmsg_type = RTM_NEWTFILTER,
-	req.t.tcm_family = AF_UNSPEC,
-	req.t.tcm_info = TC_H_MAKE(prio<<16, protocol);
-	req.t.tcm_parent = TC_H_MAKE(TC_H_CLSACT, TC_H_MIN_INGRESS);
-
-	int idx = 0;
-	req.t.tcm_ifindex = idx;
-
-	const char *annotation = "func";
-	struct rtattr *tail = (struct rtattr *)(((void *)&req.n) + NLMSG_ALIGN(req.n.nlmsg_len));
-	addattr_l(&req.n, MAX_MSG, TCA_OPTIONS, NULL, 0);
-	addattr32(&req.n, MAX_MSG, TCA_BPF_FD, prog_fd);
-	addattrstrz(&req.n, MAX_MSG, TCA_BPF_NAME, annotation);
-	addattr32(&req.n, MAX_MSG, TCA_BPF_FLAGS, TCA_BPF_FLAG_ACT_DIRECT);
-	tail->rta_len = (((uintptr_t)&req.n) + req.n.nlmsg_len) - (uintptr_t)tail;
-	
-	if (rtnl_talk(&rth, &req.n, NULL) < 0) {
-		fprintf(stderr, "We have an error talking to the kernel\n");
-		return -2;
-	}
-
-	rtnl_close(&rth);
-	return 0;
+	brf_net_leave(orig);
+	return err;
 }
 
-static int bpf_program__attach_lwt(int prog_fd, const char* file)
+// Attaches the XDP program to BRF_NET_ATTACH_DEV in native or generic mode and returns the link.
+static int brf_attach_xdp(int prog_fd, bool native)
 {
-	if (rtnl_open(&rth, 0) < 0) {
-		fprintf(stderr, "Cannot open rtnetlink\n");
+	int orig = brf_net_enter();
+	if (orig < 0)
 		return -1;
-	}
-
-	struct {
-		struct nlmsghdr	n;
-		struct rtmsg		r;
-		char			buf[4096];
-	} req;
-	
-	req.n.nlmsg_len = NLMSG_LENGTH(sizeof(struct rtmsg)),
-	req.n.nlmsg_flags = NLM_F_REQUEST | NLM_F_CREATE | NLM_F_EXCL,
-	req.n.nlmsg_type = RTM_NEWROUTE,
-	req.r.rtm_family = AF_UNSPEC,
-	req.r.rtm_table = RT_TABLE_MAIN,
-	req.r.rtm_protocol = RTPROT_BOOT;
-	req.r.rtm_scope = RT_SCOPE_UNIVERSE;
-	req.r.rtm_type = RTN_UNICAST;
-
-	char buf[1024];
-	struct rtattr *rta = (struct rtattr *)buf;
-
-	rta->rta_type = RTA_ENCAP;
-	rta->rta_len = RTA_LENGTH(0);
-
-	size_t len = sizeof(buf);
-	struct rtattr *nest = rta_nest(rta, len, RTA_ENCAP);
-
-	if (strstr(file, "lwt_in")) {
-		lwt_parse_bpf(rta, len, prog_fd, LWT_BPF_IN,
-				  BPF_PROG_TYPE_LWT_IN);
-	} else if (strstr(file, "lwt_out")) {
-		lwt_parse_bpf(rta, len, prog_fd, LWT_BPF_OUT,
-				  BPF_PROG_TYPE_LWT_OUT);
-	} else if (strstr(file, "lwt_xmit")) {
-		lwt_parse_bpf(rta, len, prog_fd, LWT_BPF_XMIT,
-				  BPF_PROG_TYPE_LWT_XMIT);
-	}
-
-	rta_nest_end(rta, nest);
-	rta_addattr16(rta, len, RTA_ENCAP_TYPE, LWTUNNEL_ENCAP_BPF);
-
-	if (rta->rta_len > RTA_LENGTH(0))
-		addraw_l(&req.n, 1024
-			 , RTA_DATA(rta), RTA_PAYLOAD(rta));
-
-	int idx = 1;
-	addattr32(&req.n, sizeof(req), RTA_OIF, idx);
-
-	if (rtnl_talk(&rth, &req.n, NULL) < 0) {
-		fprintf(stderr, "Cannot open rtnetlink\n");
-		return -2;
-	}
-
-	rtnl_close(&rth);
-
-	return 0;
+	LIBBPF_OPTS(bpf_link_create_opts, opts, .flags = native ? XDP_FLAGS_DRV_MODE : XDP_FLAGS_SKB_MODE);
+	int link_fd = bpf_link_create(prog_fd, if_nametoindex(BRF_NET_ATTACH_DEV), BPF_XDP, &opts);
+	brf_net_leave(orig);
+	return link_fd;
 }
 #endif
 
@@ -5846,10 +5887,41 @@ static struct bpf_object *find_bpf_object_by_path(const char* path)
 	return NULL;
 }
 
-static long syz_bpf_prog_open(volatile long a0)
+#include <sys/mount.h>
+#include <sys/stat.h>
+
+// Pinned maps and objects live in a bpffs mounted in the working dir of the test,
+// so that they are shared by the BPF objects of a program and torn down with the dir.
+#define BRF_BPFFS_DIR "./bpf"
+
+static void brf_mount_bpffs(void)
+{
+	struct stat st;
+	if (stat(BRF_BPFFS_DIR, &st) == 0)
+		return;
+	if (mkdir(BRF_BPFFS_DIR, 0777)) {
+		fprintf(stderr, "brf_mount_bpffs: failed to mkdir %s, errno %d\n", BRF_BPFFS_DIR, errno);
+		return;
+	}
+	if (mount("bpf", BRF_BPFFS_DIR, "bpf", 0, NULL))
+		fprintf(stderr, "brf_mount_bpffs: failed to mount bpffs, errno %d\n", errno);
+}
+
+static long syz_bpf_prog_open(volatile long a0, volatile long a1, volatile long a2)
 {
 	const char* file = (char*)a0;
-	struct bpf_object* bo = bpf_object__open(file);
+	const void* obj = (const void*)a1;
+	size_t obj_size = (size_t)a2;
+	brf_mount_bpffs();
+	LIBBPF_OPTS(bpf_object_open_opts, opts, .pin_root_path = BRF_BPFFS_DIR);
+	struct bpf_object* bo;
+	if (obj_size) {
+		// The object name becomes bo->path, so the following calls find the object by path.
+		opts.object_name = file;
+		bo = bpf_object__open_mem(obj, obj_size, &opts);
+	} else {
+		bo = bpf_object__open_file(file, &opts);
+	}
 	if (IS_ERR(bo) || !bo) {
 		fprintf(stderr, "syz_bpf_prog_load: failed to open bpf prog, errno %ld\n", PTR_ERR(bo));
 		return -1;
@@ -5862,7 +5934,7 @@ static long syz_bpf_prog_open(volatile long a0)
 	return 0;
 }
 
-static long _syz_bpf_prog_attach(const char *file, struct bpf_object *bo, int prog_fd);
+static long _syz_bpf_prog_attach(const char *file, struct bpf_object *bo, int prog_fd, int mode);
 
 static long syz_bpf_prog_load(volatile long a0, volatile long a1)
 {
@@ -5923,7 +5995,166 @@ static long syz_bpf_prog_load(volatile long a0, volatile long a1)
 	return res->prog_fds[0];
 }
 
-static long _syz_bpf_prog_attach(const char *file, struct bpf_object *bo, int prog_fd)
+// Keep in sync with brfCgroupLevels in prog/rand.go.
+#define BRF_CGROUP_LEVELS 3
+
+// Writes the path of the cgroup at level of the cgroup hierarchy of the test to path. Level 0
+// is the top of the hierarchy and BRF_CGROUP_LEVELS - 1 the leaf that triggers run in.
+static void brf_cgroup_path(char* path, size_t size, int level)
+{
+	static const char* const levels[BRF_CGROUP_LEVELS] = {"", "/mid", "/mid/leaf"};
+	snprintf(path, size, "/sys/fs/cgroup/brf%llu%s", procid, levels[level]);
+}
+
+// Builds the cgroup hierarchy of the test. It is called once per test process from
+// brf_setup_test. The hierarchy the previous test of the proc left behind is removed first,
+// which detaches the programs attached to it. Levels that cannot be removed, e.g. because
+// a process of the previous test still lives in them, are reused.
+static void brf_setup_cgroups(void)
+{
+	char path[64];
+	for (int i = BRF_CGROUP_LEVELS - 1; i >= 0; i--) {
+		brf_cgroup_path(path, sizeof(path), i);
+		rmdir(path);
+	}
+	for (int i = 0; i < BRF_CGROUP_LEVELS; i++) {
+		brf_cgroup_path(path, sizeof(path), i);
+		if (mkdir(path, 0777) && errno != EEXIST) {
+			fprintf(stderr, "brf_setup_cgroups: failed to mkdir %s, errno %d\n", path, errno);
+			return;
+		}
+	}
+}
+
+// Builds the cgroup hierarchy of the test, see setup_test. The network of the test is built
+// when it is first used, see brf_net_enter.
+static void brf_setup_test(void)
+{
+	brf_setup_cgroups();
+}
+
+// Does what runs a cgroup program loaded from section sec, i.e., the operation the expected
+// attach type the section implies hooks, e.g., an IPv6 connect for cgroup/connect6 and a UDP
+// sendmsg for cgroup/sendmsg4.
+static void bpf_cgroup_workload(const char* sec)
+{
+	char buf[64] = {};
+	if (strcmp(sec, "cgroup/sysctl") == 0) {
+		int fd = open("/proc/sys/kernel/ostype", O_RDONLY);
+		if (fd >= 0) {
+			ssize_t n = read(fd, buf, sizeof(buf));
+			(void)n;
+			close(fd);
+		}
+		return;
+	}
+	if (strcmp(sec, "cgroup/dev") == 0) {
+		int fd = open("/dev/null", O_RDONLY);
+		if (fd >= 0)
+			close(fd);
+		return;
+	}
+
+	int v6 = sec[strlen(sec) - 1] == '6';
+	struct sockaddr_storage addr = {};
+	socklen_t addrlen;
+	if (v6) {
+		struct sockaddr_in6* sin6 = (struct sockaddr_in6*)&addr;
+		sin6->sin6_family = AF_INET6;
+		sin6->sin6_addr = in6addr_loopback;
+		sin6->sin6_port = htons(20000);
+		addrlen = sizeof(*sin6);
+	} else {
+		struct sockaddr_in* sin = (struct sockaddr_in*)&addr;
+		sin->sin_family = AF_INET;
+		sin->sin_addr.s_addr = htonl(INADDR_LOOPBACK);
+		sin->sin_port = htons(20000);
+		addrlen = sizeof(*sin);
+	}
+
+	if (strcmp(sec, "sockops") == 0) {
+		// Sock ops run on the events of TCP connections, establish one over loopback.
+		int lfd = socket(AF_INET, SOCK_STREAM, 0);
+		int fd = socket(AF_INET, SOCK_STREAM, 0);
+		((struct sockaddr_in*)&addr)->sin_port = 0;
+		if (lfd >= 0 && fd >= 0 && bind(lfd, (struct sockaddr*)&addr, addrlen) == 0 &&
+		    listen(lfd, 1) == 0 && getsockname(lfd, (struct sockaddr*)&addr, &addrlen) == 0 &&
+		    connect(fd, (struct sockaddr*)&addr, addrlen) == 0) {
+			int afd = accept(lfd, NULL, NULL);
+			if (afd >= 0) {
+				ssize_t n = write(fd, buf, 1);
+				(void)n;
+				close(afd);
+			}
+		}
+		if (fd >= 0)
+			close(fd);
+		if (lfd >= 0)
+			close(lfd);
+		return;
+	}
+
+	// Creating and closing the socket runs cgroup/sock_create and cgroup/sock_release.
+	int fd = socket(v6 ? AF_INET6 : AF_INET, SOCK_DGRAM, 0);
+	if (fd < 0) {
+		fprintf(stderr, "bpf_cgroup_trigger: failed to create socket, errno %d\n", errno);
+		return;
+	}
+	if (strstr(sec, "connect") || strstr(sec, "getpeername")) {
+		if (connect(fd, (struct sockaddr*)&addr, addrlen) == 0)
+			getpeername(fd, (struct sockaddr*)&addr, &addrlen);
+	} else if (strstr(sec, "sendmsg")) {
+		sendto(fd, buf, 1, MSG_DONTWAIT, (struct sockaddr*)&addr, addrlen);
+	} else if (strstr(sec, "sockopt")) {
+		int val = 0;
+		socklen_t len = sizeof(val);
+		setsockopt(fd, SOL_SOCKET, SO_PRIORITY, &val, len);
+		getsockopt(fd, SOL_SOCKET, SO_PRIORITY, &val, &len);
+	} else if (strstr(sec, "bind") || strstr(sec, "getsockname") || strstr(sec, "recvmsg") || strstr(sec, "skb")) {
+		// Bind to a free port, and send a datagram to the socket itself for the programs
+		// on the egress and ingress paths and on recvmsg.
+		if (v6)
+			((struct sockaddr_in6*)&addr)->sin6_port = 0;
+		else
+			((struct sockaddr_in*)&addr)->sin_port = 0;
+		if (bind(fd, (struct sockaddr*)&addr, addrlen) == 0 &&
+		    getsockname(fd, (struct sockaddr*)&addr, &addrlen) == 0 &&
+		    sendto(fd, buf, 1, MSG_DONTWAIT, (struct sockaddr*)&addr, addrlen) == 1) {
+			struct sockaddr_storage from;
+			socklen_t fromlen = sizeof(from);
+			recvfrom(fd, buf, sizeof(buf), MSG_DONTWAIT, (struct sockaddr*)&from, &fromlen);
+		}
+	}
+	close(fd);
+}
+
+// Runs the workload of the cgroup program loaded from section sec in a child moved to the
+// leaf cgroup of the hierarchy of the test, so that the programs attached at all levels of
+// the hierarchy and above it run for it.
+static void bpf_cgroup_trigger(const char* sec)
+{
+	int pid = fork();
+	if (pid < 0) {
+		fprintf(stderr, "bpf_cgroup_trigger: failed to fork, errno %d\n", errno);
+		return;
+	}
+	if (pid == 0) {
+		char path[64];
+		brf_cgroup_path(path, sizeof(path), BRF_CGROUP_LEVELS - 1);
+		strcat(path, "/cgroup.procs");
+		int fd = open(path, O_WRONLY);
+		if (fd < 0 || write(fd, "0", 1) != 1)
+			fprintf(stderr, "bpf_cgroup_trigger: failed to join %s, errno %d\n", path, errno);
+		if (fd >= 0)
+			close(fd);
+		bpf_cgroup_workload(sec);
+		_exit(0);
+	}
+	while (waitpid(pid, NULL, __WALL) < 0 && errno == EINTR) {
+	}
+}
+
+static long _syz_bpf_prog_attach(const char *file, struct bpf_object *bo, int prog_fd, int mode)
 {
 	int ret = 0;
 	struct bpf_link* link = NULL;
@@ -5977,12 +6208,27 @@ static long _syz_bpf_prog_attach(const char *file, struct bpf_object *bo, int pr
 		int sock_map = bpf_map_create(BPF_MAP_TYPE_SOCKMAP, "test_map", sizeof(int), sizeof(int), 2, &opts);
 		ret = bpf_prog_attach(prog_fd, sock_map, BPF_SK_MSG_VERDICT, 0);
 	} else if (strstr(file, "tc")) {
-		ret = bpf_program__attach_tc(prog_fd, file);
+		ret = brf_attach_tc(prog_fd, mode);
+		if (ret < 0)
+			goto err;
+		brf_net_trigger();
 	} else if (strstr(file, "lwt")) {
-		ret = bpf_program__attach_lwt(prog_fd, file);
+		ret = brf_attach_lwt(prog_fd, bpf_program__section_name(prog));
+		if (ret < 0)
+			goto err;
+		brf_net_trigger();
 	} else if (strstr(file, "cg_") || strstr(file, "sock_ops")) {
-		int cgroup_fd = open("/sys/fs/cgroup", O_RDONLY);
+		// Generated tests attach cgroup programs with syz_bpf_prog_attach_cgroup, older ones
+		// still get the top of the cgroup hierarchy of the test rather than the root cgroup.
+		char path[64];
+		brf_cgroup_path(path, sizeof(path), 0);
+		int cgroup_fd = open(path, O_RDONLY | O_DIRECTORY);
+		if (cgroup_fd < 0)
+			goto err;
 		link = bpf_program__attach_cgroup(prog, cgroup_fd);
+		close(cgroup_fd);
+		if (link && !IS_ERR(link))
+			bpf_cgroup_trigger(bpf_program__section_name(prog));
 	} else if (strstr(file, "perf_event")) {
 		struct perf_event_attr attr_type_hw = {
 			.type = PERF_TYPE_HARDWARE,
@@ -5994,7 +6240,26 @@ static long _syz_bpf_prog_attach(const char *file, struct bpf_object *bo, int pr
 		int pfd = perf_event_open(&attr_type_hw, 0, -1, -1, 0);
 		link = bpf_program__attach_perf_event(prog, pfd);
 	} else if (strstr(file, "xdp")) {
-		link = bpf_program__attach_xdp(prog, 1);
+		// The link is returned as is, bpf_program__attach_xdp cannot pick the mode.
+		int link_fd = brf_attach_xdp(prog_fd, mode);
+		if (link_fd < 0)
+			goto err;
+		brf_net_trigger();
+		fprintf(stderr, "syz_bpf_prog_attach succeeds\n");
+		return link_fd;
+	} else if (strncmp(bpf_program__section_name(prog), "iter", 4) == 0) {
+		// Map iterators cannot be attached without a map to walk, try the maps of the object.
+		link = bpf_program__attach_iter(prog, NULL);
+		struct bpf_map* map;
+		bpf_object__for_each_map(map, bo)
+		{
+			if (link && !IS_ERR(link))
+				break;
+			union bpf_iter_link_info linfo = {};
+			linfo.map.map_fd = bpf_map__fd(map);
+			LIBBPF_OPTS(bpf_iter_attach_opts, opts, .link_info = &linfo, .link_info_len = sizeof(linfo));
+			link = bpf_program__attach_iter(prog, &opts);
+		}
 	} else {
 		link = bpf_program__attach(prog);
 	}
@@ -6020,10 +6285,11 @@ err:
 	}
 }
 
-static long syz_bpf_prog_attach(volatile long a0, volatile long a1)
+static long syz_bpf_prog_attach(volatile long a0, volatile long a1, volatile long a2)
 {
 	const char* file = (char*)a0;
 	int prog_fd = (int)a1;
+	int mode = (int)a2;
 
 	struct bpf_object* bo = find_bpf_object_by_path(file);
 	if (bo == NULL) {
@@ -6031,7 +6297,65 @@ static long syz_bpf_prog_attach(volatile long a0, volatile long a1)
 		return -1;
 	}
 
-	return _syz_bpf_prog_attach(file, bo, prog_fd);
+	return _syz_bpf_prog_attach(file, bo, prog_fd, mode);
+}
+
+// Attaches the cgroup program with fd a1 of the object at path a0 to the cgroup at level a2 of the
+// cgroup hierarchy of the test with the attach flags a3, replacing the program with fd a4 if a3
+// has BPF_F_REPLACE, and triggers it from the leaf cgroup. The programs attached at the levels
+// make up the effective program arrays of the cgroups below them.
+static long syz_bpf_prog_attach_cgroup(volatile long a0, volatile long a1, volatile long a2, volatile long a3, volatile long a4)
+{
+	const char* file = (char*)a0;
+	int prog_fd = (int)a1;
+	int level = (int)a2;
+	__u32 flags = (__u32)a3;
+	int replace_fd = (int)a4;
+
+	struct bpf_object* bo = find_bpf_object_by_path(file);
+	if (bo == NULL) {
+		fprintf(stderr, "failed to retrieve bpf_object\n");
+		return -1;
+	}
+	struct bpf_program* prog = bpf_object__next_program(bo, NULL);
+	if (level < 0 || level >= BRF_CGROUP_LEVELS)
+		level = BRF_CGROUP_LEVELS - 1;
+
+	char path[64];
+	brf_cgroup_path(path, sizeof(path), level);
+	int cgroup_fd = open(path, O_RDONLY | O_DIRECTORY);
+	if (cgroup_fd < 0) {
+		fprintf(stderr, "syz_bpf_prog_attach_cgroup: failed to open %s, errno %d\n", path, errno);
+		return -1;
+	}
+	LIBBPF_OPTS(bpf_prog_attach_opts, opts, .flags = flags);
+	if (flags & BPF_F_REPLACE)
+		opts.replace_prog_fd = replace_fd;
+	int ret = bpf_prog_attach_opts(prog_fd, cgroup_fd, bpf_program__expected_attach_type(prog), &opts);
+	close(cgroup_fd);
+	if (ret) {
+		fprintf(stderr, "syz_bpf_prog_attach_cgroup: failed to attach %s(%d) to %s, errno %d\n", file, prog_fd, path, errno);
+		errno = 3;
+		return -1;
+	}
+	bpf_cgroup_trigger(bpf_program__section_name(prog));
+	return 0;
+}
+
+// Triggers the cgroup program of the object at path a0 from the leaf cgroup of the cgroup
+// hierarchy of the test. Cgroup programs cannot be test run, so this is what runs them
+// concurrently with the other calls of the test.
+static long syz_bpf_cgroup_trigger(volatile long a0)
+{
+	const char* file = (char*)a0;
+
+	struct bpf_object* bo = find_bpf_object_by_path(file);
+	if (bo == NULL) {
+		fprintf(stderr, "failed to retrieve bpf_object\n");
+		return -1;
+	}
+	bpf_cgroup_trigger(bpf_program__section_name(bpf_object__next_program(bo, NULL)));
+	return 0;
 }
 
 static long syz_bpf_prog_run_cnt(volatile long a0)
@@ -6056,3 +6380,476 @@ static long syz_bpf_prog_run_cnt(volatile long a0)
 }
 
 #endif
+
+#if SYZ_EXECUTOR || __NR_syz_bpf_prog_test_run_on_cpu
+#include <linux/bpf.h>
+#include <sched.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#ifndef __NR_bpf
+#define __NR_bpf 321
+#endif
+
+// Runs BPF_PROG_TEST_RUN with the calling thread pinned to cpu, so that concurrent
+// async calls trigger the same program on different cpus at the same time.
+static long syz_bpf_prog_test_run_on_cpu(volatile long a0, volatile long a1, volatile long a2)
+{
+	int cpu = (int)a0;
+	cpu_set_t old_mask, mask;
+	bool pinned = false;
+
+	if (sched_getaffinity(0, sizeof(old_mask), &old_mask) == 0) {
+		CPU_ZERO(&mask);
+		CPU_SET(cpu, &mask);
+		pinned = sched_setaffinity(0, sizeof(mask), &mask) == 0;
+		if (!pinned)
+			fprintf(stderr, "syz_bpf_prog_test_run_on_cpu: failed to pin to cpu %d, errno %d\n", cpu, errno);
+	}
+
+	long ret = syscall(__NR_bpf, BPF_PROG_TEST_RUN, a1, a2);
+	int err = errno;
+
+	if (pinned)
+		sched_setaffinity(0, sizeof(old_mask), &old_mask);
+	errno = err;
+	return ret;
+}
+#endif
+
+#if SYZ_EXECUTOR || __NR_syz_bpf_prog_iter_read || __NR_syz_bpf_timer_teardown
+#include <bpf/bpf.h>
+#include <bpf/libbpf.h>
+#include <linux/bpf.h>
+
+// Returns the size of the value buffer of the map with info. Lookups and updates of per-cpu maps
+// take a value per possible cpu, each rounded up to 8 bytes.
+static size_t brf_map_value_size(const struct bpf_map_info* info)
+{
+	switch (info->type) {
+	case BPF_MAP_TYPE_PERCPU_HASH:
+	case BPF_MAP_TYPE_PERCPU_ARRAY:
+	case BPF_MAP_TYPE_LRU_PERCPU_HASH:
+	case BPF_MAP_TYPE_PERCPU_CGROUP_STORAGE: {
+		int ncpus = libbpf_num_possible_cpus();
+		return ((info->value_size + 7) & ~7u) * (ncpus > 0 ? ncpus : 1);
+	}
+	default:
+		return info->value_size;
+	}
+}
+#endif
+
+#if SYZ_EXECUTOR || __NR_syz_bpf_prog_iter_read
+#include <bpf/bpf.h>
+#include <linux/bpf.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+// Creates an iterator of the iterator program a0 and reads it to the end. If a map a1 is given,
+// the iterator walks it after an element is added to it. If a cgroup a2 is given, the iterator
+// walks its hierarchy in the order a3.
+static long syz_bpf_prog_iter_read(volatile long a0, volatile long a1, volatile long a2, volatile long a3)
+{
+	int prog_fd = (int)a0;
+	int map_fd = (int)a1;
+	int cgroup_fd = (int)a2;
+	union bpf_iter_link_info linfo = {};
+	LIBBPF_OPTS(bpf_link_create_opts, opts);
+
+	if (map_fd >= 0) {
+		struct bpf_map_info info = {};
+		__u32 info_len = sizeof(info);
+		if (bpf_obj_get_info_by_fd(map_fd, &info, &info_len) == 0) {
+			// Procs run concurrently, so the element is built in buffers of this call.
+			char* key = (char*)calloc(1, info.key_size + 1);
+			char* value = (char*)calloc(1, brf_map_value_size(&info) + 1);
+			if (key && value)
+				bpf_map_update_elem(map_fd, key, value, BPF_ANY);
+			free(key);
+			free(value);
+		}
+		linfo.map.map_fd = map_fd;
+		opts.iter_info = &linfo;
+		opts.iter_info_len = sizeof(linfo);
+	} else if (cgroup_fd >= 0) {
+		linfo.cgroup.cgroup_fd = cgroup_fd;
+		linfo.cgroup.order = (enum bpf_cgroup_iter_order)a3;
+		opts.iter_info = &linfo;
+		opts.iter_info_len = sizeof(linfo);
+	}
+	int link_fd = bpf_link_create(prog_fd, 0, BPF_TRACE_ITER, &opts);
+	if (link_fd < 0) {
+		fprintf(stderr, "syz_bpf_prog_iter_read: failed to create link, errno %d\n", errno);
+		return -1;
+	}
+	int iter_fd = bpf_iter_create(link_fd);
+	if (iter_fd < 0) {
+		fprintf(stderr, "syz_bpf_prog_iter_read: failed to create iterator, errno %d\n", errno);
+		close(link_fd);
+		return -1;
+	}
+	// The program runs once per object as the iterator is read, bound the reads in case it never ends.
+	char buf[4096];
+	long total = 0;
+	for (int i = 0; i < 1024; i++) {
+		ssize_t n = read(iter_fd, buf, sizeof(buf));
+		if (n <= 0)
+			break;
+		total += n;
+	}
+	close(iter_fd);
+	close(link_fd);
+	return total;
+}
+#endif
+
+#if SYZ_EXECUTOR || __NR_syz_bpf_timer_teardown
+#include <bpf/bpf.h>
+#include <linux/bpf.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+#define BRF_TIMER_DELETE 1
+#define BRF_TIMER_UPDATE 2
+#define BRF_TIMER_CLOSE 4
+#define BRF_TIMER_MAX_KEYS 64
+
+// Waits a2 us and then deletes or replaces the elements of map a0 as mode a1 says. Timers embedded
+// in the elements are freed on the way, while the program that armed them may still be running
+// asynchronously and their callbacks may be pending or running.
+static long syz_bpf_timer_teardown(volatile long a0, volatile long a1, volatile long a2)
+{
+	int map_fd = (int)a0;
+	long mode = a1;
+	struct bpf_map_info info = {};
+	__u32 info_len = sizeof(info);
+
+	if (bpf_obj_get_info_by_fd(map_fd, &info, &info_len)) {
+		fprintf(stderr, "syz_bpf_timer_teardown: bad map %d, errno %d\n", map_fd, errno);
+		return -1;
+	}
+	// Procs run concurrently, so the keys and the value are held in buffers of this call.
+	size_t key_size = info.key_size ? info.key_size : 1;
+	char* keys = (char*)calloc(BRF_TIMER_MAX_KEYS, key_size);
+	char* value = (char*)calloc(1, brf_map_value_size(&info) + 1);
+	if (!keys || !value) {
+		free(keys);
+		free(value);
+		return -1;
+	}
+	usleep(a2);
+	// Collect the keys first, deleting elements while walking the map restarts the walk.
+	int n = 0;
+	void* prev = NULL;
+	while (n < BRF_TIMER_MAX_KEYS && bpf_map_get_next_key(map_fd, prev, keys + n * key_size) == 0) {
+		prev = keys + n * key_size;
+		n++;
+	}
+	for (int i = 0; i < n; i++) {
+		if (mode & BRF_TIMER_DELETE)
+			bpf_map_delete_elem(map_fd, keys + i * key_size);
+		if (mode & BRF_TIMER_UPDATE)
+			bpf_map_update_elem(map_fd, keys + i * key_size, value, BPF_ANY);
+	}
+	free(keys);
+	free(value);
+	if (mode & BRF_TIMER_CLOSE)
+		close(map_fd);
+	return n;
+}
+#endif
+
+#if SYZ_EXECUTOR || __NR_syz_bpf_map_consume
+#include <bpf/bpf.h>
+#include <linux/bpf.h>
+#include <linux/perf_event.h>
+#include <poll.h>
+#include <sys/ioctl.h>
+#include <sys/mman.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+#define BRF_CONSUME_POLL 1
+#define BRF_CONSUME_LAG 2
+#define BRF_PERF_MAX_CPUS 8
+#define BRF_PERF_PAGES 8
+
+#ifndef BPF_RINGBUF_BUSY_BIT
+#define BPF_RINGBUF_BUSY_BIT (1U << 31)
+#define BPF_RINGBUF_DISCARD_BIT (1U << 30)
+#define BPF_RINGBUF_HDR_SZ 8
+#endif
+
+// A ring the consumer reads records from. For ringbuf maps, head and tail point to the producer
+// and consumer positions in the map. For perf event arrays, they point into the perf mmap page.
+struct brf_ring {
+	int fd;
+	void* meta;
+	size_t meta_size;
+	void* data;
+	size_t data_map_size;
+	__u64 size;
+	__u64* head;
+	__u64* tail;
+	__u64 last_head;
+	bool perf;
+};
+
+static int brf_ring_open_ringbuf(struct brf_ring* ring, int map_fd, __u32 max_entries)
+{
+	size_t page_size = getpagesize();
+	ring->fd = map_fd;
+	ring->size = max_entries;
+	ring->meta_size = page_size;
+	ring->meta = mmap(NULL, page_size, PROT_READ | PROT_WRITE, MAP_SHARED, map_fd, 0);
+	if (ring->meta == MAP_FAILED)
+		return -1;
+	// The data pages are mapped twice in a row, so records that wrap around are contiguous.
+	ring->data_map_size = page_size + 2 * (size_t)max_entries;
+	ring->data = mmap(NULL, ring->data_map_size, PROT_READ, MAP_SHARED, map_fd, page_size);
+	if (ring->data == MAP_FAILED) {
+		munmap(ring->meta, ring->meta_size);
+		return -1;
+	}
+	ring->tail = (__u64*)ring->meta;
+	ring->head = (__u64*)ring->data;
+	ring->data = (char*)ring->data + page_size;
+	return 0;
+}
+
+static int brf_ring_open_perf(struct brf_ring* ring, int map_fd, int cpu)
+{
+	size_t page_size = getpagesize();
+	struct perf_event_attr attr = {};
+	attr.size = sizeof(attr);
+	attr.type = PERF_TYPE_SOFTWARE;
+	attr.config = PERF_COUNT_SW_BPF_OUTPUT;
+	attr.sample_type = PERF_SAMPLE_RAW;
+	attr.sample_period = 1;
+	attr.wakeup_events = 1;
+	int fd = syscall(__NR_perf_event_open, &attr, -1, cpu, -1, PERF_FLAG_FD_CLOEXEC);
+	if (fd < 0)
+		return -1;
+	ring->fd = fd;
+	ring->perf = true;
+	ring->size = BRF_PERF_PAGES * page_size;
+	ring->meta_size = (BRF_PERF_PAGES + 1) * page_size;
+	ring->meta = mmap(NULL, ring->meta_size, PROT_READ | PROT_WRITE, MAP_SHARED, fd, 0);
+	if (ring->meta == MAP_FAILED) {
+		close(fd);
+		return -1;
+	}
+	struct perf_event_mmap_page* header = (struct perf_event_mmap_page*)ring->meta;
+	ring->data = (char*)ring->meta + page_size;
+	ring->head = (__u64*)&header->data_head;
+	ring->tail = (__u64*)&header->data_tail;
+	if (ioctl(fd, PERF_EVENT_IOC_ENABLE, 0) || bpf_map_update_elem(map_fd, &cpu, &fd, BPF_ANY)) {
+		munmap(ring->meta, ring->meta_size);
+		close(fd);
+		return -1;
+	}
+	return 0;
+}
+
+static void brf_ring_close(struct brf_ring* ring)
+{
+	munmap(ring->meta, ring->meta_size);
+	if (ring->perf) {
+		close(ring->fd);
+	} else {
+		size_t page_size = getpagesize();
+		munmap((char*)ring->data - page_size, ring->data_map_size);
+	}
+}
+
+// Ids of the ringbuf maps consumed in this process, hashed by id. Two consumers of a map race
+// on its consumer position, so only one of them is allowed at a time. A collision with another
+// map only makes the later consumer give up.
+#define BRF_CONSUMERS 64
+static __u32 brf_consumers[BRF_CONSUMERS];
+
+static bool brf_consumer_claim(__u32 id)
+{
+	__u32 free_slot = 0;
+	return __atomic_compare_exchange_n(&brf_consumers[id % BRF_CONSUMERS], &free_slot, id, false,
+					   __ATOMIC_ACQ_REL, __ATOMIC_ACQUIRE);
+}
+
+static void brf_consumer_release(__u32 id)
+{
+	__atomic_store_n(&brf_consumers[id % BRF_CONSUMERS], 0, __ATOMIC_RELEASE);
+}
+
+// Consumes the records in the ring, at most max of them, and returns -1 with EINVAL when the
+// ring is inconsistent, e.g. because someone else who maps it wrote the consumer position.
+static int brf_ring_consume(struct brf_ring* ring, int max)
+{
+	__u64 head = __atomic_load_n(ring->head, __ATOMIC_ACQUIRE);
+	__u64 tail = *ring->tail;
+	if (head < ring->last_head || head - tail > ring->size || head % 8) {
+		fprintf(stderr, "syz_bpf_map_consume: bad ring positions head=%llu last=%llu tail=%llu size=%llu\n",
+			head, ring->last_head, tail, ring->size);
+		errno = EINVAL;
+		return -1;
+	}
+	ring->last_head = head;
+	int n = 0;
+	while (tail < head && n < max) {
+		__u64 len;
+		if (ring->perf) {
+			struct perf_event_header* hdr = (struct perf_event_header*)((char*)ring->data + tail % ring->size);
+			len = hdr->size;
+			if (len < sizeof(*hdr) || len % 8 || len > head - tail ||
+			    (hdr->type != PERF_RECORD_SAMPLE && hdr->type != PERF_RECORD_LOST)) {
+				fprintf(stderr, "syz_bpf_map_consume: bad perf record type=%u size=%llu head=%llu tail=%llu\n",
+					hdr->type, len, head, tail);
+				errno = EINVAL;
+				return -1;
+			}
+		} else {
+			__u32 hdr_len = __atomic_load_n((__u32*)((char*)ring->data + (tail & (ring->size - 1))), __ATOMIC_ACQUIRE);
+			// The producer has not committed the record yet.
+			if (hdr_len & BPF_RINGBUF_BUSY_BIT)
+				break;
+			len = (hdr_len & ~BPF_RINGBUF_DISCARD_BIT) + BPF_RINGBUF_HDR_SZ;
+			len = (len + 7) / 8 * 8;
+			if (len > head - tail) {
+				errno = EINVAL;
+				return -1;
+			}
+		}
+		tail += len;
+		n++;
+		__atomic_store_n(ring->tail, tail, __ATOMIC_RELEASE);
+	}
+	return n;
+}
+
+// Consumes the records of the ringbuf or perf event array map a0 for a1 ms, concurrently with
+// the programs producing them. Perf buffers are opened for the first cpus and stored in the map.
+// With BRF_CONSUME_POLL in a2, the consumer waits for records with poll, with BRF_CONSUME_LAG,
+// it consumes a record at a time and falls behind the producers, so that the buffers overflow.
+// A ringbuf is consumed by one call at a time, the others fail with EBUSY.
+static long syz_bpf_map_consume(volatile long a0, volatile long a1, volatile long a2)
+{
+	int map_fd = (int)a0;
+	uint64 timeout = a1;
+	long mode = a2;
+	struct bpf_map_info info = {};
+	__u32 info_len = sizeof(info);
+	struct brf_ring rings[BRF_PERF_MAX_CPUS] = {};
+	int nrings = 0;
+
+	if (bpf_obj_get_info_by_fd(map_fd, &info, &info_len)) {
+		fprintf(stderr, "syz_bpf_map_consume: bad map %d, errno %d\n", map_fd, errno);
+		return -1;
+	}
+	if (info.type == BPF_MAP_TYPE_RINGBUF) {
+		if (!brf_consumer_claim(info.id)) {
+			errno = EBUSY;
+			return -1;
+		}
+		if (brf_ring_open_ringbuf(&rings[0], map_fd, info.max_entries) == 0)
+			nrings = 1;
+		else
+			brf_consumer_release(info.id);
+	} else if (info.type == BPF_MAP_TYPE_PERF_EVENT_ARRAY) {
+		int ncpus = sysconf(_SC_NPROCESSORS_ONLN);
+		for (int cpu = 0; cpu < ncpus && cpu < (int)info.max_entries && nrings < BRF_PERF_MAX_CPUS; cpu++) {
+			if (brf_ring_open_perf(&rings[nrings], map_fd, cpu) == 0)
+				nrings++;
+		}
+	}
+	if (nrings == 0) {
+		fprintf(stderr, "syz_bpf_map_consume: failed to map the buffers of map %d, errno %d\n", map_fd, errno);
+		return -1;
+	}
+
+	long total = 0;
+	uint64 deadline = current_time_ms() + timeout;
+	for (;;) {
+		for (int i = 0; i < nrings && total >= 0; i++) {
+			int n = brf_ring_consume(&rings[i], (mode & BRF_CONSUME_LAG) ? 1 : INT_MAX);
+			total = n < 0 ? -1 : total + n;
+		}
+		uint64 now = current_time_ms();
+		if (total < 0 || now >= deadline)
+			break;
+		if (mode & BRF_CONSUME_POLL) {
+			struct pollfd fds[BRF_PERF_MAX_CPUS] = {};
+			for (int i = 0; i < nrings; i++) {
+				fds[i].fd = rings[i].fd;
+				fds[i].events = POLLIN;
+			}
+			poll(fds, nrings, deadline - now);
+		} else {
+			usleep((mode & BRF_CONSUME_LAG) ? 1000 : 10);
+		}
+	}
+	int err = errno;
+	for (int i = 0; i < nrings; i++)
+		brf_ring_close(&rings[i]);
+	if (info.type == BPF_MAP_TYPE_RINGBUF)
+		brf_consumer_release(info.id);
+	errno = err;
+	return total;
+}
+#endif
+
+#if SYZ_EXECUTOR || __NR_syz_bpf_prog_fault_trigger
+#include <sys/mman.h>
+#include <sys/syscall.h>
+#include <unistd.h>
+
+// Keep in sync with BpfFaultAreaAddr and BpfFaultAreaSize in prog/bpf_generate.go.
+#define BRF_FAULT_AREA_ADDR 0x30000000ul
+#define BRF_FAULT_AREA_SIZE (16 << 12)
+#define BRF_FAULT_SHARED 1
+#define BRF_FAULT_PROT_NONE 2
+
+// Maps the fault area afresh and invokes syscall nr. Sleepable programs attached to the
+// syscall that read the area fault its pages in from bpf_copy_from_user and sleep.
+// Only the syscalls programs are attached to are invoked, keep in sync with brf_fault_syscall
+// in sys/linux/bpf.txt and GenKprobeEntry and GenBPFTrampoline in prog/bpf_types.go.
+static long syz_bpf_prog_fault_trigger(volatile long a0, volatile long a1)
+{
+	long nr = a0;
+	long mode = a1;
+	int flags = MAP_FIXED | MAP_PRIVATE | MAP_ANONYMOUS;
+	int fd = -1;
+
+	if (nr != __NR_getpgid && nr != __NR_nanosleep) {
+		errno = EINVAL;
+		return -1;
+	}
+
+	if (mode & BRF_FAULT_SHARED) {
+		// Faults on shared memfd pages go through the page cache, not only the page allocator.
+		fd = syscall(__NR_memfd_create, "brf_fault", 0);
+		if (fd == -1 || ftruncate(fd, BRF_FAULT_AREA_SIZE)) {
+			fprintf(stderr, "syz_bpf_prog_fault_trigger: failed to create memfd, errno %d\n", errno);
+			if (fd != -1)
+				close(fd);
+			return -1;
+		}
+		flags = MAP_FIXED | MAP_SHARED;
+	}
+	// MAP_FIXED replaces the area mapped by the previous trigger, so none of the pages are present.
+	char* area = (char*)mmap((void*)BRF_FAULT_AREA_ADDR, BRF_FAULT_AREA_SIZE, PROT_READ | PROT_WRITE, flags, fd, 0);
+	if (fd != -1)
+		close(fd);
+	if (area == MAP_FAILED) {
+		fprintf(stderr, "syz_bpf_prog_fault_trigger: failed to map the fault area, errno %d\n", errno);
+		return -1;
+	}
+	if (mode & BRF_FAULT_PROT_NONE)
+		mprotect(area + BRF_FAULT_AREA_SIZE / 2, BRF_FAULT_AREA_SIZE / 2, PROT_NONE);
+
+	long ret = syscall(nr, 0, 0, 0, 0, 0, 0);
+	int err = errno;
+	munmap(area, BRF_FAULT_AREA_SIZE);
+	errno = err;
+	return ret;
+}
+#endif
@@ -578,6 +578,23 @@ var typeText = &typeDesc{
 	},
 }
 
+var typeBpfObj = &typeDesc{
+	Names:     []string{"bpf_obj"},
+	CantBeOpt: true,
+	CantBeOut: true,
+	Varlen: func(comp *compiler, t *ast.Type, args []*ast.Type) bool {
+		return true
+	},
+	Gen: func(comp *compiler, t *ast.Type, args []*ast.Type, base prog.IntTypeCommon) prog.Type {
+		base.TypeSize = 0
+		base.TypeAlign = 1
+		return &prog.BufferType{
+			TypeCommon: base.TypeCommon,
+			Kind:       prog.BufferBpfObj,
+		}
+	},
+}
+
 var typeArgTextType = &typeArg{
 	Kind:  kindIdent,
 	Names: []string{"target", "x86_real", "x86_16", "x86_32", "x86_64", "arm64", "ppc64"},
@@ -1111,6 +1128,7 @@ func init() {
 		typeCsum,
 		typeProc,
 		typeText,
+		typeBpfObj,
 		typeString,
 		typeFmt,
 	}
@@ -0,0 +1,315 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package cover
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/syzkaller/pkg/mgrconfig"
+)
+
+// categoryCover is the coverage of a set of programs in some areas of the kernel,
+// attributed to the categories of the programs. A category is a "kind:name" label,
+// and unique coverage of a category is the coverage no other category of the same kind has.
+type categoryCover struct {
+	areas  []mgrconfig.Subsystem
+	totals []int          // PCs in each area
+	pcArea map[uint64]int // area of every PC in the areas
+	progs  map[string]int // number of programs of each category
+	pcs    map[string]map[uint64]bool
+	// For every kind, maps covered PCs to the only category covering them, or "" if there are several.
+	owners map[string]map[uint64]string
+}
+
+type categoryStats struct {
+	Kind    string
+	Name    string
+	Progs   int
+	Covered []int // covered PCs in each area
+	Unique  []int // uniquely covered PCs in each area
+}
+
+type categoryFunc struct {
+	Area    string
+	File    string
+	Name    string
+	PCs     int
+	Covered int // PCs covered by the category
+	Kind    int // PCs covered by any category of the same kind
+	Unique  int // PCs covered by the category only
+}
+
+func splitCategory(category string) (string, string) {
+	if i := strings.IndexByte(category, ':'); i != -1 {
+		return category[:i], category[i+1:]
+	}
+	return "", category
+}
+
+func findArea(areas []mgrconfig.Subsystem, name string) int {
+	for i, area := range areas {
+		for _, path := range area.Paths {
+			if strings.HasPrefix(name, path) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (rg *ReportGenerator) categoryCover(progs []Prog, areas []mgrconfig.Subsystem) *categoryCover {
+	cc := &categoryCover{
+		areas:  areas,
+		totals: make([]int, len(areas)),
+		pcArea: make(map[uint64]int),
+		progs:  make(map[string]int),
+		pcs:    make(map[string]map[uint64]bool),
+		owners: make(map[string]map[uint64]string),
+	}
+	for _, unit := range rg.Units {
+		area := findArea(areas, unit.Name)
+		if area == -1 {
+			continue
+		}
+		cc.totals[area] += len(unit.PCs)
+		for _, pc := range unit.PCs {
+			cc.pcArea[pc] = area
+		}
+	}
+	for _, prog := range progs {
+		for _, category := range prog.Categories {
+			cc.progs[category]++
+			kind, _ := splitCategory(category)
+			pcs := cc.pcs[category]
+			if pcs == nil {
+				pcs = make(map[uint64]bool)
+				cc.pcs[category] = pcs
+			}
+			owners := cc.owners[kind]
+			if owners == nil {
+				owners = make(map[uint64]string)
+				cc.owners[kind] = owners
+			}
+			for _, pc := range prog.PCs {
+				if _, ok := cc.pcArea[pc]; !ok {
+					continue
+				}
+				pcs[pc] = true
+				if owner, ok := owners[pc]; !ok {
+					owners[pc] = category
+				} else if owner != category {
+					owners[pc] = ""
+				}
+			}
+		}
+	}
+	return cc
+}
+
+func (cc *categoryCover) stats() []*categoryStats {
+	var res []*categoryStats
+	for category, pcs := range cc.pcs {
+		kind, name := splitCategory(category)
+		stats := &categoryStats{
+			Kind:    kind,
+			Name:    name,
+			Progs:   cc.progs[category],
+			Covered: make([]int, len(cc.areas)),
+			Unique:  make([]int, len(cc.areas)),
+		}
+		for pc := range pcs {
+			area := cc.pcArea[pc]
+			stats.Covered[area]++
+			if cc.owners[kind][pc] == category {
+				stats.Unique[area]++
+			}
+		}
+		res = append(res, stats)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Kind != res[j].Kind {
+			return res[i].Kind < res[j].Kind
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// categoryFuncs returns the functions of the areas that programs of the same kind as category reach.
+func (rg *ReportGenerator) categoryFuncs(cc *categoryCover, category string) []*categoryFunc {
+	kind, _ := splitCategory(category)
+	var res []*categoryFunc
+	for _, s := range rg.Symbols {
+		if s.Unit == nil {
+			continue
+		}
+		area := findArea(cc.areas, s.Unit.Name)
+		if area == -1 {
+			continue
+		}
+		fn := &categoryFunc{
+			Area: cc.areas[area].Name,
+			File: s.Unit.Name,
+			Name: s.Name,
+			PCs:  len(s.PCs),
+		}
+		for _, pc := range s.PCs {
+			owner, ok := cc.owners[kind][pc]
+			if !ok {
+				continue
+			}
+			fn.Kind++
+			if cc.pcs[category][pc] {
+				fn.Covered++
+			}
+			if owner == category {
+				fn.Unique++
+			}
+		}
+		if fn.Kind != 0 {
+			res = append(res, fn)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].File != res[j].File {
+			return res[i].File < res[j].File
+		}
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// DoCategoryCover writes a report of the coverage of progs in areas attributed to
+// the categories of the programs. If category is set, the report lists the functions
+// of the areas reached by programs of its kind, with the part of them the category reaches.
+func (rg *ReportGenerator) DoCategoryCover(w io.Writer, progs []Prog, coverFilter map[uint32]uint32,
+	areas []mgrconfig.Subsystem, category string) error {
+	progs = fixUpPCs(rg.target.Arch, progs, coverFilter)
+	if len(progs) == 0 {
+		return fmt.Errorf("no coverage collected so far")
+	}
+	cc := rg.categoryCover(progs, areas)
+	if category != "" {
+		if cc.progs[category] == 0 {
+			return fmt.Errorf("no programs of category %v", category)
+		}
+		return categoryFuncTemplate.Execute(w, map[string]interface{}{
+			"Category": category,
+			"Progs":    cc.progs[category],
+			"Funcs":    rg.categoryFuncs(cc, category),
+		})
+	}
+	var names []string
+	for _, area := range areas {
+		names = append(names, area.Name)
+	}
+	return categoryCoverTemplate.Execute(w, map[string]interface{}{
+		"Areas":      names,
+		"Totals":     cc.totals,
+		"Categories": cc.stats(),
+	})
+}
+
+const categoryStyle = `
+		<style>
+			body {
+				background: white;
+			}
+			th, td {
+				text-align: left;
+				border: 1px solid black;
+			}
+			th {
+				background: gray;
+			}
+			tr:nth-child(2n+1) {
+				background: #CCC
+			}
+			table {
+				border-collapse: collapse;
+				border: 1px solid black;
+				margin-bottom: 20px;
+			}
+		</style>
+`
+
+var categoryCoverTemplate = template.Must(template.New("categoryCover").Parse(`
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+		` + categoryStyle + `
+	</head>
+	<body>
+		<table>
+			<caption>Covered / uniquely covered PCs</caption>
+			<thead>
+				<tr>
+					<th>Kind</th>
+					<th>Category</th>
+					<th>Programs</th>
+					{{range $i, $area := .Areas}}
+					<th>{{$area}} ({{index $.Totals $i}} PCs)</th>
+					{{end}}
+				</tr>
+			</thead>
+			<tbody>
+				{{range $c := .Categories}}
+				<tr>
+					<td>{{$c.Kind}}</td>
+					<td><a href="?category={{$c.Kind}}:{{$c.Name}}">{{$c.Name}}</a></td>
+					<td>{{$c.Progs}}</td>
+					{{range $i, $covered := $c.Covered}}
+					<td>{{$covered}} / {{index $c.Unique $i}}</td>
+					{{end}}
+				</tr>
+				{{end}}
+			</tbody>
+		</table>
+	</body>
+</html>
+`))
+
+var categoryFuncTemplate = template.Must(template.New("categoryFunc").Parse(`
+<!DOCTYPE html>
+<html>
+	<head>
+		<meta http-equiv="Content-Type" content="text/html; charset=utf-8">
+		` + categoryStyle + `
+	</head>
+	<body>
+		<table>
+			<caption>{{.Category}} ({{.Progs}} programs)</caption>
+			<thead>
+				<tr>
+					<th>Area</th>
+					<th>File</th>
+					<th>Function</th>
+					<th>Covered</th>
+					<th>Uniquely covered</th>
+					<th>Covered by the kind</th>
+					<th>Total PCs</th>
+				</tr>
+			</thead>
+			<tbody>
+				{{range $f := .Funcs}}
+				<tr>
+					<td>{{$f.Area}}</td>
+					<td>{{$f.File}}</td>
+					<td>{{$f.Name}}</td>
+					<td>{{$f.Covered}}</td>
+					<td>{{$f.Unique}}</td>
+					<td>{{$f.Kind}}</td>
+					<td>{{$f.PCs}}</td>
+				</tr>
+				{{end}}
+			</tbody>
+		</table>
+	</body>
+</html>
+`))
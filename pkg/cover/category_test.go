@@ -0,0 +1,93 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package cover
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/cover/backend"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/sys/targets"
+)
+
+func TestCategoryCover(t *testing.T) {
+	unit := func(name string, pcs ...uint64) *backend.CompileUnit {
+		return &backend.CompileUnit{ObjectUnit: backend.ObjectUnit{Name: name, PCs: pcs}}
+	}
+	filter := unit("net/core/filter.c", 1, 2, 3, 4)
+	syscall := unit("kernel/bpf/syscall.c", 10, 11)
+	other := unit("mm/slab.c", 20)
+	rg := &ReportGenerator{
+		target: targets.Get(targets.Linux, targets.AMD64),
+		Impl: &backend.Impl{
+			Units: []*backend.CompileUnit{filter, syscall, other},
+			Symbols: []*backend.Symbol{
+				{ObjectUnit: backend.ObjectUnit{Name: "sk_msg_pull_data", PCs: []uint64{1, 2}}, Unit: filter},
+				{ObjectUnit: backend.ObjectUnit{Name: "bpf_skb_load_bytes", PCs: []uint64{3, 4}}, Unit: filter},
+				{ObjectUnit: backend.ObjectUnit{Name: "bpf_prog_load", PCs: []uint64{10, 11}}, Unit: syscall},
+				{ObjectUnit: backend.ObjectUnit{Name: "kmalloc", PCs: []uint64{20}}, Unit: other},
+			},
+		},
+	}
+	areas := []mgrconfig.Subsystem{
+		{Name: "kernel/bpf", Paths: []string{"kernel/bpf/"}},
+		{Name: "net/core/filter.c", Paths: []string{"net/core/filter.c"}},
+	}
+	progs := []Prog{
+		{PCs: []uint64{1, 2, 10, 20}, Categories: []string{"prog_type:sk_msg", "helper:msg_pull_data"}},
+		{PCs: []uint64{3, 10}, Categories: []string{"prog_type:sched_cls", "helper:skb_load_bytes"}},
+		{PCs: []uint64{4, 11}, Categories: []string{"prog_type:sched_cls"}},
+	}
+	cc := rg.categoryCover(progs, areas)
+	if want := []int{2, 4}; !reflect.DeepEqual(cc.totals, want) {
+		t.Fatalf("area totals %v, want %v", cc.totals, want)
+	}
+	var got []categoryStats
+	for _, stats := range cc.stats() {
+		got = append(got, *stats)
+	}
+	want := []categoryStats{
+		{"helper", "msg_pull_data", 1, []int{1, 2}, []int{0, 2}},
+		{"helper", "skb_load_bytes", 1, []int{1, 1}, []int{0, 1}},
+		{"prog_type", "sched_cls", 2, []int{2, 2}, []int{1, 2}},
+		{"prog_type", "sk_msg", 1, []int{1, 2}, []int{0, 2}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got stats %+v\nwant %+v", got, want)
+	}
+
+	var funcs []categoryFunc
+	for _, fn := range rg.categoryFuncs(cc, "prog_type:sched_cls") {
+		funcs = append(funcs, *fn)
+	}
+	wantFuncs := []categoryFunc{
+		{"kernel/bpf", "kernel/bpf/syscall.c", "bpf_prog_load", 2, 2, 2, 1},
+		{"net/core/filter.c", "net/core/filter.c", "bpf_skb_load_bytes", 2, 2, 2, 2},
+		{"net/core/filter.c", "net/core/filter.c", "sk_msg_pull_data", 2, 0, 2, 0},
+	}
+	if !reflect.DeepEqual(funcs, wantFuncs) {
+		t.Fatalf("got funcs %+v\nwant %+v", funcs, wantFuncs)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := rg.DoCategoryCover(buf, progs, nil, areas, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "?category=prog_type:sk_msg") {
+		t.Fatalf("no link to the sk_msg report:\n%s", buf.String())
+	}
+	buf.Reset()
+	if err := rg.DoCategoryCover(buf, progs, nil, areas, "prog_type:sk_msg"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "sk_msg_pull_data") {
+		t.Fatalf("no sk_msg_pull_data in the sk_msg report:\n%s", buf.String())
+	}
+	if err := rg.DoCategoryCover(buf, progs, nil, areas, "prog_type:xdp"); err == nil {
+		t.Fatalf("no error for a category without programs")
+	}
+}
@@ -22,8 +22,9 @@ type ReportGenerator struct {
 }
 
 type Prog struct {
-	Data string
-	PCs  []uint64
+	Data       string
+	PCs        []uint64
+	Categories []string // "kind:name" labels the coverage of the program is attributed to
 }
 
 var RestorePC = backend.RestorePC
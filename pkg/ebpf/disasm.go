@@ -0,0 +1,488 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+// Package ebpf disassembles compiled eBPF objects.
+// Instructions are printed the way the kernel verifier log prints them (kernel/bpf/disasm.c),
+// so the disassembly of a program can be compared with the log of its verification.
+package ebpf
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+// Func is a function of a compiled object.
+type Func struct {
+	Section string
+	Name    string
+	Insns   []Insn
+}
+
+// Insn is a disassembled instruction.
+type Insn struct {
+	Pos  int // index of the instruction in the function, 64-bit immediate loads take two
+	Text string
+}
+
+const insnSize = 8
+
+// Instruction classes.
+const (
+	classLD    = 0x00
+	classLDX   = 0x01
+	classST    = 0x02
+	classSTX   = 0x03
+	classALU   = 0x04
+	classJMP   = 0x05
+	classJMP32 = 0x06
+	classALU64 = 0x07
+)
+
+// Modes of load and store instructions.
+const (
+	modeIMM    = 0x00
+	modeABS    = 0x20
+	modeIND    = 0x40
+	modeMEM    = 0x60
+	modeMEMSX  = 0x80
+	modeATOMIC = 0xc0
+)
+
+// ALU operations.
+const (
+	aluDIV  = 0x30
+	aluNEG  = 0x80
+	aluMOD  = 0x90
+	aluMOV  = 0xb0
+	aluEND  = 0xd0
+	srcX    = 0x08
+	sizeDW  = 0x18
+	toBE    = 0x08
+	opMask  = 0xf0
+	sizeMsk = 0x18
+	modeMsk = 0xe0
+)
+
+// Jump operations.
+const (
+	jmpJA   = 0x00
+	jmpCALL = 0x80
+	jmpEXIT = 0x90
+)
+
+// Atomic operations, in the immediate of atomic instructions.
+const (
+	atomicFETCH   = 0x01
+	atomicXCHG    = 0xe0 | atomicFETCH
+	atomicCMPXCHG = 0xf0 | atomicFETCH
+)
+
+// Source registers of calls.
+const (
+	pseudoCall      = 1
+	pseudoKfuncCall = 2
+)
+
+var aluOps = map[uint8]string{
+	0x00: "+=",
+	0x10: "-=",
+	0x20: "*=",
+	0x30: "/=",
+	0x40: "|=",
+	0x50: "&=",
+	0x60: "<<=",
+	0x70: ">>=",
+	0x90: "%=",
+	0xa0: "^=",
+	0xb0: "=",
+	0xc0: "s>>=",
+}
+
+var atomicOps = map[uint8]string{
+	0x00: "add",
+	0x40: "or",
+	0x50: "and",
+	0xa0: "xor",
+}
+
+var jmpOps = map[uint8]string{
+	0x10: "==",
+	0x20: ">",
+	0x30: ">=",
+	0x40: "&",
+	0x50: "!=",
+	0x60: "s>",
+	0x70: "s>=",
+	0xa0: "<",
+	0xb0: "<=",
+	0xc0: "s<",
+	0xd0: "s<=",
+}
+
+var sizes = map[uint8]string{
+	0x00: "u32",
+	0x08: "u16",
+	0x10: "u8",
+	0x18: "u64",
+}
+
+var signedSizes = map[uint8]string{
+	0x00: "s32",
+	0x08: "s16",
+	0x10: "s8",
+}
+
+// insn is a raw instruction.
+type insn struct {
+	code uint8
+	dst  uint8
+	src  uint8
+	off  int16
+	imm  int32
+}
+
+func decode(data []byte, order binary.ByteOrder) insn {
+	regs := data[1]
+	dst, src := regs&0xf, regs>>4
+	if order == binary.BigEndian {
+		dst, src = regs>>4, regs&0xf
+	}
+	return insn{
+		code: data[0],
+		dst:  dst,
+		src:  src,
+		off:  int16(order.Uint16(data[2:])),
+		imm:  int32(order.Uint32(data[4:])),
+	}
+}
+
+// reloc is a relocation of an instruction, the symbol it refers to is in section sec at value.
+type reloc struct {
+	sym   string
+	sec   string
+	value uint64
+}
+
+// disasm disassembles a section.
+type disasm struct {
+	order  binary.ByteOrder
+	helper func(int) string
+	relocs map[int]*reloc // by instruction index in the section
+	// funcAt returns the name of the function starting at the instruction of a section.
+	funcAt func(sec string, pos int) string
+	sec    string
+}
+
+// Disassemble disassembles the functions of the executable sections of the ELF object obj.
+// helper returns the name of a helper by its number, or "" if it is not known.
+func Disassemble(obj []byte, helper func(int) string) ([]*Func, error) {
+	file, err := elf.NewFile(bytes.NewReader(obj))
+	if err != nil {
+		return nil, err
+	}
+	if file.Machine != elf.EM_BPF {
+		return nil, fmt.Errorf("not a BPF object: machine %v", file.Machine)
+	}
+	syms, err := file.Symbols()
+	if err != nil && err != elf.ErrNoSymbols {
+		return nil, err
+	}
+	// Functions by section and start, in instructions.
+	funcs := make(map[elf.SectionIndex]map[int]elf.Symbol)
+	for _, sym := range syms {
+		if elf.ST_TYPE(sym.Info) != elf.STT_FUNC || sym.Section >= elf.SectionIndex(len(file.Sections)) {
+			continue
+		}
+		if funcs[sym.Section] == nil {
+			funcs[sym.Section] = make(map[int]elf.Symbol)
+		}
+		funcs[sym.Section][int(sym.Value/insnSize)] = sym
+	}
+	funcAt := func(sec string, pos int) string {
+		for i, s := range file.Sections {
+			if s.Name == sec {
+				return funcs[elf.SectionIndex(i)][pos].Name
+			}
+		}
+		return ""
+	}
+	var res []*Func
+	for i, sec := range file.Sections {
+		if sec.Type != elf.SHT_PROGBITS || sec.Flags&elf.SHF_EXECINSTR == 0 || sec.Size == 0 {
+			continue
+		}
+		code, err := sec.Data()
+		if err != nil {
+			return nil, fmt.Errorf("section %v: %v", sec.Name, err)
+		}
+		relocs, err := readRelocs(file, i, syms)
+		if err != nil {
+			return nil, fmt.Errorf("section %v: %v", sec.Name, err)
+		}
+		d := &disasm{
+			order:  file.ByteOrder,
+			helper: helper,
+			relocs: relocs,
+			funcAt: funcAt,
+			sec:    sec.Name,
+		}
+		var starts []int
+		for start := range funcs[elf.SectionIndex(i)] {
+			starts = append(starts, start)
+		}
+		sort.Ints(starts)
+		if len(starts) == 0 || starts[0] != 0 {
+			starts = append([]int{0}, starts...)
+		}
+		n := len(code) / insnSize
+		for j, start := range starts {
+			end := n
+			if j+1 < len(starts) {
+				end = starts[j+1]
+			}
+			if start >= end {
+				continue
+			}
+			fn := &Func{
+				Section: sec.Name,
+				Name:    funcs[elf.SectionIndex(i)][start].Name,
+			}
+			for pos := start; pos < end; {
+				text, size := d.insn(code, pos)
+				fn.Insns = append(fn.Insns, Insn{Pos: pos - start, Text: text})
+				pos += size
+			}
+			res = append(res, fn)
+		}
+	}
+	return res, nil
+}
+
+func readRelocs(file *elf.File, sec int, syms []elf.Symbol) (map[int]*reloc, error) {
+	relocs := make(map[int]*reloc)
+	for _, rs := range file.Sections {
+		if rs.Type != elf.SHT_REL || int(rs.Info) != sec {
+			continue
+		}
+		data, err := rs.Data()
+		if err != nil {
+			return nil, err
+		}
+		for ; len(data) >= 16; data = data[16:] {
+			off := file.ByteOrder.Uint64(data)
+			info := file.ByteOrder.Uint64(data[8:])
+			idx := int(elf.R_SYM64(info))
+			// Symbols() skips the null symbol, so symbol i is at i-1.
+			if idx == 0 || idx > len(syms) {
+				continue
+			}
+			sym := syms[idx-1]
+			r := &reloc{sym: sym.Name, value: sym.Value}
+			if sym.Section < elf.SectionIndex(len(file.Sections)) {
+				r.sec = file.Sections[sym.Section].Name
+			}
+			if r.sym == "" {
+				r.sym = r.sec
+			}
+			relocs[int(off/insnSize)] = r
+		}
+	}
+	return relocs, nil
+}
+
+// insn returns the text of the instruction at pos and the number of slots it takes.
+func (d *disasm) insn(code []byte, pos int) (string, int) {
+	if (pos+1)*insnSize > len(code) {
+		return "truncated instruction", 1
+	}
+	in := decode(code[pos*insnSize:], d.order)
+	text, size := d.format(in, pos, code)
+	return fmt.Sprintf("(%02x) %v", in.code, text), size
+}
+
+func (d *disasm) format(in insn, pos int, code []byte) (string, int) {
+	class := in.code & 0x07
+	switch class {
+	case classALU, classALU64:
+		return formatALU(in, class), 1
+	case classSTX:
+		return formatSTX(in), 1
+	case classST:
+		if in.code&modeMsk != modeMEM {
+			return bug(in), 1
+		}
+		return fmt.Sprintf("*(%v *)(r%v %+d) = %v", sizes[in.code&sizeMsk], in.dst, in.off, in.imm), 1
+	case classLDX:
+		switch in.code & modeMsk {
+		case modeMEM:
+			return fmt.Sprintf("r%v = *(%v *)(r%v %+d)", in.dst, sizes[in.code&sizeMsk], in.src, in.off), 1
+		case modeMEMSX:
+			if size, ok := signedSizes[in.code&sizeMsk]; ok {
+				return fmt.Sprintf("r%v = *(%v *)(r%v %+d)", in.dst, size, in.src, in.off), 1
+			}
+		}
+		return bug(in), 1
+	case classLD:
+		return d.formatLD(in, pos, code)
+	case classJMP, classJMP32:
+		return d.formatJMP(in, class, pos), 1
+	}
+	return bug(in), 1
+}
+
+func bug(in insn) string {
+	return fmt.Sprintf("BUG_%02x", in.code)
+}
+
+func reg(class uint8, r uint8) string {
+	if class == classALU || class == classJMP32 {
+		return fmt.Sprintf("w%v", r)
+	}
+	return fmt.Sprintf("r%v", r)
+}
+
+func formatALU(in insn, class uint8) string {
+	op := in.code & opMask
+	dst, src := reg(class, in.dst), reg(class, in.src)
+	switch op {
+	case aluEND:
+		if class == classALU64 {
+			return fmt.Sprintf("r%v = bswap%v r%v", in.dst, in.imm, in.dst)
+		}
+		order := "le"
+		if in.code&toBE != 0 {
+			order = "be"
+		}
+		return fmt.Sprintf("r%v = %v%v r%v", in.dst, order, in.imm, in.dst)
+	case aluNEG:
+		return fmt.Sprintf("%v = -%v", dst, dst)
+	}
+	str, ok := aluOps[op]
+	if !ok {
+		return bug(in)
+	}
+	if in.off == 1 && (op == aluDIV || op == aluMOD) {
+		str = "s" + str
+	}
+	if in.code&srcX == 0 {
+		return fmt.Sprintf("%v %v %v", dst, str, in.imm)
+	}
+	cast := ""
+	if op == aluMOV && (in.off == 8 || in.off == 16 || in.off == 32) {
+		cast = fmt.Sprintf("(s%v)", in.off)
+	}
+	return fmt.Sprintf("%v %v %v%v", dst, str, cast, src)
+}
+
+func formatSTX(in insn) string {
+	size := sizes[in.code&sizeMsk]
+	switch in.code & modeMsk {
+	case modeMEM:
+		return fmt.Sprintf("*(%v *)(r%v %+d) = r%v", size, in.dst, in.off, in.src)
+	case modeATOMIC:
+	default:
+		return bug(in)
+	}
+	bits := ""
+	if in.code&sizeMsk == sizeDW {
+		bits = "64"
+	}
+	switch op := uint8(in.imm); {
+	case op == atomicXCHG:
+		return fmt.Sprintf("r%v = atomic%v_xchg((%v *)(r%v %+d), r%v)", in.src, bits, size, in.dst, in.off, in.src)
+	case op == atomicCMPXCHG:
+		return fmt.Sprintf("r0 = atomic%v_cmpxchg((%v *)(r%v %+d), r0, r%v)", bits, size, in.dst, in.off, in.src)
+	case in.imm != int32(op):
+	case op&atomicFETCH != 0 && atomicOps[op&^atomicFETCH] != "":
+		return fmt.Sprintf("r%v = atomic%v_fetch_%v((%v *)(r%v %+d), r%v)",
+			in.src, bits, atomicOps[op&^atomicFETCH], size, in.dst, in.off, in.src)
+	case atomicOps[op] != "":
+		return fmt.Sprintf("lock *(%v *)(r%v %+d) %v r%v", size, in.dst, in.off, aluOps[op], in.src)
+	}
+	return bug(in)
+}
+
+func (d *disasm) formatLD(in insn, pos int, code []byte) (string, int) {
+	size := sizes[in.code&sizeMsk]
+	switch in.code & modeMsk {
+	case modeABS:
+		return fmt.Sprintf("r0 = *(%v *)skb[%v]", size, in.imm), 1
+	case modeIND:
+		return fmt.Sprintf("r0 = *(%v *)skb[r%v + %v]", size, in.src, in.imm), 1
+	case modeIMM:
+		if in.code&sizeMsk != sizeDW {
+			break
+		}
+		if (pos+2)*insnSize > len(code) {
+			return "truncated instruction", 1
+		}
+		next := decode(code[(pos+1)*insnSize:], d.order)
+		imm := uint64(uint32(next.imm))<<32 | uint64(uint32(in.imm))
+		if r := d.relocs[pos]; r != nil {
+			if r.sec == "maps" || r.sec == ".maps" {
+				return fmt.Sprintf("r%v = map[%v]", in.dst, r.sym), 2
+			}
+			if off := int64(imm); off != 0 {
+				return fmt.Sprintf("r%v = %v%+d", in.dst, r.sym, off), 2
+			}
+			return fmt.Sprintf("r%v = %v", in.dst, r.sym), 2
+		}
+		return fmt.Sprintf("r%v = 0x%x", in.dst, imm), 2
+	}
+	return bug(in), 1
+}
+
+func (d *disasm) formatJMP(in insn, class uint8, pos int) string {
+	op := in.code & opMask
+	switch {
+	case op == jmpCALL && class == classJMP:
+		return d.formatCall(in, pos)
+	case op == jmpEXIT && class == classJMP:
+		return "exit"
+	case op == jmpJA && class == classJMP:
+		return fmt.Sprintf("goto pc%+d", in.off)
+	case op == jmpJA:
+		return fmt.Sprintf("gotol pc%+d", in.imm)
+	}
+	str, ok := jmpOps[op]
+	if !ok {
+		return bug(in)
+	}
+	if in.code&srcX != 0 {
+		return fmt.Sprintf("if %v %v %v goto pc%+d", reg(class, in.dst), str, reg(class, in.src), in.off)
+	}
+	return fmt.Sprintf("if %v %v 0x%x goto pc%+d", reg(class, in.dst), str, uint32(in.imm), in.off)
+}
+
+func (d *disasm) formatCall(in insn, pos int) string {
+	if r := d.relocs[pos]; r != nil {
+		// Calls of functions in other sections, or of kfuncs and other extern functions.
+		name := r.sym
+		if r.sec != "" {
+			if fn := d.funcAt(r.sec, int(r.value/insnSize)+int(in.imm)+1); fn != "" {
+				name = fn
+			}
+		}
+		return fmt.Sprintf("call %v", name)
+	}
+	switch in.src {
+	case pseudoCall:
+		if fn := d.funcAt(d.sec, pos+int(in.imm)+1); fn != "" {
+			return fmt.Sprintf("call pc%+d %v", in.imm, fn)
+		}
+		return fmt.Sprintf("call pc%+d", in.imm)
+	case pseudoKfuncCall:
+		return "call kernel-function"
+	}
+	name := ""
+	if d.helper != nil {
+		name = d.helper(int(in.imm))
+	}
+	if name == "" {
+		name = "unknown"
+	}
+	return fmt.Sprintf("call %v#%v", name, in.imm)
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package ebpf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestDisassemble(t *testing.T) {
+	obj, err := os.ReadFile("testdata/prog.o")
+	if err != nil {
+		t.Fatal(err)
+	}
+	helper := func(n int) string {
+		if n == 1 {
+			return "bpf_map_lookup_elem"
+		}
+		return ""
+	}
+	funcs, err := Disassemble(obj, helper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		".text/twice": `
+0: (bf) r0 = r1
+1: (67) r0 <<= 1
+2: (c7) r0 s>>= 3
+3: (27) r0 *= -5
+4: (95) exit
+`,
+		"xdp/prog": `
+0: (bf) r6 = r1
+1: (b4) w1 = 0
+2: (63) *(u32 *)(r10 -4) = r1
+3: (bf) r2 = r10
+4: (07) r2 += -4
+5: (18) r1 = map[counts]
+7: (85) call bpf_map_lookup_elem#1
+8: (bf) r7 = r0
+9: (15) if r7 == 0x0 goto pc+15
+10: (b7) r1 = 1
+11: (db) lock *(u64 *)(r7 +0) += r1
+12: (18) r1 = limit
+14: (79) r1 = *(u64 *)(r1 +0)
+15: (85) call twice
+16: (25) if r0 > 0x3e8 goto pc+6
+17: (61) r1 = *(u32 *)(r6 +0)
+18: (18) r2 = 0x123456789abcdef
+20: (7b) *(u64 *)(r7 +0) = r2
+21: (04) w1 += 7
+22: (66) if w1 s> 0x2 goto pc+2
+23: (b4) w0 = 1
+24: (95) exit
+25: (b4) w0 = 2
+26: (95) exit
+`,
+	}
+	if len(funcs) != len(want) {
+		t.Fatalf("got %v functions, want %v", len(funcs), len(want))
+	}
+	for _, fn := range funcs {
+		name := fn.Section + "/" + fn.Name
+		got := new(strings.Builder)
+		got.WriteString("\n")
+		for _, insn := range fn.Insns {
+			fmt.Fprintf(got, "%v: %v\n", insn.Pos, insn.Text)
+		}
+		if got.String() != want[name] {
+			t.Errorf("function %v:\n%s\nwant:\n%s", name, got, want[name])
+		}
+	}
+	if _, err := Disassemble([]byte("not an object"), nil); err == nil {
+		t.Errorf("no error for a corrupted object")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		insns []insn
+		want  string
+	}{
+		{[]insn{{code: 0x87, dst: 3}}, "(87) r3 = -r3"},
+		{[]insn{{code: 0x84, dst: 3}}, "(84) w3 = -w3"},
+		{[]insn{{code: 0xdc, dst: 2, imm: 16}}, "(dc) r2 = be16 r2"},
+		{[]insn{{code: 0xd4, dst: 2, imm: 32}}, "(d4) r2 = le32 r2"},
+		{[]insn{{code: 0xd7, dst: 2, imm: 64}}, "(d7) r2 = bswap64 r2"},
+		{[]insn{{code: 0xbf, dst: 1, src: 2, off: 8}}, "(bf) r1 = (s8)r2"},
+		{[]insn{{code: 0x3f, dst: 1, src: 2, off: 1}}, "(3f) r1 s/= r2"},
+		{[]insn{{code: 0x94, dst: 1, imm: 3, off: 1}}, "(94) w1 s%= 3"},
+		{[]insn{{code: 0x91, dst: 1, src: 2, off: -8}}, "(91) r1 = *(s8 *)(r2 -8)"},
+		{[]insn{{code: 0x72, dst: 10, off: -2, imm: 5}}, "(72) *(u8 *)(r10 -2) = 5"},
+		{[]insn{{code: 0x20, imm: 12}}, "(20) r0 = *(u32 *)skb[12]"},
+		{[]insn{{code: 0x48, src: 6, imm: 2}}, "(48) r0 = *(u16 *)skb[r6 + 2]"},
+		{[]insn{{code: 0xc3, dst: 1, src: 2, imm: 0x51}}, "(c3) r2 = atomic_fetch_and((u32 *)(r1 +0), r2)"},
+		{[]insn{{code: 0xdb, dst: 1, src: 2, off: 8, imm: 0xa0}}, "(db) lock *(u64 *)(r1 +8) ^= r2"},
+		{[]insn{{code: 0xdb, dst: 1, src: 2, imm: 0xe1}}, "(db) r2 = atomic64_xchg((u64 *)(r1 +0), r2)"},
+		{[]insn{{code: 0xdb, dst: 1, src: 2, imm: 0xf1}}, "(db) r0 = atomic64_cmpxchg((u64 *)(r1 +0), r0, r2)"},
+		{[]insn{{code: 0xdb, dst: 1, src: 2, imm: 0x10}}, "(db) BUG_db"},
+		{[]insn{{code: 0x3d, dst: 1, src: 2, off: -3}}, "(3d) if r1 >= r2 goto pc-3"},
+		{[]insn{{code: 0xc6, dst: 1, off: 4, imm: -1}}, "(c6) if w1 s< 0xffffffff goto pc+4"},
+		{[]insn{{code: 0x06, imm: 100}}, "(06) gotol pc+100"},
+		{[]insn{{code: 0x85, src: pseudoCall, imm: 7}}, "(85) call pc+7"},
+		{[]insn{{code: 0x85, src: pseudoKfuncCall, imm: 1234}}, "(85) call kernel-function"},
+		{[]insn{{code: 0x85, imm: 1000}}, "(85) call unknown#1000"},
+		{[]insn{{code: 0x18, dst: 1, imm: -1}, {imm: 0}}, "(18) r1 = 0xffffffff"},
+		{[]insn{{code: 0x18, dst: 1}}, "(18) truncated instruction"},
+		{[]insn{{code: 0xff}}, "(ff) BUG_ff"},
+	}
+	for _, test := range tests {
+		var code []byte
+		for _, in := range test.insns {
+			buf := make([]byte, insnSize)
+			buf[0] = in.code
+			buf[1] = in.src<<4 | in.dst
+			binary.LittleEndian.PutUint16(buf[2:], uint16(in.off))
+			binary.LittleEndian.PutUint32(buf[4:], uint32(in.imm))
+			code = append(code, buf...)
+		}
+		d := &disasm{
+			order:  binary.LittleEndian,
+			relocs: make(map[int]*reloc),
+			funcAt: func(string, int) string { return "" },
+		}
+		if got, _ := d.insn(code, 0); got != test.want {
+			t.Errorf("%+v: got %q, want %q", test.insns, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+; Source of prog.o, regenerate it with:
+;   llc -march=bpfel -mcpu=v3 -filetype=obj prog.ll -o prog.o
+
+target datalayout = "e-m:e-p:64:64-i64:64-i128:128-n32:64-S128"
+target triple = "bpfel"
+
+%struct.bpf_map_def = type { i32, i32, i32, i32, i32 }
+
+@counts = dso_local global %struct.bpf_map_def { i32 1, i32 4, i32 8, i32 16, i32 0 }, section "maps", align 4
+@limit = dso_local global i64 100, section ".data", align 8
+@_license = dso_local global [4 x i8] c"GPL\00", section "license", align 1
+
+define internal i64 @twice(i64 %x) noinline {
+  %r = shl i64 %x, 1
+  %s = ashr i64 %r, 3
+  %m = mul i64 %s, -5
+  ret i64 %m
+}
+
+define dso_local i32 @prog(i8* %ctx) section "xdp" {
+entry:
+  %key = alloca i32, align 4
+  store i32 0, i32* %key, align 4
+  %keyp = bitcast i32* %key to i8*
+  %val = call i8* inttoptr (i64 1 to i8* (i8*, i8*)*)(i8* bitcast (%struct.bpf_map_def* @counts to i8*), i8* %keyp)
+  %isnull = icmp eq i8* %val, null
+  br i1 %isnull, label %out, label %found
+found:
+  %cnt = bitcast i8* %val to i64*
+  %old = atomicrmw add i64* %cnt, i64 1 seq_cst
+  %lim = load i64, i64* @limit
+  %t = call i64 @twice(i64 %lim)
+  %c = icmp ugt i64 %t, 1000
+  br i1 %c, label %drop, label %big
+big:
+  %ctx32 = bitcast i8* %ctx to i32*
+  %d = load i32, i32* %ctx32
+  %d2 = add i32 %d, 7
+  %cmp = icmp slt i32 %d2, 3
+  store volatile i64 81985529216486895, i64* %cnt
+  br i1 %cmp, label %drop, label %out
+drop:
+  ret i32 1
+out:
+  ret i32 2
+}
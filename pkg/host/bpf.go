@@ -0,0 +1,41 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package host
+
+import (
+	"github.com/google/syzkaller/prog"
+)
+
+// BpfProber probes the BPF program types, map types and helpers supported by the kernel.
+// It implements prog.BpfProber.
+type BpfProber struct{}
+
+var (
+	probeBpfProgType func(progType, attachType uint64) string
+	probeBpfMapType  func(m *prog.BpfMapProbe) string
+	probeBpfHelper   func(progType, attachType uint64, helper int) string
+)
+
+const bpfProbeUnsupported = "BPF probing is not implemented in syzkaller"
+
+func (BpfProber) ProbeProgType(progType, attachType uint64) string {
+	if probeBpfProgType == nil {
+		return bpfProbeUnsupported
+	}
+	return probeBpfProgType(progType, attachType)
+}
+
+func (BpfProber) ProbeMapType(m *prog.BpfMapProbe) string {
+	if probeBpfMapType == nil {
+		return bpfProbeUnsupported
+	}
+	return probeBpfMapType(m)
+}
+
+func (BpfProber) ProbeHelper(progType, attachType uint64, helper int) string {
+	if probeBpfHelper == nil {
+		return bpfProbeUnsupported
+	}
+	return probeBpfHelper(progType, attachType, helper)
+}
@@ -0,0 +1,213 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package host
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/google/syzkaller/prog"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	probeBpfProgType = probeProgType
+	probeBpfMapType = probeMapType
+	probeBpfHelper = probeHelper
+}
+
+type bpfInsn struct {
+	code uint8
+	regs uint8
+	off  int16
+	imm  int32
+}
+
+var (
+	bpfMovR0Zero = bpfInsn{code: 0xb7} // BPF_ALU64 | BPF_MOV | BPF_K
+	bpfExit      = bpfInsn{code: 0x95} // BPF_JMP | BPF_EXIT
+)
+
+type bpfProgLoadAttr struct {
+	progType           uint32
+	insnCnt            uint32
+	insns              uint64
+	license            uint64
+	logLevel           uint32
+	logSize            uint32
+	logBuf             uint64
+	kernVersion        uint32
+	progFlags          uint32
+	name               [16]byte
+	ifindex            uint32
+	expectedAttachType uint32
+}
+
+type bpfMapCreateAttr struct {
+	mapType      uint32
+	keySize      uint32
+	valSize      uint32
+	maxEntries   uint32
+	flags        uint32
+	innerMapFd   uint32
+	numaNode     uint32
+	name         [16]byte
+	ifindex      uint32
+	btfFd        uint32
+	btfKeyTypeID uint32
+	btfValTypeID uint32
+}
+
+type bpfBtfLoadAttr struct {
+	btf      uint64
+	logBuf   uint64
+	btfSize  uint32
+	logSize  uint32
+	logLevel uint32
+	_        uint32
+}
+
+// btfIntBlob is a raw BTF blob describing a single type id 1 "int".
+type btfIntBlob struct {
+	magic   uint16
+	version uint8
+	flags   uint8
+	hdrLen  uint32
+	typeOff uint32
+	typeLen uint32
+	strOff  uint32
+	strLen  uint32
+	nameOff uint32
+	info    uint32
+	size    uint32
+	intData uint32
+	strs    [5]byte
+}
+
+var bpfMemlockOnce sync.Once
+
+func bpfSyscall(cmd uintptr, attr unsafe.Pointer, size uintptr) (int, syscall.Errno) {
+	// Older kernels charge BPF objects against RLIMIT_MEMLOCK.
+	bpfMemlockOnce.Do(func() {
+		unix.Setrlimit(unix.RLIMIT_MEMLOCK, &unix.Rlimit{Cur: unix.RLIM_INFINITY, Max: unix.RLIM_INFINITY})
+	})
+	fd, _, errno := syscall.Syscall(unix.SYS_BPF, cmd, uintptr(attr), size)
+	return int(fd), errno
+}
+
+// loadBpfProg loads the instructions as a program of the given type and returns the verifier log.
+func loadBpfProg(progType, attachType uint64, insns []bpfInsn) (string, syscall.Errno) {
+	license := []byte("GPL\x00")
+	log := make([]byte, 64<<10)
+	attr := &bpfProgLoadAttr{
+		progType:           uint32(progType),
+		insnCnt:            uint32(len(insns)),
+		insns:              uint64(uintptr(unsafe.Pointer(&insns[0]))),
+		license:            uint64(uintptr(unsafe.Pointer(&license[0]))),
+		logLevel:           1,
+		logSize:            uint32(len(log)),
+		logBuf:             uint64(uintptr(unsafe.Pointer(&log[0]))),
+		expectedAttachType: uint32(attachType),
+	}
+	fd, errno := bpfSyscall(unix.BPF_PROG_LOAD, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	runtime.KeepAlive(insns)
+	runtime.KeepAlive(license)
+	if errno == 0 {
+		syscall.Close(fd)
+	}
+	if n := bytes.IndexByte(log, 0); n != -1 {
+		log = log[:n]
+	}
+	return string(log), errno
+}
+
+func probeProgType(progType, attachType uint64) string {
+	log, errno := loadBpfProg(progType, attachType, []bpfInsn{bpfMovR0Zero, bpfExit})
+	// Unknown program types are rejected before the verifier runs. Programs that need
+	// an attach target are rejected by the verifier, so they still leave a log.
+	if errno != syscall.EINVAL || log != "" {
+		return ""
+	}
+	return fmt.Sprintf("BPF_PROG_LOAD failed: %v", errno)
+}
+
+func probeHelper(progType, attachType uint64, helper int) string {
+	call := bpfInsn{code: 0x85, imm: int32(helper)} // BPF_JMP | BPF_CALL
+	log, errno := loadBpfProg(progType, attachType, []bpfInsn{call, bpfMovR0Zero, bpfExit})
+	if errno == 0 {
+		return ""
+	}
+	for _, line := range bytes.Split([]byte(log), []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("invalid func ")) || bytes.HasPrefix(line, []byte("unknown func ")) {
+			return string(line)
+		}
+	}
+	return ""
+}
+
+func loadIntBtf() (int, syscall.Errno) {
+	blob := &btfIntBlob{
+		magic:   0xeb9f,
+		version: 1,
+		hdrLen:  24,
+		typeLen: 16,
+		strOff:  16,
+		strLen:  5,
+		nameOff: 1,
+		info:    1 << 24, // BTF_KIND_INT
+		size:    4,
+		intData: 1<<24 | 32, // BTF_INT_SIGNED, 32 bits
+		strs:    [5]byte{0, 'i', 'n', 't', 0},
+	}
+	attr := &bpfBtfLoadAttr{
+		btf:     uint64(uintptr(unsafe.Pointer(blob))),
+		btfSize: uint32(unsafe.Offsetof(blob.strs) + uintptr(len(blob.strs))),
+	}
+	fd, errno := bpfSyscall(unix.BPF_BTF_LOAD, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	runtime.KeepAlive(blob)
+	return fd, errno
+}
+
+func createBpfMap(attr *bpfMapCreateAttr) (int, syscall.Errno) {
+	return bpfSyscall(unix.BPF_MAP_CREATE, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+}
+
+func probeMapType(m *prog.BpfMapProbe) string {
+	attr := &bpfMapCreateAttr{
+		mapType:    uint32(m.Type),
+		keySize:    uint32(m.KeySize),
+		valSize:    uint32(m.ValSize),
+		maxEntries: uint32(m.MaxEntries),
+		flags:      uint32(m.Flags),
+	}
+	if m.InnerMap {
+		inner, errno := createBpfMap(&bpfMapCreateAttr{mapType: unix.BPF_MAP_TYPE_ARRAY, keySize: 4,
+			valSize: 4, maxEntries: 1})
+		if errno != 0 {
+			return fmt.Sprintf("failed to create inner map: %v", errno)
+		}
+		defer syscall.Close(inner)
+		attr.innerMapFd = uint32(inner)
+	}
+	if m.Btf {
+		btf, errno := loadIntBtf()
+		if errno != 0 {
+			return fmt.Sprintf("BPF_BTF_LOAD failed: %v", errno)
+		}
+		defer syscall.Close(btf)
+		attr.btfFd = uint32(btf)
+		attr.btfKeyTypeID = 1
+		attr.btfValTypeID = 1
+	}
+	fd, errno := createBpfMap(attr)
+	if errno != 0 {
+		return fmt.Sprintf("BPF_MAP_CREATE failed: %v", errno)
+	}
+	syscall.Close(fd)
+	return ""
+}
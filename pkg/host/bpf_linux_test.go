@@ -0,0 +1,39 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package host
+
+import (
+	"testing"
+
+	"github.com/google/syzkaller/prog"
+	"golang.org/x/sys/unix"
+)
+
+func TestBpfProber(t *testing.T) {
+	if _, errno := loadBpfProg(unix.BPF_PROG_TYPE_SOCKET_FILTER, 0, []bpfInsn{bpfMovR0Zero, bpfExit}); errno != 0 {
+		t.Skipf("BPF is not usable: %v", errno)
+	}
+	prober := BpfProber{}
+	if reason := prober.ProbeProgType(unix.BPF_PROG_TYPE_SOCKET_FILTER, 0); reason != "" {
+		t.Fatalf("socket filter is not supported: %v", reason)
+	}
+	if reason := prober.ProbeProgType(1<<20, 0); reason == "" {
+		t.Fatalf("unknown program type is supported")
+	}
+	// BPF_FUNC_get_prandom_u32.
+	if reason := prober.ProbeHelper(unix.BPF_PROG_TYPE_SOCKET_FILTER, 0, 7); reason != "" {
+		t.Fatalf("bpf_get_prandom_u32 is not supported: %v", reason)
+	}
+	if reason := prober.ProbeHelper(unix.BPF_PROG_TYPE_SOCKET_FILTER, 0, 1<<20); reason == "" {
+		t.Fatalf("unknown helper is supported")
+	}
+	if reason := prober.ProbeMapType(&prog.BpfMapProbe{Type: unix.BPF_MAP_TYPE_HASH, KeySize: 4,
+		ValSize: 4, MaxEntries: 1}); reason != "" {
+		t.Fatalf("hash map is not supported: %v", reason)
+	}
+	if reason := prober.ProbeMapType(&prog.BpfMapProbe{Type: 1 << 20, KeySize: 4,
+		ValSize: 4, MaxEntries: 1}); reason == "" {
+		t.Fatalf("unknown map type is supported")
+	}
+}
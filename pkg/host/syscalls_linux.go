@@ -289,39 +289,46 @@ func isSyzUsbIPSupported(c *prog.Syscall, target *prog.Target, sandbox string) (
 }
 
 var syzkallSupport = map[string]func(*prog.Syscall, *prog.Target, string) (bool, string){
-	"syz_open_dev":                isSyzOpenDevSupported,
-	"syz_open_procfs":             isSyzOpenProcfsSupported,
-	"syz_open_pts":                alwaysSupported,
-	"syz_execute_func":            alwaysSupported,
-	"syz_emit_ethernet":           isNetInjectionSupported,
-	"syz_extract_tcp_res":         isNetInjectionSupported,
-	"syz_usb_connect":             isSyzUsbSupported,
-	"syz_usb_connect_ath9k":       isSyzUsbSupported,
-	"syz_usb_disconnect":          isSyzUsbSupported,
-	"syz_usb_control_io":          isSyzUsbSupported,
-	"syz_usb_ep_write":            isSyzUsbSupported,
-	"syz_usb_ep_read":             isSyzUsbSupported,
-	"syz_kvm_setup_cpu":           isSyzKvmSetupCPUSupported,
-	"syz_emit_vhci":               isVhciInjectionSupported,
-	"syz_init_net_socket":         isSyzInitNetSocketSupported,
-	"syz_genetlink_get_family_id": isSyzGenetlinkGetFamilyIDSupported,
-	"syz_mount_image":             isSyzMountImageSupported,
-	"syz_read_part_table":         isSyzReadPartTableSupported,
-	"syz_io_uring_submit":         isSyzIoUringSupported,
-	"syz_io_uring_complete":       isSyzIoUringSupported,
-	"syz_io_uring_setup":          isSyzIoUringSupported,
-	"syz_memcpy_off":              isSyzMemcpySupported,
-	"syz_btf_id_by_name":          isBtfVmlinuxSupported,
-	"syz_fuse_handle_req":         isSyzFuseSupported,
-	"syz_80211_inject_frame":      isWifiEmulationSupported,
-	"syz_80211_join_ibss":         isWifiEmulationSupported,
-	"syz_usbip_server_init":       isSyzUsbIPSupported,
-	"syz_clone":                   alwaysSupported,
-	"syz_clone3":                  alwaysSupported,
-	"syz_bpf_prog_open":           alwaysSupported,
-	"syz_bpf_prog_load":           alwaysSupported,
-	"syz_bpf_prog_attach":         alwaysSupported,
-	"syz_bpf_prog_run_cnt":        alwaysSupported,
+	"syz_open_dev":                 isSyzOpenDevSupported,
+	"syz_open_procfs":              isSyzOpenProcfsSupported,
+	"syz_open_pts":                 alwaysSupported,
+	"syz_execute_func":             alwaysSupported,
+	"syz_emit_ethernet":            isNetInjectionSupported,
+	"syz_extract_tcp_res":          isNetInjectionSupported,
+	"syz_usb_connect":              isSyzUsbSupported,
+	"syz_usb_connect_ath9k":        isSyzUsbSupported,
+	"syz_usb_disconnect":           isSyzUsbSupported,
+	"syz_usb_control_io":           isSyzUsbSupported,
+	"syz_usb_ep_write":             isSyzUsbSupported,
+	"syz_usb_ep_read":              isSyzUsbSupported,
+	"syz_kvm_setup_cpu":            isSyzKvmSetupCPUSupported,
+	"syz_emit_vhci":                isVhciInjectionSupported,
+	"syz_init_net_socket":          isSyzInitNetSocketSupported,
+	"syz_genetlink_get_family_id":  isSyzGenetlinkGetFamilyIDSupported,
+	"syz_mount_image":              isSyzMountImageSupported,
+	"syz_read_part_table":          isSyzReadPartTableSupported,
+	"syz_io_uring_submit":          isSyzIoUringSupported,
+	"syz_io_uring_complete":        isSyzIoUringSupported,
+	"syz_io_uring_setup":           isSyzIoUringSupported,
+	"syz_memcpy_off":               isSyzMemcpySupported,
+	"syz_btf_id_by_name":           isBtfVmlinuxSupported,
+	"syz_fuse_handle_req":          isSyzFuseSupported,
+	"syz_80211_inject_frame":       isWifiEmulationSupported,
+	"syz_80211_join_ibss":          isWifiEmulationSupported,
+	"syz_usbip_server_init":        isSyzUsbIPSupported,
+	"syz_clone":                    alwaysSupported,
+	"syz_clone3":                   alwaysSupported,
+	"syz_bpf_prog_open":            alwaysSupported,
+	"syz_bpf_prog_load":            alwaysSupported,
+	"syz_bpf_prog_attach":          alwaysSupported,
+	"syz_bpf_prog_attach_cgroup":   alwaysSupported,
+	"syz_bpf_cgroup_trigger":       alwaysSupported,
+	"syz_bpf_prog_run_cnt":         alwaysSupported,
+	"syz_bpf_prog_test_run_on_cpu": alwaysSupported,
+	"syz_bpf_prog_fault_trigger":   alwaysSupported,
+	"syz_bpf_prog_iter_read":       alwaysSupported,
+	"syz_bpf_timer_teardown":       alwaysSupported,
+	"syz_bpf_map_consume":          alwaysSupported,
 }
 
 func isSupportedSyzkall(c *prog.Syscall, target *prog.Target, sandbox string) (bool, string) {
@@ -132,6 +132,22 @@ type Config struct {
 	// eg. "0xffffffff81000000:0x10\n"
 	CovFilter covFilterCfg `json:"cover_filter,omitempty"`
 
+	// Classes of the coverage of the BPF subsystem shown on the summary and /brf pages.
+	// Each class has regexps of kernel source files and functions like cover_filter,
+	// and a PC belongs to the first class with a matching file or function.
+	// eg. "brf_cover_classes": [{"name": "verifier", "files": ["^kernel/bpf/verifier.c$"]}].
+	// By default the classes are verifier, jit, helpers, maps and attach.
+	BrfCoverClasses []BrfCoverClass `json:"brf_cover_classes,omitempty"`
+	// Percentage of new inputs admitted to the corpus when all their new coverage
+	// is in the "verifier" class (default: 100). Lower values keep the corpus from
+	// filling with programs that only explore verifier branches.
+	BrfVerifierWeight int `json:"brf_verifier_weight"`
+	// Host directory shared with the VMs as /mnt/bpf_prog, where the fuzzer stores the
+	// source, the object and the model of every BPF program it generates. The corpus and
+	// crash pages show the programs from there. If not set, it is the path of the
+	// -virtfs option with mount_tag=host0 in qemu_args.
+	BrfProgDir string `json:"brf_prog_dir,omitempty"`
+
 	// Reproduce, localize and minimize crashers (default: true).
 	Reproduce bool `json:"reproduce"`
 
@@ -178,6 +194,12 @@ type Subsystem struct {
 	Paths []string `json:"path"`
 }
 
+type BrfCoverClass struct {
+	Name      string   `json:"name"`
+	Files     []string `json:"files,omitempty"`
+	Functions []string `json:"functions,omitempty"`
+}
+
 type covFilterCfg struct {
 	Files     []string `json:"files,omitempty"`
 	Functions []string `json:"functions,omitempty"`
@@ -4,6 +4,7 @@
 package mgrconfig
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -86,9 +87,73 @@ func defaultValues() *Config {
 		MaxCrashLogs:   100,
 		Procs:          6,
 		PreserveCorpus: true,
+
+		BrfVerifierWeight: 100,
 	}
 }
 
+// defaultBrfCoverClasses splits the coverage of the BPF subsystem into the verifier,
+// the JIT and interpreter, helpers, map implementations and program attach and dispatch.
+var defaultBrfCoverClasses = []BrfCoverClass{
+	{
+		Name: "verifier",
+		Files: []string{
+			"^kernel/bpf/(verifier|tnum|log|btf|disasm)\\.c$",
+		},
+		Functions: []string{
+			"_is_valid_access$",
+			"_convert_ctx_access$",
+			"_gen_prologue$",
+			"_btf_struct_access$",
+		},
+	},
+	{
+		Name: "jit",
+		Files: []string{
+			"^arch/[^/]+/net/",
+		},
+		Functions: []string{
+			"^bpf_int_jit_compile$",
+			"^bpf_jit_",
+			"^_+bpf_prog_run",
+		},
+	},
+	{
+		Name: "helpers",
+		Files: []string{
+			"^kernel/bpf/helpers\\.c$",
+			"^kernel/trace/bpf_trace\\.c$",
+			"^net/core/filter\\.c$",
+		},
+	},
+	{
+		Name: "maps",
+		Files: []string{
+			"^kernel/bpf/(arraymap|hashtab|lpm_trie|queue_stack_maps|ringbuf|devmap|cpumap|bloom_filter)\\.c$",
+			"^kernel/bpf/(local_storage|bpf_local_storage|bpf_inode_storage|bpf_task_storage)\\.c$",
+			"^kernel/bpf/(stackmap|reuseport_array|map_in_map|map_iter|percpu_freelist|bpf_lru_list)\\.c$",
+			"^net/core/(sock_map|bpf_sk_storage)\\.c$",
+			"^net/xdp/xskmap\\.c$",
+		},
+	},
+	{
+		Name: "attach",
+		Files: []string{
+			"^kernel/bpf/(syscall|cgroup|trampoline|dispatcher|net_namespace|offload|bpf_lsm)\\.c$",
+			"^kernel/bpf/(bpf_iter|task_iter|prog_iter|link_iter)\\.c$",
+			"^net/bpf/test_run\\.c$",
+			"^net/sched/(cls|act)_bpf\\.c$",
+			"^net/core/lwt_bpf\\.c$",
+		},
+		Functions: []string{
+			"^dev_xdp_",
+			"^do_xdp_generic$",
+			"^netif_receive_generic_xdp$",
+			"^bpf_prog_run_generic_xdp$",
+		},
+	},
+}
+
 func loadPartial(cfg *Config) (*Config, error) {
 	var err error
 	cfg.TargetOS, cfg.TargetVMArch, cfg.TargetArch, err = splitTarget(cfg.RawTarget)
@@ -171,6 +236,10 @@ func Complete(cfg *Config) error {
 	if cfg.FuzzingVMs < 0 {
 		return fmt.Errorf("fuzzing_vms cannot be less than 0")
 	}
+	if err := cfg.completeBrfCoverClasses(); err != nil {
+		return err
+	}
+	cfg.completeBrfProgDir()
 
 	var err error
 	cfg.Syscalls, err = ParseEnabledSyscalls(cfg.Target, cfg.EnabledSyscalls, cfg.DisabledSyscalls)
@@ -181,6 +250,65 @@ func Complete(cfg *Config) error {
 	return nil
 }
 
+func (cfg *Config) completeBrfCoverClasses() error {
+	if len(cfg.BrfCoverClasses) == 0 {
+		cfg.BrfCoverClasses = defaultBrfCoverClasses
+	}
+	names := make(map[string]bool)
+	for _, class := range cfg.BrfCoverClasses {
+		if class.Name == "" || names[class.Name] {
+			return fmt.Errorf("brf_cover_classes must have unique non-empty names")
+		}
+		names[class.Name] = true
+		for _, re := range append(append([]string{}, class.Files...), class.Functions...) {
+			if _, err := regexp.Compile(re); err != nil {
+				return fmt.Errorf("bad brf_cover_classes regexp %q: %v", re, err)
+			}
+		}
+	}
+	if cfg.BrfVerifierWeight < 0 || cfg.BrfVerifierWeight > 100 {
+		return fmt.Errorf("bad config param brf_verifier_weight: '%v', want [0, 100]", cfg.BrfVerifierWeight)
+	}
+	return nil
+}
+
+func (cfg *Config) completeBrfProgDir() {
+	if cfg.BrfProgDir == "" && cfg.Type == "qemu" {
+		vm := struct {
+			QemuArgs string `json:"qemu_args"`
+		}{}
+		if err := json.Unmarshal(cfg.VM, &vm); err == nil {
+			cfg.BrfProgDir = virtfsPath(vm.QemuArgs, "host0")
+		}
+	}
+	if cfg.BrfProgDir != "" {
+		cfg.BrfProgDir = osutil.Abs(cfg.BrfProgDir)
+	}
+}
+
+// virtfsPath returns the host path of the -virtfs option of qemu args with the mount tag.
+func virtfsPath(args, tag string) string {
+	fields := strings.Fields(args)
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] != "-virtfs" {
+			continue
+		}
+		path, tagged := "", false
+		for _, opt := range strings.Split(fields[i+1], ",") {
+			if strings.HasPrefix(opt, "path=") {
+				path = strings.TrimPrefix(opt, "path=")
+			}
+			if opt == "mount_tag="+tag {
+				tagged = true
+			}
+		}
+		if tagged {
+			return path
+		}
+	}
+	return ""
+}
+
 func (cfg *Config) initTimeouts() {
 	slowdown := 1
 	switch {
@@ -4,6 +4,8 @@
 package mgrconfig_test
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"path/filepath"
 	"testing"
 
@@ -63,3 +65,41 @@ func TestMatchSyscall(t *testing.T) {
 		}
 	}
 }
+
+func TestBrfProgDir(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "qemu.cfg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		qemuArgs string
+		progDir  string
+		result   string
+	}{
+		{"-enable-kvm -virtfs local,path=/srv/bpf,mount_tag=host0,security_model=none", "", "/srv/bpf"},
+		{"-virtfs local,path=/srv/other,mount_tag=host1 -virtfs local,path=/srv/bpf,mount_tag=host0", "", "/srv/bpf"},
+		{"-virtfs local,path=/srv/bpf,mount_tag=host0", "/srv/progs", "/srv/progs"},
+		{"-enable-kvm", "", ""},
+	}
+	for i, test := range tests {
+		raw := make(map[string]interface{})
+		if err := json.Unmarshal(data, &raw); err != nil {
+			t.Fatal(err)
+		}
+		raw["vm"].(map[string]interface{})["qemu_args"] = test.qemuArgs
+		if test.progDir != "" {
+			raw["brf_prog_dir"] = test.progDir
+		}
+		cfgData, err := json.Marshal(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := LoadData(cfgData)
+		if err != nil {
+			t.Fatalf("#%v: %v", i, err)
+		}
+		if cfg.BrfProgDir != test.result {
+			t.Errorf("#%v: brf_prog_dir %q, want %q", i, cfg.BrfProgDir, test.result)
+		}
+	}
+}
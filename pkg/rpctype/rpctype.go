@@ -9,13 +9,16 @@ import (
 	"github.com/google/syzkaller/pkg/host"
 	"github.com/google/syzkaller/pkg/ipc"
 	"github.com/google/syzkaller/pkg/signal"
+	"github.com/google/syzkaller/prog"
 )
 
 type Input struct {
-	Call   string
-	Prog   []byte
-	Signal signal.Serial
-	Cover  []uint32
+	Call          string
+	Prog          []byte
+	Signal        signal.Serial
+	Cover         []uint32
+	BpfTrace      []byte   // generation trace of the BPF program opened by Prog
+	BpfCategories []string // program type, helpers and map types of the BPF program
 }
 
 type Candidate struct {
@@ -54,6 +57,7 @@ type CheckArgs struct {
 	DisabledCalls map[string][]SyscallReason
 	Features      *host.Features
 	GlobFiles     map[string][]string
+	BrfFeatures   *prog.BpfFeatures
 }
 
 type SyscallReason struct {
@@ -66,6 +70,12 @@ type NewInputArgs struct {
 	Input
 }
 
+type NewInputRes struct {
+	// Dropped is set if the manager did not admit the input to the corpus because it only adds
+	// BPF verifier coverage.
+	Dropped bool
+}
+
 type PollArgs struct {
 	Name           string
 	NeedCandidates bool
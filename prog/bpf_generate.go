@@ -2,15 +2,17 @@ package prog
 
 import (
 	"bytes"
-	"encoding/gob"
 	"fmt"
 	"os"
 	"os/exec"
 	"regexp"
-	"time"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/syzkaller/pkg/bcc"
+	"github.com/google/syzkaller/pkg/hash"
 	"github.com/google/syzkaller/pkg/osutil"
 )
 
@@ -33,6 +35,66 @@ type SecDef struct {
 	Sleepable  bool
 }
 
+// The fault area is user memory that syz_bpf_prog_fault_trigger maps afresh right before
+// it triggers a sleepable program, so the first access to each page faults.
+const (
+	BpfFaultAreaAddr = 0x30000000
+	BpfFaultAreaSize = 16 << 12
+)
+
+// bpfUserPtrArgs are the arguments of helpers that read user memory from the address.
+var bpfUserPtrArgs = map[string]int{
+	"BPF_FUNC_copy_from_user":      2,
+	"BPF_FUNC_copy_from_user_task": 2,
+	"BPF_FUNC_probe_read_user":     2,
+	"BPF_FUNC_probe_read_user_str": 2,
+}
+
+// cgroupAttachTypes maps the sections of cgroup programs to the attach types used
+// to attach them to a cgroup.
+var cgroupAttachTypes = map[string]string{
+	"sockops":             "BPF_CGROUP_SOCK_OPS",
+	"cgroup_skb/ingress":  "BPF_CGROUP_INET_INGRESS",
+	"cgroup_skb/egress":   "BPF_CGROUP_INET_EGRESS",
+	"cgroup/skb":          "BPF_CGROUP_INET_INGRESS",
+	"cgroup/sock_create":  "BPF_CGROUP_INET_SOCK_CREATE",
+	"cgroup/sock_release": "BPF_CGROUP_INET_SOCK_RELEASE",
+	"cgroup/sock":         "BPF_CGROUP_INET_SOCK_CREATE",
+	"cgroup/post_bind4":   "BPF_CGROUP_INET4_POST_BIND",
+	"cgroup/post_bind6":   "BPF_CGROUP_INET6_POST_BIND",
+	"cgroup/dev":          "BPF_CGROUP_DEVICE",
+	"cgroup/getsockopt":   "BPF_CGROUP_GETSOCKOPT",
+	"cgroup/setsockopt":   "BPF_CGROUP_SETSOCKOPT",
+	"cgroup/bind4":        "BPF_CGROUP_INET4_BIND",
+	"cgroup/bind6":        "BPF_CGROUP_INET6_BIND",
+	"cgroup/connect4":     "BPF_CGROUP_INET4_CONNECT",
+	"cgroup/connect6":     "BPF_CGROUP_INET6_CONNECT",
+	"cgroup/sendmsg4":     "BPF_CGROUP_UDP4_SENDMSG",
+	"cgroup/sendmsg6":     "BPF_CGROUP_UDP6_SENDMSG",
+	"cgroup/recvmsg4":     "BPF_CGROUP_UDP4_RECVMSG",
+	"cgroup/recvmsg6":     "BPF_CGROUP_UDP6_RECVMSG",
+	"cgroup/getpeername4": "BPF_CGROUP_INET4_GETPEERNAME",
+	"cgroup/getpeername6": "BPF_CGROUP_INET6_GETPEERNAME",
+	"cgroup/getsockname4": "BPF_CGROUP_INET4_GETSOCKNAME",
+	"cgroup/getsockname6": "BPF_CGROUP_INET6_GETSOCKNAME",
+	"cgroup/sysctl":       "BPF_CGROUP_SYSCTL",
+}
+
+// expectedAttachTypes maps the sections of other programs that libbpf loads with an
+// expected attach type to it.
+var expectedAttachTypes = map[string]string{
+	"sk_skb/stream_parser":  "BPF_SK_SKB_STREAM_PARSER",
+	"sk_skb/stream_verdict": "BPF_SK_SKB_STREAM_VERDICT",
+	"sk_msg":                "BPF_SK_MSG_VERDICT",
+	"sk_lookup":             "BPF_SK_LOOKUP",
+}
+
+// helperAttachTypes maps the helpers that the func proto of the program type only returns
+// for some expected attach types to them.
+var helperAttachTypes = map[string][]string{
+	"BPF_FUNC_bind": {"BPF_CGROUP_INET4_CONNECT", "BPF_CGROUP_INET6_CONNECT"},
+}
+
 type BpfProgTypeDef struct {
 	Name       string
 	User       string
@@ -82,6 +144,51 @@ type BpfHelperFunc struct {
 	RetBtfId   string
 	GplOnly    bool
 	PktAccess  bool
+	Kfunc      bool
+	Sleepable  bool   // the helper may sleep, so only sleepable programs can call it
+	IterOnly   bool   // only iterator programs can call the helper
+	Decl       string // C declaration of a kfunc
+}
+
+// callName returns the name used to call the helper or kfunc in the program source.
+func (h *BpfHelperFunc) callName() string {
+	if h.Kfunc {
+		return h.Name
+	}
+	return "bpf_" + h.Enum[9:]
+}
+
+// BpfRefClass is the class of kernel objects a reference-tracked helper or kfunc operates on.
+type BpfRefClass int
+
+const (
+	RefClassSocket BpfRefClass = iota
+	RefClassRingbufRecord
+	RefClassTask
+	RefClassCgroup
+	RefClassDynptr
+	RefClassKptr
+)
+
+// Where a release call added to fix a leaking reference is placed.
+const (
+	RefReleaseAppend   = iota // at the end of the program
+	RefReleasePostCall        // right after the call acquiring the reference
+)
+
+// RefRet is the RefArg of specs whose reference is the return value.
+const RefRet = -1
+
+// BpfRefSpec declares the reference semantics of a helper or kfunc.
+type BpfRefSpec struct {
+	Acquire   bool
+	Release   bool
+	Propagate bool // the return value refers to the same object as RefArg
+	Class     BpfRefClass
+	RefArg    int            // the argument holding the reference or RefRet
+	MapTypes  []string       // the reference is only tracked for calls on these map types
+	FixedArgs map[int]string // values of other arguments when a release call is added
+	Placement int            // placement of release calls, see RefRelease*
 }
 
 type BpfMap struct {
@@ -92,6 +199,7 @@ type BpfMap struct {
 	Val        *StructDef
 	MaxEntries int64
 	InnerMap   *BpfMap
+	Pinned     bool // pinned by name under the bpffs of the executor
 }
 
 func (m *BpfMap) getFlag(f string) int {
@@ -115,6 +223,30 @@ func (m *BpfMap) removeFlag(flag string) {
 	}
 }
 
+func (m *BpfMap) PinningStr() string {
+	// A map whose definition changed after it was named is no longer safe to share.
+	if m.Pinned && m.MapName == m.pinnedName() {
+		return "LIBBPF_PIN_BY_NAME"
+	}
+	return "LIBBPF_PIN_NONE"
+}
+
+// pinnedName derives the name a map is pinned under from its definition, so a pinned
+// map libbpf finds under that name is always compatible with the map reusing it.
+func (m *BpfMap) pinnedName() string {
+	def := fmt.Sprintf("%v %v %v %v %v", m.MapType, m.FlagsStr(), m.MaxEntries,
+		structDefFields(m.Key), structDefFields(m.Val))
+	sig := hash.Hash([]byte(def))
+	return fmt.Sprintf("pin_%08x", uint32(sig.Truncate64()))
+}
+
+func structDefFields(sd *StructDef) string {
+	if sd == nil {
+		return "-"
+	}
+	return "{" + strings.Join(sd.FieldTypes, ",") + "}"
+}
+
 func (m *BpfMap) FlagsStr() string {
 	flags := "0"
 	for _, f := range m.MapFlags {
@@ -131,6 +263,7 @@ const (
 	HintGenConstStr
 	HintGenXdpSockMap
 	HintGenSockMap
+	HintGenKptr
 )
 
 type BpfCallGenHint struct {
@@ -196,6 +329,8 @@ type BpfCall struct {
 	StackVarSize int
 	Hint         *BpfCallGenHint
 	PostCalls    []*BpfCall
+	ExitCond     string // if set, the call is also made before an early return taken when ExitCond holds
+	RetBtfId     string // BTF type of the returned pointer when it depends on the arguments
 }
 
 func NewBpfCall(helper *BpfHelperFunc, hint *BpfCallGenHint) *BpfCall {
@@ -211,11 +346,11 @@ func (call *BpfCall) getArgConstraints(s *BpfProgState) []string {
 	var constraints []string
 	for _, arg := range call.Args {
 		if arg.IsPktMetaAccess {
-			constraints = append(constraints, fmt.Sprintf("%v + %v < %v", s.CtxVars["data_meta"], arg.AccessSize, s.CtxVars["data"]))
+			constraints = append(constraints, fmt.Sprintf("%v + %v < %v", arg.Name, arg.AccessSize, s.CtxVars["data"]))
 			continue
 		}
 		if arg.IsPktAccess {
-			constraints = append(constraints, fmt.Sprintf("%v + %v < %v", s.CtxVars["data"], arg.AccessSize, s.CtxVars["data_end"]))
+			constraints = append(constraints, fmt.Sprintf("%v + %v < %v", arg.Name, arg.AccessSize, s.CtxVars["data_end"]))
 			continue
 		}
 		//if !arg.CanBeNull && !arg.IsNotNull && strings.Contains(arg.ArgType, "ARG_PTR_TO") {
@@ -263,6 +398,10 @@ func (sd *StructDef) offsetOfMember(mi int) int {
 		case "uint32_t": offset += 4
 		case "uint16_t": offset += 2
 		case "uint8_t": offset += 1
+		default:
+			if isKptrField(sd.FieldTypes[i]) {
+				offset += 8
+			}
 		}
 	}
 	return offset
@@ -277,6 +416,35 @@ func (sd *StructDef) findMember(m string) int {
 	return -1
 }
 
+// kptrTypes are the types of referenced kptrs that can be stored in map values.
+var kptrTypes = []string{"struct task_struct", "struct cgroup"}
+
+var kptrRefClasses = map[string]BpfRefClass{
+	"struct task_struct": RefClassTask,
+	"struct cgroup":      RefClassCgroup,
+}
+
+func kptrField(typ string) string {
+	return fmt.Sprintf("%v __kptr *", typ)
+}
+
+func isKptrField(ft string) bool {
+	return strings.HasSuffix(ft, " __kptr *")
+}
+
+func kptrFieldType(ft string) string {
+	return strings.TrimSuffix(ft, " __kptr *")
+}
+
+func (sd *StructDef) findKptrMember() int {
+	for i, mt := range sd.FieldTypes {
+		if isKptrField(mt) {
+			return i
+		}
+	}
+	return -1
+}
+
 func occupiedSize(hints map[ArgHint]bool) int {
 	occupied := 0
 	if _, ok := hints[HintGenSpinlock]; ok {
@@ -288,6 +456,9 @@ func occupiedSize(hints map[ArgHint]bool) int {
 	if _, ok := hints[HintGenConstStr]; ok {
 		occupied += 8
 	}
+	if _, ok := hints[HintGenKptr]; ok {
+		occupied += 8
+	}
 	return occupied
 }
 
@@ -301,12 +472,28 @@ type BpfProgState struct {
 	Externs     map[string]string
 	CtxVars     map[string]string
 	CtxTypes    map[string]string
+	Callbacks   map[string]string // definitions of the static functions passed to helpers, by name
+	CtxAccesses []string          // statements writing ctx fields or loading parts of them, run before the calls
 	RetVal      int
 	SecStr      string
 	Sec         SecDef
 	prog        *bcc.Module
 	Path        string
 	AttachOpt   BpfAttachOption
+	Trace       []BpfTraceEvent
+	gen         *bpfGenCtx
+}
+
+// bpfGenCtx is the state of the generation or mutation of a program in progress. A new one
+// is started for every GenBpfProg, MutBpfProg and FixRef, so nothing is carried over from
+// earlier, possibly failed, attempts on the same program.
+type bpfGenCtx struct {
+	rd int // recursion depth of genBpfHelperCall
+}
+
+// beginGen starts a new generation or mutation of the program.
+func (s *BpfProgState) beginGen() {
+	s.gen = new(bpfGenCtx)
 }
 
 func NewBpfProgState(brf *BpfRuntimeFuzzer, pt *BpfProgTypeDef, r *randGen) *BpfProgState {
@@ -316,6 +503,8 @@ func NewBpfProgState(brf *BpfRuntimeFuzzer, pt *BpfProgTypeDef, r *randGen) *Bpf
 		Externs: make(map[string]string),
 		CtxVars: make(map[string]string),
 		CtxTypes: make(map[string]string),
+		Callbacks: make(map[string]string),
+		gen: new(bpfGenCtx),
 	}
 	if r != nil {
 		newProgState.RetVal = genRandReturnVal(r, pt.Enum)
@@ -331,6 +520,159 @@ func NewBpfProgState(brf *BpfRuntimeFuzzer, pt *BpfProgTypeDef, r *randGen) *Bpf
 	return newProgState
 }
 
+// TrampolineSyscall returns the syscall the program is attached to through a trampoline,
+// or "" if the program is not attached to a syscall.
+func (s *BpfProgState) TrampolineSyscall() string {
+	const prefix = "__x64_sys_"
+	i := strings.Index(s.SecStr, prefix)
+	if i == -1 {
+		return ""
+	}
+	name := s.SecStr[i+len(prefix):]
+	if end := strings.IndexByte(name, '"'); end != -1 {
+		name = name[:end]
+	}
+	return name
+}
+
+// iterCtx returns the iterator kind of an iterator program, or nil for other programs.
+func (s *BpfProgState) iterCtx() *TracingIterCtx {
+	for _, prefix := range []string{"\"iter/", "\"iter.s/"} {
+		i := strings.Index(s.SecStr, prefix)
+		if i == -1 {
+			continue
+		}
+		name := s.SecStr[i+len(prefix):]
+		if end := strings.IndexByte(name, '"'); end != -1 {
+			name = name[:end]
+		}
+		for i := range tracingIterCtxs {
+			if tracingIterCtxs[i].Name == name {
+				return &tracingIterCtxs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// IterMap returns the index of the map walked by a map iterator program in Maps, or -1.
+func (s *BpfProgState) IterMap() int {
+	iter := s.iterCtx()
+	if iter == nil {
+		return -1
+	}
+	for i, m := range s.Maps {
+		for _, typ := range iter.MapTypes {
+			if m.MapType == typ {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// TimerMaps returns the indexes of the maps in Maps whose values embed a timer.
+func (s *BpfProgState) TimerMaps() []int {
+	var maps []int
+	for i, m := range s.Maps {
+		if m.Val != nil && m.Val.findMember("struct bpf_timer") != -1 {
+			maps = append(maps, i)
+		}
+	}
+	return maps
+}
+
+// OutputMaps returns the indexes of the ringbuf and perf event array maps in Maps.
+func (s *BpfProgState) OutputMaps() []int {
+	var maps []int
+	for i, m := range s.Maps {
+		if m.MapType == "BPF_MAP_TYPE_RINGBUF" || m.MapType == "BPF_MAP_TYPE_PERF_EVENT_ARRAY" {
+			maps = append(maps, i)
+		}
+	}
+	return maps
+}
+
+// IsCgroupIter returns whether the program is an iterator walking a cgroup hierarchy.
+func (s *BpfProgState) IsCgroupIter() bool {
+	iter := s.iterCtx()
+	return iter != nil && iter.Cgroup
+}
+
+// genIterMap adds a map the iterator program can walk, unless there is one already.
+func (s *BpfProgState) genIterMap(r *randGen, iter *TracingIterCtx) {
+	if s.IterMap() != -1 {
+		return
+	}
+	var mapTypes []BpfMapType
+	for _, mt := range s.brf.mapTypes {
+		for _, typ := range iter.MapTypes {
+			if mt.Type == typ {
+				mapTypes = append(mapTypes, mt)
+			}
+		}
+	}
+	if len(mapTypes) == 0 {
+		return
+	}
+	s.NewMap(mapTypes[r.Intn(len(mapTypes))], newBpfCallGenHint(nil), 0, r)
+}
+
+// iterCtxField returns the field of the iterator context holding a pointer to btfId.
+func (s *BpfProgState) iterCtxField(btfId string) string {
+	iter := s.iterCtx()
+	if iter == nil || btfId == "" {
+		return ""
+	}
+	if btfId == "struct seq_file" {
+		return "meta->seq"
+	}
+	for i, typ := range iter.Ctx.FieldTypes {
+		if typ == btfId+" *" {
+			return iter.Ctx.FieldNames[i]
+		}
+	}
+	return ""
+}
+
+// ctxType returns the type the program takes its context as.
+func (s *BpfProgState) ctxType() string {
+	if iter := s.iterCtx(); iter != nil {
+		return "struct " + iter.Ctx.Name
+	}
+	return s.pt.User
+}
+
+// CgroupAttachType returns the attach type of a cgroup program or "" for other programs.
+func (s *BpfProgState) CgroupAttachType() string {
+	return cgroupAttachTypes[s.Sec.Sec]
+}
+
+// ExpectedAttachType returns the expected attach type the section makes libbpf load the
+// program with, or "" if it has none. The verifier checks ctx accesses and helper calls
+// against it.
+func (s *BpfProgState) ExpectedAttachType() string {
+	if t, ok := cgroupAttachTypes[s.Sec.Sec]; ok {
+		return t
+	}
+	return expectedAttachTypes[s.Sec.Sec]
+}
+
+// attachTypeAllowed returns whether the expected attach type of the program is one of
+// attachTypes. An empty list allows any attach type.
+func (s *BpfProgState) attachTypeAllowed(attachTypes []string) bool {
+	if len(attachTypes) == 0 {
+		return true
+	}
+	expected := s.ExpectedAttachType()
+	for _, t := range attachTypes {
+		if t == expected {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *BpfProgState) NewMap(newMapType BpfMapType, hint *BpfCallGenHint, minValSize int, r *randGen) *BpfMap {
 	mapType := newMapType.Type
 	maxEntries := int64(0)
@@ -374,7 +716,7 @@ func (s *BpfProgState) NewMap(newMapType BpfMapType, hint *BpfCallGenHint, minVa
 	var innerMap *BpfMap
 	if mapType == "BPF_MAP_TYPE_ARRAY_OF_MAPS" || mapType == "BPF_MAP_TYPE_HASH_OF_MAPS" {
 		var innerMapHint BpfCallGenHint
-		innerMapType := bpfMapTypes[r.Intn(len(bpfMapTypes))]
+		innerMapType := s.brf.mapTypes[r.Intn(len(s.brf.mapTypes))]
 		innerMap = s.NewMap(innerMapType, &innerMapHint, 0, r)
 	}
 
@@ -412,6 +754,18 @@ func (s *BpfProgState) NewMap(newMapType BpfMapType, hint *BpfCallGenHint, minVa
 		MaxEntries: maxEntries,
 		InnerMap: innerMap,
 	}
+	// Pinned maps are shared with the compat programs of the same test, see
+	// sharePinnedMaps. The prog access flags are left out, since the calls using a shared
+	// map may need to remove them, which would change its definition.
+	pinned := *newMap
+	pinned.MapFlags = append([]string{}, mapFlags...)
+	pinned.removeFlag("BPF_F_RDONLY_PROG")
+	pinned.removeFlag("BPF_F_WRONLY_PROG")
+	if innerMap == nil && r.oneOf(4) && s.findMap(pinned.pinnedName()) == nil {
+		newMap = &pinned
+		newMap.MapName = newMap.pinnedName()
+		newMap.Pinned = true
+	}
 	s.Maps = append(s.Maps, newMap)
 	return newMap
 }
@@ -429,6 +783,52 @@ func (s *BpfProgState) AddMap(typ string, flags []string, name string, key *Stru
 	return newMap
 }
 
+func (s *BpfProgState) findMap(name string) *BpfMap {
+	for _, m := range s.Maps {
+		if m.MapName == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// sharePinnedMaps copies the pinned maps of orig into s. Both programs are loaded
+// by the same test, so libbpf makes the later one reuse the map pinned by the first.
+func (s *BpfProgState) sharePinnedMaps(orig *BpfProgState) {
+	for _, m := range orig.Maps {
+		if !m.Pinned || m.MapName != m.pinnedName() || s.findMap(m.MapName) != nil {
+			continue
+		}
+		shared := *m
+		shared.MapFlags = append([]string{}, m.MapFlags...)
+		shared.Key = s.copyStructDef(m.Key)
+		shared.Val = s.copyStructDef(m.Val)
+		s.Maps = append(s.Maps, &shared)
+	}
+}
+
+func (s *BpfProgState) copyStructDef(sd *StructDef) *StructDef {
+	if sd == nil {
+		return nil
+	}
+	c := &StructDef{
+		Name:       sd.Name,
+		FieldNames: append([]string{}, sd.FieldNames...),
+		FieldTypes: append([]string{}, sd.FieldTypes...),
+		Size:       sd.Size,
+		Hints:      make(map[ArgHint]bool),
+		IsStruct:   sd.IsStruct,
+	}
+	for h, v := range sd.Hints {
+		c.Hints[h] = v
+	}
+	if c.IsStruct {
+		c.Name = fmt.Sprintf("struct_%d", len(s.Structs))
+	}
+	s.Structs = append(s.Structs, c)
+	return c
+}
+
 func (s *BpfProgState) ProgType() int {
 	return s.pt.Num
 }
@@ -437,24 +837,34 @@ func (s *BpfProgState) ProgTypeEnum() string {
 	return s.pt.Enum
 }
 
-func (s *BpfProgState) WriteGob(path string) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return err
+// CoverCategories returns the program type, helpers and map types of the program as
+// "prog_type:", "helper:" and "map_type:" labels the coverage of the program is attributed to.
+func (s *BpfProgState) CoverCategories() []string {
+	seen := make(map[string]bool)
+	res := []string{"prog_type:" + s.pt.Enum}
+	add := func(category string) {
+		if !seen[category] {
+			seen[category] = true
+			res = append(res, category)
+		}
 	}
-	defer file.Close()
-
-	return gob.NewEncoder(file).Encode(s)
+	for _, call := range s.Calls {
+		add("helper:" + call.Helper.Enum)
+	}
+	for _, m := range s.Maps {
+		add("map_type:" + m.MapType)
+	}
+	sort.Strings(res[1:])
+	return res
 }
 
-func (s *BpfProgState) ReadGob(path string) error {
-	file, err := os.Open(path)
+// Object returns the compiled object of the program, or nil if it is not compiled.
+func (s *BpfProgState) Object() []byte {
+	data, err := os.ReadFile(s.Path)
 	if err != nil {
-		return err
+		return nil
 	}
-	defer file.Close()
-
-	return gob.NewDecoder(file).Decode(s)
+	return data
 }
 
 func NewBpfFuncProto(attr map[string]string) *BpfHelperFunc {
@@ -797,7 +1207,7 @@ func generateStruct(s *BpfProgState, r *randGen, sizeConstraints []int, hints ma
 		target = "val"
 	}
 	fmt.Printf("(%v) gen %v struct_%d initial min=%v max=%v align=%v ArgHints=%x occu=%d\n",
-		rd, target, len(s.Structs), min, max, align, hints, occupiedSize(hints))
+		s.gen.rd, target, len(s.Structs), min, max, align, hints, occupiedSize(hints))
 
 	if useHint {
 		occupied := occupiedSize(hints)
@@ -840,7 +1250,7 @@ func generateStruct(s *BpfProgState, r *randGen, sizeConstraints []int, hints ma
 	sd.Size = size
 
 	fmt.Printf("(%v) gen %v struct_%d adjust min=%v max=%v align=%v, size=%v\n",
-		rd, target, len(s.Structs), min, max, align, size)
+		s.gen.rd, target, len(s.Structs), min, max, align, size)
 
 	offset := 0
 	for {
@@ -848,7 +1258,13 @@ func generateStruct(s *BpfProgState, r *randGen, sizeConstraints []int, hints ma
 			break
 		}
 		toEnd := size - offset
-		if _, ok := hints[HintGenSpinlock]; useHint && ok {
+		if _, ok := hints[HintGenKptr]; useHint && ok {
+			// Place the kptr first to keep it 8-byte aligned
+			sd.Hints[HintGenKptr] = true
+			delete(hints, HintGenKptr)
+			sd.FieldTypes = append(sd.FieldTypes, kptrField(s.genKptrType(r)))
+			offset += 8
+		} else if _, ok := hints[HintGenSpinlock]; useHint && ok {
 			sd.Hints[HintGenSpinlock] = true
 			delete(hints, HintGenSpinlock)
 			sd.FieldTypes = append(sd.FieldTypes, "struct bpf_spin_lock")
@@ -878,7 +1294,7 @@ func generateStruct(s *BpfProgState, r *randGen, sizeConstraints []int, hints ma
 		}
 	}
 
-	if len(sd.FieldTypes) == 1 {
+	if len(sd.FieldTypes) == 1 && sd.findKptrMember() == -1 {
 		sd.IsStruct = false
 		sd.Name = fmt.Sprintf("%v", sd.FieldTypes[0])
 	} else {
@@ -890,6 +1306,20 @@ func generateStruct(s *BpfProgState, r *randGen, sizeConstraints []int, hints ma
 	return sd, true
 }
 
+// genKptrType picks the type of a kptr field, preferring types the program can release.
+func (s *BpfProgState) genKptrType(r *randGen) string {
+	var types []string
+	for _, typ := range kptrTypes {
+		if len(s.refHelpers(kptrRefClasses[typ], false)) != 0 {
+			types = append(types, typ)
+		}
+	}
+	if len(types) == 0 {
+		types = kptrTypes
+	}
+	return types[r.Intn(len(types))]
+}
+
 var mayUpdateSockmapProgs = map[string]bool {
 	"BPF_PROG_TYPE_TRACING": true,
 //	if (eatype == BPF_TRACE_ITER)
@@ -911,6 +1341,7 @@ var funcCompMaps = map[string][]string {
 	"BPF_FUNC_xdp_output": []string{"BPF_MAP_TYPE_PERF_EVENT_ARRAY"},
 	"BPF_FUNC_ringbuf_output": []string{"BPF_MAP_TYPE_RINGBUF"},
 	"BPF_FUNC_ringbuf_reserve": []string{"BPF_MAP_TYPE_RINGBUF"},
+	"BPF_FUNC_ringbuf_reserve_dynptr": []string{"BPF_MAP_TYPE_RINGBUF"},
 	"BPF_FUNC_ringbuf_query": []string{"BPF_MAP_TYPE_RINGBUF"},
 	"BPF_FUNC_get_stackid": []string{"BPF_MAP_TYPE_STACK_TRACE"},
 	"BPF_FUNC_current_task_under_cgroup": []string{"BPF_MAP_TYPE_CGROUP_ARRAY"},
@@ -938,7 +1369,7 @@ var funcCompMaps = map[string][]string {
 var mapCompFuncs = map[string][]string {
 	"BPF_MAP_TYPE_PROG_ARRAY": []string{"BPF_FUNC_tail_call"},
 	"BPF_MAP_TYPE_PERF_EVENT_ARRAY": []string{"BPF_FUNC_perf_event_read","BPF_FUNC_perf_event_output","BPF_FUNC_skb_output","BPF_FUNC_perf_event_read_value","BPF_FUNC_xdp_output"},
-	"BPF_MAP_TYPE_RINGBUF": []string{"BPF_FUNC_ringbuf_output","BPF_FUNC_ringbuf_reserve","BPF_FUNC_ringbuf_query"},
+	"BPF_MAP_TYPE_RINGBUF": []string{"BPF_FUNC_ringbuf_output","BPF_FUNC_ringbuf_reserve","BPF_FUNC_ringbuf_query","BPF_FUNC_ringbuf_reserve_dynptr"},
 	"BPF_MAP_TYPE_STACK_TRACE": []string{"BPF_FUNC_get_stackid"},
 	"BPF_MAP_TYPE_CGROUP_ARRAY": []string{"BPF_FUNC_skb_under_cgroup","BPF_FUNC_current_task_under_cgroup"},
 	"BPF_MAP_TYPE_CGROUP_STORAGE": []string{"BPF_FUNC_get_local_storage"},
@@ -999,6 +1430,7 @@ func getHelperCompatMaps(s *BpfProgState, call *BpfCall) []*BpfMap {
 		mapHasSpinlock := (m.Val != nil && m.Val.findMember("struct bpf_spin_lock") != -1)
 		mapHasTimer := (m.Val != nil && m.Val.findMember("struct bpf_timer") != -1)
 		mapHasConstStr := (m.Val != nil && m.Val.findMember("char [8]") != -1)
+		mapHasKptr := (m.Val != nil && m.Val.findKptrMember() != -1)
 		mapIsRdOnly := (m.getFlag("BPF_F_RDONLY_PROG") != -1)
 		mapIsWrOnly := (m.getFlag("BPF_F_WRONLY_PROG") != -1)
 
@@ -1012,9 +1444,11 @@ func getHelperCompatMaps(s *BpfProgState, call *BpfCall) []*BpfMap {
 		_, genSpinlock := call.Hint.ArgHints[HintGenSpinlock]
 		_, genTimer := call.Hint.ArgHints[HintGenTimer]
 		_, genConstStr := call.Hint.ArgHints[HintGenConstStr]
+		_, genKptr := call.Hint.ArgHints[HintGenKptr]
 		if (genSpinlock && (!mapHasSpinlock || mapIsRdOnly)) ||
 		   (genTimer && (!mapHasTimer || mapIsRdOnly)) ||
-		   (genConstStr && !mapHasConstStr) {
+		   (genConstStr && !mapHasConstStr) ||
+		   (genKptr && (!mapHasKptr || mapIsRdOnly)) {
 			continue
 		}
 		//11473, 11478, 11484
@@ -1093,7 +1527,7 @@ func isTracingProgType(pt string) bool {
 
 func getHelperCompatMapTypes(s *BpfProgState, call *BpfCall) []BpfMapType {
 	var compatMapTypes []BpfMapType
-	for _, mt := range bpfMapTypes {
+	for _, mt := range s.brf.mapTypes {
 		if !isMapFuncCompatible(mt.Type, call.Helper.Enum) {
 			continue
 		}
@@ -1119,6 +1553,11 @@ func getHelperCompatMapTypes(s *BpfProgState, call *BpfCall) []BpfMapType {
 				continue
 			}
 		}
+		if _, ok := call.Hint.ArgHints[HintGenKptr]; ok {
+			if mt.Type != "BPF_MAP_TYPE_HASH" && mt.Type != "BPF_MAP_TYPE_LRU_HASH" && mt.Type != "BPF_MAP_TYPE_ARRAY" {
+				continue
+			}
+		}
 		//11503
 		if mt.Type == "BPF_MAP_TYPE_STRUCT_OPS" {
 			continue
@@ -1183,6 +1622,9 @@ func getCompatKeyStructDefs(s *BpfProgState, mapType BpfMapType) []*StructDef {
 		if structDef.Size < mapType.KeySize[0] || structDef.Size > mapType.KeySize[1] {
 			continue
 		}
+		if structDef.findKptrMember() != -1 {
+			continue
+		}
 		compatStructs = append(compatStructs, structDef)
 	}
 	return compatStructs
@@ -1210,6 +1652,10 @@ func getCompatValStructDefs(s *BpfProgState, hint *BpfCallGenHint, minValSize in
 			structDef.findMember("char [8]") == -1 {
 			continue
 		}
+		if _, ok := hint.ArgHints[HintGenKptr]; ok &&
+			structDef.findKptrMember() == -1 {
+			continue
+		}
 		if _, ok := hint.ArgHints[HintGenSockMap]; ok {
 			continue
 		}
@@ -1389,6 +1835,36 @@ var PktPtrReadWriteNoCheck = map[string]bool {
 	"BPF_PROG_TYPE_CGROUP_SOCKOPT": true,
 }
 
+// PktDataChangers move or reallocate the packet (bpf_helper_changes_pkt_data). The verifier
+// invalidates all packet pointers after calling them, so the program reloads them from ctx.
+var PktDataChangers = map[string]bool {
+	"BPF_FUNC_clone_redirect": true,
+	"BPF_FUNC_l3_csum_replace": true,
+	"BPF_FUNC_l4_csum_replace": true,
+	"BPF_FUNC_lwt_push_encap": true,
+	"BPF_FUNC_lwt_seg6_action": true,
+	"BPF_FUNC_lwt_seg6_adjust_srh": true,
+	"BPF_FUNC_lwt_seg6_store_bytes": true,
+	"BPF_FUNC_msg_pop_data": true,
+	"BPF_FUNC_msg_pull_data": true,
+	"BPF_FUNC_msg_push_data": true,
+	"BPF_FUNC_skb_adjust_room": true,
+	"BPF_FUNC_skb_change_head": true,
+	"BPF_FUNC_skb_change_proto": true,
+	"BPF_FUNC_skb_change_tail": true,
+	"BPF_FUNC_skb_pull_data": true,
+	"BPF_FUNC_skb_store_bytes": true,
+	"BPF_FUNC_skb_vlan_pop": true,
+	"BPF_FUNC_skb_vlan_push": true,
+	"BPF_FUNC_store_hdr_opt": true,
+	"BPF_FUNC_xdp_adjust_head": true,
+	"BPF_FUNC_xdp_adjust_meta": true,
+	"BPF_FUNC_xdp_adjust_tail": true,
+}
+
+// pktFields are the ctx fields holding packet pointers.
+var pktFields = []string{"data", "data_end", "data_meta"}
+
 func checkPktAccess(s *BpfProgState, h *BpfHelperFunc, isWrite bool) bool {
 	canWrite := true
 	if _, ok := PktPtrReadOnly[s.pt.Enum]; ok {
@@ -1416,7 +1892,7 @@ func (t PtrToPacketMetaRegType) String() string {
 }
 
 func (t PtrToPacketMetaRegType) Generate(s *BpfProgState, r *randGen, call *BpfCall, arg int) *BpfArg {
-	return nil
+	return s.genPktPtr(r, call, arg, true)
 }
 
 func (t PtrToPacketMetaRegType) CheckAccess(s *BpfProgState, h *BpfHelperFunc, isWrite bool) bool {
@@ -1431,13 +1907,145 @@ func (t PtrToPacketRegType) String() string {
 }
 
 func (t PtrToPacketRegType) Generate(s *BpfProgState, r *randGen, call *BpfCall, arg int) *BpfArg {
-	return nil
+	return s.genPktPtr(r, call, arg, false)
 }
 
 func (t PtrToPacketRegType) CheckAccess(s *BpfProgState, h *BpfHelperFunc, isWrite bool) bool {
 	return checkPktAccess(s, h, isWrite)
 }
 
+// genPktPtr generates a pointer into the packet, or into the metadata in front of it if meta
+// is set, at an offset read from the packet. The verifier has to track the range of the offset
+// instead of a constant. The packet may be moved in its buffer right before the access.
+func (s *BpfProgState) genPktPtr(r *randGen, call *BpfCall, arg int, meta bool) *BpfArg {
+	start, end, rt := "data", "data_end", "PTR_TO_PACKET"
+	if meta {
+		start, end, rt = "data_meta", "data", "PTR_TO_PACKET_META"
+	}
+	if _, ok := s.pt.ctxAccess.regTypeMap[rt]; !ok {
+		return nil
+	}
+	if r.nOutOf(1, 2) {
+		s.genPktMoveCall(r, call, meta)
+	}
+	startVar := s.pktCtxVar(start)
+	endVar := s.pktCtxVar(end)
+
+	a := NewBpfArg(call.Helper, arg)
+	a.Name = fmt.Sprintf("v%d", s.VarId)
+	s.VarId += 1
+	a.IsPktAccess = !meta
+	a.IsPktMetaAccess = meta
+	genPktAccessSize(r, call, arg, a)
+
+	types := []string{"uint8_t", "uint16_t", "uint32_t"}
+	sizes := []int{1, 2, 4}
+	ti := r.Intn(len(types))
+	off := r.Intn(16)
+	mask := []int{0x7, 0x3f, 0xff, 0x3ff}[r.Intn(4)]
+	a.Prepare = fmt.Sprintf("	void *%v = %v;\n", a.Name, startVar)
+	a.Prepare += fmt.Sprintf("	if (%v + %v < %v)\n", startVar, off+sizes[ti], endVar)
+	a.Prepare += fmt.Sprintf("		%v += *(%v *)(%v + %v) & 0x%x;\n", a.Name, types[ti], startVar, off, mask)
+	return a
+}
+
+// genPktMoveCall adds a call that moves the start or the end of the packet, or the start of
+// the metadata if meta is set, right before call. The deltas stay close to what the kernel
+// accepts, so the packet is actually moved rather than the call failing.
+func (s *BpfProgState) genPktMoveCall(r *randGen, call *BpfCall, meta bool) {
+	enums := []string{"BPF_FUNC_xdp_adjust_head", "BPF_FUNC_xdp_adjust_tail", "BPF_FUNC_skb_pull_data", "BPF_FUNC_skb_change_tail"}
+	if meta {
+		enums = []string{"BPF_FUNC_xdp_adjust_meta"}
+	}
+	helpers := s.getBpfHelpers(enums)
+	if len(helpers) == 0 {
+		return
+	}
+	helper := helpers[r.Intn(len(helpers))]
+	mcall := NewBpfCall(helper, newBpfCallGenHint(nil))
+	for i := range helper.Args {
+		mcall.Args[i] = NewBpfArg(helper, i)
+		mcall.Args[i].Name = "0"
+		mcall.Args[i].IsNotNull = true
+	}
+	mcall.Args[0].Name = "ctx"
+	delta := 0
+	switch helper.Enum {
+	case "BPF_FUNC_xdp_adjust_head":
+		// Grow into the headroom (XDP_PACKET_HEADROOM) or strip headers
+		if r.nOutOf(1, 2) {
+			delta = -r.Intn(257)
+		} else {
+			delta = r.Intn(128)
+		}
+	case "BPF_FUNC_xdp_adjust_tail":
+		delta = r.Intn(257) - 128
+	case "BPF_FUNC_xdp_adjust_meta":
+		// The metadata is at most 32 bytes and 4-byte aligned
+		delta = -4 * (1 + r.Intn(8))
+	case "BPF_FUNC_skb_pull_data":
+		delta = r.Intn(256)
+	case "BPF_FUNC_skb_change_tail":
+		delta = 14 + r.Intn(2048)
+	}
+	mcall.Args[1].Name = fmt.Sprint(delta)
+	mcall.RetType = bpfRetType(mcall)
+	mcall.Ret = fmt.Sprintf("v%v", s.VarId)
+	s.VarId += 1
+
+	// The call is already in the program when its argument is mutated
+	i := len(s.Calls)
+	for j, c := range s.Calls {
+		if c == call {
+			i = j
+			break
+		}
+	}
+	s.Calls = append(s.Calls[:i], append([]*BpfCall{mcall}, s.Calls[i:]...)...)
+	s.trace(BpfTraceCall, helper, -1, "move the packet by %v before %v", delta, call.Helper.Enum)
+}
+
+// pktCtxVar returns the variable holding the packet pointer in the ctx field.
+func (s *BpfProgState) pktCtxVar(field string) string {
+	if v, ok := s.CtxVars[field]; ok {
+		return v
+	}
+	v := fmt.Sprintf("v%d", s.VarId)
+	s.VarId += 1
+	s.CtxVars[field] = v
+	s.CtxTypes[field] = "void *"
+	return v
+}
+
+// genPktAccessSize sets the size of the packet access made through a to the size of the
+// memory the helper argument points to.
+func genPktAccessSize(r *randGen, call *BpfCall, arg int, a *BpfArg) {
+	argType := call.Helper.Args[arg]
+	if argType == "ARG_PTR_TO_MAP_KEY" {
+		if call.ArgMap != nil && call.ArgMap.Key != nil {
+			//a.AccessSize = call.ArgMap.Key.Size
+			a.AccessSize = roundUp(call.ArgMap.Key.Size, 8) //XXX need to round up key size?
+		}
+	}
+	if argType == "ARG_PTR_TO_MAP_VALUE" || argType == "ARG_PTR_TO_MAP_VALUE_OR_NULL" || argType == "ARG_PTR_TO_UNINIT_MAP_VALUE" {
+		if call.ArgMap != nil && call.ArgMap.Val != nil {
+			//a.AccessSize = call.ArgMap.Val.Size
+			a.AccessSize = roundUp(call.ArgMap.Val.Size, 8)
+		}
+	}
+	if argType == "ARG_PTR_TO_MEM" || argType == "ARG_PTR_TO_MEM_OR_NULL" || argType == "ARG_PTR_TO_UNINIT_MEM" {
+		size := r.Intn(128)//XXX determine max
+		a.AccessSize = size
+		call.StackVarSize = size
+	}
+	if argType == "ARG_PTR_TO_INT" {
+		a.AccessSize = 4
+	}
+	if argType == "ARG_PTR_TO_LONG" {
+		a.AccessSize = 8
+	}
+}
+
 type PtrToPacketEndRegType struct {
 }
 
@@ -1552,7 +2160,22 @@ func (t PtrToBtfIdRegType) String() string {
 }
 
 func (t PtrToBtfIdRegType) Generate(s *BpfProgState, r *randGen, call *BpfCall, arg int) *BpfArg {
-	return nil
+	// Only iterators get kernel objects from the context for now
+	_, btfId := s.genCompatibleRegTypes(call, arg)
+	field := s.iterCtxField(btfId)
+	if field == "" {
+		return nil
+	}
+	a := NewBpfArg(call.Helper, arg)
+	if v, ok := s.CtxVars[field]; ok {
+		a.Name = v
+	} else {
+		a.Name = fmt.Sprintf("v%d", s.VarId)
+		s.VarId += 1
+		s.CtxVars[field] = a.Name
+		s.CtxTypes[field] = btfId + " *"
+	}
+	return a
 }
 
 func (t PtrToBtfIdRegType) CheckAccess(s *BpfProgState, h *BpfHelperFunc, isWrite bool) bool {
@@ -1632,7 +2255,48 @@ func (t PtrToFuncRegType) String() string {
 }
 
 func (t PtrToFuncRegType) Generate(s *BpfProgState, r *randGen, call *BpfCall, arg int) *BpfArg {
-	return nil
+	// Only timer callbacks are generated, for the timer in the map value passed as the first argument
+	if call.Helper.Enum != "BPF_FUNC_timer_set_callback" || call.ArgMap == nil || call.ArgMap.Val == nil {
+		return nil
+	}
+	mi := call.ArgMap.Val.findMember("struct bpf_timer")
+	if mi == -1 {
+		return nil
+	}
+	a := NewBpfArg(call.Helper, arg)
+	a.IsNotNull = true
+	a.Name = s.genTimerCallback(r, call.ArgMap, mi)
+	return a
+}
+
+// genTimerCallback defines a callback of the timer in member mi of the values of m and returns
+// its name. Besides returning, the callback may re-arm or cancel its own timer, or delete or
+// replace the map element the timer is embedded in, which frees the timer while it runs.
+func (s *BpfProgState) genTimerCallback(r *randGen, m *BpfMap, mi int) string {
+	name := fmt.Sprintf("timer_cb%v", s.VarId)
+	s.VarId += 1
+	body := ""
+	switch r.Intn(5) {
+	case 1:
+		body = fmt.Sprintf("	bpf_timer_start(&val->e%v, %v, 0);\n", mi, genTimerExpiry(r))
+	case 2:
+		body = fmt.Sprintf("	bpf_timer_cancel(&val->e%v);\n", mi)
+	case 3:
+		body = "	bpf_map_delete_elem(map, key);\n"
+	case 4:
+		body = "	bpf_map_update_elem(map, key, val, 0);\n"
+	}
+	s.Callbacks[name] = fmt.Sprintf("static int %v(void *map, void *key, %v *val) {\n%v	return 0;\n}\n", name, m.Val.Name, body)
+	return name
+}
+
+// genTimerExpiry returns a timeout in ns short enough for a timer to fire while userspace is
+// still tearing down the map or the program it belongs to.
+func genTimerExpiry(r *randGen) int {
+	if r.oneOf(4) {
+		return 0
+	}
+	return 1 << uint(r.Intn(20))
 }
 
 func (t PtrToFuncRegType) CheckAccess(s *BpfProgState, h *BpfHelperFunc, isWrite bool) bool {
@@ -1655,6 +2319,86 @@ func (t PtrToMapKeyRegType) CheckAccess(s *BpfProgState, h *BpfHelperFunc, isWri
 	return !isWrite
 }
 
+type PtrToDynptrRegType struct {
+}
+
+func (t PtrToDynptrRegType) String() string {
+	return "PTR_TO_DYNPTR"
+}
+
+var dynptrInitHelpers = []string{"BPF_FUNC_ringbuf_reserve_dynptr", "BPF_FUNC_dynptr_from_mem"}
+
+// Dynptrs live in stack slots. A slot is initialized by passing it as an uninit
+// dynptr and it is released (if it is a ringbuf dynptr) by submitting or discarding it.
+func (t PtrToDynptrRegType) Generate(s *BpfProgState, r *randGen, call *BpfCall, arg int) *BpfArg {
+	a := NewBpfArg(call.Helper, arg)
+	a.IsNotNull = true
+	if call.Helper.Args[arg] == "ARG_PTR_TO_UNINIT_DYNPTR" {
+		v := fmt.Sprintf("v%d", s.VarId)
+		a.Name = fmt.Sprintf("&%v", v)
+		a.Prepare = fmt.Sprintf("	struct bpf_dynptr %s = {};\n", v)
+		s.VarId += 1
+		return a
+	}
+
+	ringbufOnly := call.Helper.Enum == "BPF_FUNC_ringbuf_submit_dynptr" || call.Helper.Enum == "BPF_FUNC_ringbuf_discard_dynptr"
+	if dynptrs := s.liveDynptrs(ringbufOnly); len(dynptrs) != 0 && r.nOutOf(2, 3) {
+		a.Name = dynptrs[r.Intn(len(dynptrs))]
+		return a
+	}
+	initHelpers := dynptrInitHelpers
+	if ringbufOnly {
+		initHelpers = initHelpers[:1]
+	}
+	helpers := s.getBpfHelpers(initHelpers)
+	if len(helpers) == 0 {
+		return nil
+	}
+	initCall, ok := s.genBpfHelperCall(r, helpers[r.Intn(len(helpers))], newBpfCallGenHint(nil), false)
+	if !ok {
+		return nil
+	}
+	a.Name = initCall.Args[3].Name
+	return a
+}
+
+func (t PtrToDynptrRegType) CheckAccess(s *BpfProgState, h *BpfHelperFunc, isWrite bool) bool {
+	return true
+}
+
+// liveDynptrs returns the initialized dynptrs that have not been released by calls in the program.
+func (s *BpfProgState) liveDynptrs(ringbufOnly bool) []string {
+	var dynptrs []string
+	released := make(map[string]bool)
+	isRingbuf := make(map[string]bool)
+	var visit func(call *BpfCall)
+	visit = func(call *BpfCall) {
+		for _, arg := range call.Args {
+			if arg != nil && arg.ArgType == "ARG_PTR_TO_UNINIT_DYNPTR" {
+				dynptrs = append(dynptrs, arg.Name)
+				isRingbuf[arg.Name] = call.Helper.Enum == "BPF_FUNC_ringbuf_reserve_dynptr"
+			}
+		}
+		if (call.Helper.Enum == "BPF_FUNC_ringbuf_submit_dynptr" || call.Helper.Enum == "BPF_FUNC_ringbuf_discard_dynptr") &&
+			call.Args[0] != nil {
+			released[call.Args[0].Name] = true
+		}
+		for _, pcall := range call.PostCalls {
+			visit(pcall)
+		}
+	}
+	for _, call := range s.Calls {
+		visit(call)
+	}
+	var live []string
+	for _, d := range dynptrs {
+		if !released[d] && (!ringbufOnly || isRingbuf[d]) {
+			live = append(live, d)
+		}
+	}
+	return live
+}
+
 type BpfCtxAccessAttr struct {
 	rangeInCtx   []string
 	canRead      bool
@@ -1681,11 +2425,17 @@ func NewBpfCtxAccess() *BpfCtxAccess {
 	return newCtxAccess
 }
 
+// BpfRuntimeFuzzer holds the tables used to generate BPF programs. It is shared by all
+// procs, so the tables must not be modified once InitFromSrc and Prune are done. The
+// state of a program being generated is kept in BpfProgState and bpfGenCtx instead.
 type BpfRuntimeFuzzer struct {
 	isEnabled     bool
 	helperFuncMap map[string]*BpfHelperFunc
 	progTypeMap   map[string]*BpfProgTypeDef
+	progTypes     []string // sorted names of progTypeMap
 	ctxAccessMap  map[string]*BpfCtxAccess
+	refFuncMap    map[string][]BpfRefSpec
+	mapTypes      []BpfMapType
 
 	helperProtoMap    map[string]map[string]bool
 	helperProtoGrepRe *regexp.Regexp
@@ -1698,7 +2448,7 @@ func InitBrf(enable bool) {
 	Brf = NewBpfRuntimeFuzzer()
 
 	Brf.isEnabled = enable
-	Brf.InitFromSrc(HelperFuncMap, ProgTypeMap, CtxAccessMap)
+	Brf.InitFromSrc(HelperFuncMap, ProgTypeMap, CtxAccessMap, RefFuncMap)
 }
 
 func (brf *BpfRuntimeFuzzer) IsEnabled() bool {
@@ -1771,6 +2521,10 @@ var const_str_ptr_types = []RegType{PtrToMapValueRegType{}}
 
 var timer_types = []RegType{PtrToMapValueRegType{}}
 
+var kptr_types = []RegType{PtrToMapValueRegType{}}
+
+var dynptr_types = []RegType{PtrToDynptrRegType{}}
+
 var all_types = []RegType{
 	ScalarValRegType{},
 	PtrToCtxRegType{},
@@ -1825,6 +2579,10 @@ var compatibleRegType = map[string][]RegType {
 	"ARG_PTR_TO_STACK_OR_NULL": stack_ptr_types,
 	"ARG_PTR_TO_CONST_STR": const_str_ptr_types,
 	"ARG_PTR_TO_TIMER": timer_types,
+	"ARG_PTR_TO_KPTR": kptr_types,
+	"ARG_PTR_TO_BTF_ID_OR_NULL": btf_ptr_types,
+	"ARG_PTR_TO_DYNPTR": dynptr_types,
+	"ARG_PTR_TO_UNINIT_DYNPTR": dynptr_types,
 }
 
 func NewBpfRuntimeFuzzer() *BpfRuntimeFuzzer {
@@ -1832,6 +2590,8 @@ func NewBpfRuntimeFuzzer() *BpfRuntimeFuzzer {
 	brf.helperFuncMap = make(map[string]*BpfHelperFunc)
 	brf.progTypeMap = make(map[string]*BpfProgTypeDef)
 	brf.ctxAccessMap = make(map[string]*BpfCtxAccess)
+	brf.refFuncMap = make(map[string][]BpfRefSpec)
+	brf.mapTypes = bpfMapTypes
 	brf.helperProtoMap = make(map[string]map[string]bool)
 	brf.helperProtoGrepRe = regexp.MustCompile(`([./0-9a-zA-Z_-]+):([0-9]+):(?:static\s)?const\sstruct\sbpf_func_proto\s([0-9a-zA-Z_]+)\s=\s\{`)
 	brf.helperProtoRe = regexp.MustCompile(`\s+.([0-9a-zA-Z_]+)\s+=\s([0-9a-zA-Z_]+),`)
@@ -1871,12 +2631,18 @@ func getCtxAccessAttr(sd *StructDef, accesses []BpfCtxAccessAttr, fieldIdx int,
 	return BpfCtxAccessAttr{}, -1
 }
 
-func (brf *BpfRuntimeFuzzer) InitFromSrc(hMap map[string]*BpfHelperFunc, ptMap map[string]*BpfProgTypeDef, caMap map[string]*BpfCtxAccess) {
+// InitFromSrc sets up the fuzzer from the description tables. The program types are
+// copied, so the tables are not modified and can be shared by several fuzzers.
+func (brf *BpfRuntimeFuzzer) InitFromSrc(hMap map[string]*BpfHelperFunc, ptMap map[string]*BpfProgTypeDef, caMap map[string]*BpfCtxAccess,
+	rMap map[string][]BpfRefSpec) {
 	brf.helperFuncMap = hMap
-	brf.progTypeMap = ptMap
+	brf.progTypeMap = make(map[string]*BpfProgTypeDef)
 	brf.ctxAccessMap = caMap
+	brf.refFuncMap = rMap
 
-	for name, pt := range brf.progTypeMap {
+	for name, desc := range ptMap {
+		pt := *desc
+		pt.Helpers = nil
 		availableHelper := make(map[string]bool)
 		for _, proto := range pt.FuncProtos {
 			helper := brf.helperFuncMap[proto]
@@ -1887,7 +2653,8 @@ func (brf *BpfRuntimeFuzzer) InitFromSrc(hMap map[string]*BpfHelperFunc, ptMap m
 		}
 
 		var accesses []BpfCtxAccessAttr
-		pt.ctxAccess = brf.ctxAccessMap[name]
+		ctxAccess := *brf.ctxAccessMap[name]
+		pt.ctxAccess = &ctxAccess
 		var sd *StructDef
 		var ctxStructName = pt.User
 		if len(pt.User) > 6 && pt.User[0:6] == "struct" {
@@ -1915,7 +2682,18 @@ func (brf *BpfRuntimeFuzzer) InitFromSrc(hMap map[string]*BpfHelperFunc, ptMap m
 			}
 			pt.ctxAccess.accesses = accesses
 		}
+		brf.progTypeMap[name] = &pt
 	}
+	brf.progTypes = sortedProgTypes(brf.progTypeMap)
+}
+
+func sortedProgTypes(m map[string]*BpfProgTypeDef) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 func (brf *BpfRuntimeFuzzer) ProgTypeEnumToString(pv int) string {
@@ -1951,6 +2729,17 @@ func (brf *BpfRuntimeFuzzer) HelperEnumToString(pv int, hv int) string {
 	return he
 }
 
+// HelperName returns the name of helper number hv the way the kernel names it in
+// verifier logs, e.g. bpf_map_lookup_elem, or "" if there is no such helper.
+func (brf *BpfRuntimeFuzzer) HelperName(hv int) string {
+	for _, helper := range brf.helperFuncMap {
+		if !helper.Kfunc && helper.Num == hv && strings.HasPrefix(helper.Enum, "BPF_FUNC_") {
+			return "bpf_" + strings.TrimPrefix(helper.Enum, "BPF_FUNC_")
+		}
+	}
+	return ""
+}
+
 func (brf *BpfRuntimeFuzzer) MapTypeEnumToString(mv int) string {
 	me := ""
 	if mv > 0 && mv <= len(bpfMapTypes) {
@@ -1959,6 +2748,15 @@ func (brf *BpfRuntimeFuzzer) MapTypeEnumToString(mv int) string {
 	return me
 }
 
+func findStruct(s *BpfProgState, structType string) int {
+	for i, sd := range s.Structs {
+		if sd.Name == structType {
+			return i
+		}
+	}
+	return -1
+}
+
 func findMember(s *BpfProgState, structType string, memberType string) int {
 	for _, sd := range s.Structs {
 		if sd.Name == structType {
@@ -1971,7 +2769,7 @@ func findMember(s *BpfProgState, structType string, memberType string) int {
 //XXX record fail prog:func pair
 func (s *BpfProgState) genBpfHelperCallArg(r *randGen, call *BpfCall, arg int) bool {
 	argType := call.Helper.Args[arg]
-	fmt.Printf("(%v) gen call[%v] arg[%v]=%v (%v)\n", rd, len(s.Calls), arg, argType, call.Helper.Enum)
+	fmt.Printf("(%v) gen call[%v] arg[%v]=%v (%v)\n", s.gen.rd, len(s.Calls), arg, argType, call.Helper.Enum)
 
 	var a *BpfArg
 	ok := false
@@ -1980,20 +2778,39 @@ func (s *BpfProgState) genBpfHelperCallArg(r *randGen, call *BpfCall, arg int) b
 		a.Name = "0"
 		a.IsNotNull = true
 		ok = true
+		s.trace(BpfTraceArg, call.Helper, arg, "fixed value 0")
+	}
+	// Only swap in a new reference if kptr_xchg is called unconditionally, or the reference may leak
+	if !ok && call.Helper.Enum == "BPF_FUNC_kptr_xchg" && arg == 1 &&
+		(r.nOutOf(1, 2) || (!call.Args[0].IsNotNull && !call.Args[0].CanBeNull)) {
+		a = NewBpfArg(call.Helper, arg)
+		a.Name = "NULL"
+		a.IsNotNull = true
+		ok = true
+		s.trace(BpfTraceArg, call.Helper, arg, "fixed value NULL")
+	}
+	// Read user memory the trigger has not faulted in, so sleepable programs sleep on it
+	if i, found := bpfUserPtrArgs[call.Helper.Enum]; !ok && found && i == arg && r.nOutOf(2, 3) {
+		a = NewBpfArg(call.Helper, arg)
+		a.Name = fmt.Sprintf("0x%x", BpfFaultAreaAddr+r.Intn(BpfFaultAreaSize))
+		a.IsNotNull = true
+		ok = true
+		s.trace(BpfTraceArg, call.Helper, arg, "fault area address %v", a.Name)
 	}
 	if !ok && r.nOutOf(1, 3) {
-		fmt.Printf("(%v) gen arg using helper return value\n", rd)
+		fmt.Printf("(%v) gen arg using helper return value\n", s.gen.rd)
 		a, ok = s.genRandBpfHelperCall(r, call, arg)
 	}
 	if !ok && r.nOutOf(1, 2) {
-		fmt.Printf("(%v) gen arg using ctx access\n", rd)
+		fmt.Printf("(%v) gen arg using ctx access\n", s.gen.rd)
 		a, ok = s.genRandBpfCtxAccess(r, call, arg)
 	}
 	if !ok {
-		fmt.Printf("(%v) gen arg directly\n", rd)
+		fmt.Printf("(%v) gen arg directly\n", s.gen.rd)
 		a, ok = s.genRandDirectAccess(r, call, arg)
 	}
 	if !ok {
+		s.trace(BpfTraceReject, call.Helper, arg, "no source can produce %v", argType)
 		return false
 	}
 	fmt.Printf("(%v) gen arg v%v\n", r, ok, s.VarId)
@@ -2004,9 +2821,15 @@ func (s *BpfProgState) genBpfHelperCallArg(r *randGen, call *BpfCall, arg int) b
 
 	// Adding a predicate other than the referenced object can produce paths that may leak references
 	// XXX Is it possible to achieve so without leaking ref?
-	if call.isRefReleaseCall() != -1 && arg != 0 {
+	// Neither can references acquired through arguments, e.g., dynptrs, be conditional
+	spec := s.refSpec(call, false, true, false)
+	if acqSpec := s.refSpec(call, true, false, false); spec == nil && acqSpec != nil && acqSpec.RefArg != RefRet {
+		spec = acqSpec
+	}
+	if spec != nil && arg != spec.RefArg && call.Helper.Enum != "BPF_FUNC_kptr_xchg" {
 		//if a.IsNotNull && a.CanBeNull {
 		if !a.IsNotNull && !a.CanBeNull {
+			s.trace(BpfTraceReject, call.Helper, arg, "%v may be NULL, a check would leak the reference", a.Name)
 			return false
 		}
 	}
@@ -2018,25 +2841,30 @@ func (s *BpfProgState) genBpfHelperCallArg(r *randGen, call *BpfCall, arg int) b
 //XXX add mem size constraints
 func (s *BpfProgState) genCompatibleRegTypes(call *BpfCall, arg int) ([]RegType, string) {
 	argType := call.Helper.Args[arg]
-	regTypes := compatibleRegType[argType]
-	if argType == "ARG_PTR_TO_UNINIT_MAP_VALUE" || argType == "ARG_PTR_TO_UNINIT_MEM" {
-		for i, t := range regTypes {
-			if !t.CheckAccess(s, call.Helper, true) {
-				regTypes = append(regTypes[0:i], regTypes[i+1:]...)
-			}
+	isUninit := argType == "ARG_PTR_TO_UNINIT_MAP_VALUE" || argType == "ARG_PTR_TO_UNINIT_MEM"
+	pktAccess := checkPktAccess(s, call.Helper, false) //verbose_5053
+	// Filter into a new slice, compatibleRegType is shared by all programs
+	var regTypes []RegType
+	for _, t := range compatibleRegType[argType] {
+		if isUninit && !t.CheckAccess(s, call.Helper, true) {
+			continue
 		}
-	}
-	if !checkPktAccess(s, call.Helper, false) { //verbose_5053
-		for i, t := range regTypes {
-			if t.String() == "PTR_TO_PACKET" || t.String() == "PTR_TO_PACKET_META" {
-				regTypes = append(regTypes[0:i], regTypes[i+1:]...)
-			}
+		if !pktAccess && (t.String() == "PTR_TO_PACKET" || t.String() == "PTR_TO_PACKET_META") {
+			continue
 		}
+		regTypes = append(regTypes, t)
+	}
+
+	// Only map values are supported as the memory of local dynptrs
+	if call.Helper.Enum == "BPF_FUNC_dynptr_from_mem" && arg == 0 {
+		regTypes = []RegType{PtrToMapValueRegType{}}
 	}
 
 	btfId := ""
 	if argType == "ARG_PTR_TO_BTF_ID" {
 		btfId = call.Helper.ArgBtfIds[0] //XXX helpers have only one at most now
+	} else if argType == "ARG_PTR_TO_BTF_ID_OR_NULL" {
+		btfId = call.RetBtfId // kptr_xchg takes and returns pointers of the kptr type
 	} else if argType == "ARG_PTR_TO_BTF_ID_SOCK_COMMON" {
 		btfId = "struct sock_common"
 	}
@@ -2049,7 +2877,8 @@ func (s *BpfProgState) genRandDirectAccess(r *randGen, call *BpfCall, arg int) (
 		rt := compatRegTypes[r.Intn(len(compatRegTypes))]
 		a := rt.Generate(s, r, call, arg)
 		if a != nil {
-			fmt.Printf("(%v) gen arg using %v directly\n", rd, rt.String())
+			fmt.Printf("(%v) gen arg using %v directly\n", s.gen.rd, rt.String())
+			s.trace(BpfTraceArg, call.Helper, arg, "%v %v directly", a.Name, rt.String())
 			return a, true
 		}
 	}
@@ -2073,8 +2902,10 @@ func (s *BpfProgState) genRandBpfCtxAccess(r *randGen, call *BpfCall, arg int) (
 		var ctxStruct *StructDef
 		if len(s.pt.User) > 6 && s.pt.User[0:6] == "struct" {
 			ctxStruct = ctxStructsMap[s.pt.User[7:len(s.pt.User)]]
-			readAccess := s.pt.ctxAccess.accesses[ctxStruct.fieldIdx(ranges[0][2])*2].canRead
-			writeAccess := s.pt.ctxAccess.accesses[ctxStruct.fieldIdx(ranges[0][2])*2+1].canWrite
+			read := s.pt.ctxAccess.accesses[ctxStruct.fieldIdx(ranges[0][2])*2]
+			write := s.pt.ctxAccess.accesses[ctxStruct.fieldIdx(ranges[0][2])*2+1]
+			readAccess := read.canRead && s.ctxAccessAllowed(read)
+			writeAccess := write.canWrite && s.ctxAccessAllowed(write)
 			if !readAccess && !writeAccess {
 				continue
 			}
@@ -2105,78 +2936,192 @@ func (s *BpfProgState) genRandBpfCtxAccess(r *randGen, call *BpfCall, arg int) (
 			s.CtxTypes[field] = typ
 		}
 		if rt == "PTR_TO_PACKET_META" {
-			if _, ok := s.CtxVars["data"]; !ok {
-				a1 := fmt.Sprintf("v%d", s.VarId)
-				s.VarId += 1
-				s.CtxVars["data"] = a1
-				s.CtxTypes["data"] = typ
-			}
-			argType := call.Helper.Args[arg]
+			s.pktCtxVar("data")
 			a.IsPktMetaAccess = true
-			if argType == "ARG_PTR_TO_MAP_KEY" {
-				if call.ArgMap != nil && call.ArgMap.Key != nil {
-					//a.AccessSize = call.ArgMap.Key.Size
-					a.AccessSize = roundUp(call.ArgMap.Key.Size, 8) //XXX need to round up key size?
-				}
-			}
-			if argType == "ARG_PTR_TO_MAP_VALUE" || argType == "ARG_PTR_TO_MAP_VALUE_OR_NULL" || argType == "ARG_PTR_TO_UNINIT_MAP_VALUE" {
-				if call.ArgMap != nil && call.ArgMap.Val != nil {
-					//a.AccessSize = call.ArgMap.Val.Size
-					a.AccessSize = roundUp(call.ArgMap.Val.Size, 8)
-				}
-			}
-			if argType == "ARG_PTR_TO_MEM" || argType == "ARG_PTR_TO_MEM_OR_NULL" || argType == "ARG_PTR_TO_UNINIT_MEM" {
-				size := r.Intn(128)//XXX determine max
-				a.AccessSize = size
-				call.StackVarSize = size
-			}
-			if argType == "ARG_PTR_TO_INT" {
-				a.AccessSize = 4
-			}
-			if argType == "ARG_PTR_TO_LONG" {
-				a.AccessSize = 8
-			}
+			genPktAccessSize(r, call, arg, a)
 //			a.AccessSize = call.Hint.RetAccessSize
 		}
 		if rt == "PTR_TO_PACKET" {
-			if _, ok := s.CtxVars["data_end"]; !ok {
-				a1 := fmt.Sprintf("v%d", s.VarId)
-				s.VarId += 1
-				s.CtxVars["data_end"] = a1
-				s.CtxTypes["data_end"] = typ
-			}
-			argType := call.Helper.Args[arg]
+			s.pktCtxVar("data_end")
 			a.IsPktAccess = true
-			if argType == "ARG_PTR_TO_MAP_KEY" {
-				if call.ArgMap != nil && call.ArgMap.Key != nil {
-					//a.AccessSize = call.ArgMap.Key.Size
-					a.AccessSize = roundUp(call.ArgMap.Key.Size, 8) //XXX need to round up key size?
-				}
+			genPktAccessSize(r, call, arg, a)
+//			a.AccessSize = call.Hint.RetAccessSize
+		}
+		s.trace(BpfTraceArg, call.Helper, arg, "%v ctx->%v as %v", a.Name, field, rt)
+		return a, true
+	}
+	return nil, false
+}
+
+
+// ctxStruct returns the definition of the ctx struct of the program, or nil if the accesses
+// to its fields are not described per field.
+func (s *BpfProgState) ctxStruct() *StructDef {
+	if s.iterCtx() != nil || !strings.HasPrefix(s.pt.User, "struct ") {
+		return nil
+	}
+	sd := ctxStructsMap[strings.TrimPrefix(s.pt.User, "struct ")]
+	if sd == nil || len(s.pt.ctxAccess.accesses) != 2*len(sd.FieldNames) {
+		return nil
+	}
+	return sd
+}
+
+// ctxFieldElem returns the type, the size and the number of the elements of a ctx field.
+// The size is 0 for fields that cannot be accessed as integers.
+func ctxFieldElem(ft string) (string, int, int) {
+	n := 1
+	if i := strings.Index(ft, " ["); i != -1 {
+		n, _ = strconv.Atoi(ft[i+2 : len(ft)-1])
+		ft = ft[:i]
+	}
+	switch ft {
+	case "uint32_t", "int32_t":
+		return ft, 4, n
+	case "uint64_t":
+		return ft, 8, n
+	}
+	return ft, 0, n
+}
+
+// ctxFieldOffset returns the offset of the field fi in the ctx struct. Fields are naturally
+// aligned and pointers take 8 bytes, as __bpf_md_ptr does.
+func (sd *StructDef) ctxFieldOffset(fi int) int {
+	offset := 0
+	for i := 0; i <= fi; i++ {
+		ft := sd.FieldTypes[i]
+		_, size, n := ctxFieldElem(ft)
+		if strings.HasSuffix(ft, "*") {
+			size = 8
+		} else if size == 0 && ctxStructsMap[strings.TrimPrefix(ft, "struct ")] != nil {
+			size = 8
+			n = ctxStructsMap[strings.TrimPrefix(ft, "struct ")].Size / 8
+		}
+		offset = roundUp(offset, size)
+		if i == fi {
+			break
+		}
+		offset += size * n
+	}
+	return offset
+}
+
+// ctxAccessAllowed returns whether the access described by attr is allowed for the attach
+// type of the program.
+func (s *BpfProgState) ctxAccessAllowed(attr BpfCtxAccessAttr) bool {
+	return s.attachTypeAllowed(attr.attachTypes)
+}
+
+// genCtxAccess generates a statement that accesses a ctx field in a way other than the
+// full-width loads of CtxVars, as the access table of the program type allows: a write of
+// a random value, a narrow load of a part of the field or a wide load across array elements.
+// These go through the ctx access conversion of the verifier. It returns "" if the table
+// allows none of them.
+func (s *BpfProgState) genCtxAccess(r *randGen) string {
+	sd := s.ctxStruct()
+	if sd == nil {
+		return ""
+	}
+	var writes, narrows, wides []int
+	for i, ft := range sd.FieldTypes {
+		_, size, n := ctxFieldElem(ft)
+		if size == 0 || n == 0 {
+			continue
+		}
+		// A size other than the one of the field comes from a range or default entry
+		// that does not apply to it, e.g., 8-byte fields only take 8-byte accesses
+		read, write := s.pt.ctxAccess.accesses[2*i], s.pt.ctxAccess.accesses[2*i+1]
+		if write.canWrite && (write.size == 0 || write.size == size) && s.ctxAccessAllowed(write) {
+			writes = append(writes, i)
+		}
+		if read.canRead && s.ctxAccessAllowed(read) {
+			if read.narrowAccess && read.defaultSize == size {
+				narrows = append(narrows, i)
 			}
-			if argType == "ARG_PTR_TO_MAP_VALUE" || argType == "ARG_PTR_TO_MAP_VALUE_OR_NULL" || argType == "ARG_PTR_TO_UNINIT_MAP_VALUE" {
-				if call.ArgMap != nil && call.ArgMap.Val != nil {
-					//a.AccessSize = call.ArgMap.Val.Size
-					a.AccessSize = roundUp(call.ArgMap.Val.Size, 8)
-				}
+			if read.wideAccess && sd.ctxWideElems(i) != nil {
+				wides = append(wides, i)
 			}
-			if argType == "ARG_PTR_TO_MEM" || argType == "ARG_PTR_TO_MEM_OR_NULL" || argType == "ARG_PTR_TO_UNINIT_MEM" {
-				size := r.Intn(128)//XXX determine max
-				a.AccessSize = size
-				call.StackVarSize = size
+		}
+	}
+	var kinds []func() string
+	if len(writes) != 0 {
+		kinds = append(kinds, func() string {
+			i := writes[r.Intn(len(writes))]
+			_, size, n := ctxFieldElem(sd.FieldTypes[i])
+			if elems := sd.ctxWideElems(i); s.pt.ctxAccess.accesses[2*i+1].wideAccess && elems != nil && r.nOutOf(1, 2) {
+				return fmt.Sprintf("	*(uint64_t *)&ctx->%v[%v] = 0x%x;\n", sd.FieldNames[i], elems[r.Intn(len(elems))], r.randInt(64))
 			}
-			if argType == "ARG_PTR_TO_INT" {
-				a.AccessSize = 4
+			val := r.randInt(uint64(size * 8))
+			if size < 8 {
+				val &= 1<<uint(size*8) - 1
 			}
-			if argType == "ARG_PTR_TO_LONG" {
-				a.AccessSize = 8
+			return fmt.Sprintf("	ctx->%v = 0x%x;\n", ctxFieldRef(sd, i, n, r), val)
+		})
+	}
+	if len(narrows) != 0 {
+		kinds = append(kinds, func() string {
+			i := narrows[r.Intn(len(narrows))]
+			_, size, n := ctxFieldElem(sd.FieldTypes[i])
+			sizes := []int{1, 2, 4}
+			for len(sizes) > 1 && sizes[len(sizes)-1] >= size {
+				sizes = sizes[:len(sizes)-1]
 			}
-//			a.AccessSize = call.Hint.RetAccessSize
+			narrow := sizes[r.Intn(len(sizes))]
+			v := fmt.Sprintf("v%v", s.VarId)
+			s.VarId += 1
+			return fmt.Sprintf("	uint%v_t %v = *(volatile uint%v_t *)((void *)&ctx->%v + %v);\n",
+				narrow*8, v, narrow*8, ctxFieldRef(sd, i, n, r), narrow*r.Intn(size/narrow))
+		})
+	}
+	if len(wides) != 0 {
+		kinds = append(kinds, func() string {
+			i := wides[r.Intn(len(wides))]
+			elems := sd.ctxWideElems(i)
+			v := fmt.Sprintf("v%v", s.VarId)
+			s.VarId += 1
+			return fmt.Sprintf("	uint64_t %v = *(volatile uint64_t *)&ctx->%v[%v];\n", v, sd.FieldNames[i], elems[r.Intn(len(elems))])
+		})
+	}
+	if len(kinds) == 0 {
+		return ""
+	}
+	return kinds[r.Intn(len(kinds))]()
+}
+
+// ctxFieldRef returns the lvalue of the field fi of ctx, or of a random element of it if the field is an array.
+func ctxFieldRef(sd *StructDef, fi, n int, r *randGen) string {
+	if strings.Contains(sd.FieldTypes[fi], "[") {
+		return fmt.Sprintf("%v[%v]", sd.FieldNames[fi], r.Intn(n))
+	}
+	return sd.FieldNames[fi]
+}
+
+// ctxWideElems returns the elements of the array field fi of 4-byte integers that start
+// an 8-byte aligned 8-byte access within the field.
+func (sd *StructDef) ctxWideElems(fi int) []int {
+	_, size, n := ctxFieldElem(sd.FieldTypes[fi])
+	if size != 4 || !strings.Contains(sd.FieldTypes[fi], "[") {
+		return nil
+	}
+	var elems []int
+	offset := sd.ctxFieldOffset(fi)
+	for j := 0; j+1 < n; j++ {
+		if (offset+4*j)%8 == 0 {
+			elems = append(elems, j)
 		}
-		return a, true
 	}
-	return nil, false
+	return elems
 }
 
+// genCtxAccesses adds a few ctx accesses to the program.
+func (s *BpfProgState) genCtxAccesses(r *randGen) {
+	for n := r.Intn(4); n > 0; n-- {
+		if stmt := s.genCtxAccess(r); stmt != "" {
+			s.CtxAccesses = append(s.CtxAccesses, stmt)
+			s.trace(BpfTraceCtx, nil, -1, "%v", strings.TrimSpace(stmt))
+		}
+	}
+}
 
 //RET_INTEGER,                    /* function returns integer */
 //RET_VOID,                       /* function doesn't return anything */
@@ -2202,8 +3147,12 @@ func bpfRetType(call *BpfCall) string {
 		}
 	} else if call.Helper.Ret == "RET_PTR_TO_BTF_ID_OR_NULL" ||
 		call.Helper.Ret == "RET_PTR_TO_BTF_ID" {
+		if call.RetBtfId != "" {
+			return fmt.Sprintf("%v*", call.RetBtfId)
+		}
 		return fmt.Sprintf("%v*", call.Helper.RetBtfId)
 	} else if call.Helper.Ret == "RET_PTR_TO_ALLOC_MEM_OR_NULL" ||
+		call.Helper.Ret == "RET_PTR_TO_DYNPTR_MEM_OR_NULL" ||
 		call.Helper.Ret == "RET_PTR_TO_MEM_OR_BTF_ID_OR_NULL" ||
 		call.Helper.Ret == "RET_PTR_TO_MEM_OR_BTF_ID" {
 		return "void *"
@@ -2216,12 +3165,28 @@ func bpfRetType(call *BpfCall) string {
 	}
 }
 
-// recursion depth of genBpfHelperCall
-var rd int
+// helpers returns the helpers of the program type that the program can call. Helpers
+// that may sleep are only available to sleepable programs, helpers writing to the
+// seq_file only to iterators, and the ones in helperAttachTypes only to programs with
+// one of their expected attach types.
+func (s *BpfProgState) helpers() []*BpfHelperFunc {
+	iter := s.iterCtx() != nil
+	var helpers []*BpfHelperFunc
+	for _, helper := range s.pt.Helpers {
+		if (helper.Sleepable && !s.Sec.Sleepable) || (helper.IterOnly && !iter) {
+			continue
+		}
+		if !s.attachTypeAllowed(helperAttachTypes[helper.Enum]) {
+			continue
+		}
+		helpers = append(helpers, helper)
+	}
+	return helpers
+}
 
 func (s *BpfProgState) getBpfHelpers(enums []string) ([]*BpfHelperFunc) {
 	var helpers []*BpfHelperFunc
-	for _, helper := range s.pt.Helpers {
+	for _, helper := range s.helpers() {
 		for _, enum := range enums {
 			if helper.Enum == enum {
 				helpers = append(helpers, helper)
@@ -2232,9 +3197,11 @@ func (s *BpfProgState) getBpfHelpers(enums []string) ([]*BpfHelperFunc) {
 }
 
 func (s *BpfProgState) genBpfHelperCall(r *randGen, helper *BpfHelperFunc, hint *BpfCallGenHint, prepend bool) (*BpfCall, bool) {
-	rd += 1
-	if rd > 100 {
-		fmt.Printf("(%v) failed to gen helper call. Tried generating helper call resursively too hard\n", rd)
+	s.gen.rd += 1
+	defer func() { s.gen.rd -= 1 }()
+	if s.gen.rd > 100 {
+		fmt.Printf("(%v) failed to gen helper call. Tried generating helper call resursively too hard\n", s.gen.rd)
+		s.trace(BpfTraceFail, helper, -1, "recursion is too deep")
 		return nil, false
 	}
 
@@ -2243,23 +3210,26 @@ func (s *BpfProgState) genBpfHelperCall(r *randGen, helper *BpfHelperFunc, hint
 		preferredMapName = hint.PreferredMap.MapName
 	}
 	fmt.Printf("(%v) gen call[%v] hint: ArgHints=%v, RetAccessSize=%v, IsRetAccessRaw=%v, PreferredMap=%v\n",
-		rd, len(s.Calls), hint.ArgHints, hint.RetAccessSize, hint.IsRetAccessRaw, preferredMapName)
+		s.gen.rd, len(s.Calls), hint.ArgHints, hint.RetAccessSize, hint.IsRetAccessRaw, preferredMapName)
+	s.trace(BpfTraceCall, helper, -1, "%v", hint)
 
 	call := NewBpfCall(helper, hint)
 	attempt := 0
 	for i := 0; i < len(helper.Args); {
-		fmt.Printf("(%v) attempt=%v\n", rd, attempt)
+		fmt.Printf("(%v) attempt=%v\n", s.gen.rd, attempt)
 		if s.genBpfHelperCallArg(r, call, i) {
 			attempt = 0
 			i++
 		} else if attempt += 1; attempt > 50 {
 			fmt.Printf("failed to gen arg[%d] for %v\n", i , helper.Enum)
+			s.trace(BpfTraceFail, helper, i, "%v attempts failed", attempt-1)
 			return nil, false
 		}
 	}
 
 	// Do not acquire references if the program has no helper to release them
-	if call.isRefAcquireCall() == 1 && len(s.getBpfHelpers([]string{"BPF_FUNC_sk_release"})) == 0 {
+	if spec := s.refSpec(call, true, false, false); spec != nil && len(s.refHelpers(s.refClass(call, spec), false)) == 0 {
+		s.trace(BpfTraceFail, helper, -1, "no helper can release the acquired reference")
 		return nil, false
 	}
 
@@ -2273,8 +3243,6 @@ func (s *BpfProgState) genBpfHelperCall(r *randGen, helper *BpfHelperFunc, hint
 	} else {
 		s.Calls = append(s.Calls, call)
 	}
-	rd -= 1
-
 	return call, true
 }
 
@@ -2292,6 +3260,7 @@ var retToRegTypeMap = map[string]map[string]bool{
 	"RET_PTR_TO_MEM_OR_BTF_ID_OR_NULL": map[string]bool{"PTR_TO_MEM": true, "PTR_TO_BTF_ID":true},
 	"RET_PTR_TO_MEM_OR_BTF_ID":         map[string]bool{"PTR_TO_MEM": true, "PTR_TO_BTF_ID":true},
 	"RET_PTR_TO_BTF_ID":                map[string]bool{"PTR_TO_BTF_ID": true},
+	"RET_PTR_TO_DYNPTR_MEM_OR_NULL":    map[string]bool{"PTR_TO_MEM": true},
 }
 
 func helperCanReturn(helper *BpfHelperFunc, reg RegType, btfId string) bool {
@@ -2337,6 +3306,9 @@ func genHint(r *randGen, producer *BpfHelperFunc, consumer *BpfCall, arg int) *B
 	if consumerArg == "ARG_PTR_TO_CONST_STR" {
 		hint.ArgHints[HintGenConstStr] = true
 	}
+	if consumerArg == "ARG_PTR_TO_KPTR" {
+		hint.ArgHints[HintGenKptr] = true
+	}
 
 	if consumerArg == "ARG_PTR_TO_MAP_KEY" {
 		if consumer.ArgMap != nil && consumer.ArgMap.Key != nil {
@@ -2363,7 +3335,7 @@ func (s *BpfProgState) genRandBpfHelperCall(r *randGen, call *BpfCall, arg int)
 	a := NewBpfArg(call.Helper, arg)
 	var compatHelpers []*BpfHelperFunc
 	compatRegTypes, btfId := s.genCompatibleRegTypes(call, arg)
-	for _, helper := range s.pt.Helpers {
+	for _, helper := range s.helpers() {
 		for _, regType := range compatRegTypes {
 			if !helperCanReturn(helper, regType, btfId) {
 				continue
@@ -2372,7 +3344,7 @@ func (s *BpfProgState) genRandBpfHelperCall(r *randGen, call *BpfCall, arg int)
 				continue
 			}
 			compatHelpers = append(compatHelpers, helper)
-			fmt.Printf("(%v) compatible helper: %v\n", rd, helper.Enum)
+			fmt.Printf("(%v) compatible helper: %v\n", s.gen.rd, helper.Enum)
 		}
 	}
 
@@ -2382,6 +3354,7 @@ func (s *BpfProgState) genRandBpfHelperCall(r *randGen, call *BpfCall, arg int)
 
 	helper := compatHelpers[r.Intn(len(compatHelpers))]
 	hint := genHint(r, helper, call, arg)
+	s.trace(BpfTraceArg, call.Helper, arg, "return value of %v", helper.Enum)
 	prodCall, ok := s.genBpfHelperCall(r, helper, hint, false)
 	if ok {
 		argType := call.Helper.Args[arg]
@@ -2401,17 +3374,33 @@ func (s *BpfProgState) genRandBpfHelperCall(r *randGen, call *BpfCall, arg int)
 		} else if argType == "ARG_PTR_TO_CONST_STR" {
 			mi := findMember(s, retStruct, "char [8]")
 			a.Name = fmt.Sprintf("%v->e%v", prodCall.Ret, mi)
+		} else if argType == "ARG_PTR_TO_KPTR" {
+			mi := -1
+			si := findStruct(s, retStruct)
+			if si != -1 {
+				mi = s.Structs[si].findKptrMember()
+			}
+			if mi == -1 {
+				fmt.Printf("(%v) failed to find a kptr in %v\n", s.gen.rd, retStruct)
+				s.trace(BpfTraceReject, call.Helper, arg, "no kptr in %v", retStruct)
+				ok = false
+			} else {
+				call.RetBtfId = kptrFieldType(s.Structs[si].FieldTypes[mi])
+				a.Name = fmt.Sprintf("&%v->e%v", prodCall.Ret, mi)
+			}
 		} else if (prodCall.Helper.Ret == "RET_PTR_TO_MAP_VALUE" || prodCall.Helper.Ret == "RET_PTR_TO_MAP_VALUE_OR_NULL") &&
 			prodCall.ArgMap.Val != nil && len(prodCall.ArgMap.Val.FieldTypes) >= 2 {
 			var members []int
 			for mi, mt := range prodCall.ArgMap.Val.FieldTypes {
-				if mt != "struct bpf_spin_lock" && mt != "struct bpf_timer" &&
+				if mt != "struct bpf_spin_lock" && mt != "struct bpf_timer" && !isKptrField(mt) &&
 					(prodCall.ArgMap.Val.Size - prodCall.ArgMap.Val.offsetOfMember(mi) >= prodCall.Hint.RetAccessSize) {
 					members = append(members, mi)
 				}
 			}
 			if len(members) == 0 {
-				fmt.Printf("(%v) failed to find a valid offset in %v\n", rd, prodCall.ArgMap.MapName)
+				fmt.Printf("(%v) failed to find a valid offset in %v\n", s.gen.rd, prodCall.ArgMap.MapName)
+				s.trace(BpfTraceReject, call.Helper, arg, "no member of %v fits %v bytes",
+					prodCall.ArgMap.MapName, prodCall.Hint.RetAccessSize)
 				ok = false
 			} else {
 				a.Name = fmt.Sprintf("&%v->e%v", prodCall.Ret, members[r.Intn(len(members))])
@@ -2472,18 +3461,29 @@ func (brf *BpfRuntimeFuzzer) CompileBpfProg(src string, out string, s *BpfProgSt
 }
 
 func (brf *BpfRuntimeFuzzer) GenBpfSeedProg(r *randGen) *BpfProgState {
+	return brf.genBpfSeedProg(r, nil)
+}
+
+// GenCompatBpfSeedProg generates a seed program that can take the place of orig,
+// i.e., a program of the same type, section and attach options.
+func (brf *BpfRuntimeFuzzer) GenCompatBpfSeedProg(r *randGen, orig *BpfProgState) *BpfProgState {
+	return brf.genBpfSeedProg(r, orig)
+}
+
+func (brf *BpfRuntimeFuzzer) genBpfSeedProg(r *randGen, orig *BpfProgState) *BpfProgState {
 	var s *BpfProgState
 	genProgAttempt := 20
 	for i := 0; i < genProgAttempt; i++ {
 		for ok := false; !ok; {
-			s, ok = brf.GenBpfProg(r)
+			s, ok = brf.GenBpfProg(r, orig)
 		}
 		s.FixRef(r)
 		s.FixSpinLock(r)
-		base := fmt.Sprintf("/mnt/bpf_prog/prog_%x_%s", time.Now().UnixNano(), s.pt.Name)
+		s.FixTimer(r)
+		base := s.base()
 		s.WriteFuzzerSource(base+".c")
 		s.Path = base+".o"
-		s.WriteGob(base+".gob")
+		s.WriteText(base+".brf")
 
 		if brf.CompileBpfProg(base+".c", base+".o", s) {
 			break
@@ -2492,57 +3492,70 @@ func (brf *BpfRuntimeFuzzer) GenBpfSeedProg(r *randGen) *BpfProgState {
 	return s
 }
 
-func (brf *BpfRuntimeFuzzer) GenBpfProg(r *randGen) (*BpfProgState, bool) {
-	var ptKeys []string
-	for name, _ := range brf.progTypeMap {
-		ptKeys = append(ptKeys, name)
+// GenBpfProg generates a program of a random type. If orig is not nil, the program
+// has the same type, section and attach options as orig and shares its pinned maps.
+func (brf *BpfRuntimeFuzzer) GenBpfProg(r *randGen, orig *BpfProgState) (*BpfProgState, bool) {
+	var pt *BpfProgTypeDef
+	if orig != nil {
+		pt = orig.pt
+	} else {
+		pt = brf.progTypeMap[brf.progTypes[r.Intn(len(brf.progTypes))]]
 	}
 
-	pt := brf.progTypeMap[ptKeys[r.Intn(len(ptKeys))]]
-	helper := pt.Helpers[r.Intn(len(pt.Helpers))]
 	s := NewBpfProgState(brf, pt, r)
+	if orig != nil {
+		s.Sec = orig.Sec
+		s.SecStr = orig.SecStr
+		s.AttachOpt = orig.AttachOpt
+		s.AttachOpt.IntOpts = append([]int64{}, orig.AttachOpt.IntOpts...)
+		s.sharePinnedMaps(orig)
+	}
+
+	if iter := s.iterCtx(); iter != nil && len(iter.MapTypes) != 0 {
+		s.genIterMap(r, iter)
+	}
+
+	helpers := s.helpers()
+	// Nothing else reaches the paths only sleepable programs and iterators take, so
+	// start from a helper only they can call half of the time.
+	if exclusive := s.exclusiveHelpers(); len(exclusive) != 0 && r.nOutOf(1, 2) {
+		helpers = exclusive
+	}
+	if len(helpers) == 0 {
+		return s, false
+	}
+	helper := helpers[r.Intn(len(helpers))]
 
 	fmt.Printf("gen prog %v %v\n", pt.Name, helper.Enum)
-	rd = 0
+	s.trace(BpfTraceProg, helper, -1, "type %v %v", pt.Name, strings.TrimSpace(s.SecStr))
 	hint := newBpfCallGenHint(nil)
 	_, ok := s.genBpfHelperCall(r, helper, hint, false)
+	if ok {
+		s.genCtxAccesses(r)
+	}
 	return s, ok
 }
 
 func RestoreBpfSeedProg(brf *BpfRuntimeFuzzer, prog string) *BpfProgState {
-	prefix := strings.Index(prog, "prog_")
-	postfix := strings.Index(prog, ".")
-	ptStr := ""
-	if prefix != -1 && postfix != -1 {
-		ptStr = prog[prefix+22:postfix]
-	}
-	pt, ok := brf.progTypeMap[ptStr]
-	fmt.Printf("restore prog %v pt %v %v\n", prog, ptStr, ok)
-	if !ok {
+	s, err := brf.restoreBpfProgState(prog)
+	if err != nil {
+		fmt.Printf("restore prog %v failed: %v\n", prog, err)
 		return nil
 	}
-
-	gob := prog[:len(prog)-1] + "gob"
-	s := NewBpfProgState(brf, pt, nil)
-	s.ReadGob(gob)
-	fmt.Printf("restore calls %v maps %v\n", len(s.Calls), len(s.Maps))
+	fmt.Printf("restore prog %v pt %v calls %v maps %v\n", prog, s.pt.Name, len(s.Calls), len(s.Maps))
 	return s
 }
 
+// MutBpfSeedProg mutates the program compiled to prog and compiles the result. It returns nil
+// if the model of the program cannot be restored, e.g. for a program embedded in a test that
+// comes from another machine, so that the program is kept rather than replaced.
 func (brf *BpfRuntimeFuzzer) MutBpfSeedProg(r *randGen, prog string) *BpfProgState {
-	prefix := strings.Index(prog, "prog_")
-	postfix := strings.Index(prog, ".")
-	ptStr := ""
-	if prefix != -1 && postfix != -1 {
-		ptStr = prog[prefix+22:postfix]
-	}
-	pt, ok := brf.progTypeMap[ptStr]
-	if !ok {
-		return brf.GenBpfSeedProg(r)
+	s, err := brf.restoreBpfProgState(prog)
+	if err != nil {
+		fmt.Printf("restore prog %v failed: %v\n", prog, err)
+		return nil
 	}
-
-	s := NewBpfProgState(brf, pt, r)
-	s.ReadGob(prog)
+	s.restartTrace(prog)
 
 	mutProgAttempt := 20
 	for i := 0; i < mutProgAttempt; i++ {
@@ -2551,11 +3564,12 @@ func (brf *BpfRuntimeFuzzer) MutBpfSeedProg(r *randGen, prog string) *BpfProgSta
 		}
 		s.FixRef(r)
 		s.FixSpinLock(r)
+		s.FixTimer(r)
 
-		base := fmt.Sprintf("/mnt/bpf_prog/prog_%x_%s", time.Now().UnixNano(), s.pt.Name)
+		base := s.base()
 		s.WriteFuzzerSource(base+".c")
 		s.Path = base+".o"
-		s.WriteGob(base+".gob")
+		s.WriteText(base+".brf")
 
 		if brf.CompileBpfProg(base+".c", base+".o", s) {
 			break
@@ -2576,159 +3590,288 @@ func (brf *BpfRuntimeFuzzer) MutBpfProg(r *randGen, s *BpfProgState) bool {
 		return false
 	}
 
+	s.beginGen()
+	if r.nOutOf(1, 5) {
+		if stmt := s.genCtxAccess(r); stmt != "" {
+			if len(s.CtxAccesses) != 0 && r.nOutOf(1, 2) {
+				i := r.Intn(len(s.CtxAccesses))
+				s.trace(BpfTraceMutate, nil, -1, "replace %v", strings.TrimSpace(s.CtxAccesses[i]))
+				s.CtxAccesses[i] = stmt
+			} else {
+				s.trace(BpfTraceMutate, nil, -1, "add a ctx access")
+				s.CtxAccesses = append(s.CtxAccesses, stmt)
+			}
+			s.trace(BpfTraceCtx, nil, -1, "%v", strings.TrimSpace(stmt))
+			return true
+		}
+	}
 	call := calls[r.Intn(len(calls))]
 	arg := r.Intn(len(call.Args))
+	old := "nil"
+	if call.Args[arg] != nil {
+		old = call.Args[arg].Name
+	}
+	s.trace(BpfTraceMutate, call.Helper, arg, "replace %v", old)
 	return s.genBpfHelperCallArg(r, call, arg)
 }
 
 type ObjRef struct {
-	vars     []string
-	objMap   *BpfMap
-	typ      int
-	count    int
-	calls    []*BpfCall
+	vars   []string
+	objMap *BpfMap
+	class  BpfRefClass
+	count  int
+	calls  []*BpfCall
+	specs  []*BpfRefSpec
+	// The release call and spec that first released the reference more often than it was acquired.
+	overCall *BpfCall
+	overSpec *BpfRefSpec
+}
+
+// refSpecs returns the reference semantics of the helper or kfunc called by call.
+func (s *BpfProgState) refSpecs(call *BpfCall) []*BpfRefSpec {
+	specs, ok := s.brf.refFuncMap[call.Helper.Enum]
+	if !ok {
+		specs = s.brf.refFuncMap[call.Helper.Name]
+	}
+	var res []*BpfRefSpec
+	for i, spec := range specs {
+		if len(spec.MapTypes) != 0 {
+			if call.ArgMap == nil {
+				continue
+			}
+			match := false
+			for _, typ := range spec.MapTypes {
+				match = match || call.ArgMap.MapType == typ
+			}
+			if !match {
+				continue
+			}
+		}
+		res = append(res, &specs[i])
+	}
+	return res
 }
 
-func (call *BpfCall) isRefAcquireCall() int {
-	refType := -1
-	if call.Helper.Enum == "BPF_FUNC_sk_lookup_tcp" || call.Helper.Enum == "BPF_FUNC_sk_lookup_udp" || call.Helper.Enum == "BPF_FUNC_skc_lookup_tcp" ||
-		(call.Helper.Enum == "BPF_FUNC_map_lookup_elem" && (call.ArgMap.MapType == "BPF_MAP_TYPE_SOCKMAP" || call.ArgMap.MapType == "BPF_MAP_TYPE_SOCKHASH")) {
-		refType = 1
+func (s *BpfProgState) refSpec(call *BpfCall, acquire, release, propagate bool) *BpfRefSpec {
+	for _, spec := range s.refSpecs(call) {
+		if (acquire && spec.Acquire) || (release && spec.Release) || (propagate && spec.Propagate) {
+			return spec
+		}
 	}
-	if call.Helper.Enum == "BPF_FUNC_ringbuf_reserve" {
-		refType = 2
+	return nil
+}
+
+// exclusiveHelpers returns the helpers the program can call that are only available to
+// sleepable programs or iterators.
+func (s *BpfProgState) exclusiveHelpers() []*BpfHelperFunc {
+	var helpers []*BpfHelperFunc
+	for _, helper := range s.helpers() {
+		if helper.Sleepable || helper.IterOnly {
+			helpers = append(helpers, helper)
+		}
 	}
-	return refType
+	return helpers
 }
 
-func (call *BpfCall) isRefReleaseCall() int {
-	refType := -1
-	if call.Helper.Enum == "BPF_FUNC_sk_release" {
-		refType = 1
+// refHelpers returns the helpers of the program type that acquire (or release) references of class.
+// Only helpers that acquire references through their return value are considered, since
+// the others need the reference to be prepared by the caller.
+func (s *BpfProgState) refHelpers(class BpfRefClass, acquire bool) []*BpfHelperFunc {
+	var helpers []*BpfHelperFunc
+	for _, helper := range s.helpers() {
+		specs, ok := s.brf.refFuncMap[helper.Enum]
+		if !ok {
+			specs = s.brf.refFuncMap[helper.Name]
+		}
+		for _, spec := range specs {
+			if spec.Class != class {
+				continue
+			}
+			if (acquire && spec.Acquire && spec.RefArg == RefRet) || (!acquire && spec.Release) {
+				helpers = append(helpers, helper)
+				break
+			}
+		}
 	}
-	if call.Helper.Enum == "BPF_FUNC_ringbuf_submit" || call.Helper.Enum == "BPF_FUNC_ringbuf_discard" {
-		refType = 2
+	return helpers
+}
+
+// refClass returns the class of the reference, resolving kptrs to the class of the pointee.
+func (s *BpfProgState) refClass(call *BpfCall, spec *BpfRefSpec) BpfRefClass {
+	if class, ok := kptrRefClasses[call.RetBtfId]; ok && spec.Class == RefClassKptr {
+		return class
 	}
-	return refType
+	return spec.Class
 }
 
-func (call *BpfCall) isRefPropagateCall() int {
-	refType := -1
-	if call.Helper.Enum == "BPF_FUNC_tcp_sock" || call.Helper.Enum == "BPF_FUNC_sk_fullsock" ||
-		call.Helper.Enum == "BPF_FUNC_skc_to_tcp_sock" || call.Helper.Enum == "BPF_FUNC_skc_to_tcp6_sock" ||
-		call.Helper.Enum == "BPF_FUNC_skc_to_udp6_sock" || call.Helper.Enum == "BPF_FUNC_skc_to_tcp_timewait_sock" ||
-		call.Helper.Enum == "BPF_FUNC_skc_to_tcp_request_sock" {
-		refType = 1
+func (s *BpfProgState) refVar(call *BpfCall, spec *BpfRefSpec) string {
+	if spec.RefArg == RefRet {
+		return call.Ret
 	}
-	return refType
+	return call.Args[spec.RefArg].Name
 }
 
+// FixRef makes every reference acquired by the program released exactly once on every path.
+// Releases of references that are never acquired get an acquiring call prepended, and leaking
+// references get a release call added as declared by the RefFuncMap entry of the release helper.
 func (s *BpfProgState) FixRef(r *randGen) {
+	s.beginGen()
 	objRefMap := make(map[string]*ObjRef)
+	var refs []*ObjRef
+	newRef := func(v string, call *BpfCall, spec *BpfRefSpec) *ObjRef {
+		ref, ok := objRefMap[v]
+		if !ok {
+			ref = &ObjRef{vars: []string{v}, objMap: call.ArgMap, class: s.refClass(call, spec), count: 0,
+				calls: []*BpfCall{call}, specs: []*BpfRefSpec{spec}}
+			objRefMap[v] = ref
+			refs = append(refs, ref)
+		}
+		return ref
+	}
 	for i, call := range s.Calls {
-		if refType := call.isRefAcquireCall(); refType != -1 {
-			v := call.Ret
-			if _, ok := objRefMap[v]; !ok {
-				objRefMap[v] = &ObjRef{vars: []string{v}, objMap: call.ArgMap, typ: refType, count: 0, calls: []*BpfCall{call}}
-			}
-			objRefMap[v].count += 1
-			fmt.Printf("ref(%v:%v) acquired by call #%v %v\n", v, objRefMap[v].count, i, call.Helper.Enum)
-		}
-		if refType := call.isRefReleaseCall(); refType != -1 {
-			v := call.Args[0].Name
-			if _, ok := objRefMap[v]; !ok {
-				objRefMap[v] = &ObjRef{vars: []string{v}, objMap: call.ArgMap, typ: refType, count: 0, calls: []*BpfCall{call}}
-			}
-			objRefMap[v].count -= 1
-			fmt.Printf("ref(%v:%v) released by call #%v %v\n", v, objRefMap[v].count, i, call.Helper.Enum)
-		}
-		if refType := call.isRefPropagateCall(); refType != -1 {
-			v := call.Args[0].Name
-			vp := call.Ret
-			if ref, ok := objRefMap[v]; ok {
-				ref.calls = append(ref.calls, call)
-				ref.vars = append(ref.vars, vp)
-				objRefMap[vp] = ref
-				fmt.Printf("ref(%v:%v) propagated by call #%v %v\n", v, objRefMap[v].count, i, call.Helper.Enum)
-			} else {
-				fmt.Printf("ref(%v:0) propagated by call #%v %v\n", v, i, call.Helper.Enum)
+		for _, spec := range s.refSpecs(call) {
+			switch {
+			case spec.Acquire:
+				v := s.refVar(call, spec)
+				ref := newRef(v, call, spec)
+				ref.count += 1
+				fmt.Printf("ref(%v:%v) acquired by call #%v %v\n", v, ref.count, i, call.Helper.Enum)
+			case spec.Release:
+				v := s.refVar(call, spec)
+				if v == "NULL" {
+					continue
+				}
+				ref := newRef(v, call, spec)
+				ref.count -= 1
+				if ref.count < 0 && ref.overCall == nil {
+					ref.overCall, ref.overSpec = call, spec
+				}
+				fmt.Printf("ref(%v:%v) released by call #%v %v\n", v, ref.count, i, call.Helper.Enum)
+			case spec.Propagate:
+				v := s.refVar(call, spec)
+				vp := call.Ret
+				if ref, ok := objRefMap[v]; ok {
+					ref.calls = append(ref.calls, call)
+					ref.specs = append(ref.specs, spec)
+					ref.vars = append(ref.vars, vp)
+					objRefMap[vp] = ref
+					fmt.Printf("ref(%v:%v) propagated by call #%v %v\n", v, ref.count, i, call.Helper.Enum)
+				} else {
+					fmt.Printf("ref(%v:0) propagated by call #%v %v\n", v, i, call.Helper.Enum)
+				}
 			}
 		}
 	}
 
-	for _, ref := range objRefMap {
+	for _, ref := range refs {
 		if ref.count < 0 {
 			// Add a ref-acquire helper
-			if ref.typ == 1 {
-				helpers := s.getBpfHelpers([]string{"BPF_FUNC_sk_lookup_tcp", "BPF_FUNC_sk_lookup_udp", "BPF_FUNC_skc_lookup_tcp", "BPF_FUNC_map_lookup_elem"})
-				if len(helpers) > 0 {
-					helper := helpers[r.Intn(len(helpers))]
-					hint := newBpfCallGenHint(ref.objMap)
-					if prodCall, ok := s.genBpfHelperCall(r, helper, hint, true); ok {//XXX change to ENUM append, prepend, random
-						ref.calls[0].Args[0].Name = prodCall.Ret
-						fmt.Printf("ref: fix releasing invalid ref(%v:%v) by adding %v\n", ref.vars[0], ref.count, helper.Enum)
-					} else {
-						fmt.Printf("ref: fix releasing invalid ref(%v:%v) failed since no helper can acquire the reference\n", ref.vars[0], ref.count)
-					}
-				}
+			helpers := s.refHelpers(ref.class, true)
+			if len(helpers) == 0 {
+				fmt.Printf("ref: fix releasing invalid ref(%v:%v) failed since no helper can acquire the reference\n", ref.vars[0], ref.count)
+				continue
 			}
-			if ref.typ == 2 {
-				helpers := s.getBpfHelpers([]string{"BPF_FUNC_ringbuf_reserve"})
-				if len(helpers) > 0 {
-					helper := helpers[r.Intn(len(helpers))]
-					hint := newBpfCallGenHint(ref.objMap)
-					if prodCall, ok := s.genBpfHelperCall(r, helper, hint, true); ok {
-						ref.calls[0].Args[0].Name = prodCall.Ret
-						fmt.Printf("ref: fix releasing invalid ref(%v:%v) by adding %v\n", ref.vars[0], ref.count, helper.Enum)
-					} else {
-						fmt.Printf("ref: fix releasing invalid ref(%v:%v) failed since no helper can acquire the reference\n", ref.vars[0], ref.count)
-					}
-				}
+			helper := helpers[r.Intn(len(helpers))]
+			hint := newBpfCallGenHint(ref.objMap)
+			if prodCall, ok := s.genBpfHelperCall(r, helper, hint, true); ok {//XXX change to ENUM append, prepend, random
+				ref.overCall.Args[ref.overSpec.RefArg].Name = prodCall.Ret
+				s.trace(BpfTraceFix, helper, -1, "acquire %v released by %v", prodCall.Ret, ref.overCall.Helper.Enum)
+				fmt.Printf("ref: fix releasing invalid ref(%v:%v) by adding %v\n", ref.vars[0], ref.count, helper.Enum)
+			} else {
+				fmt.Printf("ref: fix releasing invalid ref(%v:%v) failed since no helper can acquire the reference\n", ref.vars[0], ref.count)
 			}
 		}
 		if ref.count > 0 {
 			// Add a ref-release helper
-			if ref.typ == 1 {
-				helpers := s.getBpfHelpers([]string{"BPF_FUNC_sk_release"})
-				if len(helpers) > 0 {
-					helper := helpers[r.Intn(len(helpers))]
-					hint := newBpfCallGenHint(ref.objMap)
-					//s.genBpfHelperCall(r, h, hint, false)
-					call := NewBpfCall(helper, hint)
-					a0 := NewBpfArg(helper, 0)
-					a0.Name = ref.vars[r.Intn(len(ref.vars))]
-					call.Args[0] = a0
-					ref.calls[0].PostCalls = append(ref.calls[0].PostCalls, call)
-					//s.Calls = append(s.Calls, call)
-					ref.count = 0
-					fmt.Printf("ref: fixing leaking ref(%v:%v) by adding %v\n", ref.vars[0], ref.count, helper.Enum)
-				} else {
-					fmt.Printf("ref: fixing leaking ref(%v:%v) failed since no helper can release the reference\n", ref.vars[0], ref.count)
-				}
+			helpers := s.refHelpers(ref.class, false)
+			if len(helpers) == 0 {
+				fmt.Printf("ref: fixing leaking ref(%v:%v) failed since no helper can release the reference\n", ref.vars[0], ref.count)
+				continue
 			}
-			if ref.typ == 2 {
-				helpers := s.getBpfHelpers([]string{"BPF_FUNC_ringbuf_submit", "BPF_FUNC_ringbuf_discard"})
-				if len(helpers) > 0 {
-					helper := helpers[r.Intn(len(helpers))]
-					hint := newBpfCallGenHint(ref.objMap)
-					//s.genBpfHelperCall(r, h, hint, false)
-					call := NewBpfCall(helper, hint)
-					a0 := NewBpfArg(helper, 0)
-					a0.Name = ref.vars[r.Intn(len(ref.vars))]
-					call.Args[0] = a0
-					a1 := NewBpfArg(helper, 1)
-					a1.Name = "0"
-					a1.IsNotNull = true
-					call.Args[1] = a1
-					s.Calls = append(s.Calls, call)
-					ref.count = 0
-					fmt.Printf("ref: fixing leaking ref(%v:%v) by adding %v\n", ref.vars[0], ref.count, helper.Enum)
-				} else {
-					fmt.Printf("ref: fixing leaking ref(%v:%v) failed since no helper can release the reference\n", ref.vars[0], ref.count)
-				}
+			helper := helpers[r.Intn(len(helpers))]
+			call := s.newRefReleaseCall(r, helper, ref)
+			if call == nil {
+				fmt.Printf("ref: fixing leaking ref(%v:%v) failed since %v cannot release the reference\n", ref.vars[0], ref.count, helper.Enum)
+				continue
+			}
+			// Release the only reference of the program on an early return path as well.
+			if len(refs) == 1 && r.oneOf(3) {
+				call.ExitCond = s.genExitCond(r, ref.calls[0])
+			}
+			if s.refSpec(call, false, true, false).Placement == RefReleasePostCall {
+				ref.calls[0].PostCalls = append(ref.calls[0].PostCalls, call)
+			} else {
+				s.Calls = append(s.Calls, call)
 			}
+			ref.count = 0
+			s.trace(BpfTraceFix, helper, -1, "release %v acquired by %v", ref.vars[0], ref.calls[0].Helper.Enum)
+			fmt.Printf("ref: fixing leaking ref(%v:%v) by adding %v\n", ref.vars[0], ref.count, helper.Enum)
+		}
+	}
+}
+
+// changesPktData returns whether the call or any of its post calls moves the packet.
+func (call *BpfCall) changesPktData() bool {
+	for _, c := range append([]*BpfCall{call}, call.PostCalls...) {
+		if PktDataChangers[c.Helper.Enum] {
+			return true
+		}
+	}
+	return false
+}
+
+func (call *BpfCall) argList() string {
+	var args []string
+	for _, arg := range call.Args {
+		args = append(args, arg.Name)
+	}
+	return strings.Join(args, ", ")
+}
+
+// newRefReleaseCall creates a call to helper that releases ref. The other arguments
+// take the values declared in the release spec.
+func (s *BpfProgState) newRefReleaseCall(r *randGen, helper *BpfHelperFunc, ref *ObjRef) *BpfCall {
+	hint := newBpfCallGenHint(ref.objMap)
+	call := NewBpfCall(helper, hint)
+	spec := s.refSpec(call, false, true, false)
+	if spec == nil || spec.RefArg == RefRet {
+		return nil
+	}
+	for i := range helper.Args {
+		a := NewBpfArg(helper, i)
+		if i == spec.RefArg {
+			a.Name = ref.vars[r.Intn(len(ref.vars))]
+			a.IsNotNull = strings.HasPrefix(a.Name, "&") // references in stack slots, e.g., dynptrs
+		} else if v, ok := spec.FixedArgs[i]; ok {
+			a.Name = v
+			a.IsNotNull = true
+		} else {
+			return nil
 		}
+		call.Args[i] = a
 	}
+	return call
+}
+
+// genExitCond generates the condition of an early return path. The condition depends on
+// a scalar returned by a call made before the call acquiring the reference, or on a random number.
+func (s *BpfProgState) genExitCond(r *randGen, acquire *BpfCall) string {
+	var scalars []string
+	for _, call := range s.Calls {
+		if call == acquire {
+			break
+		}
+		if call.Helper.Ret == "RET_INTEGER" && call.Ret != "" {
+			scalars = append(scalars, call.Ret)
+		}
+	}
+	if len(scalars) != 0 {
+		return fmt.Sprintf("%v & %v", scalars[r.Intn(len(scalars))], 1<<uint(r.Intn(8)))
+	}
+	if s.pt.getHelper("BPF_FUNC_get_prandom_u32") != nil {
+		return fmt.Sprintf("bpf_get_prandom_u32() & %v", 1<<uint(r.Intn(8)))
+	}
+	return ""
 }
 
 func (s *BpfProgState) FixSpinLock(r *randGen) {
@@ -2745,6 +3888,7 @@ func (s *BpfProgState) FixSpinLock(r *randGen) {
 					lockHeld = a0.Name
 					s.Calls = append(s.Calls[:i+1], s.Calls[i:]...)
 					s.Calls[i] = call
+					s.trace(BpfTraceFix, helper, -1, "lock %v before unlocking it", a0.Name)
 				} else {
 					fmt.Printf("spinlock: fixing spinlock failed since no helper can lock the spinlock\n")
 					break
@@ -2754,6 +3898,7 @@ func (s *BpfProgState) FixSpinLock(r *randGen) {
 					lockHeld = ""
 				} else {
 					fmt.Printf("spinlock: fixing a mismatch spin_unlock\n")
+					s.trace(BpfTraceFix, call.Helper, 0, "unlock %v instead of %v", lockHeld, call.Args[0].Name)
 					call.Args[0].Name = lockHeld
 				}
 			}
@@ -2769,6 +3914,7 @@ func (s *BpfProgState) FixSpinLock(r *randGen) {
 					lockHeld = a0.Name
 					s.Calls = append(s.Calls[:i+1], s.Calls[i:]...)
 					s.Calls[i+1] = call
+					s.trace(BpfTraceFix, helper, -1, "unlock %v after locking it", a0.Name)
 				} else {
 					fmt.Printf("spinlock: fixing spinlock failed since no helper can unlock the spinlock\n")
 					break
@@ -2780,6 +3926,67 @@ func (s *BpfProgState) FixSpinLock(r *randGen) {
 	}
 }
 
+// FixTimer arms the timers the program uses. Timer helpers fail at runtime unless the timer is
+// initialized and has a callback, so the first call on each timer is followed by calls that
+// initialize it, set a callback and start it with a short expiry. The callback may then still
+// be pending when userspace deletes the element or frees the map the timer is embedded in.
+func (s *BpfProgState) FixTimer(r *randGen) {
+	armed := make(map[string]bool)
+	for _, call := range s.Calls {
+		if len(call.Args) == 0 || call.Helper.Args[0] != "ARG_PTR_TO_TIMER" || call.Args[0] == nil || call.ArgMap == nil {
+			continue
+		}
+		timer := call.Args[0].Name
+		for _, pcall := range call.PostCalls {
+			if pcall.Helper.Enum == "BPF_FUNC_timer_start" && pcall.Args[0].Name == timer {
+				armed[timer] = true
+			}
+		}
+		if armed[timer] {
+			continue
+		}
+		armed[timer] = true
+		var calls []*BpfCall
+		for _, enum := range []string{"BPF_FUNC_timer_init", "BPF_FUNC_timer_set_callback", "BPF_FUNC_timer_start"} {
+			helper := s.pt.getHelper(enum)
+			if helper == nil {
+				fmt.Printf("timer: fixing timer failed since %v is not available\n", enum)
+				calls = nil
+				break
+			}
+			pcall := NewBpfCall(helper, newBpfCallGenHint(nil))
+			pcall.ArgMap = call.ArgMap
+			pcall.Args[0] = NewBpfArg(helper, 0)
+			pcall.Args[0].Name = timer
+			switch enum {
+			case "BPF_FUNC_timer_init":
+				pcall.Args[1] = NewBpfArg(helper, 1)
+				pcall.Args[1].Name = fmt.Sprintf("&%v", call.ArgMap.MapName)
+				pcall.Args[2] = NewBpfArg(helper, 2)
+				// CLOCK_MONOTONIC, CLOCK_REALTIME or CLOCK_BOOTTIME, vmlinux.h does not define them
+				pcall.Args[2].Name = []string{"1", "0", "7"}[r.Intn(3)]
+			case "BPF_FUNC_timer_set_callback":
+				pcall.Args[1] = PtrToFuncRegType{}.Generate(s, r, pcall, 1)
+			case "BPF_FUNC_timer_start":
+				pcall.Args[1] = NewBpfArg(helper, 1)
+				pcall.Args[1].Name = fmt.Sprint(genTimerExpiry(r))
+				pcall.Args[2] = NewBpfArg(helper, 2)
+				pcall.Args[2].Name = "0"
+			}
+			if pcall.Args[1] == nil {
+				fmt.Printf("timer: fixing timer failed since %v has no callback\n", call.ArgMap.MapName)
+				calls = nil
+				break
+			}
+			calls = append(calls, pcall)
+		}
+		if len(calls) != 0 {
+			call.PostCalls = append(call.PostCalls, calls...)
+			s.trace(BpfTraceFix, call.Helper, -1, "arm %v after %v", timer, call.Helper.Enum)
+		}
+	}
+}
+
 //417-program exit
 func genRandReturnVal(r *randGen, progType string) int {
 	retVal := 0
@@ -2812,7 +4019,29 @@ func genRandReturnVal(r *randGen, progType string) int {
 	return retVal
 }
 
+// base returns the path of the files of the program without the extension. The path is
+// derived from the source, so the same program is always stored in the same files.
+func (prog *BpfProgState) base() string {
+	sig := hash.Hash(prog.Source())
+	return fmt.Sprintf("/mnt/bpf_prog/prog_%016x_%s", uint64(sig.Truncate64()), prog.pt.Name)
+}
+
 func (prog *BpfProgState) WriteFuzzerSource(path string) {
+	s := prog.Source()
+	fmt.Printf("\n%s\n", s)
+
+	outf, err := os.Create(path)
+	if err != nil {
+		fmt.Printf("failed to create output file: %v", err)
+		return
+	}
+	defer outf.Close()
+
+	outf.Write(s)
+}
+
+// Source returns the C source of the program.
+func (prog *BpfProgState) Source() []byte {
 	s := new(bytes.Buffer)
 	fmt.Fprintf(s, "#include \"/usr/local/include/vmlinux.h\"\n")
 	fmt.Fprintf(s, "#include \"/usr/include/bpf/bpf_helpers.h\"\n\n")
@@ -2827,46 +4056,52 @@ func (prog *BpfProgState) WriteFuzzerSource(path string) {
 	fmt.Fprintf(s, "        __attribute__((section(name), used))                            \\\n")
 	fmt.Fprintf(s, "        _Pragma(\"GCC diagnostic pop\")                                   \n\n")
 
-	fmt.Fprintf(s, "#define __ksym __attribute__((section(\".ksyms\")))\n\n")
+	fmt.Fprintf(s, "#define __ksym __attribute__((section(\".ksyms\")))\n")
+	fmt.Fprintf(s, "#define __kptr __attribute__((btf_type_tag(\"kptr\")))\n\n")
 
-	fmt.Fprintf(s, "#define DEFINE_BPF_MAP(the_map, TypeOfMap, MapFlags, TypeOfKey, TypeOfValue, MaxEntries) \\\n")
+	fmt.Fprintf(s, "#define DEFINE_BPF_MAP(the_map, TypeOfMap, MapFlags, MapPinning, TypeOfKey, TypeOfValue, MaxEntries) \\\n")
 	fmt.Fprintf(s, "        struct {                                                        \\\n")
 	fmt.Fprintf(s, "            __uint(type, TypeOfMap);                                    \\\n")
 	fmt.Fprintf(s, "            __uint(map_flags, (MapFlags));                              \\\n")
+	fmt.Fprintf(s, "            __uint(pinning, (MapPinning));                              \\\n")
 	fmt.Fprintf(s, "            __uint(max_entries, (MaxEntries));                          \\\n")
 	fmt.Fprintf(s, "            __type(key, TypeOfKey);                                     \\\n")
 	fmt.Fprintf(s, "            __type(value, TypeOfValue);                                 \\\n")
 	fmt.Fprintf(s, "        } the_map SEC(\".maps\");\n\n")
 
-	fmt.Fprintf(s, "#define DEFINE_BPF_MAP_IN_MAP(the_map, TypeOfMap, MapFlags, TypeOfKey, TypeOfValue, MaxEntries, innerMap) \\\n")
+	fmt.Fprintf(s, "#define DEFINE_BPF_MAP_IN_MAP(the_map, TypeOfMap, MapFlags, MapPinning, TypeOfKey, TypeOfValue, MaxEntries, innerMap) \\\n")
 	fmt.Fprintf(s, "        struct {                                                        \\\n")
 	fmt.Fprintf(s, "            __uint(type, TypeOfMap);                                    \\\n")
 	fmt.Fprintf(s, "            __uint(map_flags, (MapFlags));                              \\\n")
+	fmt.Fprintf(s, "            __uint(pinning, (MapPinning));                              \\\n")
 	fmt.Fprintf(s, "            __uint(max_entries, (MaxEntries));                          \\\n")
 	fmt.Fprintf(s, "            __type(key, TypeOfKey);                                     \\\n")
 	fmt.Fprintf(s, "            __array(values, typeof(innerMap));                          \\\n")
 	fmt.Fprintf(s, "        } the_map SEC(\".maps\") = { .values = {&innerMap}, };\n\n")
 
-	fmt.Fprintf(s, "#define DEFINE_BPF_MAP_NO_KEY(the_map, TypeOfMap, MapFlags, TypeOfValue, MaxEntries) \\\n")
+	fmt.Fprintf(s, "#define DEFINE_BPF_MAP_NO_KEY(the_map, TypeOfMap, MapFlags, MapPinning, TypeOfValue, MaxEntries) \\\n")
 	fmt.Fprintf(s, "        struct {                                                        \\\n")
 	fmt.Fprintf(s, "            __uint(type, TypeOfMap);                                    \\\n")
 	fmt.Fprintf(s, "            __uint(map_flags, (MapFlags));                              \\\n")
+	fmt.Fprintf(s, "            __uint(pinning, (MapPinning));                              \\\n")
 	fmt.Fprintf(s, "            __uint(max_entries, (MaxEntries));                          \\\n")
 	fmt.Fprintf(s, "            __type(value, TypeOfValue);                                 \\\n")
 	fmt.Fprintf(s, "        } the_map SEC(\".maps\");\n\n")
 
-	fmt.Fprintf(s, "#define DEFINE_BPF_MAP_NO_VAL(the_map, TypeOfMap, MapFlags, TypeOfKey, MaxEntries) \\\n")
+	fmt.Fprintf(s, "#define DEFINE_BPF_MAP_NO_VAL(the_map, TypeOfMap, MapFlags, MapPinning, TypeOfKey, MaxEntries) \\\n")
 	fmt.Fprintf(s, "        struct {                                                        \\\n")
 	fmt.Fprintf(s, "            __uint(type, TypeOfMap);                                    \\\n")
 	fmt.Fprintf(s, "            __uint(map_flags, (MapFlags));                              \\\n")
+	fmt.Fprintf(s, "            __uint(pinning, (MapPinning));                              \\\n")
 	fmt.Fprintf(s, "            __uint(max_entries, (MaxEntries));                          \\\n")
 	fmt.Fprintf(s, "            __type(key, TypeOfKey);                                     \\\n")
 	fmt.Fprintf(s, "        } the_map SEC(\".maps\");\n\n")
 
-	fmt.Fprintf(s, "#define DEFINE_BPF_MAP_NO_KEY_VAL(the_map, TypeOfMap, MapFlags, MaxEntries) \\\n")
+	fmt.Fprintf(s, "#define DEFINE_BPF_MAP_NO_KEY_VAL(the_map, TypeOfMap, MapFlags, MapPinning, MaxEntries) \\\n")
 	fmt.Fprintf(s, "        struct {                                                        \\\n")
 	fmt.Fprintf(s, "            __uint(type, TypeOfMap);                                    \\\n")
 	fmt.Fprintf(s, "            __uint(map_flags, (MapFlags));                              \\\n")
+	fmt.Fprintf(s, "            __uint(pinning, (MapPinning));                              \\\n")
 	fmt.Fprintf(s, "            __uint(max_entries, (MaxEntries));                          \\\n")
 	fmt.Fprintf(s, "        } the_map SEC(\".maps\");\n\n")
 
@@ -2891,28 +4126,45 @@ func (prog *BpfProgState) WriteFuzzerSource(path string) {
 		fmt.Fprintf(s, "} %v;\n\n", t.Name)
 	}
 
-	for v, t := range prog.Externs {
-		fmt.Fprintf(s, "extern const %s %s __ksym;\n\n", t, v)
+	for _, v := range sortedKeys(prog.Externs) {
+		fmt.Fprintf(s, "extern const %s %s __ksym;\n\n", prog.Externs[v], v)
+	}
+
+	kfuncs := make(map[string]bool)
+	for _, call := range prog.Calls {
+		for _, c := range append([]*BpfCall{call}, call.PostCalls...) {
+			if c.Helper.Kfunc && !kfuncs[c.Helper.Name] {
+				kfuncs[c.Helper.Name] = true
+				fmt.Fprintf(s, "extern %s __ksym;\n\n", c.Helper.Decl)
+			}
+		}
 	}
 
 	for _, m := range prog.Maps {
 		if m.Key == nil && m.Val == nil {
-			fmt.Fprintf(s, "DEFINE_BPF_MAP_NO_KEY_VAL(%s, %s, %s, %d);\n", m.MapName, m.MapType, m.FlagsStr(), m.MaxEntries)
+			fmt.Fprintf(s, "DEFINE_BPF_MAP_NO_KEY_VAL(%s, %s, %s, %s, %d);\n", m.MapName, m.MapType, m.FlagsStr(), m.PinningStr(), m.MaxEntries)
 		} else if m.Key == nil {
-			fmt.Fprintf(s, "DEFINE_BPF_MAP_NO_KEY(%s, %s, %s, %s, %d);\n", m.MapName, m.MapType, m.FlagsStr(), m.Val.Name, m.MaxEntries)
+			fmt.Fprintf(s, "DEFINE_BPF_MAP_NO_KEY(%s, %s, %s, %s, %s, %d);\n", m.MapName, m.MapType, m.FlagsStr(), m.PinningStr(), m.Val.Name, m.MaxEntries)
 		} else if m.Val == nil {
-			fmt.Fprintf(s, "DEFINE_BPF_MAP_NO_VAL(%s, %s, %s, %s, %d);\n", m.MapName, m.MapType, m.FlagsStr(), m.Key.Name, m.MaxEntries)
+			fmt.Fprintf(s, "DEFINE_BPF_MAP_NO_VAL(%s, %s, %s, %s, %s, %d);\n", m.MapName, m.MapType, m.FlagsStr(), m.PinningStr(), m.Key.Name, m.MaxEntries)
 		} else if m.InnerMap == nil {
-			fmt.Fprintf(s, "DEFINE_BPF_MAP(%s, %s, %s, %s, %s, %d);\n", m.MapName, m.MapType, m.FlagsStr(), m.Key.Name, m.Val.Name, m.MaxEntries)
+			fmt.Fprintf(s, "DEFINE_BPF_MAP(%s, %s, %s, %s, %s, %s, %d);\n", m.MapName, m.MapType, m.FlagsStr(), m.PinningStr(), m.Key.Name, m.Val.Name, m.MaxEntries)
 		} else {
-			fmt.Fprintf(s, "DEFINE_BPF_MAP_IN_MAP(%s, %s, %s, %s, %s, %d, %s);\n", m.MapName, m.MapType, m.FlagsStr(), m.Key.Name, m.Val.Name, m.MaxEntries, m.InnerMap.MapName)
+			fmt.Fprintf(s, "DEFINE_BPF_MAP_IN_MAP(%s, %s, %s, %s, %s, %s, %d, %s);\n", m.MapName, m.MapType, m.FlagsStr(), m.PinningStr(), m.Key.Name, m.Val.Name, m.MaxEntries, m.InnerMap.MapName)
 		}
 	}
 
+	for _, cb := range sortedKeys(prog.Callbacks) {
+		fmt.Fprintf(s, "%s\n", prog.Callbacks[cb])
+	}
+
 	fmt.Fprintf(s, "%s", prog.SecStr)
-	fmt.Fprintf(s, "int func(%s *ctx) {\n", prog.pt.User)
-	for field, v := range prog.CtxVars {
-		fmt.Fprintf(s, "	%s %s = ctx->%s;\n", prog.CtxTypes[field], v, field)
+	fmt.Fprintf(s, "int func(%s *ctx) {\n", prog.ctxType())
+	for _, field := range sortedKeys(prog.CtxVars) {
+		fmt.Fprintf(s, "	%s %s = ctx->%s;\n", prog.CtxTypes[field], prog.CtxVars[field], field)
+	}
+	for _, stmt := range prog.CtxAccesses {
+		fmt.Fprintf(s, "%s", stmt)
 	}
 	for i, call := range prog.Calls {
 		for j, arg := range call.Args {
@@ -2942,10 +4194,16 @@ func (prog *BpfProgState) WriteFuzzerSource(path string) {
 			indent = "	"
 		}
 
+		if call.ExitCond != "" {
+			fmt.Fprintf(s, "%s	if (%s) {\n", indent, call.ExitCond)
+			fmt.Fprintf(s, "%s		%s(%s);\n", indent, call.Helper.callName(), call.argList())
+			fmt.Fprintf(s, "%s		return %v;\n", indent, prog.RetVal)
+			fmt.Fprintf(s, "%s	}\n", indent)
+		}
 		if call.RetType != "" {
-			fmt.Fprintf(s, "%s	%s = bpf_%s(", indent, call.Ret, call.Helper.Enum[9:])
+			fmt.Fprintf(s, "%s	%s = %s(", indent, call.Ret, call.Helper.callName())
 		} else {
-			fmt.Fprintf(s, "%s	bpf_%s(", indent, call.Helper.Enum[9:])
+			fmt.Fprintf(s, "%s	%s(", indent, call.Helper.callName())
 		}
 		for i, arg := range call.Args {
 			fmt.Fprintf(s, "%v", arg.Name)
@@ -2956,34 +4214,41 @@ func (prog *BpfProgState) WriteFuzzerSource(path string) {
 		fmt.Fprintf(s, ");\n")
 
 		for _, pcall := range call.PostCalls {
-			fmt.Fprintf(s, "%s	bpf_%s(", indent, pcall.Helper.Enum[9:])
-			for i, arg := range pcall.Args {
-				fmt.Fprintf(s, "%v", arg.Name)
-				if i < len(pcall.Args)-1 {
-					fmt.Fprintf(s, ", ")
-				}
+			if pcall.ExitCond != "" {
+				fmt.Fprintf(s, "%s	if (%s) {\n", indent, pcall.ExitCond)
+				fmt.Fprintf(s, "%s		%s(%s);\n", indent, pcall.Helper.callName(), pcall.argList())
+				fmt.Fprintf(s, "%s		return %v;\n", indent, prog.RetVal)
+				fmt.Fprintf(s, "%s	}\n", indent)
 			}
-			fmt.Fprintf(s, ");\n")
+			fmt.Fprintf(s, "%s	%s(%s);\n", indent, pcall.Helper.callName(), pcall.argList())
 		}
 
 		if len(constraints) != 0 {
 			fmt.Fprintf(s, "	}\n")
 		}
+
+		// Re-derive the packet pointers the call invalidated
+		if call.changesPktData() {
+			for _, field := range pktFields {
+				if v, ok := prog.CtxVars[field]; ok {
+					fmt.Fprintf(s, "	%s = ctx->%s;\n", v, field)
+				}
+			}
+		}
 	}
 
 	fmt.Fprintf(s, "	return %v;\n", prog.RetVal)
 	fmt.Fprintf(s, "}\n\n")
 
 	fmt.Fprintf(s, "char _license[] SEC(\"license\") = \"GPL\";\n")
+	return s.Bytes()
+}
 
-	fmt.Printf("\n%v\n", s)
-
-	outf, err := os.Create(path)
-	if err != nil {
-		fmt.Printf("failed to create output file: %v", err)
-		return
+func sortedKeys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
 	}
-	defer outf.Close()
-
-	outf.Write(s.Bytes())
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,644 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var (
+	testBrf     *BpfRuntimeFuzzer
+	testBrfOnce sync.Once
+)
+
+// initTestBrf returns a fuzzer shared by all tests, the same way Brf is shared by all procs.
+func initTestBrf() *BpfRuntimeFuzzer {
+	testBrfOnce.Do(func() {
+		testBrf = NewBpfRuntimeFuzzer()
+		testBrf.InitFromSrc(HelperFuncMap, ProgTypeMap, CtxAccessMap, RefFuncMap)
+	})
+	return testBrf
+}
+
+func TestRefFuncMapHelpers(t *testing.T) {
+	enums := make(map[string]bool)
+	for _, h := range HelperFuncMap {
+		enums[h.Enum] = true
+	}
+	for enum := range RefFuncMap {
+		if !enums[enum] {
+			t.Errorf("reference semantics are declared for %v, which is not a helper or kfunc", enum)
+		}
+	}
+}
+
+func TestFixRef(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	lookup := HelperFuncMap["bpf_sk_lookup_tcp_proto"]
+	release := HelperFuncMap["bpf_sk_release_proto"]
+	reserve := HelperFuncMap["bpf_ringbuf_reserve_proto"]
+	submit := HelperFuncMap["bpf_ringbuf_submit_proto"]
+	pt := &BpfProgTypeDef{Helpers: []*BpfHelperFunc{lookup, release, reserve, submit}}
+	newCall := func(helper *BpfHelperFunc, ret string) *BpfCall {
+		call := NewBpfCall(helper, newBpfCallGenHint(nil))
+		for i := range helper.Args {
+			call.Args[i] = NewBpfArg(helper, i)
+			call.Args[i].Name = "0"
+		}
+		call.Ret = ret
+		return call
+	}
+	for i := 0; i < iters; i++ {
+		s := &BpfProgState{brf: brf, pt: pt}
+		sk := newCall(lookup, "v0")
+		rec := newCall(reserve, "v1")
+		s.Calls = []*BpfCall{sk, rec}
+		s.FixRef(r)
+		if len(sk.PostCalls) != 1 || sk.PostCalls[0].Helper != release || sk.PostCalls[0].Args[0].Name != "v0" {
+			t.Fatalf("socket reference is not released after the lookup: %+v", sk.PostCalls)
+		}
+		if len(s.Calls) != 3 || s.Calls[2].Helper != submit || s.Calls[2].Args[0].Name != "v1" ||
+			s.Calls[2].Args[1].Name != "0" {
+			t.Fatalf("ringbuf record is not submitted at the end: %+v", s.Calls)
+		}
+		if sk.PostCalls[0].ExitCond != "" || s.Calls[2].ExitCond != "" {
+			t.Fatalf("early return added to a program holding two references")
+		}
+	}
+}
+
+func TestFixRefReleaseWithoutAcquire(t *testing.T) {
+	target, rs, _ := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	release := HelperFuncMap["bpf_sk_release_proto"]
+	pt := &BpfProgTypeDef{Helpers: []*BpfHelperFunc{release}}
+	call := NewBpfCall(release, newBpfCallGenHint(nil))
+	call.Args[0] = NewBpfArg(release, 0)
+	call.Args[0].Name = "v0"
+	s := &BpfProgState{brf: brf, pt: pt, Calls: []*BpfCall{call}}
+	// Nothing can acquire a socket, so the program is left as it is.
+	s.FixRef(r)
+	if len(s.Calls) != 1 || call.Args[0].Name != "v0" {
+		t.Fatalf("unexpected fix: %+v", s.Calls)
+	}
+}
+
+func TestFixRefDoubleRelease(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	reserve := HelperFuncMap["bpf_ringbuf_reserve_proto"]
+	submit := HelperFuncMap["bpf_ringbuf_submit_proto"]
+	discard := HelperFuncMap["bpf_ringbuf_discard_proto"]
+	fixed := 0
+	for i := 0; i < iters; i++ {
+		s := NewBpfProgState(brf, brf.progTypeMap["tc_cls"], nil)
+		rec, ok := s.genBpfHelperCall(r, reserve, newBpfCallGenHint(nil), false)
+		if !ok {
+			continue
+		}
+		newCall := func(helper *BpfHelperFunc) *BpfCall {
+			call := NewBpfCall(helper, newBpfCallGenHint(nil))
+			for i := range call.Args {
+				call.Args[i] = NewBpfArg(helper, i)
+				call.Args[i].Name = "0"
+			}
+			call.Args[0].Name = rec.Ret
+			s.Calls = append(s.Calls, call)
+			return call
+		}
+		sub := newCall(submit)
+		dis := newCall(discard)
+		// The record is released twice, the second release gets a record of its own.
+		s.FixRef(r)
+		if sub.Args[0].Name != rec.Ret {
+			t.Fatalf("the first release of %v is rewritten to %v", rec.Ret, sub.Args[0].Name)
+		}
+		if dis.Args[0].Name != rec.Ret {
+			fixed++
+		}
+	}
+	if fixed == 0 {
+		t.Fatalf("never fixed the double release")
+	}
+}
+
+func TestFixRefEarlyExit(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	reserve := HelperFuncMap["bpf_ringbuf_reserve_proto"]
+	discard := HelperFuncMap["bpf_ringbuf_discard_proto"]
+	prandom := HelperFuncMap["bpf_get_prandom_u32_proto"]
+	pt := &BpfProgTypeDef{Helpers: []*BpfHelperFunc{reserve, discard, prandom}}
+	exits := 0
+	for i := 0; i < iters; i++ {
+		call := NewBpfCall(reserve, newBpfCallGenHint(nil))
+		call.Ret = "v0"
+		s := &BpfProgState{brf: brf, pt: pt, Calls: []*BpfCall{call}}
+		s.FixRef(r)
+		if len(s.Calls) != 2 {
+			t.Fatalf("ringbuf record is not released: %+v", s.Calls)
+		}
+		if s.Calls[1].ExitCond != "" {
+			exits++
+		}
+	}
+	if exits == 0 || exits == iters {
+		t.Fatalf("released on an early return path in %v/%v programs", exits, iters)
+	}
+}
+
+func TestGenDynptrCall(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	submit := HelperFuncMap["bpf_ringbuf_submit_dynptr_proto"]
+	generated := 0
+	for i := 0; i < iters; i++ {
+		s := NewBpfProgState(brf, brf.progTypeMap["tc_cls"], r)
+		call, ok := s.genBpfHelperCall(r, submit, newBpfCallGenHint(nil), false)
+		if !ok {
+			continue
+		}
+		generated++
+		var reserve *BpfCall
+		for _, c := range s.Calls {
+			if c.Helper.Enum == "BPF_FUNC_ringbuf_reserve_dynptr" && c.Args[3].Name == call.Args[0].Name {
+				reserve = c
+			}
+		}
+		if reserve == nil {
+			t.Fatalf("dynptr %v is submitted without being reserved", call.Args[0].Name)
+		}
+		for _, d := range s.liveDynptrs(true) {
+			if d == call.Args[0].Name {
+				t.Fatalf("submitted dynptr %v is still live", d)
+			}
+		}
+	}
+	if generated == 0 {
+		t.Fatalf("failed to generate any dynptr submit call")
+	}
+}
+
+func TestDynptrKptrProtos(t *testing.T) {
+	has := func(pt, proto string) bool {
+		for _, p := range ProgTypeMap[pt].FuncProtos {
+			if p == proto {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range bpfBaseFuncProtoProgTypes {
+		if !has(name, "bpf_map_lookup_elem_proto") {
+			t.Errorf("%v does not fall back to bpf_base_func_proto", name)
+		}
+		if !has(name, "bpf_kptr_xchg_proto") || !has(name, "bpf_dynptr_data_proto") {
+			t.Errorf("%v misses the dynptr and kptr helpers", name)
+		}
+	}
+	if has("lirc_mode2", "bpf_kptr_xchg_proto") {
+		t.Errorf("lirc_mode2 has the dynptr and kptr helpers")
+	}
+}
+
+func TestGenKptrXchgCall(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	xchg := HelperFuncMap["bpf_kptr_xchg_proto"]
+	generated := 0
+	for i := 0; i < iters; i++ {
+		s := NewBpfProgState(brf, brf.progTypeMap["tc_cls"], r)
+		call, ok := s.genBpfHelperCall(r, xchg, newBpfCallGenHint(nil), false)
+		if !ok {
+			continue
+		}
+		generated++
+		if _, ok := kptrRefClasses[call.RetBtfId]; !ok {
+			t.Fatalf("kptr_xchg returns unknown kptr type %q", call.RetBtfId)
+		}
+		if call.RetType != call.RetBtfId+"*" {
+			t.Fatalf("kptr_xchg returns %v, want %v*", call.RetType, call.RetBtfId)
+		}
+		s.FixRef(r)
+		released := false
+		for _, c := range s.Calls {
+			if c.Helper.Kfunc && c.Args[0].Name == call.Ret {
+				released = true
+			}
+		}
+		if !released {
+			t.Fatalf("kptr %v returned by kptr_xchg is not released", call.Ret)
+		}
+		path := filepath.Join(t.TempDir(), "prog.c")
+		s.WriteFuzzerSource(path)
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(src), call.RetBtfId+" __kptr *") || !strings.Contains(string(src), "__ksym;") {
+			t.Fatalf("kptr field or kfunc declaration missing:\n%s", src)
+		}
+	}
+	if generated == 0 {
+		t.Fatalf("failed to generate any kptr_xchg call")
+	}
+}
+
+func TestGenBpfProgDeterminism(t *testing.T) {
+	target, rs, iters := initTest(t)
+	brf := initTestBrf()
+	seed := rs.Int63()
+	gen := func() [][]byte {
+		r := newRand(target, rand.NewSource(seed))
+		var srcs [][]byte
+		for i := 0; i < iters; i++ {
+			s, ok := brf.GenBpfProg(r, nil)
+			if !ok {
+				continue
+			}
+			s.FixRef(r)
+			s.FixSpinLock(r)
+			s.FixTimer(r)
+			srcs = append(srcs, s.Source())
+		}
+		return srcs
+	}
+	srcs, srcs1 := gen(), gen()
+	if len(srcs) != len(srcs1) {
+		t.Fatalf("generated %v programs, then %v programs", len(srcs), len(srcs1))
+	}
+	for i := range srcs {
+		if !bytes.Equal(srcs[i], srcs1[i]) {
+			t.Fatalf("program %v differs:\n%s\nvs\n%s", i, srcs[i], srcs1[i])
+		}
+	}
+}
+
+func TestGenBpfProgSharePinnedMaps(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	shared := 0
+	for i := 0; i < iters; i++ {
+		orig, ok := brf.GenBpfProg(r, nil)
+		if !ok {
+			continue
+		}
+		s, _ := brf.GenBpfProg(r, orig)
+		for _, m := range append(append([]*BpfMap{}, orig.Maps...), s.Maps...) {
+			if m.PinningStr() != "LIBBPF_PIN_NONE" && m.MapName != m.pinnedName() {
+				t.Fatalf("map %v is pinned under a name not derived from its definition %v",
+					m.MapName, m.pinnedName())
+			}
+		}
+		for _, m := range orig.Maps {
+			if m.PinningStr() != "LIBBPF_PIN_BY_NAME" {
+				continue
+			}
+			m1 := s.findMap(m.MapName)
+			if m1 == nil || m1.PinningStr() != "LIBBPF_PIN_BY_NAME" {
+				t.Fatalf("pinned map %v is not shared with the compat program", m.MapName)
+			}
+			shared++
+		}
+	}
+	if shared == 0 {
+		t.Fatalf("no map is shared")
+	}
+}
+
+func TestGenBpfProgConcurrent(t *testing.T) {
+	target, rs, iters := initTest(t)
+	brf := initTestBrf()
+	var wg sync.WaitGroup
+	for p := 0; p < 8; p++ {
+		seed := rs.Int63()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := newRand(target, rand.NewSource(seed))
+			for i := 0; i < iters/4; i++ {
+				s, ok := brf.GenBpfProg(r, nil)
+				if !ok {
+					continue
+				}
+				s.FixRef(r)
+				s.FixSpinLock(r)
+				s.FixTimer(r)
+				for j := 0; j < 5; j++ {
+					brf.MutBpfProg(r, s)
+				}
+				s.FixRef(r)
+				s.FixSpinLock(r)
+				s.FixTimer(r)
+				s.Source()
+				if _, err := s.Serialize(); err != nil {
+					t.Errorf("failed to serialize: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGenSleepableBpfProg(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	pt := brf.progTypeMap["tracing"]
+	sleepable, faults := 0, 0
+	for i := 0; i < iters; i++ {
+		s, ok := brf.GenBpfProg(r, NewBpfProgState(brf, pt, r))
+		if !ok {
+			continue
+		}
+		for _, call := range s.Calls {
+			if call.Helper.Sleepable && !s.Sec.Sleepable {
+				t.Fatalf("%v is called from non-sleepable section %v", call.Helper.Enum, s.Sec.Sec)
+			}
+			if call.Helper.Sleepable {
+				sleepable++
+			}
+			if arg, ok := bpfUserPtrArgs[call.Helper.Enum]; ok && call.Args[arg] != nil {
+				addr, err := strconv.ParseInt(call.Args[arg].Name, 0, 64)
+				if err == nil && addr >= BpfFaultAreaAddr && addr < BpfFaultAreaAddr+BpfFaultAreaSize {
+					faults++
+				}
+			}
+		}
+	}
+	if sleepable == 0 || faults == 0 {
+		t.Fatalf("generated %v sleepable helper calls, %v reading the fault area", sleepable, faults)
+	}
+}
+
+func TestGenBpfIterProg(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	pt := brf.progTypeMap["tracing"]
+	seq := 0
+	for i := 0; i < iters*4; i++ {
+		s, ok := brf.GenBpfProg(r, NewBpfProgState(brf, pt, r))
+		if !ok {
+			continue
+		}
+		iter := s.iterCtx()
+		for _, call := range s.Calls {
+			if call.Helper.IterOnly && iter == nil {
+				t.Fatalf("%v is called from non-iterator section %v", call.Helper.Enum, s.SecStr)
+			}
+		}
+		if iter == nil {
+			continue
+		}
+		if len(iter.MapTypes) != 0 && s.IterMap() == -1 {
+			t.Fatalf("%v iterator has no map to walk: %+v", iter.Name, s.Maps)
+		}
+		src := string(s.Source())
+		if !strings.Contains(src, "int func(struct bpf_iter__"+iter.Name+" *ctx)") {
+			t.Fatalf("%v iterator takes the wrong context:\n%s", iter.Name, src)
+		}
+		if strings.Contains(src, "= ctx->meta->seq;") {
+			seq++
+		}
+	}
+	if seq == 0 {
+		t.Fatalf("no iterator writes to its seq_file")
+	}
+}
+
+func TestFixTimer(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	start := HelperFuncMap["bpf_timer_start_proto"]
+	generated := 0
+	for i := 0; i < iters; i++ {
+		s := NewBpfProgState(brf, brf.progTypeMap["tc_cls"], r)
+		call, ok := s.genBpfHelperCall(r, start, newBpfCallGenHint(nil), false)
+		if !ok {
+			continue
+		}
+		generated++
+		s.FixTimer(r)
+		s.FixTimer(r)
+		var helpers []string
+		for _, pcall := range call.PostCalls {
+			if pcall.Args[0].Name != call.Args[0].Name {
+				t.Fatalf("%v is called on %v, want %v", pcall.Helper.Enum, pcall.Args[0].Name, call.Args[0].Name)
+			}
+			helpers = append(helpers, pcall.Helper.Enum)
+		}
+		if strings.Join(helpers, " ") != "BPF_FUNC_timer_init BPF_FUNC_timer_set_callback BPF_FUNC_timer_start" {
+			t.Fatalf("timer %v is not armed once: %v", call.Args[0].Name, helpers)
+		}
+		cb := call.PostCalls[1].Args[1].Name
+		src := string(s.Source())
+		if s.Callbacks[cb] == "" || !strings.Contains(src, "static int "+cb+"(") {
+			t.Fatalf("callback %v is not defined:\n%s", cb, src)
+		}
+		if len(s.TimerMaps()) == 0 {
+			t.Fatalf("no map embeds the timer: %+v", s.Maps)
+		}
+	}
+	if generated == 0 {
+		t.Fatalf("failed to generate any timer_start call")
+	}
+}
+
+func TestGenPktPtr(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	helper := HelperFuncMap["bpf_csum_diff_proto"]
+	moved := 0
+	for i := 0; i < iters; i++ {
+		s := NewBpfProgState(brf, brf.progTypeMap["xdp"], r)
+		call := NewBpfCall(helper, newBpfCallGenHint(nil))
+		meta := r.nOutOf(1, 2)
+		var a *BpfArg
+		start := "data"
+		if meta {
+			a = PtrToPacketMetaRegType{}.Generate(s, r, call, 0)
+			start = "data_meta"
+		} else {
+			a = PtrToPacketRegType{}.Generate(s, r, call, 0)
+		}
+		if a == nil {
+			t.Fatalf("failed to generate a packet pointer")
+		}
+		if a.IsPktAccess == meta || a.IsPktMetaAccess != meta {
+			t.Fatalf("%v is not checked against the end of its region", a.Name)
+		}
+		if !strings.Contains(a.Prepare, "void *"+a.Name+" = "+s.CtxVars[start]+";") {
+			t.Fatalf("%v is not derived from ctx->%v:\n%s", a.Name, start, a.Prepare)
+		}
+		if len(s.Calls) == 0 {
+			continue
+		}
+		moved++
+		if !s.Calls[0].changesPktData() {
+			t.Fatalf("%v does not move the packet", s.Calls[0].Helper.Enum)
+		}
+		src := string(s.Source())
+		for _, field := range pktFields {
+			if v, ok := s.CtxVars[field]; ok && !strings.Contains(src, "\t"+v+" = ctx->"+field+";\n") {
+				t.Fatalf("ctx->%v is not reloaded after %v:\n%s", field, s.Calls[0].Helper.Enum, src)
+			}
+		}
+	}
+	if moved == 0 {
+		t.Fatalf("failed to move the packet before any access")
+	}
+}
+
+func TestGenCtxAccess(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	tc := NewBpfProgState(brf, brf.progTypeMap["tc_cls"], r)
+	writable := map[string]bool{"mark": true, "tc_index": true, "priority": true, "tc_classid": true,
+		"queue_mapping": true, "cb": true, "tstamp": true}
+	kinds := make(map[string]bool)
+	for i := 0; i < iters*10; i++ {
+		stmt := strings.TrimSpace(tc.genCtxAccess(r))
+		if strings.HasPrefix(stmt, "ctx->") {
+			field := strings.TrimPrefix(stmt, "ctx->")
+			field = field[:strings.IndexAny(field, "[ ")]
+			if !writable[field] {
+				t.Fatalf("write to a read-only field: %v", stmt)
+			}
+			kinds["write"] = true
+		} else if strings.Contains(stmt, "volatile uint64_t") {
+			t.Fatalf("wide load from __sk_buff: %v", stmt)
+		} else {
+			kinds["narrow"] = true
+		}
+	}
+	if !kinds["write"] || !kinds["narrow"] {
+		t.Fatalf("failed to generate writes and narrow loads: %v", kinds)
+	}
+
+	addr := NewBpfProgState(brf, brf.progTypeMap["cg_sock_addr"], r)
+	addr.Sec = SecDef{Sec: "cgroup/connect6"}
+	wide := false
+	for i := 0; i < iters*10; i++ {
+		stmt := strings.TrimSpace(addr.genCtxAccess(r))
+		if strings.Contains(stmt, "user_ip4") {
+			t.Fatalf("access to user_ip4 from a connect6 program: %v", stmt)
+		}
+		if strings.Contains(stmt, "uint64_t") {
+			// user_ip6 starts at offset 8, so only its elements 0 and 2 are 8-byte aligned
+			if !strings.Contains(stmt, "user_ip6[0]") && !strings.Contains(stmt, "user_ip6[2]") {
+				t.Fatalf("unaligned wide access: %v", stmt)
+			}
+			wide = true
+		}
+	}
+	if !wide {
+		t.Fatalf("failed to generate wide accesses to user_ip6")
+	}
+}
+
+func TestGenExpectedAttachType(t *testing.T) {
+	target, rs, _ := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	hasBind := func(s *BpfProgState) bool {
+		for _, h := range s.helpers() {
+			if h.Enum == "BPF_FUNC_bind" {
+				return true
+			}
+		}
+		return false
+	}
+	for _, test := range []struct {
+		sec      string
+		expected string
+		bind     bool
+	}{
+		{"cgroup/connect4", "BPF_CGROUP_INET4_CONNECT", true},
+		{"cgroup/connect6", "BPF_CGROUP_INET6_CONNECT", true},
+		{"cgroup/sendmsg4", "BPF_CGROUP_UDP4_SENDMSG", false},
+		{"cgroup/getsockname6", "BPF_CGROUP_INET6_GETSOCKNAME", false},
+	} {
+		s := NewBpfProgState(brf, brf.progTypeMap["cg_sock_addr"], r)
+		s.Sec = SecDef{Sec: test.sec}
+		if got := s.ExpectedAttachType(); got != test.expected {
+			t.Fatalf("%v: expected attach type %v, want %v", test.sec, got, test.expected)
+		}
+		if hasBind(s) != test.bind {
+			t.Fatalf("%v: bpf_bind available: %v, want %v", test.sec, !test.bind, test.bind)
+		}
+	}
+
+	s := NewBpfProgState(brf, brf.progTypeMap["sk_msg"], r)
+	s.Sec = SecDef{Sec: "sk_msg"}
+	if got := s.ExpectedAttachType(); got != "BPF_SK_MSG_VERDICT" || s.CgroupAttachType() != "" {
+		t.Fatalf("sk_msg: expected attach type %v, cgroup attach type %v", got, s.CgroupAttachType())
+	}
+}
+
+func TestBpfCoverCategories(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	for i := 0; i < iters; i++ {
+		s, ok := brf.GenBpfProg(r, nil)
+		if !ok {
+			continue
+		}
+		categories := s.CoverCategories()
+		if categories[0] != "prog_type:"+s.ProgTypeEnum() {
+			t.Fatalf("categories do not start with the program type: %v", categories)
+		}
+		seen := make(map[string]bool)
+		for _, category := range categories {
+			if seen[category] {
+				t.Fatalf("duplicate category %v: %v", category, categories)
+			}
+			seen[category] = true
+		}
+		for _, call := range s.Calls {
+			if !seen["helper:"+call.Helper.Enum] {
+				t.Fatalf("helper %v is missing: %v", call.Helper.Enum, categories)
+			}
+		}
+		for _, m := range s.Maps {
+			if !seen["map_type:"+m.MapType] {
+				t.Fatalf("map type %v is missing: %v", m.MapType, categories)
+			}
+		}
+	}
+}
+
+func TestBpfHelperName(t *testing.T) {
+	brf := initTestBrf()
+	for num, want := range map[int]string{
+		1:     "bpf_map_lookup_elem",
+		8:     "bpf_get_smp_processor_id",
+		12:    "bpf_tail_call",
+		-1:    "",
+		10000: "",
+	} {
+		if got := brf.HelperName(num); got != want {
+			t.Errorf("helper %v: got %q, want %q", num, got, want)
+		}
+	}
+}
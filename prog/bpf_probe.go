@@ -0,0 +1,221 @@
+package prog
+
+import (
+	"fmt"
+	"sort"
+)
+
+// BpfProber checks whether the target kernel supports a BPF feature. Each method returns
+// an empty string if the feature is supported, or the reason why it is not.
+type BpfProber interface {
+	ProbeProgType(progType, attachType uint64) string
+	ProbeMapType(m *BpfMapProbe) string
+	ProbeHelper(progType, attachType uint64, helper int) string
+}
+
+// BpfMapProbe describes the map created to check if a map type is supported.
+type BpfMapProbe struct {
+	Type       uint64
+	KeySize    int
+	ValSize    int
+	MaxEntries int
+	Flags      uint64
+	InnerMap   bool // the map needs an inner map
+	Btf        bool // the map needs BTF type ids of an int key and value
+}
+
+type BpfFeature struct {
+	Name    string
+	Enabled bool
+	Reason  string
+	// For helpers, the program types in which the helper is not supported.
+	DisabledIn []string
+}
+
+// BpfFeatures is the set of program types, map types and helpers supported by the target kernel.
+type BpfFeatures struct {
+	ProgTypes []BpfFeature
+	MapTypes  []BpfFeature
+	Helpers   []BpfFeature
+}
+
+// bpfProbeAttachTypes are the expected attach types needed to load programs of some types.
+var bpfProbeAttachTypes = map[string]string{
+	"BPF_PROG_TYPE_CGROUP_SOCK":      "BPF_CGROUP_INET_SOCK_CREATE",
+	"BPF_PROG_TYPE_CGROUP_SOCK_ADDR": "BPF_CGROUP_INET4_CONNECT",
+	"BPF_PROG_TYPE_CGROUP_SOCKOPT":   "BPF_CGROUP_GETSOCKOPT",
+	"BPF_PROG_TYPE_SK_LOOKUP":        "BPF_SK_LOOKUP",
+	"BPF_PROG_TYPE_SK_REUSEPORT":     "BPF_SK_REUSEPORT_SELECT",
+	"BPF_PROG_TYPE_LIRC_MODE2":       "BPF_LIRC_MODE2",
+	"BPF_PROG_TYPE_TRACING":          "BPF_TRACE_FENTRY",
+	"BPF_PROG_TYPE_LSM":              "BPF_LSM_MAC",
+}
+
+// bpfProbeMaps are the map types that cannot be created with the smallest key and value
+// sizes and the mandatory flags in bpfMapTypes.
+var bpfProbeMaps = map[string]BpfMapProbe{
+	"BPF_MAP_TYPE_ARRAY_OF_MAPS":       {KeySize: 4, ValSize: 4, MaxEntries: 1, InnerMap: true},
+	"BPF_MAP_TYPE_HASH_OF_MAPS":        {KeySize: 4, ValSize: 4, MaxEntries: 1, InnerMap: true},
+	"BPF_MAP_TYPE_LPM_TRIE":            {KeySize: 8, ValSize: 8, MaxEntries: 1},
+	"BPF_MAP_TYPE_REUSEPORT_SOCKARRAY": {KeySize: 4, ValSize: 4, MaxEntries: 1},
+	"BPF_MAP_TYPE_SK_STORAGE":          {KeySize: 4, ValSize: 4, Btf: true},
+	"BPF_MAP_TYPE_INODE_STORAGE":       {KeySize: 4, ValSize: 4, Btf: true},
+	"BPF_MAP_TYPE_TASK_STORAGE":        {KeySize: 4, ValSize: 4, Btf: true},
+	"BPF_MAP_TYPE_RINGBUF":             {MaxEntries: 4096},
+}
+
+// ProbeBpf probes the target kernel for the program types, map types and helpers
+// described in ProgTypeMap, HelperFuncMap and bpfMapTypes.
+func ProbeBpf(target *Target, prober BpfProber) *BpfFeatures {
+	features := new(BpfFeatures)
+	var ptNames []string
+	for name := range ProgTypeMap {
+		ptNames = append(ptNames, name)
+	}
+	sort.Strings(ptNames)
+
+	type helperProbe struct {
+		progType, attachType uint64
+		helper               int
+	}
+	helpers := make(map[string]*BpfFeature)
+	helperRes := make(map[helperProbe]string)
+	for _, name := range ptNames {
+		pt := ProgTypeMap[name]
+		attachType := target.constValue(bpfProbeAttachTypes[pt.Enum])
+		feat := BpfFeature{Name: name, Enabled: true}
+		if reason := prober.ProbeProgType(uint64(pt.Num), attachType); reason != "" {
+			feat.Enabled = false
+			feat.Reason = reason
+		}
+		features.ProgTypes = append(features.ProgTypes, feat)
+		for _, proto := range pt.FuncProtos {
+			helper := HelperFuncMap[proto]
+			hf := helpers[helper.Enum]
+			if hf == nil {
+				hf = &BpfFeature{Name: helper.Enum}
+				helpers[helper.Enum] = hf
+			}
+			if !feat.Enabled {
+				continue
+			}
+			reason := ""
+			// Kfuncs are resolved through BTF and cannot be probed by id.
+			if !helper.Kfunc {
+				probe := helperProbe{uint64(pt.Num), attachType, helper.Num}
+				var ok bool
+				if reason, ok = helperRes[probe]; !ok {
+					reason = prober.ProbeHelper(probe.progType, probe.attachType, probe.helper)
+					helperRes[probe] = reason
+				}
+			}
+			if reason == "" {
+				hf.Enabled = true
+			} else if len(hf.DisabledIn) == 0 || hf.DisabledIn[len(hf.DisabledIn)-1] != name {
+				hf.DisabledIn = append(hf.DisabledIn, name)
+				if hf.Reason == "" {
+					hf.Reason = reason
+				}
+			}
+		}
+	}
+	for _, hf := range helpers {
+		if !hf.Enabled && hf.Reason == "" {
+			hf.Reason = "no supported program type"
+		}
+		features.Helpers = append(features.Helpers, *hf)
+	}
+	sort.Slice(features.Helpers, func(i, j int) bool {
+		return features.Helpers[i].Name < features.Helpers[j].Name
+	})
+
+	for _, mt := range bpfMapTypes {
+		feat := BpfFeature{Name: mt.Type, Enabled: true}
+		mapType := target.constValue(mt.Type)
+		if mapType == 0 {
+			feat.Enabled = false
+			feat.Reason = "unknown map type"
+			features.MapTypes = append(features.MapTypes, feat)
+			continue
+		}
+		probe, ok := bpfProbeMaps[mt.Type]
+		if !ok {
+			probe = BpfMapProbe{KeySize: mt.KeySize[0], ValSize: mt.ValSize[0], MaxEntries: 1}
+			if mt.MaxEntries == 0 {
+				probe.MaxEntries = 0
+			}
+		}
+		probe.Type = mapType
+		for _, fs := range mt.ManFlags {
+			probe.Flags |= target.constValue(fs[0])
+		}
+		if reason := prober.ProbeMapType(&probe); reason != "" {
+			feat.Enabled = false
+			feat.Reason = reason
+		}
+		features.MapTypes = append(features.MapTypes, feat)
+	}
+	return features
+}
+
+// Prune removes the program types, map types and helpers that are not supported by
+// the target kernel from the fuzzer. The description tables are left intact.
+func (brf *BpfRuntimeFuzzer) Prune(features *BpfFeatures) {
+	disabledHelpers := make(map[string]map[string]bool)
+	for _, hf := range features.Helpers {
+		disabled := make(map[string]bool)
+		for _, name := range hf.DisabledIn {
+			disabled[name] = true
+		}
+		if !hf.Enabled {
+			disabled[""] = true
+		}
+		disabledHelpers[hf.Name] = disabled
+	}
+	progTypeMap := make(map[string]*BpfProgTypeDef)
+	for _, feat := range features.ProgTypes {
+		pt, ok := brf.progTypeMap[feat.Name]
+		if !ok || !feat.Enabled {
+			continue
+		}
+		npt := *pt
+		npt.Helpers = nil
+		for _, helper := range pt.Helpers {
+			disabled := disabledHelpers[helper.Enum]
+			if !disabled[""] && !disabled[feat.Name] {
+				npt.Helpers = append(npt.Helpers, helper)
+			}
+		}
+		if len(npt.Helpers) != 0 {
+			progTypeMap[feat.Name] = &npt
+		}
+	}
+	brf.progTypeMap = progTypeMap
+	brf.progTypes = sortedProgTypes(progTypeMap)
+
+	enabledMaps := make(map[string]bool)
+	for _, feat := range features.MapTypes {
+		enabledMaps[feat.Name] = feat.Enabled
+	}
+	var mapTypes []BpfMapType
+	for _, mt := range brf.mapTypes {
+		if enabledMaps[mt.Type] {
+			mapTypes = append(mapTypes, mt)
+		}
+	}
+	brf.mapTypes = mapTypes
+}
+
+func (features *BpfFeatures) String() string {
+	count := func(feats []BpfFeature) string {
+		enabled := 0
+		for _, feat := range feats {
+			if feat.Enabled {
+				enabled++
+			}
+		}
+		return fmt.Sprintf("%v/%v", enabled, len(feats))
+	}
+	return fmt.Sprintf("prog types %v, map types %v, helpers %v",
+		count(features.ProgTypes), count(features.MapTypes), count(features.Helpers))
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"testing"
+)
+
+type testBpfProber struct {
+	progTypes map[uint64]bool
+	mapTypes  map[uint64]bool
+	helpers   map[[2]uint64]bool
+}
+
+func (p *testBpfProber) ProbeProgType(progType, attachType uint64) string {
+	if p.progTypes[progType] {
+		return "disabled"
+	}
+	return ""
+}
+
+func (p *testBpfProber) ProbeMapType(m *BpfMapProbe) string {
+	if p.mapTypes[m.Type] {
+		return "disabled"
+	}
+	return ""
+}
+
+func (p *testBpfProber) ProbeHelper(progType, attachType uint64, helper int) string {
+	if p.helpers[[2]uint64{progType, uint64(helper)}] {
+		return "disabled"
+	}
+	return ""
+}
+
+func TestProbeBpf(t *testing.T) {
+	target, _, _ := initTest(t)
+	brf := initTestBrf()
+	xdp := brf.progTypeMap["xdp"]
+	tc := brf.progTypeMap["tc_cls"]
+	prandom := HelperFuncMap["bpf_get_prandom_u32_proto"]
+	prober := &testBpfProber{
+		progTypes: map[uint64]bool{uint64(xdp.Num): true},
+		mapTypes:  map[uint64]bool{target.constValue("BPF_MAP_TYPE_RINGBUF"): true},
+		helpers:   map[[2]uint64]bool{{uint64(tc.Num), uint64(prandom.Num)}: true},
+	}
+	features := ProbeBpf(target, prober)
+	for _, feat := range features.MapTypes {
+		if feat.Enabled != (feat.Name != "BPF_MAP_TYPE_RINGBUF") {
+			t.Fatalf("map type %v enabled %v", feat.Name, feat.Enabled)
+		}
+	}
+	for _, feat := range features.Helpers {
+		if feat.Name != prandom.Enum {
+			continue
+		}
+		if !feat.Enabled || len(feat.DisabledIn) == 0 {
+			t.Fatalf("bpf_get_prandom_u32 is enabled %v, disabled in %v", feat.Enabled, feat.DisabledIn)
+		}
+	}
+
+	pruned := NewBpfRuntimeFuzzer()
+	pruned.progTypeMap = brf.progTypeMap
+	pruned.Prune(features)
+	if _, ok := pruned.progTypeMap["xdp"]; ok {
+		t.Fatalf("xdp is not pruned")
+	}
+	if pruned.progTypeMap["tc_cls"].getHelper(prandom.Enum) != nil {
+		t.Fatalf("bpf_get_prandom_u32 is not pruned from tc_cls")
+	}
+	if pruned.progTypeMap["tc_act"].getHelper(prandom.Enum) == nil {
+		t.Fatalf("bpf_get_prandom_u32 is pruned from tc_act")
+	}
+	if tc.getHelper(prandom.Enum) == nil || len(brf.progTypeMap) != len(ProgTypeMap) {
+		t.Fatalf("description tables are modified")
+	}
+	for _, mt := range pruned.mapTypes {
+		if mt.Type == "BPF_MAP_TYPE_RINGBUF" {
+			t.Fatalf("ringbuf map is not pruned")
+		}
+	}
+}
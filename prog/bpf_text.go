@@ -0,0 +1,864 @@
+package prog
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Text format of BpfProgState.
+//
+// A program state is a sequence of records, one per line. Empty lines and lines
+// starting with '#' are ignored. A record starts with its kind, followed by
+// positional values and key=value attributes. Values are identifiers, integers,
+// Go-quoted strings or lists of them in brackets, e.g. [BPF_F_NO_PREALLOC, "char [8]"].
+// Attributes that are omitted take the zero value of their type.
+//
+//	version 2
+//	type <program type>
+//	sec <section> str=<SEC() line> sleepable=<bool>
+//	ret <return value>
+//	var_id <next variable id>
+//	path <compiled object>
+//	attach str1=<string> str2=<string> opts=[<int>, ...]
+//	extern <name> <value>
+//	ctx_var <name> <value>
+//	ctx_type <name> <value>
+//	callback <name> <definition>
+//	ctx_access <statement>
+//	struct <id> name= struct=<bool> size= hints=[...] field_names=[...] field_types=[...]
+//	map <name> type= flags=[...] key=<struct id> val=<struct id> max_entries= inner=<map> pinned=<bool>
+//	call <id> parent=<call id> helper= ret= ret_type= map=<map> stack_var_size= exit_cond= ret_btf_id=
+//	hint arg_hints=[...] ret_access_size= ret_access_raw=<bool> map=<map>
+//	arg name= type= prepare= can_be_null= is_not_null= umin= umax= pkt_access= pkt_meta_access= access_size=
+//	arg nil
+//	trace <kind> depth= helper= arg= detail= repeat=
+//
+// Structs are numbered in the order they are defined. A call is a post call of the
+// call parent if parent is set. Hint and arg records belong to the preceding call.
+// Helpers and kfuncs are named by their key in HelperFuncMap. Trace records are the
+// generation trace of the program in order, see BpfTraceEvent. Version 2 added them.
+// Callback records hold the C source of functions passed to helpers, e.g., timer callbacks.
+// Version 3 added them. Ctx access records are the statements of CtxAccesses in order.
+// Version 4 added them.
+const bpfTextVersion = 4
+
+var bpfArgHintNames = map[ArgHint]string{
+	HintGenSpinlock:   "spinlock",
+	HintGenTimer:      "timer",
+	HintGenConstStr:   "const_str",
+	HintGenXdpSockMap: "xdp_sock_map",
+	HintGenSockMap:    "sock_map",
+	HintGenKptr:       "kptr",
+}
+
+var bpfTextIdentRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*|-?[0-9]+)$`)
+
+func bpfTextValue(v string) string {
+	if bpfTextIdentRe.MatchString(v) && v != "nil" {
+		return v
+	}
+	return strconv.Quote(v)
+}
+
+type bpfTextRecordWriter struct {
+	buf *bytes.Buffer
+}
+
+func (w bpfTextRecordWriter) str(key, v string) {
+	if v != "" {
+		fmt.Fprintf(w.buf, " %v=%v", key, bpfTextValue(v))
+	}
+}
+
+func (w bpfTextRecordWriter) int(key string, v int64) {
+	if v != 0 {
+		fmt.Fprintf(w.buf, " %v=%v", key, v)
+	}
+}
+
+func (w bpfTextRecordWriter) bool(key string, v bool) {
+	if v {
+		fmt.Fprintf(w.buf, " %v=true", key)
+	}
+}
+
+func (w bpfTextRecordWriter) list(key string, vs []string) {
+	if len(vs) == 0 {
+		return
+	}
+	var items []string
+	for _, v := range vs {
+		items = append(items, bpfTextValue(v))
+	}
+	fmt.Fprintf(w.buf, " %v=[%v]", key, strings.Join(items, ", "))
+}
+
+func (w bpfTextRecordWriter) hints(key string, hints map[ArgHint]bool) {
+	var names []string
+	for hint := range hints {
+		names = append(names, bpfArgHintNames[hint])
+	}
+	sort.Strings(names)
+	w.list(key, names)
+}
+
+func (w bpfTextRecordWriter) end() {
+	w.buf.WriteByte('\n')
+}
+
+func (w bpfTextRecordWriter) record(kind string, args ...string) bpfTextRecordWriter {
+	w.buf.WriteString(kind)
+	for _, arg := range args {
+		w.buf.WriteByte(' ')
+		w.buf.WriteString(arg)
+	}
+	return w
+}
+
+func bpfHelperKey(h *BpfHelperFunc) string {
+	if h.Kfunc {
+		return h.Name
+	}
+	return h.Proto
+}
+
+// Serialize returns the program state in the text format.
+func (s *BpfProgState) Serialize() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	w := bpfTextRecordWriter{buf}
+	w.record("version", fmt.Sprint(bpfTextVersion)).end()
+	w.record("type", bpfTextValue(s.pt.Name)).end()
+	rec := w.record("sec", strconv.Quote(s.Sec.Sec))
+	rec.str("str", s.SecStr)
+	rec.bool("sleepable", s.Sec.Sleepable)
+	rec.end()
+	w.record("ret", fmt.Sprint(s.RetVal)).end()
+	w.record("var_id", fmt.Sprint(s.VarId)).end()
+	if s.Path != "" {
+		w.record("path", strconv.Quote(s.Path)).end()
+	}
+	rec = w.record("attach")
+	rec.str("str1", s.AttachOpt.Str1)
+	rec.str("str2", s.AttachOpt.Str2)
+	var opts []string
+	for _, opt := range s.AttachOpt.IntOpts {
+		opts = append(opts, fmt.Sprint(opt))
+	}
+	rec.list("opts", opts)
+	rec.end()
+	for _, kv := range []struct {
+		kind string
+		m    map[string]string
+	}{{"extern", s.Externs}, {"ctx_var", s.CtxVars}, {"ctx_type", s.CtxTypes}, {"callback", s.Callbacks}} {
+		for _, k := range sortedKeys(kv.m) {
+			w.record(kv.kind, bpfTextValue(k), bpfTextValue(kv.m[k])).end()
+		}
+	}
+	for _, stmt := range s.CtxAccesses {
+		w.record("ctx_access", bpfTextValue(stmt)).end()
+	}
+
+	structIds := make(map[*StructDef]int)
+	for i, sd := range s.Structs {
+		structIds[sd] = i
+		rec := w.record("struct", fmt.Sprint(i))
+		rec.str("name", sd.Name)
+		rec.bool("struct", sd.IsStruct)
+		rec.int("size", int64(sd.Size))
+		rec.hints("hints", sd.Hints)
+		rec.list("field_names", sd.FieldNames)
+		rec.list("field_types", sd.FieldTypes)
+		rec.end()
+	}
+	structRef := func(sd *StructDef) (string, error) {
+		if sd == nil {
+			return "", nil
+		}
+		id, ok := structIds[sd]
+		if !ok {
+			return "", fmt.Errorf("struct %v is not in the program", sd.Name)
+		}
+		return fmt.Sprint(id), nil
+	}
+	mapNames := make(map[*BpfMap]bool)
+	for _, m := range s.Maps {
+		mapNames[m] = true
+	}
+	mapRef := func(m *BpfMap) (string, error) {
+		if m == nil {
+			return "", nil
+		}
+		if !mapNames[m] {
+			return "", fmt.Errorf("map %v is not in the program", m.MapName)
+		}
+		return m.MapName, nil
+	}
+	for _, m := range s.Maps {
+		key, err := structRef(m.Key)
+		if err != nil {
+			return nil, err
+		}
+		val, err := structRef(m.Val)
+		if err != nil {
+			return nil, err
+		}
+		inner, err := mapRef(m.InnerMap)
+		if err != nil {
+			return nil, err
+		}
+		rec := w.record("map", bpfTextValue(m.MapName))
+		rec.str("type", m.MapType)
+		rec.list("flags", m.MapFlags)
+		if key != "" {
+			fmt.Fprintf(buf, " key=%v", key)
+		}
+		if val != "" {
+			fmt.Fprintf(buf, " val=%v", val)
+		}
+		rec.int("max_entries", m.MaxEntries)
+		rec.str("inner", inner)
+		rec.bool("pinned", m.Pinned)
+		rec.end()
+	}
+
+	id := 0
+	var serializeCall func(call *BpfCall, parent int) error
+	serializeCall = func(call *BpfCall, parent int) error {
+		argMap, err := mapRef(call.ArgMap)
+		if err != nil {
+			return err
+		}
+		callId := id
+		id++
+		rec := w.record("call", fmt.Sprint(callId))
+		if parent != -1 {
+			fmt.Fprintf(buf, " parent=%v", parent)
+		}
+		rec.str("helper", bpfHelperKey(call.Helper))
+		rec.str("ret", call.Ret)
+		rec.str("ret_type", call.RetType)
+		rec.str("map", argMap)
+		rec.int("stack_var_size", int64(call.StackVarSize))
+		rec.str("exit_cond", call.ExitCond)
+		rec.str("ret_btf_id", call.RetBtfId)
+		rec.end()
+		if hint := call.Hint; hint != nil {
+			preferredMap, err := mapRef(hint.PreferredMap)
+			if err != nil {
+				return err
+			}
+			rec := w.record("hint")
+			rec.hints("arg_hints", hint.ArgHints)
+			rec.int("ret_access_size", int64(hint.RetAccessSize))
+			rec.bool("ret_access_raw", hint.IsRetAccessRaw)
+			rec.str("map", preferredMap)
+			rec.end()
+		}
+		for _, arg := range call.Args {
+			if arg == nil {
+				w.record("arg", "nil").end()
+				continue
+			}
+			rec := w.record("arg")
+			rec.str("name", arg.Name)
+			rec.str("type", arg.ArgType)
+			rec.str("prepare", arg.Prepare)
+			rec.bool("can_be_null", arg.CanBeNull)
+			rec.bool("is_not_null", arg.IsNotNull)
+			rec.int("umin", arg.Umin)
+			rec.int("umax", arg.Umax)
+			rec.bool("pkt_access", arg.IsPktAccess)
+			rec.bool("pkt_meta_access", arg.IsPktMetaAccess)
+			rec.int("access_size", int64(arg.AccessSize))
+			rec.end()
+		}
+		for _, pcall := range call.PostCalls {
+			if err := serializeCall(pcall, callId); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, call := range s.Calls {
+		if err := serializeCall(call, -1); err != nil {
+			return nil, err
+		}
+	}
+	for _, ev := range s.Trace {
+		rec := w.record("trace", bpfTextValue(ev.Kind))
+		rec.int("depth", int64(ev.Depth))
+		rec.str("helper", ev.Helper)
+		rec.int("arg", int64(ev.Arg))
+		rec.str("detail", ev.Detail)
+		rec.int("repeat", int64(ev.Repeat))
+		rec.end()
+	}
+	return buf.Bytes(), nil
+}
+
+type bpfTextAttr struct {
+	val    string
+	list   []string
+	isList bool
+}
+
+type bpfTextRecord struct {
+	kind  string
+	args  []string
+	attrs map[string]*bpfTextAttr
+	used  map[string]bool
+	err   error
+}
+
+func (rec *bpfTextRecord) errorf(msg string, args ...interface{}) {
+	if rec.err == nil {
+		rec.err = fmt.Errorf(msg, args...)
+	}
+}
+
+func (rec *bpfTextRecord) attr(key string, isList bool) *bpfTextAttr {
+	rec.used[key] = true
+	a := rec.attrs[key]
+	if a != nil && a.isList != isList {
+		rec.errorf("bad value of %v", key)
+		return nil
+	}
+	return a
+}
+
+func (rec *bpfTextRecord) str(key string) string {
+	if a := rec.attr(key, false); a != nil {
+		return a.val
+	}
+	return ""
+}
+
+func (rec *bpfTextRecord) int(key string) int64 {
+	a := rec.attr(key, false)
+	if a == nil {
+		return 0
+	}
+	v, err := strconv.ParseInt(a.val, 0, 64)
+	if err != nil {
+		rec.errorf("bad integer %v=%v", key, a.val)
+	}
+	return v
+}
+
+func (rec *bpfTextRecord) bool(key string) bool {
+	a := rec.attr(key, false)
+	if a == nil {
+		return false
+	}
+	v, err := strconv.ParseBool(a.val)
+	if err != nil {
+		rec.errorf("bad bool %v=%v", key, a.val)
+	}
+	return v
+}
+
+func (rec *bpfTextRecord) list(key string) []string {
+	if a := rec.attr(key, true); a != nil {
+		return a.list
+	}
+	return nil
+}
+
+func (rec *bpfTextRecord) hints(key string) map[ArgHint]bool {
+	hints := make(map[ArgHint]bool)
+	for _, name := range rec.list(key) {
+		found := false
+		for hint, hintName := range bpfArgHintNames {
+			if name == hintName {
+				hints[hint] = true
+				found = true
+			}
+		}
+		if !found {
+			rec.errorf("unknown hint %v", name)
+		}
+	}
+	return hints
+}
+
+func (rec *bpfTextRecord) arg(i int) string {
+	if i >= len(rec.args) {
+		rec.errorf("%v needs %v values", rec.kind, i+1)
+		return ""
+	}
+	return rec.args[i]
+}
+
+// finish checks that all values of the record were used.
+func (rec *bpfTextRecord) finish(nargs int) error {
+	if len(rec.args) > nargs {
+		rec.errorf("unexpected value %v", rec.args[nargs])
+	}
+	var keys []string
+	for key := range rec.attrs {
+		if !rec.used[key] {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) != 0 {
+		sort.Strings(keys)
+		rec.errorf("unknown attribute %v", keys[0])
+	}
+	return rec.err
+}
+
+// parseBpfTextValue parses a value at the beginning of line. It returns the value,
+// whether it was quoted and the rest of the line.
+func parseBpfTextValue(line string) (string, bool, string, error) {
+	if strings.HasPrefix(line, "\"") {
+		quoted, err := strconv.QuotedPrefix(line)
+		if err != nil {
+			return "", false, "", fmt.Errorf("bad string %v", line)
+		}
+		v, _ := strconv.Unquote(quoted)
+		return v, true, line[len(quoted):], nil
+	}
+	end := strings.IndexAny(line, " \t,]=")
+	if end == -1 {
+		end = len(line)
+	}
+	if end == 0 {
+		return "", false, "", fmt.Errorf("expected a value at %q", line)
+	}
+	return line[:end], false, line[end:], nil
+}
+
+func parseBpfTextRecord(line string) (*bpfTextRecord, error) {
+	rec := &bpfTextRecord{
+		attrs: make(map[string]*bpfTextAttr),
+		used:  make(map[string]bool),
+	}
+	for line = strings.TrimSpace(line); line != ""; line = strings.TrimLeft(line, " \t") {
+		v, quoted, rest, err := parseBpfTextValue(line)
+		if err != nil {
+			return nil, err
+		}
+		line = rest
+		if quoted || !strings.HasPrefix(line, "=") {
+			if rec.kind == "" {
+				rec.kind = v
+			} else if len(rec.attrs) != 0 {
+				return nil, fmt.Errorf("value %v after attributes", v)
+			} else {
+				rec.args = append(rec.args, v)
+			}
+			continue
+		}
+		key := v
+		if rec.attrs[key] != nil {
+			return nil, fmt.Errorf("duplicate attribute %v", key)
+		}
+		line = line[1:]
+		attr := new(bpfTextAttr)
+		if strings.HasPrefix(line, "[") {
+			attr.isList = true
+			line = strings.TrimLeft(line[1:], " \t")
+			for !strings.HasPrefix(line, "]") {
+				if line == "" {
+					return nil, fmt.Errorf("unterminated list %v", key)
+				}
+				v, _, rest, err := parseBpfTextValue(line)
+				if err != nil {
+					return nil, err
+				}
+				attr.list = append(attr.list, v)
+				line = strings.TrimLeft(rest, " \t")
+				if strings.HasPrefix(line, ",") {
+					line = strings.TrimLeft(line[1:], " \t")
+				}
+			}
+			line = line[1:]
+		} else {
+			attr.val, _, line, err = parseBpfTextValue(line)
+			if err != nil {
+				return nil, err
+			}
+		}
+		rec.attrs[key] = attr
+	}
+	return rec, nil
+}
+
+// DeserializeBpfProgState parses a program state in the text format.
+func (brf *BpfRuntimeFuzzer) DeserializeBpfProgState(data []byte) (*BpfProgState, error) {
+	var s *BpfProgState
+	var calls []*BpfCall
+	var pending []func() error
+	maps := make(map[string]*BpfMap)
+	mapRef := func(name string, ref **BpfMap) {
+		if name == "" {
+			return
+		}
+		pending = append(pending, func() error {
+			m := maps[name]
+			if m == nil {
+				return fmt.Errorf("unknown map %v", name)
+			}
+			*ref = m
+			return nil
+		})
+	}
+	structRef := func(rec *bpfTextRecord, key string) *StructDef {
+		if rec.attrs[key] == nil {
+			rec.used[key] = true
+			return nil
+		}
+		id := int(rec.int(key))
+		if id < 0 || id >= len(s.Structs) {
+			rec.errorf("unknown struct %v", id)
+			return nil
+		}
+		return s.Structs[id]
+	}
+	lastCall := func(rec *bpfTextRecord) *BpfCall {
+		if len(calls) == 0 {
+			rec.errorf("%v before call", rec.kind)
+			return &BpfCall{}
+		}
+		return calls[len(calls)-1]
+	}
+
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		rec, err := parseBpfTextRecord(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+		if s == nil && rec.kind != "version" && rec.kind != "type" {
+			return nil, fmt.Errorf("line %v: %v before type", i+1, rec.kind)
+		}
+		nargs := 0
+		switch rec.kind {
+		case "version":
+			nargs = 1
+			if v, err := strconv.Atoi(rec.arg(0)); err != nil || v > bpfTextVersion {
+				rec.errorf("unsupported version %v", rec.arg(0))
+			}
+		case "type":
+			nargs = 1
+			if s != nil {
+				rec.errorf("duplicate type")
+				break
+			}
+			pt, ok := brf.progTypeMap[rec.arg(0)]
+			if !ok {
+				return nil, fmt.Errorf("line %v: unknown program type %v", i+1, rec.arg(0))
+			}
+			s = NewBpfProgState(brf, pt, nil)
+		case "sec":
+			nargs = 1
+			s.Sec = SecDef{Sec: rec.arg(0), Sleepable: rec.bool("sleepable")}
+			for _, sec := range s.pt.SecDefs {
+				if sec.Sec == s.Sec.Sec && sec.Sleepable == s.Sec.Sleepable {
+					s.Sec = sec
+				}
+			}
+			s.SecStr = rec.str("str")
+		case "ret":
+			nargs = 1
+			s.RetVal, err = strconv.Atoi(rec.arg(0))
+			if err != nil {
+				rec.errorf("bad return value %v", rec.arg(0))
+			}
+		case "var_id":
+			nargs = 1
+			s.VarId, err = strconv.Atoi(rec.arg(0))
+			if err != nil {
+				rec.errorf("bad variable id %v", rec.arg(0))
+			}
+		case "path":
+			nargs = 1
+			s.Path = rec.arg(0)
+		case "attach":
+			s.AttachOpt.Str1 = rec.str("str1")
+			s.AttachOpt.Str2 = rec.str("str2")
+			for j, opt := range rec.list("opts") {
+				v, err := strconv.ParseInt(opt, 0, 64)
+				if err != nil {
+					rec.errorf("bad attach option %v", opt)
+				}
+				if j < len(s.AttachOpt.IntOpts) {
+					s.AttachOpt.IntOpts[j] = v
+				} else {
+					s.AttachOpt.IntOpts = append(s.AttachOpt.IntOpts, v)
+				}
+			}
+		case "extern", "ctx_var", "ctx_type", "callback":
+			nargs = 2
+			m := map[string]map[string]string{"extern": s.Externs, "ctx_var": s.CtxVars, "ctx_type": s.CtxTypes,
+				"callback": s.Callbacks}
+			m[rec.kind][rec.arg(0)] = rec.arg(1)
+		case "ctx_access":
+			nargs = 1
+			s.CtxAccesses = append(s.CtxAccesses, rec.arg(0))
+		case "struct":
+			nargs = 1
+			if rec.arg(0) != fmt.Sprint(len(s.Structs)) {
+				rec.errorf("struct %v is out of order", rec.arg(0))
+			}
+			s.Structs = append(s.Structs, &StructDef{
+				Name:       rec.str("name"),
+				IsStruct:   rec.bool("struct"),
+				Size:       int(rec.int("size")),
+				Hints:      rec.hints("hints"),
+				FieldNames: rec.list("field_names"),
+				FieldTypes: rec.list("field_types"),
+			})
+		case "map":
+			nargs = 1
+			m := &BpfMap{
+				MapName:    rec.arg(0),
+				MapType:    rec.str("type"),
+				MapFlags:   rec.list("flags"),
+				Key:        structRef(rec, "key"),
+				Val:        structRef(rec, "val"),
+				MaxEntries: rec.int("max_entries"),
+				Pinned:     rec.bool("pinned"),
+			}
+			if maps[m.MapName] != nil {
+				rec.errorf("duplicate map %v", m.MapName)
+			}
+			mapRef(rec.str("inner"), &m.InnerMap)
+			maps[m.MapName] = m
+			s.Maps = append(s.Maps, m)
+		case "call":
+			nargs = 1
+			if rec.arg(0) != fmt.Sprint(len(calls)) {
+				rec.errorf("call %v is out of order", rec.arg(0))
+			}
+			helper := brf.helperFuncMap[rec.str("helper")]
+			if helper == nil {
+				rec.errorf("unknown helper %v", rec.str("helper"))
+				helper = &BpfHelperFunc{}
+			}
+			call := &BpfCall{
+				Helper:       helper,
+				Ret:          rec.str("ret"),
+				RetType:      rec.str("ret_type"),
+				StackVarSize: int(rec.int("stack_var_size")),
+				ExitCond:     rec.str("exit_cond"),
+				RetBtfId:     rec.str("ret_btf_id"),
+			}
+			mapRef(rec.str("map"), &call.ArgMap)
+			if rec.attrs["parent"] != nil {
+				parent := int(rec.int("parent"))
+				if parent < 0 || parent >= len(calls) {
+					rec.errorf("unknown parent call %v", parent)
+				} else {
+					calls[parent].PostCalls = append(calls[parent].PostCalls, call)
+				}
+			} else {
+				s.Calls = append(s.Calls, call)
+			}
+			calls = append(calls, call)
+		case "hint":
+			call := lastCall(rec)
+			call.Hint = &BpfCallGenHint{
+				ArgHints:       rec.hints("arg_hints"),
+				RetAccessSize:  int(rec.int("ret_access_size")),
+				IsRetAccessRaw: rec.bool("ret_access_raw"),
+			}
+			mapRef(rec.str("map"), &call.Hint.PreferredMap)
+		case "arg":
+			call := lastCall(rec)
+			if len(rec.args) != 0 && rec.args[0] == "nil" {
+				nargs = 1
+				call.Args = append(call.Args, nil)
+				break
+			}
+			call.Args = append(call.Args, &BpfArg{
+				Name:            rec.str("name"),
+				ArgType:         rec.str("type"),
+				Prepare:         rec.str("prepare"),
+				CanBeNull:       rec.bool("can_be_null"),
+				IsNotNull:       rec.bool("is_not_null"),
+				Umin:            rec.int("umin"),
+				Umax:            rec.int("umax"),
+				IsPktAccess:     rec.bool("pkt_access"),
+				IsPktMetaAccess: rec.bool("pkt_meta_access"),
+				AccessSize:      int(rec.int("access_size")),
+			})
+		case "trace":
+			nargs = 1
+			s.Trace = append(s.Trace, BpfTraceEvent{
+				Kind:   rec.arg(0),
+				Depth:  int(rec.int("depth")),
+				Helper: rec.str("helper"),
+				Arg:    int(rec.int("arg")),
+				Detail: rec.str("detail"),
+				Repeat: int(rec.int("repeat")),
+			})
+		default:
+			return nil, fmt.Errorf("line %v: unknown record %v", i+1, rec.kind)
+		}
+		if err := rec.finish(nargs); err != nil {
+			return nil, fmt.Errorf("line %v: %v", i+1, err)
+		}
+	}
+	if s == nil {
+		return nil, fmt.Errorf("no program type")
+	}
+	for _, fn := range pending {
+		if err := fn(); err != nil {
+			return nil, err
+		}
+	}
+	for _, call := range calls {
+		if len(call.Args) != len(call.Helper.Args) {
+			return nil, fmt.Errorf("call to %v has %v args, expected %v", bpfHelperKey(call.Helper),
+				len(call.Args), len(call.Helper.Args))
+		}
+	}
+	return s, nil
+}
+
+// WriteText writes the program state to path in the text format.
+func (s *BpfProgState) WriteText(path string) error {
+	data, err := s.Serialize()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// ReadBpfProgState reads a program state in the text format from path.
+func (brf *BpfRuntimeFuzzer) ReadBpfProgState(path string) (*BpfProgState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := brf.DeserializeBpfProgState(data)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+	return s, nil
+}
+
+// bpfProgTypeName returns the name of the program type in the name of a file of the
+// program, /mnt/bpf_prog/prog_<16 hex digits>_<type>.<ext>, or "" if there is none.
+func bpfProgTypeName(path string) string {
+	prefix := strings.Index(path, "prog_")
+	postfix := strings.LastIndex(path, ".")
+	if prefix != -1 && postfix > prefix+22 {
+		return path[prefix+22 : postfix]
+	}
+	return ""
+}
+
+// ReadBpfGob reads a program state stored with encoding/gob by older versions of BRF.
+// Gob files do not store the program type, so it is parsed from the name of the file,
+// /mnt/bpf_prog/prog_<16 hex digits>_<type>.gob. Maps, structs and helpers that gob
+// decoded as copies are linked back to the ones of the program.
+func (brf *BpfRuntimeFuzzer) ReadBpfGob(path string) (*BpfProgState, error) {
+	ptStr := bpfProgTypeName(path)
+	pt, ok := brf.progTypeMap[ptStr]
+	if !ok {
+		return nil, fmt.Errorf("%v: unknown program type %q", path, ptStr)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	s := NewBpfProgState(brf, pt, nil)
+	if err := gob.NewDecoder(file).Decode(s); err != nil {
+		return nil, fmt.Errorf("%v: %v", path, err)
+	}
+
+	for _, sec := range pt.SecDefs {
+		if sec.Sec == s.Sec.Sec && sec.Sleepable == s.Sec.Sleepable {
+			s.Sec = sec
+		}
+	}
+	linkStruct := func(sd *StructDef) *StructDef {
+		if sd == nil {
+			return nil
+		}
+		for _, sd1 := range s.Structs {
+			if sd1.Name == sd.Name && sd1.Size == sd.Size && sd1.IsStruct == sd.IsStruct &&
+				strings.Join(sd1.FieldTypes, ",") == strings.Join(sd.FieldTypes, ",") {
+				return sd1
+			}
+		}
+		s.Structs = append(s.Structs, sd)
+		return sd
+	}
+	var linkMap func(m *BpfMap) *BpfMap
+	linkMap = func(m *BpfMap) *BpfMap {
+		if m == nil {
+			return nil
+		}
+		for _, m1 := range s.Maps {
+			if m1.MapName == m.MapName {
+				return m1
+			}
+		}
+		s.Maps = append(s.Maps, m)
+		m.Key = linkStruct(m.Key)
+		m.Val = linkStruct(m.Val)
+		m.InnerMap = linkMap(m.InnerMap)
+		return m
+	}
+	for _, m := range s.Maps {
+		m.Key = linkStruct(m.Key)
+		m.Val = linkStruct(m.Val)
+		m.InnerMap = linkMap(m.InnerMap)
+	}
+	var linkCall func(call *BpfCall) error
+	linkCall = func(call *BpfCall) error {
+		helper := brf.helperFuncMap[bpfHelperKey(call.Helper)]
+		if helper == nil {
+			return fmt.Errorf("%v: unknown helper %v", path, call.Helper.Enum)
+		}
+		call.Helper = helper
+		call.ArgMap = linkMap(call.ArgMap)
+		if call.Hint != nil {
+			call.Hint.PreferredMap = linkMap(call.Hint.PreferredMap)
+		}
+		for _, pcall := range call.PostCalls {
+			if err := linkCall(pcall); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, call := range s.Calls {
+		if err := linkCall(call); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// restoreBpfProgState reads the state of the program compiled to obj. States stored
+// with encoding/gob by older versions of BRF are converted to the text format.
+func (brf *BpfRuntimeFuzzer) restoreBpfProgState(obj string) (*BpfProgState, error) {
+	base := strings.TrimSuffix(obj, ".o")
+	s, err := brf.ReadBpfProgState(base + ".brf")
+	if !os.IsNotExist(err) {
+		return s, err
+	}
+	s, err = brf.ReadBpfGob(base + ".gob")
+	if err != nil {
+		return nil, err
+	}
+	if err := s.WriteText(base + ".brf"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
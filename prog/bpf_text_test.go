@@ -0,0 +1,158 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBpfProgStateSerialize(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	for i := 0; i < iters; i++ {
+		s, ok := brf.GenBpfProg(r, nil)
+		if !ok {
+			continue
+		}
+		s.FixRef(r)
+		s.FixSpinLock(r)
+		s.FixTimer(r)
+		s.Path = "/mnt/bpf_prog/prog.o"
+		data, err := s.Serialize()
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		s1, err := brf.DeserializeBpfProgState(data)
+		if err != nil {
+			t.Fatalf("failed to deserialize: %v\n%s", err, data)
+		}
+		data1, err := s1.Serialize()
+		if err != nil {
+			t.Fatalf("failed to serialize: %v", err)
+		}
+		if !bytes.Equal(data, data1) {
+			t.Fatalf("program state changed:\n%s\nvs\n%s", data, data1)
+		}
+		if src, src1 := s.Source(), s1.Source(); !bytes.Equal(src, src1) {
+			t.Fatalf("program source changed:\n%s\nvs\n%s", src, src1)
+		}
+	}
+}
+
+func TestBpfProgStateDeserialize(t *testing.T) {
+	brf := initTestBrf()
+	state := `
+# lookup an element of a hash map
+version 1
+type tc_cls
+sec "tc" str="SEC(\"tc\")\n"
+ret 0
+var_id 2
+attach opts=[0, 0, 0, 0, 0, 0, 0, 0]
+struct 0 name=uint32_t size=4 field_types=[uint32_t]
+struct 1 name=struct_1 struct=true size=12 hints=[spinlock] field_types=["struct bpf_spin_lock", uint64_t]
+map map_0 type=BPF_MAP_TYPE_HASH key=0 val=1 max_entries=16
+call 0 helper=bpf_map_lookup_elem_proto ret=v1 ret_type="struct struct_1 *" map=map_0
+hint arg_hints=[spinlock] map=map_0
+arg name="&map_0" type=ARG_CONST_MAP_PTR
+arg name="&v0" type=ARG_PTR_TO_MAP_KEY
+`
+	s, err := brf.DeserializeBpfProgState([]byte(state))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Calls) != 1 || len(s.Maps) != 1 || len(s.Structs) != 2 {
+		t.Fatalf("got %v calls, %v maps, %v structs", len(s.Calls), len(s.Maps), len(s.Structs))
+	}
+	call := s.Calls[0]
+	if call.Helper != HelperFuncMap["bpf_map_lookup_elem_proto"] {
+		t.Fatalf("call to %v, want bpf_map_lookup_elem", call.Helper.Name)
+	}
+	if call.ArgMap != s.Maps[0] || call.Hint.PreferredMap != s.Maps[0] {
+		t.Fatalf("call does not refer to map_0")
+	}
+	if s.Maps[0].Key != s.Structs[0] || s.Maps[0].Val != s.Structs[1] {
+		t.Fatalf("map_0 does not refer to its key and value structs")
+	}
+	if !s.Structs[1].Hints[HintGenSpinlock] || !call.Hint.ArgHints[HintGenSpinlock] {
+		t.Fatalf("lost spinlock hint")
+	}
+
+	errors := map[string]string{
+		"version 5\ntype tc_cls":             "unsupported version",
+		"type foo":                           "unknown program type",
+		"ret 0":                              "before type",
+		"type tc_cls\nmap map_0 typ=HASH":    "unknown attribute typ",
+		"type tc_cls\nmap map_0 key=0":       "unknown struct 0",
+		"type tc_cls\nmap map_0 inner=map_1": "unknown map map_1",
+		"type tc_cls\ncall 1 helper=bpf_map_lookup_elem_proto": "out of order",
+		"type tc_cls\ncall 0 helper=foo":                       "unknown helper foo",
+		"type tc_cls\ncall 0 helper=bpf_map_lookup_elem_proto": "has 0 args",
+		"type tc_cls\narg name=v0":                             "arg before call",
+		"type tc_cls\nstruct 0 hints=[foo]":                    "unknown hint foo",
+		"type tc_cls\nstruct 0 size=[1]":                       "bad value of size",
+		"type tc_cls\nsec \"tc":                                "bad string",
+	}
+	for state, want := range errors {
+		_, err := brf.DeserializeBpfProgState([]byte(state))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("deserializing %q: got error %v, want %q", state, err, want)
+		}
+	}
+}
+
+func TestReadBpfGob(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	dir := t.TempDir()
+	for i := 0; i < iters; i++ {
+		s, ok := brf.GenBpfProg(r, nil)
+		if !ok {
+			continue
+		}
+		s.FixRef(r)
+		s.FixSpinLock(r)
+		s.FixTimer(r)
+		base := filepath.Join(dir, fmt.Sprintf("prog_%016x_%s", i, s.pt.Name))
+		file, err := os.Create(base + ".gob")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := gob.NewEncoder(file).Encode(s); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		s1, err := brf.restoreBpfProgState(base + ".o")
+		if err != nil {
+			t.Fatalf("failed to convert gob: %v", err)
+		}
+		if src, src1 := s.Source(), s1.Source(); !bytes.Equal(src, src1) {
+			t.Fatalf("program source changed:\n%s\nvs\n%s", src, src1)
+		}
+		if _, err := os.Stat(base + ".brf"); err != nil {
+			t.Fatalf("converted state is not written: %v", err)
+		}
+	}
+}
+
+func TestMutBpfSeedProgWithoutModel(t *testing.T) {
+	target, rs, _ := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	obj := filepath.Join(t.TempDir(), "prog_0000000000000000_tc_cls.o")
+	if err := os.WriteFile(obj, []byte("\x7fELF"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if s := brf.MutBpfSeedProg(r, obj); s != nil {
+		t.Fatalf("program without a model is replaced by %v", s.Path)
+	}
+}
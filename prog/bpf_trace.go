@@ -0,0 +1,107 @@
+package prog
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Kinds of BpfTraceEvent.
+const (
+	BpfTraceProg   = "prog"   // the program type and the first helper were chosen
+	BpfTraceMutate = "mutate" // an argument was chosen to be regenerated
+	BpfTraceCall   = "call"   // a call is generated with the hint in Detail
+	BpfTraceArg    = "arg"    // an argument is produced by the source in Detail
+	BpfTraceReject = "reject" // an attempt was rejected for the reason in Detail
+	BpfTraceFail   = "fail"   // a call could not be generated
+	BpfTraceFix    = "fix"    // a call was added to balance references or locks
+	BpfTraceCtx    = "ctx"    // a ctx field is written or partially loaded by the statement in Detail
+	BpfTraceFrom   = "from"   // the program is mutated from the program in Detail
+)
+
+// BpfTraceEvent is a decision made while generating or mutating a program.
+type BpfTraceEvent struct {
+	Kind   string
+	Depth  int    // recursion depth of genBpfHelperCall
+	Helper string // helper or kfunc of the call the decision is about
+	Arg    int    // argument of the call, or -1 if the decision is about the whole call
+	Detail string
+	Repeat int // number of times the event was repeated right after it happened
+}
+
+func (s *BpfProgState) trace(kind string, helper *BpfHelperFunc, arg int, msg string, args ...interface{}) {
+	ev := BpfTraceEvent{
+		Kind:   kind,
+		Arg:    arg,
+		Detail: fmt.Sprintf(msg, args...),
+	}
+	if s.gen != nil {
+		ev.Depth = s.gen.rd
+	}
+	if helper != nil {
+		ev.Helper = helper.Enum
+	}
+	// Retries tend to hit the same failure many times in a row.
+	if n := len(s.Trace); n != 0 {
+		if last := &s.Trace[n-1]; last.Kind == ev.Kind && last.Depth == ev.Depth && last.Helper == ev.Helper &&
+			last.Arg == ev.Arg && last.Detail == ev.Detail {
+			last.Repeat++
+			return
+		}
+	}
+	s.Trace = append(s.Trace, ev)
+}
+
+// restartTrace drops the trace of the program s was restored from, so the trace of a
+// mutated program only holds the mutations that produced it.
+func (s *BpfProgState) restartTrace(from string) {
+	s.Trace = nil
+	s.trace(BpfTraceFrom, nil, -1, "%v", strings.TrimSuffix(filepath.Base(from), ".o"))
+}
+
+func (h *BpfCallGenHint) String() string {
+	var hints []string
+	for hint := range h.ArgHints {
+		hints = append(hints, bpfArgHintNames[hint])
+	}
+	sort.Strings(hints)
+	var res []string
+	if len(hints) != 0 {
+		res = append(res, fmt.Sprintf("arg_hints=[%v]", strings.Join(hints, ", ")))
+	}
+	if h.RetAccessSize != 0 {
+		res = append(res, fmt.Sprintf("ret_access_size=%v", h.RetAccessSize))
+	}
+	if h.IsRetAccessRaw {
+		res = append(res, "ret_access_raw")
+	}
+	if h.PreferredMap != nil {
+		res = append(res, "map="+h.PreferredMap.MapName)
+	}
+	return strings.Join(res, " ")
+}
+
+// FormatTrace returns the decisions made to build the program, one per line and indented
+// by the recursion depth, so arguments produced by other calls are nested under them.
+func (s *BpfProgState) FormatTrace() []byte {
+	buf := new(bytes.Buffer)
+	for _, ev := range s.Trace {
+		fmt.Fprintf(buf, "%v%-6v", strings.Repeat("  ", ev.Depth), ev.Kind)
+		if ev.Helper != "" {
+			fmt.Fprintf(buf, " %v", ev.Helper)
+		}
+		if ev.Arg != -1 {
+			fmt.Fprintf(buf, " arg[%v]", ev.Arg)
+		}
+		if ev.Detail != "" {
+			fmt.Fprintf(buf, ": %v", ev.Detail)
+		}
+		if ev.Repeat != 0 {
+			fmt.Fprintf(buf, " (%v times)", ev.Repeat+1)
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package prog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBpfTrace(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	for i := 0; i < iters; i++ {
+		s, ok := brf.GenBpfProg(r, nil)
+		if !ok {
+			continue
+		}
+		if len(s.Trace) == 0 || s.Trace[0].Kind != BpfTraceProg || s.Trace[0].Helper != s.Calls[len(s.Calls)-1].Helper.Enum {
+			t.Fatalf("trace does not start with the program type: %+v", s.Trace)
+		}
+		traced := make(map[string]bool)
+		for _, ev := range s.Trace {
+			if ev.Kind == BpfTraceCall {
+				traced[ev.Helper] = true
+			}
+			if ev.Depth < 0 {
+				t.Fatalf("negative depth: %+v", ev)
+			}
+		}
+		for _, call := range s.Calls {
+			if !traced[call.Helper.Enum] {
+				t.Fatalf("call to %v is not traced:\n%s", call.Helper.Enum, s.FormatTrace())
+			}
+		}
+		n := len(s.Trace)
+		brf.MutBpfProg(r, s)
+		if len(s.Trace) > n && s.Trace[n].Kind != BpfTraceMutate {
+			t.Fatalf("mutation is not traced: %+v", s.Trace[n])
+		}
+		if lines := bytes.Count(s.FormatTrace(), []byte("\n")); lines != len(s.Trace) {
+			t.Fatalf("formatted %v events in %v lines", len(s.Trace), lines)
+		}
+		s.restartTrace("/mnt/bpf_prog/prog_0123456789abcdef_xdp.o")
+		if len(s.Trace) != 1 || s.Trace[0].Kind != BpfTraceFrom || s.Trace[0].Detail != "prog_0123456789abcdef_xdp" {
+			t.Fatalf("trace is not restarted: %+v", s.Trace)
+		}
+	}
+}
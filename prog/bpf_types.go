@@ -171,8 +171,8 @@ var HelperFuncMap = map[string]*BpfHelperFunc{
 	"bpf_sk_assign_proto":                      &BpfHelperFunc{Num: 124, Enum: "BPF_FUNC_sk_assign", Name: "bpf_sk_assign", Proto: "bpf_sk_assign_proto", Args: []string{"ARG_PTR_TO_CTX", "ARG_PTR_TO_BTF_ID_SOCK_COMMON", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
 	"bpf_sk_lookup_assign_proto":               &BpfHelperFunc{Num: 124, Enum: "BPF_FUNC_sk_assign", Name: "bpf_sk_lookup_assign", Proto: "bpf_sk_lookup_assign_proto", Args: []string{"ARG_PTR_TO_CTX", "ARG_PTR_TO_SOCKET_OR_NULL", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
 	"bpf_ktime_get_boot_ns_proto":              &BpfHelperFunc{Num: 125, Enum: "BPF_FUNC_ktime_get_boot_ns", Name: "bpf_ktime_get_boot_ns", Proto: "bpf_ktime_get_boot_ns_proto", Ret: "RET_INTEGER"},
-	"bpf_seq_printf_proto":                     &BpfHelperFunc{Num: 126, Enum: "BPF_FUNC_seq_printf", Name: "bpf_seq_printf", Proto: "bpf_seq_printf_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE", "ARG_PTR_TO_MEM_OR_NULL", "ARG_CONST_SIZE_OR_ZERO"}, ArgBtfIds: []string{"struct seq_file"}, Ret: "RET_INTEGER", GplOnly: true},
-	"bpf_seq_write_proto":                      &BpfHelperFunc{Num: 127, Enum: "BPF_FUNC_seq_write", Name: "bpf_seq_write", Proto: "bpf_seq_write_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE_OR_ZERO"}, ArgBtfIds: []string{"struct seq_file"}, Ret: "RET_INTEGER", GplOnly: true},
+	"bpf_seq_printf_proto":                     &BpfHelperFunc{Num: 126, Enum: "BPF_FUNC_seq_printf", Name: "bpf_seq_printf", Proto: "bpf_seq_printf_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE", "ARG_PTR_TO_MEM_OR_NULL", "ARG_CONST_SIZE_OR_ZERO"}, ArgBtfIds: []string{"struct seq_file"}, Ret: "RET_INTEGER", GplOnly: true, IterOnly: true},
+	"bpf_seq_write_proto":                      &BpfHelperFunc{Num: 127, Enum: "BPF_FUNC_seq_write", Name: "bpf_seq_write", Proto: "bpf_seq_write_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE_OR_ZERO"}, ArgBtfIds: []string{"struct seq_file"}, Ret: "RET_INTEGER", GplOnly: true, IterOnly: true},
 	"bpf_sk_cgroup_id_proto":                   &BpfHelperFunc{Num: 128, Enum: "BPF_FUNC_sk_cgroup_id", Name: "bpf_sk_cgroup_id", Proto: "bpf_sk_cgroup_id_proto", Args: []string{"ARG_PTR_TO_BTF_ID_SOCK_COMMON"}, Ret: "RET_INTEGER"},
 	"bpf_sk_ancestor_cgroup_id_proto":          &BpfHelperFunc{Num: 129, Enum: "BPF_FUNC_sk_ancestor_cgroup_id", Name: "bpf_sk_ancestor_cgroup_id", Proto: "bpf_sk_ancestor_cgroup_id_proto", Args: []string{"ARG_PTR_TO_BTF_ID_SOCK_COMMON", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
 	"bpf_ringbuf_output_proto":                 &BpfHelperFunc{Num: 130, Enum: "BPF_FUNC_ringbuf_output", Name: "bpf_ringbuf_output", Proto: "bpf_ringbuf_output_proto", Args: []string{"ARG_CONST_MAP_PTR", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE_OR_ZERO", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
@@ -193,9 +193,9 @@ var HelperFuncMap = map[string]*BpfHelperFunc{
 	"bpf_inode_storage_get_proto":              &BpfHelperFunc{Num: 145, Enum: "BPF_FUNC_inode_storage_get", Name: "bpf_inode_storage_get", Proto: "bpf_inode_storage_get_proto", Args: []string{"ARG_CONST_MAP_PTR", "ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_MAP_VALUE_OR_NULL", "ARG_ANYTHING"}, ArgBtfIds: []string{"struct inode"}, Ret: "RET_PTR_TO_MAP_VALUE_OR_NULL"},
 	"bpf_inode_storage_delete_proto":           &BpfHelperFunc{Num: 146, Enum: "BPF_FUNC_inode_storage_delete", Name: "bpf_inode_storage_delete", Proto: "bpf_inode_storage_delete_proto", Args: []string{"ARG_CONST_MAP_PTR", "ARG_PTR_TO_BTF_ID"}, ArgBtfIds: []string{"struct inode"}, Ret: "RET_INTEGER"},
 	"bpf_d_path_proto":                         &BpfHelperFunc{Num: 147, Enum: "BPF_FUNC_d_path", Name: "bpf_d_path", Proto: "bpf_d_path_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE_OR_ZERO"}, ArgBtfIds: []string{"struct path"}, Ret: "RET_INTEGER"},
-	"bpf_copy_from_user_proto":                 &BpfHelperFunc{Num: 148, Enum: "BPF_FUNC_copy_from_user", Name: "bpf_copy_from_user", Proto: "bpf_copy_from_user_proto", Args: []string{"ARG_PTR_TO_UNINIT_MEM", "ARG_CONST_SIZE_OR_ZERO", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
+	"bpf_copy_from_user_proto":                 &BpfHelperFunc{Num: 148, Enum: "BPF_FUNC_copy_from_user", Name: "bpf_copy_from_user", Proto: "bpf_copy_from_user_proto", Args: []string{"ARG_PTR_TO_UNINIT_MEM", "ARG_CONST_SIZE_OR_ZERO", "ARG_ANYTHING"}, Ret: "RET_INTEGER", Sleepable: true},
 	"bpf_snprintf_btf_proto":                   &BpfHelperFunc{Num: 149, Enum: "BPF_FUNC_snprintf_btf", Name: "bpf_snprintf_btf", Proto: "bpf_snprintf_btf_proto", Args: []string{"ARG_PTR_TO_MEM", "ARG_CONST_SIZE", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
-	"bpf_seq_printf_btf_proto":                 &BpfHelperFunc{Num: 150, Enum: "BPF_FUNC_seq_printf_btf", Name: "bpf_seq_printf_btf", Proto: "bpf_seq_printf_btf_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE_OR_ZERO", "ARG_ANYTHING"}, ArgBtfIds: []string{"struct seq_file"}, Ret: "RET_INTEGER", GplOnly: true},
+	"bpf_seq_printf_btf_proto":                 &BpfHelperFunc{Num: 150, Enum: "BPF_FUNC_seq_printf_btf", Name: "bpf_seq_printf_btf", Proto: "bpf_seq_printf_btf_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE_OR_ZERO", "ARG_ANYTHING"}, ArgBtfIds: []string{"struct seq_file"}, Ret: "RET_INTEGER", GplOnly: true, IterOnly: true},
 	"bpf_skb_cgroup_classid_proto":             &BpfHelperFunc{Num: 151, Enum: "BPF_FUNC_skb_cgroup_classid", Name: "bpf_skb_cgroup_classid", Proto: "bpf_skb_cgroup_classid_proto", Args: []string{"ARG_PTR_TO_CTX"}, Ret: "RET_INTEGER"},
 	"bpf_redirect_neigh_proto":                 &BpfHelperFunc{Num: 152, Enum: "BPF_FUNC_redirect_neigh", Name: "bpf_redirect_neigh", Proto: "bpf_redirect_neigh_proto", Args: []string{"ARG_ANYTHING", "ARG_PTR_TO_MEM_OR_NULL", "ARG_CONST_SIZE_OR_ZERO", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
 	"bpf_per_cpu_ptr_proto":                    &BpfHelperFunc{Num: 153, Enum: "BPF_FUNC_per_cpu_ptr", Name: "bpf_per_cpu_ptr", Proto: "bpf_per_cpu_ptr_proto", Args: []string{"ARG_PTR_TO_PERCPU_BTF_ID", "ARG_ANYTHING"}, Ret: "RET_PTR_TO_MEM_OR_BTF_ID_OR_NULL"},
@@ -206,7 +206,7 @@ var HelperFuncMap = map[string]*BpfHelperFunc{
 	"bpf_get_current_task_btf_proto":           &BpfHelperFunc{Num: 158, Enum: "BPF_FUNC_get_current_task_btf", Name: "bpf_get_current_task_btf", Proto: "bpf_get_current_task_btf_proto", Ret: "RET_PTR_TO_BTF_ID", RetBtfId: "struct task_struct", GplOnly: true},
 	"bpf_bprm_opts_set_proto":                  &BpfHelperFunc{Num: 159, Enum: "BPF_FUNC_bprm_opts_set", Name: "bpf_bprm_opts_set", Proto: "bpf_bprm_opts_set_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
 	"bpf_ktime_get_coarse_ns_proto":            &BpfHelperFunc{Num: 160, Enum: "BPF_FUNC_ktime_get_coarse_ns", Name: "bpf_ktime_get_coarse_ns", Proto: "bpf_ktime_get_coarse_ns_proto", Ret: "RET_INTEGER"},
-	"bpf_ima_inode_hash_proto":                 &BpfHelperFunc{Num: 161, Enum: "BPF_FUNC_ima_inode_hash", Name: "bpf_ima_inode_hash", Proto: "bpf_ima_inode_hash_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_UNINIT_MEM", "ARG_CONST_SIZE"}, Ret: "RET_INTEGER"},
+	"bpf_ima_inode_hash_proto":                 &BpfHelperFunc{Num: 161, Enum: "BPF_FUNC_ima_inode_hash", Name: "bpf_ima_inode_hash", Proto: "bpf_ima_inode_hash_proto", Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_PTR_TO_UNINIT_MEM", "ARG_CONST_SIZE"}, Ret: "RET_INTEGER", Sleepable: true},
 	"bpf_sock_from_file_proto":                 &BpfHelperFunc{Num: 162, Enum: "BPF_FUNC_sock_from_file", Name: "bpf_sock_from_file", Proto: "bpf_sock_from_file_proto", Args: []string{"ARG_PTR_TO_BTF_ID"}, ArgBtfIds: []string{"struct file"}, Ret: "RET_PTR_TO_BTF_ID_OR_NULL", RetBtfId: "struct socket"},
 	"bpf_skb_check_mtu_proto":                  &BpfHelperFunc{Num: 163, Enum: "BPF_FUNC_check_mtu", Name: "bpf_skb_check_mtu", Proto: "bpf_skb_check_mtu_proto", Args: []string{"ARG_PTR_TO_CTX", "ARG_ANYTHING", "ARG_PTR_TO_INT", "ARG_ANYTHING", "ARG_ANYTHING"}, Ret: "RET_INTEGER", GplOnly: true},
 	"bpf_xdp_check_mtu_proto":                  &BpfHelperFunc{Num: 163, Enum: "BPF_FUNC_check_mtu", Name: "bpf_xdp_check_mtu", Proto: "bpf_xdp_check_mtu_proto", Args: []string{"ARG_PTR_TO_CTX", "ARG_ANYTHING", "ARG_PTR_TO_INT", "ARG_ANYTHING", "ARG_ANYTHING"}, Ret: "RET_INTEGER", GplOnly: true},
@@ -224,6 +224,59 @@ var HelperFuncMap = map[string]*BpfHelperFunc{
 	"bpf_get_attach_cookie_proto_trace":        &BpfHelperFunc{Num: 174, Enum: "BPF_FUNC_get_attach_cookie", Name: "bpf_get_attach_cookie_trace", Proto: "bpf_get_attach_cookie_proto_trace", Args: []string{"ARG_PTR_TO_CTX"}, Ret: "RET_INTEGER"},
 	"bpf_get_attach_cookie_proto_pe":           &BpfHelperFunc{Num: 174, Enum: "BPF_FUNC_get_attach_cookie", Name: "bpf_get_attach_cookie_pe", Proto: "bpf_get_attach_cookie_proto_pe", Args: []string{"ARG_PTR_TO_CTX"}, Ret: "RET_INTEGER"},
 	"bpf_task_pt_regs_proto":                   &BpfHelperFunc{Num: 175, Enum: "BPF_FUNC_task_pt_regs", Name: "bpf_task_pt_regs", Proto: "bpf_task_pt_regs_proto", Args: []string{"ARG_PTR_TO_BTF_ID"}, ArgBtfIds: []string{"struct task_struct"}, Ret: "RET_PTR_TO_BTF_ID", RetBtfId: "struct pt_regs", GplOnly: true},
+	"bpf_copy_from_user_task_proto":            &BpfHelperFunc{Num: 191, Enum: "BPF_FUNC_copy_from_user_task", Name: "bpf_copy_from_user_task", Proto: "bpf_copy_from_user_task_proto", Args: []string{"ARG_PTR_TO_UNINIT_MEM", "ARG_CONST_SIZE_OR_ZERO", "ARG_ANYTHING", "ARG_PTR_TO_BTF_ID", "ARG_ANYTHING"}, ArgBtfIds: []string{"struct task_struct"}, Ret: "RET_INTEGER", GplOnly: true, Sleepable: true},
+	"bpf_kptr_xchg_proto":                      &BpfHelperFunc{Num: 194, Enum: "BPF_FUNC_kptr_xchg", Name: "bpf_kptr_xchg", Proto: "bpf_kptr_xchg_proto", Args: []string{"ARG_PTR_TO_KPTR", "ARG_PTR_TO_BTF_ID_OR_NULL"}, Ret: "RET_PTR_TO_BTF_ID_OR_NULL"},
+	"bpf_dynptr_from_mem_proto":                &BpfHelperFunc{Num: 197, Enum: "BPF_FUNC_dynptr_from_mem", Name: "bpf_dynptr_from_mem", Proto: "bpf_dynptr_from_mem_proto", Args: []string{"ARG_PTR_TO_UNINIT_MEM", "ARG_CONST_SIZE_OR_ZERO", "ARG_ANYTHING", "ARG_PTR_TO_UNINIT_DYNPTR"}, Ret: "RET_INTEGER"},
+	"bpf_ringbuf_reserve_dynptr_proto":         &BpfHelperFunc{Num: 198, Enum: "BPF_FUNC_ringbuf_reserve_dynptr", Name: "bpf_ringbuf_reserve_dynptr", Proto: "bpf_ringbuf_reserve_dynptr_proto", Args: []string{"ARG_CONST_MAP_PTR", "ARG_ANYTHING", "ARG_ANYTHING", "ARG_PTR_TO_UNINIT_DYNPTR"}, Ret: "RET_INTEGER"},
+	"bpf_ringbuf_submit_dynptr_proto":          &BpfHelperFunc{Num: 199, Enum: "BPF_FUNC_ringbuf_submit_dynptr", Name: "bpf_ringbuf_submit_dynptr", Proto: "bpf_ringbuf_submit_dynptr_proto", Args: []string{"ARG_PTR_TO_DYNPTR", "ARG_ANYTHING"}, Ret: "RET_VOID"},
+	"bpf_ringbuf_discard_dynptr_proto":         &BpfHelperFunc{Num: 200, Enum: "BPF_FUNC_ringbuf_discard_dynptr", Name: "bpf_ringbuf_discard_dynptr", Proto: "bpf_ringbuf_discard_dynptr_proto", Args: []string{"ARG_PTR_TO_DYNPTR", "ARG_ANYTHING"}, Ret: "RET_VOID"},
+	"bpf_dynptr_read_proto":                    &BpfHelperFunc{Num: 201, Enum: "BPF_FUNC_dynptr_read", Name: "bpf_dynptr_read", Proto: "bpf_dynptr_read_proto", Args: []string{"ARG_PTR_TO_UNINIT_MEM", "ARG_CONST_SIZE_OR_ZERO", "ARG_PTR_TO_DYNPTR", "ARG_ANYTHING", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
+	"bpf_dynptr_write_proto":                   &BpfHelperFunc{Num: 202, Enum: "BPF_FUNC_dynptr_write", Name: "bpf_dynptr_write", Proto: "bpf_dynptr_write_proto", Args: []string{"ARG_PTR_TO_DYNPTR", "ARG_ANYTHING", "ARG_PTR_TO_MEM", "ARG_CONST_SIZE_OR_ZERO", "ARG_ANYTHING"}, Ret: "RET_INTEGER"},
+	"bpf_dynptr_data_proto":                    &BpfHelperFunc{Num: 203, Enum: "BPF_FUNC_dynptr_data", Name: "bpf_dynptr_data", Proto: "bpf_dynptr_data_proto", Args: []string{"ARG_PTR_TO_DYNPTR", "ARG_ANYTHING", "ARG_CONST_ALLOC_SIZE_OR_ZERO"}, Ret: "RET_PTR_TO_DYNPTR_MEM_OR_NULL"},
+	// kfuncs
+	"bpf_task_acquire":                         &BpfHelperFunc{Num: -1, Enum: "bpf_task_acquire", Name: "bpf_task_acquire", Decl: "struct task_struct *bpf_task_acquire(struct task_struct *p)", Kfunc: true, Args: []string{"ARG_PTR_TO_BTF_ID"}, ArgBtfIds: []string{"struct task_struct"}, Ret: "RET_PTR_TO_BTF_ID_OR_NULL", RetBtfId: "struct task_struct"},
+	"bpf_task_from_pid":                        &BpfHelperFunc{Num: -1, Enum: "bpf_task_from_pid", Name: "bpf_task_from_pid", Decl: "struct task_struct *bpf_task_from_pid(s32 pid)", Kfunc: true, Args: []string{"ARG_ANYTHING"}, Ret: "RET_PTR_TO_BTF_ID_OR_NULL", RetBtfId: "struct task_struct"},
+	"bpf_task_release":                         &BpfHelperFunc{Num: -1, Enum: "bpf_task_release", Name: "bpf_task_release", Decl: "void bpf_task_release(struct task_struct *p)", Kfunc: true, Args: []string{"ARG_PTR_TO_BTF_ID"}, ArgBtfIds: []string{"struct task_struct"}, Ret: "RET_VOID"},
+	"bpf_cgroup_acquire":                       &BpfHelperFunc{Num: -1, Enum: "bpf_cgroup_acquire", Name: "bpf_cgroup_acquire", Decl: "struct cgroup *bpf_cgroup_acquire(struct cgroup *cgrp)", Kfunc: true, Args: []string{"ARG_PTR_TO_BTF_ID"}, ArgBtfIds: []string{"struct cgroup"}, Ret: "RET_PTR_TO_BTF_ID_OR_NULL", RetBtfId: "struct cgroup"},
+	"bpf_cgroup_ancestor":                      &BpfHelperFunc{Num: -1, Enum: "bpf_cgroup_ancestor", Name: "bpf_cgroup_ancestor", Decl: "struct cgroup *bpf_cgroup_ancestor(struct cgroup *cgrp, int level)", Kfunc: true, Args: []string{"ARG_PTR_TO_BTF_ID", "ARG_ANYTHING"}, ArgBtfIds: []string{"struct cgroup"}, Ret: "RET_PTR_TO_BTF_ID_OR_NULL", RetBtfId: "struct cgroup"},
+	"bpf_cgroup_from_id":                       &BpfHelperFunc{Num: -1, Enum: "bpf_cgroup_from_id", Name: "bpf_cgroup_from_id", Decl: "struct cgroup *bpf_cgroup_from_id(u64 cgid)", Kfunc: true, Args: []string{"ARG_ANYTHING"}, Ret: "RET_PTR_TO_BTF_ID_OR_NULL", RetBtfId: "struct cgroup"},
+	"bpf_cgroup_release":                       &BpfHelperFunc{Num: -1, Enum: "bpf_cgroup_release", Name: "bpf_cgroup_release", Decl: "void bpf_cgroup_release(struct cgroup *cgrp)", Kfunc: true, Args: []string{"ARG_PTR_TO_BTF_ID"}, ArgBtfIds: []string{"struct cgroup"}, Ret: "RET_VOID"},
+}
+
+// RefFuncMap declares the reference semantics of helpers (by enum) and kfuncs (by name).
+var RefFuncMap = map[string][]BpfRefSpec{
+	// Sockets
+	"BPF_FUNC_sk_lookup_tcp":            []BpfRefSpec{{Acquire: true, Class: RefClassSocket, RefArg: RefRet}},
+	"BPF_FUNC_sk_lookup_udp":            []BpfRefSpec{{Acquire: true, Class: RefClassSocket, RefArg: RefRet}},
+	"BPF_FUNC_skc_lookup_tcp":           []BpfRefSpec{{Acquire: true, Class: RefClassSocket, RefArg: RefRet}},
+	"BPF_FUNC_map_lookup_elem":          []BpfRefSpec{{Acquire: true, Class: RefClassSocket, RefArg: RefRet, MapTypes: []string{"BPF_MAP_TYPE_SOCKMAP", "BPF_MAP_TYPE_SOCKHASH"}}},
+	"BPF_FUNC_sk_release":               []BpfRefSpec{{Release: true, Class: RefClassSocket, RefArg: 0, Placement: RefReleasePostCall}},
+	"BPF_FUNC_tcp_sock":                 []BpfRefSpec{{Propagate: true, Class: RefClassSocket, RefArg: 0}},
+	"BPF_FUNC_sk_fullsock":              []BpfRefSpec{{Propagate: true, Class: RefClassSocket, RefArg: 0}},
+	"BPF_FUNC_skc_to_tcp_sock":          []BpfRefSpec{{Propagate: true, Class: RefClassSocket, RefArg: 0}},
+	"BPF_FUNC_skc_to_tcp6_sock":         []BpfRefSpec{{Propagate: true, Class: RefClassSocket, RefArg: 0}},
+	"BPF_FUNC_skc_to_udp6_sock":         []BpfRefSpec{{Propagate: true, Class: RefClassSocket, RefArg: 0}},
+	"BPF_FUNC_skc_to_tcp_timewait_sock": []BpfRefSpec{{Propagate: true, Class: RefClassSocket, RefArg: 0}},
+	"BPF_FUNC_skc_to_tcp_request_sock":  []BpfRefSpec{{Propagate: true, Class: RefClassSocket, RefArg: 0}},
+	// Ringbuf records
+	"BPF_FUNC_ringbuf_reserve": []BpfRefSpec{{Acquire: true, Class: RefClassRingbufRecord, RefArg: RefRet}},
+	"BPF_FUNC_ringbuf_submit":  []BpfRefSpec{{Release: true, Class: RefClassRingbufRecord, RefArg: 0, FixedArgs: map[int]string{1: "0"}}},
+	"BPF_FUNC_ringbuf_discard": []BpfRefSpec{{Release: true, Class: RefClassRingbufRecord, RefArg: 0, FixedArgs: map[int]string{1: "0"}}},
+	// Dynptrs
+	"BPF_FUNC_ringbuf_reserve_dynptr": []BpfRefSpec{{Acquire: true, Class: RefClassDynptr, RefArg: 3}},
+	"BPF_FUNC_ringbuf_submit_dynptr":  []BpfRefSpec{{Release: true, Class: RefClassDynptr, RefArg: 0, FixedArgs: map[int]string{1: "0"}}},
+	"BPF_FUNC_ringbuf_discard_dynptr": []BpfRefSpec{{Release: true, Class: RefClassDynptr, RefArg: 0, FixedArgs: map[int]string{1: "0"}}},
+	// Kptrs
+	"BPF_FUNC_kptr_xchg": []BpfRefSpec{{Acquire: true, Class: RefClassKptr, RefArg: RefRet}, {Release: true, Class: RefClassKptr, RefArg: 1}},
+	// Tasks
+	"bpf_task_acquire":  []BpfRefSpec{{Acquire: true, Class: RefClassTask, RefArg: RefRet}},
+	"bpf_task_from_pid": []BpfRefSpec{{Acquire: true, Class: RefClassTask, RefArg: RefRet}},
+	"bpf_task_release":  []BpfRefSpec{{Release: true, Class: RefClassTask, RefArg: 0}},
+	// Cgroups
+	"bpf_cgroup_acquire":  []BpfRefSpec{{Acquire: true, Class: RefClassCgroup, RefArg: RefRet}},
+	"bpf_cgroup_ancestor": []BpfRefSpec{{Acquire: true, Class: RefClassCgroup, RefArg: RefRet}},
+	"bpf_cgroup_from_id":  []BpfRefSpec{{Acquire: true, Class: RefClassCgroup, RefArg: RefRet}},
+	"bpf_cgroup_release":  []BpfRefSpec{{Release: true, Class: RefClassCgroup, RefArg: 0}},
 }
 
 var ProgTypeMap = map[string]*BpfProgTypeDef{
@@ -680,6 +733,9 @@ var ProgTypeMap = map[string]*BpfProgTypeDef{
 			"bpf_get_current_task_proto", "bpf_get_current_task_btf_proto", "bpf_probe_read_user_proto", "bpf_probe_read_kernel_proto",
 			"bpf_probe_read_user_str_proto", "bpf_probe_read_kernel_str_proto", "bpf_snprintf_btf_proto", "bpf_snprintf_proto",
 			"bpf_task_pt_regs_proto",
+			//  kfuncs
+			"bpf_task_acquire", "bpf_task_from_pid", "bpf_task_release", "bpf_cgroup_acquire",
+			"bpf_cgroup_ancestor", "bpf_cgroup_from_id", "bpf_cgroup_release",
 	}},
 	"tc_act": &BpfProgTypeDef{
 		Name: "tc_act",
@@ -1036,7 +1092,7 @@ var ProgTypeMap = map[string]*BpfProgTypeDef{
 			"bpf_ringbuf_submit_proto", "bpf_ringbuf_discard_proto", "bpf_ringbuf_query_proto", "bpf_jiffies64_proto",
 			"bpf_get_task_stack_proto", "bpf_copy_from_user_proto", "bpf_snprintf_btf_proto", "bpf_per_cpu_ptr_proto",
 			"bpf_this_cpu_ptr_proto", "bpf_task_storage_get_proto", "bpf_task_storage_delete_proto", "bpf_for_each_map_elem_proto",
-			"bpf_snprintf_proto", "bpf_get_func_ip_proto_tracing",
+			"bpf_snprintf_proto", "bpf_get_func_ip_proto_tracing", "bpf_copy_from_user_task_proto",
 			//    bpf_base_func_proto
 			//"bpf_map_lookup_elem_proto", "bpf_map_update_elem_proto", "bpf_map_delete_elem_proto", "bpf_map_push_elem_proto",
 			//"bpf_map_pop_elem_proto", "bpf_map_peek_elem_proto", "bpf_get_prandom_u32_proto", "bpf_get_raw_smp_processor_id_proto",
@@ -1049,6 +1105,9 @@ var ProgTypeMap = map[string]*BpfProgTypeDef{
 			//"bpf_trace_printk_proto", "bpf_get_current_task_proto", "bpf_get_current_task_btf_proto", "bpf_probe_read_user_proto",
 			//"bpf_probe_read_kernel_proto", "bpf_probe_read_user_str_proto", "bpf_probe_read_kernel_str_proto", "bpf_snprintf_btf_proto",
 			//"bpf_snprintf_proto", "bpf_task_pt_regs_proto",
+			//  kfuncs
+			"bpf_task_acquire", "bpf_task_from_pid", "bpf_task_release", "bpf_cgroup_acquire",
+			"bpf_cgroup_ancestor", "bpf_cgroup_from_id", "bpf_cgroup_release",
 	}},
 //	"bpf_struct_ops": &BpfProgTypeDef{
 //		Name: "bpf_struct_ops",
@@ -1114,9 +1173,12 @@ var ProgTypeMap = map[string]*BpfProgTypeDef{
 //	}},
 }
 
+// TracingIterCtx describes the context of the programs of a BPF iterator kind.
 type TracingIterCtx struct {
-	Name string
-	Ctx  *StructDef
+	Name     string
+	Ctx      *StructDef
+	MapTypes []string // types of the map the iterator walks, if it walks the elements of a map
+	Cgroup   bool     // the iterator walks a cgroup hierarchy
 }
 
 /*
@@ -1126,6 +1188,7 @@ type TracingIterCtx struct {
 ./kernel/bpf/task_iter.c:DEFINE_BPF_ITER_FUNC(task, struct bpf_iter_meta *meta, struct task_struct *task)
 ./kernel/bpf/task_iter.c:DEFINE_BPF_ITER_FUNC(task_file, struct bpf_iter_meta *meta,
 ./kernel/bpf/task_iter.c:DEFINE_BPF_ITER_FUNC(task_vma, struct bpf_iter_meta *meta,
+./kernel/bpf/cgroup_iter.c:DEFINE_BPF_ITER_FUNC(cgroup, struct bpf_iter_meta *meta, struct cgroup *cgroup)
 ./net/unix/af_unix.c:DEFINE_BPF_ITER_FUNC(unix, struct bpf_iter_meta *meta,
 ./net/ipv4/udp.c:DEFINE_BPF_ITER_FUNC(udp, struct bpf_iter_meta *meta,
 ./net/ipv4/tcp_ipv4.c:DEFINE_BPF_ITER_FUNC(tcp, struct bpf_iter_meta *meta,
@@ -1134,20 +1197,63 @@ type TracingIterCtx struct {
 ./net/netlink/af_netlink.c:DEFINE_BPF_ITER_FUNC(netlink, struct bpf_iter_meta *meta, struct netlink_sock *sk)
 ./net/ipv6/route.c:DEFINE_BPF_ITER_FUNC(ipv6_route, struct bpf_iter_meta *meta, struct fib6_info *rt)
 */
+// bpfDynptrKptrProtos are the dynptr and kptr helpers bpf_base_func_proto gives to
+// programs loaded with CAP_BPF.
+var bpfDynptrKptrProtos = []string{
+	"bpf_kptr_xchg_proto", "bpf_dynptr_from_mem_proto", "bpf_ringbuf_reserve_dynptr_proto", "bpf_ringbuf_submit_dynptr_proto",
+	"bpf_ringbuf_discard_dynptr_proto", "bpf_dynptr_read_proto", "bpf_dynptr_write_proto", "bpf_dynptr_data_proto",
+}
+
+// bpfBaseFuncProtoProgTypes are the program types whose func_proto falls back to
+// bpf_base_func_proto. lirc_mode2 is described without any base helpers, so it is left out.
+var bpfBaseFuncProtoProgTypes = []string{
+	"sock_ops", "sk_reuseport", "sk_msg", "flow_dissector", "sk_filter", "cg_skb", "cg_sock", "lwt_in",
+	"lwt_seg6local", "sk_skb", "raw_tracepoint", "cg_dev", "cg_sockopt", "sk_lookup", "tc_cls", "tc_act",
+	"cg_sock_addr", "perf_event", "cg_sysctl", "xdp", "lwt_out", "lwt_xmit", "kprobe", "tracepoint",
+	"raw_tracepoint_writable", "tracing",
+}
+
+func init() {
+	for _, name := range bpfBaseFuncProtoProgTypes {
+		pt := ProgTypeMap[name]
+		pt.FuncProtos = append(pt.FuncProtos, bpfDynptrKptrProtos...)
+	}
+}
+
 var tracingIterCtxs = []TracingIterCtx{
-	TracingIterCtx{Name:"bpf_map", Ctx: nil},
-	TracingIterCtx{Name:"bpf_map_elem", Ctx: nil},
-	TracingIterCtx{Name:"bpf_prog", Ctx: nil},
-	TracingIterCtx{Name:"task", Ctx: nil},
-	TracingIterCtx{Name:"task_file", Ctx: nil},
-	TracingIterCtx{Name:"task_vma", Ctx: nil},
-	TracingIterCtx{Name:"unix", Ctx: nil},
-	TracingIterCtx{Name:"udp", Ctx: nil},
-	TracingIterCtx{Name:"tcp", Ctx: nil},
-	TracingIterCtx{Name:"bpf_sk_storage_map", Ctx: nil},
-	TracingIterCtx{Name:"sockmap", Ctx: nil},
-	TracingIterCtx{Name:"netlink", Ctx: nil},
-	TracingIterCtx{Name:"ipv6_route", Ctx: nil},
+	TracingIterCtx{Name: "bpf_map", Ctx: newIterCtx("bpf_map", "map", "struct bpf_map *")},
+	TracingIterCtx{Name: "bpf_map_elem", Ctx: newIterCtx("bpf_map_elem", "map", "struct bpf_map *", "key", "void *", "value", "void *"),
+		MapTypes: []string{"BPF_MAP_TYPE_HASH", "BPF_MAP_TYPE_ARRAY", "BPF_MAP_TYPE_PERCPU_HASH", "BPF_MAP_TYPE_PERCPU_ARRAY",
+			"BPF_MAP_TYPE_LRU_HASH", "BPF_MAP_TYPE_LRU_PERCPU_HASH"}},
+	TracingIterCtx{Name: "bpf_prog", Ctx: newIterCtx("bpf_prog", "prog", "struct bpf_prog *")},
+	TracingIterCtx{Name: "task", Ctx: newIterCtx("task", "task", "struct task_struct *")},
+	TracingIterCtx{Name: "task_file", Ctx: newIterCtx("task_file", "task", "struct task_struct *", "fd", "u32", "file", "struct file *")},
+	TracingIterCtx{Name: "task_vma", Ctx: newIterCtx("task_vma", "task", "struct task_struct *", "vma", "struct vm_area_struct *")},
+	TracingIterCtx{Name: "cgroup", Ctx: newIterCtx("cgroup", "cgroup", "struct cgroup *"), Cgroup: true},
+	TracingIterCtx{Name: "unix", Ctx: newIterCtx("unix", "unix_sk", "struct unix_sock *", "uid", "uid_t")},
+	TracingIterCtx{Name: "udp", Ctx: newIterCtx("udp", "udp_sk", "struct udp_sock *", "uid", "uid_t", "bucket", "int")},
+	TracingIterCtx{Name: "tcp", Ctx: newIterCtx("tcp", "sk_common", "struct sock_common *", "uid", "uid_t")},
+	TracingIterCtx{Name: "bpf_sk_storage_map", Ctx: newIterCtx("bpf_sk_storage_map", "map", "struct bpf_map *", "sk", "struct sock *", "value", "void *"),
+		MapTypes: []string{"BPF_MAP_TYPE_SK_STORAGE"}},
+	TracingIterCtx{Name: "sockmap", Ctx: newIterCtx("sockmap", "map", "struct bpf_map *", "key", "void *", "sk", "struct sock *"),
+		MapTypes: []string{"BPF_MAP_TYPE_SOCKMAP", "BPF_MAP_TYPE_SOCKHASH"}},
+	TracingIterCtx{Name: "netlink", Ctx: newIterCtx("netlink", "sk", "struct netlink_sock *")},
+	TracingIterCtx{Name: "ipv6_route", Ctx: newIterCtx("ipv6_route", "rt", "struct fib6_info *")},
+}
+
+// newIterCtx returns the context struct bpf_iter__<name> of an iterator. All of them start
+// with the meta data holding the seq_file, followed by pairs of field names and types.
+func newIterCtx(name string, fields ...string) *StructDef {
+	sd := &StructDef{
+		Name:       "bpf_iter__" + name,
+		FieldNames: []string{"meta"},
+		FieldTypes: []string{"struct bpf_iter_meta *"},
+	}
+	for i := 0; i < len(fields); i += 2 {
+		sd.FieldNames = append(sd.FieldNames, fields[i])
+		sd.FieldTypes = append(sd.FieldTypes, fields[i+1])
+	}
+	return sd
 }
 
 func GenXdpEntry(r *randGen) (string, *StructDef) {
@@ -1172,7 +1278,7 @@ func GenBPFTrampoline(r *randGen) (string, *StructDef) {
 
 func GenTracingIter(r *randGen) (string, *StructDef) {
 	i := r.Intn(len(tracingIterCtxs))
-	return tracingIterCtxs[i].Name, nil
+	return tracingIterCtxs[i].Name, tracingIterCtxs[i].Ctx
 }
 
 var CtxAccessMap = map[string]*BpfCtxAccess{
@@ -1223,16 +1329,15 @@ var CtxAccessMap = map[string]*BpfCtxAccess{
 			{rangeInCtx: []string{"queue_mapping", "queue_mapping"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"queue_mapping", "queue_mapping"}, canRead: true, defaultSize: 4, narrowAccess: true,},
 			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
-			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data", "data"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketRegType{},},
-			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketMetaRegType{},},
-			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketEndRegType{},},
+			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data", "data"}, canRead: true, size: 4, regType: &PtrToPacketRegType{},},
+			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, size: 4, regType: &PtrToPacketMetaRegType{},},
+			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, size: 4, regType: &PtrToPacketEndRegType{},},
 			{rangeInCtx: []string{"flow_keys", "flow_keys"},},
 			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, canWrite: true, size: 8,},
 			{rangeInCtx: []string{"sk"}, canRead: true, size: 8, regType: &PtrToSockCommonRegType{},},
-			{rangeInCtx: []string{"default"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"default"}, canRead: true, defaultSize: 4, narrowAccess: true},
 		},
 	},
@@ -1257,16 +1362,15 @@ var CtxAccessMap = map[string]*BpfCtxAccess{
 			{rangeInCtx: []string{"queue_mapping", "queue_mapping"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"queue_mapping", "queue_mapping"}, canRead: true, defaultSize: 4, narrowAccess: true,},
 			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
-			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data", "data"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketRegType{},},
-			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketMetaRegType{},},
-			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketEndRegType{},},
+			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data", "data"}, canRead: true, size: 4, regType: &PtrToPacketRegType{},},
+			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, size: 4, regType: &PtrToPacketMetaRegType{},},
+			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, size: 4, regType: &PtrToPacketEndRegType{},},
 			{rangeInCtx: []string{"flow_keys", "flow_keys"},},
 			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, canWrite: true, size: 8,},
 			{rangeInCtx: []string{"sk"}, canRead: true, size: 8, regType: &PtrToSockCommonRegType{},},
-			{rangeInCtx: []string{"default"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"default"}, canRead: true, defaultSize: 4, narrowAccess: true},
 		},
 	},
@@ -1288,16 +1392,15 @@ var CtxAccessMap = map[string]*BpfCtxAccess{
 			{rangeInCtx: []string{"priority"}, canRead: true, canWrite: true,},
 			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
 			//bpf_skb_is_valid_access
-			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketRegType{}},
-			{rangeInCtx: []string{"data_meta"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data_end"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketEndRegType{}},
+			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data"}, canRead: true, size: 4, regType: &PtrToPacketRegType{}},
+			{rangeInCtx: []string{"data_meta"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data_end"}, canRead: true, size: 4, regType: &PtrToPacketEndRegType{}},
 			{rangeInCtx: []string{"flow_keys"},},
-			{rangeInCtx: []string{"tstamp"}, canRead: true, canWrite: true, size: 8,},
+			{rangeInCtx: []string{"tstamp"}, canRead: true, size: 8,},
 			{rangeInCtx: []string{"sk"}, canRead: true, size: 8, regType: &PtrToSockCommonRegType{},},
-			{rangeInCtx: []string{"default"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"default"}, canRead: true, defaultSize: 4, narrowAccess: true,},
 		},
 	},
@@ -1319,16 +1422,15 @@ var CtxAccessMap = map[string]*BpfCtxAccess{
 			{rangeInCtx: []string{"priority"}, canRead: true, canWrite: true,},
 			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
 			//bpf_skb_is_valid_access
-			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data", "data"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketRegType{}},
-			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketEndRegType{}},
+			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data", "data"}, canRead: true, size: 4, regType: &PtrToPacketRegType{}},
+			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, size: 4, regType: &PtrToPacketEndRegType{}},
 			{rangeInCtx: []string{"flow_keys", "flow_keys"},},
-			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, canWrite: true, size: 8,},
+			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, size: 8,},
 			{rangeInCtx: []string{"sk"}, canRead: true, size: 8, regType: &PtrToSockCommonRegType{},},
-			{rangeInCtx: []string{"default"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"default"}, canRead: true, defaultSize: 4, narrowAccess: true,},
 		},
 	},
@@ -1397,7 +1499,7 @@ var CtxAccessMap = map[string]*BpfCtxAccess{
 			{rangeInCtx: []string{"data"}, canRead: true, size: 4, regType: &PtrToPacketRegType{},},
 			{rangeInCtx: []string{"data_meta"}, canRead: true, size: 4, regType: &PtrToPacketMetaRegType{},},
 			{rangeInCtx: []string{"data_end"}, canRead: true, size: 4, regType: &PtrToPacketEndRegType{},},
-			{rangeInCtx: []string{"rx_queue_index"}, canRead: true, canWrite: true, size: 4,},
+			{rangeInCtx: []string{"rx_queue_index"}, canRead: true, size: 4,},
 			{rangeInCtx: []string{"default"}, canRead: true, size: 4,},
 		},
 	},
@@ -1465,16 +1567,15 @@ var CtxAccessMap = map[string]*BpfCtxAccess{
 //			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
 //			{rangeInCtx: []string{"tstamp"}, canRead: true, canWrite: true,},
 			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
-			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data", "data"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketRegType{}},
-			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketEndRegType{}},
+			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data", "data"}, canRead: true, size: 4, regType: &PtrToPacketRegType{}},
+			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, size: 4, regType: &PtrToPacketEndRegType{}},
 			{rangeInCtx: []string{"flow_keys", "flow_keys"},},
 			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, canWrite: true, size: 8,},
 			{rangeInCtx: []string{"sk"}, canRead: true, size: 8, regType: &PtrToSockCommonRegType{},},
-			{rangeInCtx: []string{"default"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"default"}, canRead: true, defaultSize: 4, narrowAccess: true,},
 //bpf_skb_is_valid_access
 //			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
@@ -1531,16 +1632,15 @@ var CtxAccessMap = map[string]*BpfCtxAccess{
 			{rangeInCtx: []string{"priority"}, canRead: true, canWrite: true,},
 			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
 			//bpf_skb_is_valid_access
-			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data", "data"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketRegType{}},
-			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketEndRegType{}},
+			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data", "data"}, canRead: true, size: 4, regType: &PtrToPacketRegType{}},
+			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, size: 4, regType: &PtrToPacketEndRegType{}},
 			{rangeInCtx: []string{"flow_keys", "flow_keys"},},
-			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, canWrite: true, size: 8,},
+			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, size: 8,},
 			{rangeInCtx: []string{"sk"}, canRead: true, size: 8, regType: &PtrToSockCommonRegType{},},
-			{rangeInCtx: []string{"default"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"default"}, canRead: true, defaultSize: 4, narrowAccess: true,},
 //bpf_skb_is_valid_access
 //			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
@@ -1575,16 +1675,15 @@ var CtxAccessMap = map[string]*BpfCtxAccess{
 			{rangeInCtx: []string{"priority"}, canRead: true, canWrite: true,},
 			{rangeInCtx: []string{"cb[0]", "cb[4]"}, canRead: true, canWrite: true,},
 			//bpf_skb_is_valid_access
-			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data", "data"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketRegType{}},
-			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, canWrite: true, size: 4,},
-			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, canWrite: true, size: 4, regType: &PtrToPacketEndRegType{}},
+			{rangeInCtx: []string{"remote_ip6[0]", "remote_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"local_ip6[0]", "local_ip6[3]"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"remote_ip4", "remote_ip4"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data", "data"}, canRead: true, size: 4, regType: &PtrToPacketRegType{}},
+			{rangeInCtx: []string{"data_meta", "data_meta"}, canRead: true, size: 4,},
+			{rangeInCtx: []string{"data_end", "data_end"}, canRead: true, size: 4, regType: &PtrToPacketEndRegType{}},
 			{rangeInCtx: []string{"flow_keys", "flow_keys"},},
-			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, canWrite: true, size: 8,},
+			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, size: 8,},
 			{rangeInCtx: []string{"sk"}, canRead: true, size: 8, regType: &PtrToSockCommonRegType{},},
-			{rangeInCtx: []string{"default"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"default"}, canRead: true, defaultSize: 4, narrowAccess: true,},
 		},
 	},
@@ -1616,7 +1715,6 @@ var CtxAccessMap = map[string]*BpfCtxAccess{
 			{rangeInCtx: []string{"flow_keys", "flow_keys"},},
 			{rangeInCtx: []string{"tstamp", "tstamp"}, canRead: true, /*canWrite: true,*/ size: 8,},
 			{rangeInCtx: []string{"sk"}, canRead: true, size: 8, regType: &PtrToSockCommonRegType{},},
-			{rangeInCtx: []string{"default"}, canWrite: true, size: 4,},
 			{rangeInCtx: []string{"default"}, canRead: true, defaultSize: 4, narrowAccess: true},
 		},
 	},
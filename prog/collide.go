@@ -8,6 +8,7 @@ package prog
 import (
 	"fmt"
 	"math/rand"
+	"strings"
 )
 
 // The executor has no more than 32 threads that are used both for async calls and for calls
@@ -102,3 +103,133 @@ func DoubleExecCollide(origProg *Prog, rand *rand.Rand) (*Prog, error) {
 	prog.Calls = append(prog.Calls, dupCalls...)
 	return prog, nil
 }
+
+// The maximum number of cpus BrfRaceCollide runs the program on concurrently.
+const brfRaceMaxCpus = 4
+
+// The maximum number of map operations BrfRaceCollide races against the program.
+const brfRaceMaxMapCalls = 8
+
+var brfRaceMapCalls = []string{
+	"bpf$MAP_UPDATE_ELEM",
+	"bpf$MAP_DELETE_ELEM",
+	"bpf$MAP_UPDATE_BATCH",
+	"bpf$MAP_DELETE_BATCH",
+	"bpf$BPF_MAP_LOOKUP_AND_DELETE_BATCH",
+}
+
+// BrfRaceCollide makes the BPF program of a BRF prog race against itself and userspace.
+// Right after the program is attached, we insert async test runs pinned to different
+// cpus and async updates/deletes on the maps used by the program. So the program runs
+// on several cpus at the same time while the maps it accesses are being modified.
+func BrfRaceCollide(origProg *Prog, rand *rand.Rand) (*Prog, error) {
+	if !isBrfProg(origProg) {
+		return nil, fmt.Errorf("the prog is not a BRF prog")
+	}
+	prog := origProg.Clone()
+	load := prog.Calls[1]
+	if load.Ret == nil {
+		return nil, fmt.Errorf("the prog does not expose the BPF prog resources")
+	}
+	mapFds := brfResMapFds(load)
+
+	r := newRand(prog.Target, rand)
+	s := analyze(nil, nil, prog, nil)
+	if !s.brfCallEnabled("syz_bpf_prog_test_run_on_cpu") {
+		return nil, fmt.Errorf("syz_bpf_prog_test_run_on_cpu is disabled")
+	}
+	// Only raw tracepoint test runs take BPF_F_TEST_RUN_ON_CPU, the kernel rejects
+	// any flags or cpu for the other program types. Without the model of the program,
+	// e.g. for a program embedded in a test from another machine, the type is unknown.
+	ps := RestoreBpfSeedProg(Brf, brfProgPath(prog))
+	runOnCpu := ps != nil && ps.pt.Name == "raw_tracepoint"
+	var calls []*Call
+	ncpus := 2 + r.Intn(brfRaceMaxCpus-1)
+	for cpu := 0; cpu < ncpus; cpu++ {
+		c := r.generateBpfProgTestRunOnCpuCall(s, load.Ret, uint64(cpu), runOnCpu)
+		s.analyze(c)
+		calls = append(calls, c)
+	}
+	nmapCalls := 1 + r.Intn(brfRaceMaxMapCalls)
+	if ps != nil && len(ps.Maps) == 0 {
+		nmapCalls = 0
+	}
+	for i := 0; i < nmapCalls; i++ {
+		name := brfRaceMapCalls[r.Intn(len(brfRaceMapCalls))]
+		calls = append(calls, r.generateBpfMapCalls(s, name, mapFds)...)
+	}
+	if len(prog.Calls)+len(calls) > MaxCalls {
+		return nil, fmt.Errorf("the prog is too big for the BrfRaceCollide transformation")
+	}
+
+	r.Shuffle(len(calls), func(i, j int) {
+		calls[i], calls[j] = calls[j], calls[i]
+	})
+	leftAsync := maxAsyncPerProg
+	for _, c := range calls {
+		if leftAsync == 0 {
+			break
+		}
+		c.Props.Async = true
+		leftAsync--
+	}
+	var newCalls []*Call
+	newCalls = append(newCalls, prog.Calls[:3]...)
+	newCalls = append(newCalls, calls...)
+	newCalls = append(newCalls, prog.Calls[3:]...)
+	prog.Calls = newCalls
+	return prog, nil
+}
+
+// isBrfProg returns whether prog starts with the open/load/attach calls of a BRF seed.
+func isBrfProg(prog *Prog) bool {
+	if Brf == nil || !Brf.isEnabled || len(prog.Calls) < 3 {
+		return false
+	}
+	return prog.Calls[0].Meta.Name == "syz_bpf_prog_open" &&
+		prog.Calls[1].Meta.Name == "syz_bpf_prog_load" &&
+		IsBrfAttachCall(prog.Calls[2].Meta.Name)
+}
+
+// IsBrfAttachCall returns whether the syscall attaches the program of a BRF prog. Cgroup programs
+// are attached at a level of the cgroup hierarchy of the test, the others generically.
+func IsBrfAttachCall(name string) bool {
+	return name == "syz_bpf_prog_attach" || name == "syz_bpf_prog_attach_cgroup"
+}
+
+// brfProgPath returns the object of the program that the first call of a BRF prog opens.
+func brfProgPath(prog *Prog) string {
+	return brfCallPath(prog.Calls[0])
+}
+
+// brfCallPath returns the object that the path argument of a BRF call refers to.
+func brfCallPath(c *Call) string {
+	ptr, ok := c.Args[0].(*PointerArg)
+	if !ok || ptr.Res == nil {
+		return ""
+	}
+	data, ok := ptr.Res.(*DataArg)
+	if !ok || data.Dir() == DirOut {
+		return ""
+	}
+	return strings.TrimRight(string(data.Data()), "\x00")
+}
+
+// brfResMapFds returns the map fds that syz_bpf_prog_load writes into bpf_res.
+func brfResMapFds(load *Call) []*ResultArg {
+	ptr, ok := load.Args[1].(*PointerArg)
+	if !ok || ptr.Res == nil {
+		return nil
+	}
+	res := ptr.Res.(*GroupArg)
+	var fds []*ResultArg
+	for i, field := range res.Type().(*StructType).Fields {
+		if field.Name != "map_fds" {
+			continue
+		}
+		for _, elem := range res.Inner[i].(*GroupArg).Inner {
+			fds = append(fds, elem.(*ResultArg))
+		}
+	}
+	return fds
+}
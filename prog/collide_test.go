@@ -4,7 +4,10 @@
 package prog
 
 import (
+	"fmt"
 	"math/rand"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -148,3 +151,95 @@ dup(r3)
 		}
 	}
 }
+
+func TestBrfRaceCollide(t *testing.T) {
+	brf := *initTestBrf()
+	brf.isEnabled = true
+	oldBrf := Brf
+	Brf = &brf
+	defer func() { Brf = oldBrf }()
+
+	target, rs, iters := initTest(t)
+	r := rand.New(rs)
+	dir := t.TempDir()
+	// The type of the program comes from its model, not from the name of its object.
+	for _, test := range []struct {
+		path     string
+		typ      string
+		runOnCpu bool
+	}{
+		{"./file0", "", false},
+		{filepath.Join(dir, "prog_0123456789abcdef_raw_tracepoint.o"), "xdp", false},
+		{filepath.Join(dir, "prog_0123456789abcdef_xdp.o"), "raw_tracepoint", true},
+	} {
+		if test.typ != "" {
+			s := NewBpfProgState(&brf, brf.progTypeMap[test.typ], nil)
+			if err := s.WriteText(strings.TrimSuffix(test.path, ".o") + ".brf"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		testBrfRaceCollide(t, target, r, iters, test.path, test.runOnCpu)
+	}
+
+	p, err := target.Deserialize([]byte(`r0 = openat(0xffffffffffffff9c, &AUTO='./file1\x00', 0x42, 0x1ff)
+close(r0)
+`), Strict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BrfRaceCollide(p, r); err == nil {
+		t.Fatalf("expected to fail on a non-BRF prog")
+	}
+}
+
+func testBrfRaceCollide(t *testing.T, target *Target, r *rand.Rand, iters int, path string, runOnCpu bool) {
+	p, err := target.Deserialize([]byte(fmt.Sprintf(`syz_bpf_prog_open(&AUTO='%[1]v\x00')
+r0 = syz_bpf_prog_load(&AUTO='%[1]v\x00', &AUTO)
+syz_bpf_prog_attach(&AUTO='%[1]v\x00', r0)
+syz_bpf_prog_run_cnt(r0)
+`, path)), NonStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < iters; i++ {
+		collided, err := BrfRaceCollide(p, r)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := collided.validate(); err != nil {
+			t.Fatalf("invalid prog: %v\n%s", err, collided.Serialize())
+		}
+		if got := collided.Calls[len(collided.Calls)-1].Meta.Name; got != "syz_bpf_prog_run_cnt" {
+			t.Fatalf("last call is %v, want syz_bpf_prog_run_cnt", got)
+		}
+		cpus := make(map[uint64]bool)
+		for i, c := range collided.Calls {
+			if i < 3 && c.Props.Async {
+				t.Fatalf("call %v (%v) must not be async", i, c.Meta.Name)
+			}
+			if c.Meta.Name == "syz_bpf_prog_test_run_on_cpu" {
+				if !c.Props.Async {
+					t.Fatalf("test run is not async:\n%s", collided.Serialize())
+				}
+				cpu := c.Args[0].(*ConstArg).Val
+				cpus[cpu] = true
+				arg := c.Args[1].(*PointerArg).Res.(*GroupArg)
+				for j, field := range arg.Type().(*StructType).Fields {
+					if field.Name != "flags" && field.Name != "cpu" {
+						continue
+					}
+					val := arg.Inner[j].(*ConstArg).Val
+					switch {
+					case field.Name == "flags" && (val != 0) != runOnCpu,
+						field.Name == "cpu" && runOnCpu && val != cpu,
+						field.Name == "cpu" && !runOnCpu && val != 0:
+						t.Fatalf("%v: test run %v = %v:\n%s", path, field.Name, val, collided.Serialize())
+					}
+				}
+			}
+		}
+		if len(cpus) < 2 {
+			t.Fatalf("the prog runs on %v cpus:\n%s", len(cpus), collided.Serialize())
+		}
+	}
+}
@@ -5,8 +5,11 @@ package prog
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
 	"reflect"
 	"strconv"
 	"strings"
@@ -147,6 +150,10 @@ func (a *DataArg) serialize(ctx *serializer) {
 		return
 	}
 	data := a.Data()
+	if typ.Kind == BufferBpfObj {
+		serializeCompressedData(ctx.buf, data)
+		return
+	}
 	// Statically typed data will be padded with 0s during deserialization,
 	// so we can strip them here for readability always. For variable-size
 	// data we strip trailing 0s only if we strip enough of them.
@@ -871,6 +878,29 @@ func serializeData(buf *bytes.Buffer, data []byte, readable bool) {
 	buf.WriteByte('\'')
 }
 
+// serializeCompressedData writes data as "$" followed by base64 of the zlib-compressed data.
+// BPF objects are mostly zeros and debug info, which compress well.
+func serializeCompressedData(buf *bytes.Buffer, data []byte) {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(data)
+	w.Close()
+	fmt.Fprintf(buf, "\"$%v\"", base64.RawURLEncoding.EncodeToString(compressed.Bytes()))
+}
+
+func deserializeCompressedData(val string) ([]byte, error) {
+	compressed, err := base64.RawURLEncoding.DecodeString(val)
+	if err != nil {
+		return nil, err
+	}
+	r, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
 func EncodeData(buf *bytes.Buffer, data []byte, readable bool) {
 	if !readable && isReadableData(data) {
 		readable = true
@@ -952,6 +982,20 @@ func (p *parser) deserializeData() ([]byte, error) {
 	var data []byte
 	if p.Char() == '"' {
 		p.Parse('"')
+		if p.Char() == '$' {
+			p.consume()
+			start := p.i
+			for p.Char() != '"' && p.Char() != 0 {
+				p.consume()
+			}
+			val := p.s[start:p.i]
+			p.Parse('"')
+			data, err := deserializeCompressedData(val)
+			if err != nil {
+				return nil, fmt.Errorf("data arg has bad compressed value %q: %v", val, err)
+			}
+			return data, nil
+		}
 		val := ""
 		if p.Char() != '"' {
 			val = p.Ident()
@@ -47,6 +47,54 @@ func TestSerializeData(t *testing.T) {
 	}
 }
 
+func TestSerializeCompressedData(t *testing.T) {
+	t.Parallel()
+	r := rand.New(rand.NewSource(0))
+	for i := 0; i < 1e3; i++ {
+		data := make([]byte, r.Intn(1024))
+		for i := range data {
+			data[i] = byte(r.Intn(4))
+		}
+		buf := new(bytes.Buffer)
+		serializeCompressedData(buf, data)
+		p := newParser(nil, buf.Bytes(), true)
+		if !p.Scan() {
+			t.Fatalf("parser does not scan")
+		}
+		data1, err := p.deserializeData()
+		if err != nil {
+			t.Fatalf("failed to deserialize %q -> %s: %v", data, buf.Bytes(), err)
+		}
+		if !bytes.Equal(data, data1) {
+			t.Fatalf("corrupted data %q -> %s -> %q", data, buf.Bytes(), data1)
+		}
+	}
+}
+
+func TestSerializeBpfObj(t *testing.T) {
+	target := initTargetTest(t, "linux", "amd64")
+	obj := []byte("\x7fELF\x02\x01\x01\x00\x00\x00\xff\xfe")
+	p, err := target.Deserialize([]byte(`syz_bpf_prog_open(&(0x7f0000000000)='./file0\x00', &(0x7f0000001000), 0x0)`),
+		NonStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := p.Calls[0].Args[1].(*PointerArg).Res.(*DataArg)
+	data.data = obj
+	text := p.Serialize()
+	if !bytes.Contains(text, []byte(`="$`)) {
+		t.Fatalf("object is not compressed:\n%s", text)
+	}
+	p1, err := target.Deserialize(text, Strict)
+	if err != nil {
+		t.Fatalf("failed to deserialize %s: %v", text, err)
+	}
+	data1 := p1.Calls[0].Args[1].(*PointerArg).Res.(*DataArg).Data()
+	if !bytes.Equal(obj, data1) {
+		t.Fatalf("corrupted object %q -> %s -> %q", obj, text, data1)
+	}
+}
+
 func TestCallSet(t *testing.T) {
 	t.Parallel()
 	tests := []struct {
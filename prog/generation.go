@@ -32,13 +32,69 @@ func (target *Target) Generate(rs rand.Source, ncalls int, ct *ChoiceTable) *Pro
 		p.Calls = append(p.Calls, c1)
 		progFd = c1.Ret
 
-		c2 := r.generateBpfProgAttachCall(s, ps, c1.Ret)
-		s.analyze(c2)
+		// Cgroup programs are attached at the top of the cgroup hierarchy of the test instead
+		// of through the generic attach call and get no link.
+		var c2 *Call
+		if ps.CgroupAttachType() != "" && s.brfCallEnabled("syz_bpf_prog_attach_cgroup") {
+			c2 = r.generateBpfProgAttachCgroupLevelCall(s, ps, c1.Ret, nil, 0, r.brfCgroupAttachFlags())
+		} else {
+			c2 = r.generateBpfProgAttachCall(s, ps, c1.Ret)
+			s.analyze(c2)
+		}
 		p.Calls = append(p.Calls, c2)
 
+		// Stack cgroup programs at the levels of the cgroup hierarchy of the test. Some levels
+		// get a compatible program first, which the program then replaces.
+		var compat *BpfProgState
+		var compatFd *ResultArg
+		if ps.CgroupAttachType() != "" && r.oneOf(3) {
+			var calls []*Call
+			compat, calls = r.generateBpfCompatProgCalls(s, ps)
+			p.Calls = append(p.Calls, calls...)
+			compatFd = calls[len(calls)-1].Ret
+		}
+		p.Calls = append(p.Calls, r.generateBpfCgroupAttachCalls(s, ps, c1.Ret, compat, compatFd)...)
+
+		// Consume the ring and perf buffers of the program while the test run fills them.
+		p.Calls = append(p.Calls, r.generateBpfMapConsumeCalls(s, ps, brfResMapFds(c1))...)
+
 		c3 := r.generateBpfProgTestRunCall(s, ps, c1.Ret)
 		s.analyze(c3)
 		p.Calls = append(p.Calls, c3)
+
+		// Sleepable programs only sleep if the user memory they read is not faulted in yet.
+		if c := r.generateBpfFaultTriggerCall(s, ps); c != nil {
+			s.analyze(c)
+			p.Calls = append(p.Calls, c)
+		}
+
+		// Iterator programs only run when the iterator is read.
+		p.Calls = append(p.Calls, r.generateBpfIterReadCalls(s, ps, c1.Ret, brfResMapFds(c1))...)
+
+		// Share the program or its maps through the bpffs.
+		if r.oneOf(4) {
+			for _, c := range r.generateBpfPinCalls(s, c1.Ret, brfResMapFds(c1)) {
+				p.Calls = append(p.Calls, c)
+			}
+		}
+
+		// Update, replace and detach the program while the test run triggers it.
+		async := false
+		if r.oneOf(3) {
+			p.Calls = append(p.Calls, r.generateBpfAsyncTriggerCalls(s, ps, c3)...)
+			async = true
+			for _, c := range r.generateBpfLinkLifecycleCalls(s, ps, c1.Ret, c2.Ret, p.Calls) {
+				p.Calls = append(p.Calls, c)
+			}
+		}
+
+		// Free the timers of the program while the test run arms them.
+		if calls := r.generateBpfTimerTeardownCalls(s, ps, c1.Ret, c2.Ret, brfResMapFds(c1)); len(calls) != 0 {
+			if !async {
+				p.Calls = append(p.Calls, r.generateBpfAsyncTriggerCalls(s, ps, c3)...)
+			}
+			p.Calls = append(p.Calls, calls...)
+		}
 	}
 
 	for len(p.Calls) < ncalls {
@@ -102,6 +102,9 @@ func generateHints(compMap CompMap, arg Arg, exec func()) {
 		case BufferFilename:
 			// This can generate escaping paths and is probably not too useful anyway.
 			return
+		case BufferBpfObj:
+			// The object is compiled from the BPF program model.
+			return
 		case BufferString, BufferGlob:
 			if len(t.Values) != 0 {
 				// These are frequently file names or complete enumerations.
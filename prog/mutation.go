@@ -220,7 +220,7 @@ func (ctx *mutator) mutateArg() bool {
 		if len(p.Calls) >= 3 && idx < 3 {
 			if (p.Calls[0].Meta != r.target.SyscallMap["syz_bpf_prog_open"] ||
 			    p.Calls[1].Meta != r.target.SyscallMap["syz_bpf_prog_load"] ||
-			    p.Calls[2].Meta != r.target.SyscallMap["syz_bpf_prog_attach"]) ||
+			    !IsBrfAttachCall(p.Calls[2].Meta.Name)) ||
 			   (p.Calls[0].Args[0].(*PointerArg).Res == nil ||
 			    p.Calls[1].Args[0].(*PointerArg).Res == nil ||
 			    p.Calls[2].Args[0].(*PointerArg).Res == nil) {
@@ -228,9 +228,10 @@ func (ctx *mutator) mutateArg() bool {
 			}
 			path := string(c.Args[0].(*PointerArg).Res.(*DataArg).data)
 			ps := Brf.MutBpfSeedProg(r, path)
-			p.Calls[0].Args[0].(*PointerArg).Res.(*DataArg).data = []byte(ps.Path)
-			p.Calls[1].Args[0].(*PointerArg).Res.(*DataArg).data = []byte(ps.Path)
-			p.Calls[2].Args[0].(*PointerArg).Res.(*DataArg).data = []byte(ps.Path)
+			if ps == nil {
+				return false
+			}
+			r.updateBpfProgCalls(analyze(ctx.ct, ctx.corpus, p, p.Calls[0]), p, ps)
 			return true
 		}
 	}
@@ -423,6 +424,8 @@ func (t *BufferType) mutate(r *randGen, s *state, arg Arg, ctx ArgCtx) (calls []
 	case BufferText:
 		data := append([]byte{}, a.Data()...)
 		a.data = r.mutateText(t.Text, data)
+	case BufferBpfObj:
+		retry = true
 	default:
 		panic("unknown buffer kind")
 	}
@@ -711,6 +714,10 @@ func (t *BufferType) getMutationPrio(target *Target, arg Arg, ignoreSpecial bool
 		// These are effectively consts (and frequently file names).
 		return dontMutate, false
 	}
+	if t.Kind == BufferBpfObj {
+		// The object is replaced when the BPF program model is mutated.
+		return dontMutate, false
+	}
 	return 0.8 * maxPriority, false
 }
 
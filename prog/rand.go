@@ -566,11 +566,37 @@ func (r *randGen) generateBpfProgOpenCall(s *state, ps *BpfProgState) *Call {
 	pathBufferArg := MakeDataArg(pathBuffer, pathBufferDir, pathStr)
 	args[0] = r.allocAddr(s, pathArg.Type, pathArg.Dir(DirIn), pathBufferArg.Size(), pathBufferArg)
 
+	/* Compiled object */
+	args[1] = r.allocBpfObj(s, meta.Args[1], ps)
+	args[2] = MakeConstArg(meta.Args[2].Type, meta.Args[2].Dir(DirIn), 0)
+
 	c.Args = args
 	r.target.assignSizesCall(c)
 	return c
 }
 
+func (r *randGen) allocBpfObj(s *state, objArg Field, ps *BpfProgState) *PointerArg {
+	objPtr := objArg.Type.(*PtrType)
+	objBufferArg := MakeDataArg(objPtr.Elem, objPtr.ElemDir, ps.Object())
+	return r.allocAddr(s, objArg.Type, objArg.Dir(DirIn), objBufferArg.Size(), objBufferArg)
+}
+
+// updateBpfProgCalls makes the open, load and attach calls at the beginning of p and the cgroup
+// attach and trigger calls of the same program use ps.
+func (r *randGen) updateBpfProgCalls(s *state, p *Prog, ps *BpfProgState) {
+	old := brfProgPath(p)
+	for i, c := range p.Calls {
+		if i >= 3 && (c.Meta.Name != "syz_bpf_prog_attach_cgroup" && c.Meta.Name != "syz_bpf_cgroup_trigger" ||
+			brfCallPath(c) != old) {
+			continue
+		}
+		c.Args[0].(*PointerArg).Res.(*DataArg).data = []byte(ps.Path)
+	}
+	open := p.Calls[0]
+	open.Args[1] = r.allocBpfObj(s, open.Meta.Args[1], ps)
+	r.target.assignSizesCall(open)
+}
+
 func (r *randGen) generateBpfProgLoadCall(s *state, ps *BpfProgState) *Call {
 	meta := r.target.SyscallMap["syz_bpf_prog_load"]
 	args := make([]Arg, len(meta.Args))
@@ -610,6 +636,9 @@ func (r *randGen) generateBpfProgAttachCall(s *state, ps *BpfProgState, ra *Resu
 	resType := resArg.Type.(*ResourceType)
 	args[1] = MakeResultArg(resType, resArg.Dir(DirIn), ra, 0)
 
+	modeArg := meta.Args[2]
+	args[2], _ = r.generateArg(s, modeArg.Type, modeArg.Dir(DirIn))
+
 	c.Args = args
 	r.target.assignSizesCall(c)
 	return c
@@ -650,6 +679,584 @@ func (r *randGen) generateBpfProgTestRunCall(s *state, ps *BpfProgState, ra *Res
 	return c
 }
 
+// generateBpfProgTestRunOnCpuCall generates a test run of the program referenced by ra
+// from an executor thread pinned to the given cpu. If onCpu is set, the test run is also
+// pinned with BPF_F_TEST_RUN_ON_CPU, which only raw tracepoint programs support.
+func (r *randGen) generateBpfProgTestRunOnCpuCall(s *state, ra *ResultArg, cpu uint64, onCpu bool) *Call {
+	meta := r.target.SyscallMap["syz_bpf_prog_test_run_on_cpu"]
+	args := make([]Arg, len(meta.Args))
+	c := MakeCall(meta, nil)
+
+	cpuArg := meta.Args[0]
+	args[0] = MakeConstArg(cpuArg.Type, cpuArg.Dir(DirIn), cpu)
+
+	testProgArg := meta.Args[1]
+	testProgPtr := testProgArg.Type.(*PtrType)
+	testProgStruct := testProgPtr.Elem.(*StructType)
+	testProgStructDir := testProgPtr.ElemDir
+
+	testProgStructFields := make([]Arg, len(testProgStruct.Fields))
+	for i, field := range testProgStruct.Fields {
+		switch field.Name {
+		case "prog":
+			resType := field.Type.(*ResourceType)
+			testProgStructFields[i] = MakeResultArg(resType, field.Dir(DirIn), ra, 0)
+		case "flags":
+			flags := field.Type.(*FlagsType)
+			val := uint64(0)
+			if onCpu {
+				val = flags.Vals[0]
+			}
+			testProgStructFields[i] = MakeConstArg(flags, field.Dir(DirIn), val)
+		case "cpu":
+			val := uint64(0)
+			if onCpu {
+				val = cpu
+			}
+			testProgStructFields[i] = MakeConstArg(field.Type, field.Dir(DirIn), val)
+		default:
+			testProgStructFields[i], _ = r.generateArg(s, field.Type, field.Dir(DirIn))
+		}
+	}
+
+	testProgStructArg := MakeGroupArg(testProgStruct, testProgStructDir, testProgStructFields)
+	args[1] = r.allocAddr(s, testProgArg.Type, testProgArg.Dir(DirIn), testProgStructArg.Size(), testProgStructArg)
+
+	lenArg := meta.Args[2]
+	args[2], _ = r.generateArg(s, lenArg.Type, lenArg.Dir(DirIn))
+
+	c.Args = args
+	r.target.assignSizesCall(c)
+	return c
+}
+
+// generateBpfAsyncTriggerCalls makes the program run concurrently with the calls generated
+// after it by making its test run testRun async. Cgroup programs cannot be test run, for them
+// it generates an async trigger from the leaf cgroup of the cgroup hierarchy of the test.
+func (r *randGen) generateBpfAsyncTriggerCalls(s *state, ps *BpfProgState, testRun *Call) []*Call {
+	if ps.CgroupAttachType() == "" || !s.brfCallEnabled("syz_bpf_cgroup_trigger") {
+		testRun.Props.Async = true
+		return nil
+	}
+	meta := r.target.SyscallMap["syz_bpf_cgroup_trigger"]
+	args := make([]Arg, len(meta.Args))
+	c := MakeCall(meta, nil)
+
+	pathArg := meta.Args[0]
+	pathPtr := pathArg.Type.(*PtrType)
+	pathBufferArg := MakeDataArg(pathPtr.Elem, pathPtr.ElemDir, []byte(ps.Path))
+	args[0] = r.allocAddr(s, pathArg.Type, pathArg.Dir(DirIn), pathBufferArg.Size(), pathBufferArg)
+
+	c.Args = args
+	r.target.assignSizesCall(c)
+	s.analyze(c)
+	c.Props.Async = true
+	return []*Call{c}
+}
+
+// generateBpfCompatProgCalls generates a program compatible with ps and the calls that open
+// and load it. The last call returns the fd of the program.
+func (r *randGen) generateBpfCompatProgCalls(s *state, ps *BpfProgState) (*BpfProgState, []*Call) {
+	newPs := Brf.GenCompatBpfSeedProg(r, ps)
+
+	open := r.generateBpfProgOpenCall(s, newPs)
+	s.analyze(open)
+
+	load := r.generateBpfProgLoadCall(s, newPs)
+	s.analyze(load)
+	return newPs, []*Call{open, load}
+}
+
+// generateBpfLinkLifecycleCalls generates calls that update, replace and detach the program
+// referenced by progFd while it is attached through linkFd, or only replace it if it is attached
+// without a link and linkFd is nil. The new program is a freshly loaded program compatible with
+// ps. prev are the calls generated before for the test.
+func (r *randGen) generateBpfLinkLifecycleCalls(s *state, ps *BpfProgState, progFd, linkFd *ResultArg,
+	prev []*Call) []*Call {
+	newPs, calls := r.generateBpfCompatProgCalls(s, ps)
+	newProgFd := calls[len(calls)-1].Ret
+
+	if r.bin() {
+		calls = append(calls, r.generateBpfCgroupReplaceCalls(s, ps, progFd, newPs, newProgFd, prev)...)
+	}
+	if linkFd == nil {
+		return calls
+	}
+	if s.brfCallEnabled("bpf$BPF_LINK_UPDATE") && r.nOutOf(2, 3) {
+		c := r.generateBpfLinkUpdateCall(s, linkFd, newProgFd, progFd)
+		s.analyze(c)
+		calls = append(calls, c)
+	}
+	if s.brfCallEnabled("bpf$LINK_DETACH") && r.bin() {
+		c := r.generateBpfLinkDetachCall(s, linkFd)
+		s.analyze(c)
+		calls = append(calls, c)
+	}
+	return calls
+}
+
+// brfCallEnabled returns whether the syscall that BRF generates on its own is enabled.
+func (s *state) brfCallEnabled(name string) bool {
+	meta := s.target.SyscallMap[name]
+	return meta != nil && !meta.Attrs.Disabled && (s.ct == nil || s.ct.Enabled(meta.ID))
+}
+
+// The levels of the cgroup hierarchy of the test, keep in sync with BRF_CGROUP_LEVELS in
+// executor/common_linux.h.
+const brfCgroupLevels = 3
+
+// generateBpfCgroupAttachCalls generates calls that attach the cgroup program referenced by
+// progFd at some levels of the cgroup hierarchy of the test below the top one, which the attach
+// call at the beginning of the test takes, from the top down, so that copies of it stack in the
+// effective program array of the leaf cgroup the triggers run in. If compatFd
+// is not nil, levels attached with BPF_F_ALLOW_MULTI may first get the compatible program compat
+// referenced by compatFd, which the program then replaces in place with BPF_F_REPLACE.
+// It generates nothing for other programs.
+func (r *randGen) generateBpfCgroupAttachCalls(s *state, ps *BpfProgState, progFd *ResultArg,
+	compat *BpfProgState, compatFd *ResultArg) []*Call {
+	if ps.CgroupAttachType() == "" || !s.brfCallEnabled("syz_bpf_prog_attach_cgroup") {
+		return nil
+	}
+	var calls []*Call
+	for level := 1; level < brfCgroupLevels; level++ {
+		if r.bin() {
+			continue
+		}
+		flags := r.brfCgroupAttachFlags()
+		var replaceFd *ResultArg
+		if flags == r.target.constValue("BPF_F_ALLOW_MULTI") && compatFd != nil && r.oneOf(3) {
+			calls = append(calls, r.generateBpfProgAttachCgroupLevelCall(s, compat, compatFd, nil, level, flags))
+			replaceFd = compatFd
+		}
+		calls = append(calls, r.generateBpfProgAttachCgroupLevelCall(s, ps, progFd, replaceFd, level, flags))
+	}
+	return calls
+}
+
+// brfCgroupAttachFlags returns BPF_F_ALLOW_MULTI, BPF_F_ALLOW_OVERRIDE or no flags for a cgroup
+// attach.
+func (r *randGen) brfCgroupAttachFlags() uint64 {
+	switch {
+	case r.bin():
+		return r.target.constValue("BPF_F_ALLOW_MULTI")
+	case r.bin():
+		return r.target.constValue("BPF_F_ALLOW_OVERRIDE")
+	}
+	return 0
+}
+
+// generateBpfProgAttachCgroupLevelCall generates an attach of progFd at level of the cgroup
+// hierarchy of the test with flags. If replaceFd is not nil, the attach replaces the program
+// referenced by replaceFd, which must be attached at the level already, with BPF_F_REPLACE.
+func (r *randGen) generateBpfProgAttachCgroupLevelCall(s *state, ps *BpfProgState, progFd, replaceFd *ResultArg,
+	level int, flags uint64) *Call {
+	meta := r.target.SyscallMap["syz_bpf_prog_attach_cgroup"]
+	args := make([]Arg, len(meta.Args))
+	c := MakeCall(meta, nil)
+
+	pathArg := meta.Args[0]
+	pathPtr := pathArg.Type.(*PtrType)
+	pathBufferArg := MakeDataArg(pathPtr.Elem, pathPtr.ElemDir, []byte(ps.Path))
+	args[0] = r.allocAddr(s, pathArg.Type, pathArg.Dir(DirIn), pathBufferArg.Size(), pathBufferArg)
+
+	progArg := meta.Args[1]
+	args[1] = MakeResultArg(progArg.Type, progArg.Dir(DirIn), progFd, 0)
+
+	levelArg := meta.Args[2]
+	args[2] = MakeConstArg(levelArg.Type, levelArg.Dir(DirIn), uint64(level))
+
+	if replaceFd != nil {
+		flags |= r.target.constValue("BPF_F_REPLACE")
+	}
+	flagsArg := meta.Args[3]
+	args[3] = MakeConstArg(flagsArg.Type, flagsArg.Dir(DirIn), flags)
+
+	replaceArg := meta.Args[4]
+	if replaceFd != nil {
+		args[4] = MakeResultArg(replaceArg.Type, replaceArg.Dir(DirIn), replaceFd, 0)
+	} else {
+		args[4] = replaceArg.DefaultArg(replaceArg.Dir(DirIn))
+	}
+
+	c.Args = args
+	r.target.assignSizesCall(c)
+	s.analyze(c)
+	return c
+}
+
+// generateBpfCgroupReplaceCalls generates calls that attach the cgroup program referenced by
+// progFd with BPF_F_ALLOW_MULTI at a level of the cgroup hierarchy of the test and then replace
+// it there with the compatible program newPs referenced by newProgFd. The level is one prev
+// attaches nothing to, below no level prev attaches to without allow flags, since the kernel
+// refuses the attach otherwise. It generates nothing for other programs or if there is no
+// such level.
+func (r *randGen) generateBpfCgroupReplaceCalls(s *state, ps *BpfProgState, progFd *ResultArg,
+	newPs *BpfProgState, newProgFd *ResultArg, prev []*Call) []*Call {
+	if ps.CgroupAttachType() == "" || !s.brfCallEnabled("syz_bpf_prog_attach_cgroup") {
+		return nil
+	}
+	allow := r.target.constValue("BPF_F_ALLOW_MULTI") | r.target.constValue("BPF_F_ALLOW_OVERRIDE")
+	var used [brfCgroupLevels]bool
+	exclusive := brfCgroupLevels
+	for _, c := range prev {
+		if c.Meta.Name != "syz_bpf_prog_attach_cgroup" {
+			continue
+		}
+		level := int(c.Args[2].(*ConstArg).Val)
+		if level < 0 || level >= brfCgroupLevels {
+			level = brfCgroupLevels - 1
+		}
+		used[level] = true
+		if c.Args[3].(*ConstArg).Val&allow == 0 && level < exclusive {
+			exclusive = level
+		}
+	}
+	var free []int
+	for level := 0; level < brfCgroupLevels && level <= exclusive; level++ {
+		if !used[level] {
+			free = append(free, level)
+		}
+	}
+	if len(free) == 0 {
+		return nil
+	}
+	level := free[r.Intn(len(free))]
+	multi := r.target.constValue("BPF_F_ALLOW_MULTI")
+	return []*Call{
+		r.generateBpfProgAttachCgroupLevelCall(s, ps, progFd, nil, level, multi),
+		r.generateBpfProgAttachCgroupLevelCall(s, newPs, newProgFd, progFd, level, multi),
+	}
+}
+
+// generateBpfLinkUpdateCall generates an update of the program behind linkFd to newProgFd.
+// The update uses BPF_F_REPLACE with oldProgFd half of the time.
+func (r *randGen) generateBpfLinkUpdateCall(s *state, linkFd, newProgFd, oldProgFd *ResultArg) *Call {
+	meta := r.target.SyscallMap["bpf$BPF_LINK_UPDATE"]
+	args := make([]Arg, len(meta.Args))
+	c := MakeCall(meta, nil)
+
+	cmdArg := meta.Args[0]
+	args[0], _ = r.generateArg(s, cmdArg.Type, cmdArg.Dir(DirIn))
+
+	updateArg := meta.Args[1]
+	updatePtr := updateArg.Type.(*PtrType)
+	updateStruct := updatePtr.Elem.(*StructType)
+	updateStructDir := updatePtr.ElemDir
+
+	replace := r.bin()
+	updateStructFields := make([]Arg, len(updateStruct.Fields))
+	for i, field := range updateStruct.Fields {
+		dir := field.Dir(updateStructDir)
+		switch field.Name {
+		case "link_fd":
+			updateStructFields[i] = MakeResultArg(field.Type, dir, linkFd, 0)
+		case "new_prog_fd":
+			updateStructFields[i] = MakeResultArg(field.Type, dir, newProgFd, 0)
+		case "flags":
+			flags := uint64(0)
+			if replace {
+				flags = r.target.constValue("BPF_F_REPLACE")
+			}
+			updateStructFields[i] = MakeConstArg(field.Type, dir, flags)
+		case "old_prog_fd":
+			if replace {
+				updateStructFields[i] = MakeResultArg(field.Type, dir, oldProgFd, 0)
+			} else {
+				updateStructFields[i] = field.Type.DefaultArg(dir)
+			}
+		default:
+			updateStructFields[i], _ = r.generateArg(s, field.Type, dir)
+		}
+	}
+
+	updateStructArg := MakeGroupArg(updateStruct, updateStructDir, updateStructFields)
+	args[1] = r.allocAddr(s, updateArg.Type, updateArg.Dir(DirIn), updateStructArg.Size(), updateStructArg)
+
+	lenArg := meta.Args[2]
+	args[2], _ = r.generateArg(s, lenArg.Type, lenArg.Dir(DirIn))
+
+	c.Args = args
+	r.target.assignSizesCall(c)
+	return c
+}
+
+func (r *randGen) generateBpfLinkDetachCall(s *state, linkFd *ResultArg) *Call {
+	meta := r.target.SyscallMap["bpf$LINK_DETACH"]
+	args := make([]Arg, len(meta.Args))
+	c := MakeCall(meta, nil)
+
+	cmdArg := meta.Args[0]
+	args[0], _ = r.generateArg(s, cmdArg.Type, cmdArg.Dir(DirIn))
+
+	linkArg := meta.Args[1]
+	linkPtr := linkArg.Type.(*PtrType)
+	linkFdArg := MakeResultArg(linkPtr.Elem, linkPtr.ElemDir, linkFd, 0)
+	args[1] = r.allocAddr(s, linkArg.Type, linkArg.Dir(DirIn), linkFdArg.Size(), linkFdArg)
+
+	lenArg := meta.Args[2]
+	args[2], _ = r.generateArg(s, lenArg.Type, lenArg.Dir(DirIn))
+
+	c.Args = args
+	r.target.assignSizesCall(c)
+	return c
+}
+
+// The bpffs the executor mounts in the working dir and pins maps of BPF objects under.
+const brfBpffsDir = "./bpf"
+
+// generateBpfPinCalls generates calls that pin the program or one of its maps in the bpffs,
+// close the original fd, get the pinned object back and use it again.
+func (r *randGen) generateBpfPinCalls(s *state, progFd *ResultArg, mapFds []*ResultArg) []*Call {
+	var calls []*Call
+	pinMap := len(mapFds) != 0 && r.nOutOf(2, 3)
+	pin, get := "bpf$OBJ_PIN_PROG", "bpf$OBJ_GET_PROG"
+	fd := progFd
+	if pinMap {
+		pin, get = "bpf$OBJ_PIN_MAP", "bpf$OBJ_GET_MAP"
+		fd = mapFds[r.Intn(len(mapFds))]
+	}
+	if !s.brfCallEnabled(pin) || !s.brfCallEnabled(get) {
+		return nil
+	}
+	path := fmt.Sprintf("%v/pin%v", brfBpffsDir, r.Intn(4))
+
+	c := r.generateBpfObjCall(s, pin, path, fd)
+	s.analyze(c)
+	calls = append(calls, c)
+	if s.brfCallEnabled("close") && r.bin() {
+		meta := r.target.SyscallMap["close"]
+		c = MakeCall(meta, []Arg{MakeResultArg(meta.Args[0].Type, DirIn, fd, 0)})
+		s.analyze(c)
+		calls = append(calls, c)
+	}
+	c = r.generateBpfObjCall(s, get, path, nil)
+	s.analyze(c)
+	calls = append(calls, c)
+
+	if pinMap {
+		calls = append(calls, r.generateBpfMapCalls(s, "bpf$MAP_UPDATE_ELEM", []*ResultArg{c.Ret})...)
+	} else {
+		c = r.generateBpfProgTestRunCall(s, nil, c.Ret)
+		s.analyze(c)
+		calls = append(calls, c)
+	}
+	return calls
+}
+
+// generateBpfObjCall generates a bpf$OBJ_PIN_* call that pins fd at path,
+// or a bpf$OBJ_GET_* call that gets the object pinned at path if fd is nil.
+func (r *randGen) generateBpfObjCall(s *state, name, path string, fd *ResultArg) *Call {
+	meta := r.target.SyscallMap[name]
+	args := make([]Arg, len(meta.Args))
+	c := MakeCall(meta, nil)
+
+	cmdArg := meta.Args[0]
+	args[0], _ = r.generateArg(s, cmdArg.Type, cmdArg.Dir(DirIn))
+
+	objArg := meta.Args[1]
+	objPtr := objArg.Type.(*PtrType)
+	objStruct := objPtr.Elem.(*StructType)
+	objStructDir := objPtr.ElemDir
+
+	objStructFields := make([]Arg, len(objStruct.Fields))
+	for i, field := range objStruct.Fields {
+		dir := field.Dir(objStructDir)
+		switch {
+		case field.Name == "path":
+			pathPtr := field.Type.(*PtrType)
+			pathArg := MakeDataArg(pathPtr.Elem, pathPtr.ElemDir, []byte(path+"\x00"))
+			objStructFields[i] = r.allocAddr(s, field.Type, dir, pathArg.Size(), pathArg)
+		case field.Name == "fd" && fd != nil:
+			objStructFields[i] = MakeResultArg(field.Type, dir, fd, 0)
+		default:
+			objStructFields[i], _ = r.generateArg(s, field.Type, dir)
+		}
+	}
+
+	objStructArg := MakeGroupArg(objStruct, objStructDir, objStructFields)
+	args[1] = r.allocAddr(s, objArg.Type, objArg.Dir(DirIn), objStructArg.Size(), objStructArg)
+
+	lenArg := meta.Args[2]
+	args[2], _ = r.generateArg(s, lenArg.Type, lenArg.Dir(DirIn))
+
+	c.Args = args
+	r.target.assignSizesCall(c)
+	return c
+}
+
+// generateBpfMapCalls generates the named map operation on one of mapFds.
+// It only reuses existing resources, so no other maps are created on the way.
+func (r *randGen) generateBpfMapCalls(s *state, name string, mapFds []*ResultArg) []*Call {
+	if !s.brfCallEnabled(name) {
+		return nil
+	}
+	inGenerateResource := r.inGenerateResource
+	r.inGenerateResource = true
+	calls := r.generateParticularCall(s, r.target.SyscallMap[name])
+	r.inGenerateResource = inGenerateResource
+	for _, c := range calls {
+		ForeachArg(c, func(arg Arg, ctx *ArgCtx) {
+			res, ok := arg.(*ResultArg)
+			if !ok || res.Dir() == DirOut || res.Type().Name() != "fd_bpf_map" {
+				return
+			}
+			replaceResultArg(res, MakeResultArg(res.Type(), res.Dir(), mapFds[r.Intn(len(mapFds))], 0))
+		})
+		s.analyze(c)
+	}
+	return calls
+}
+
+// generateBpfFaultTriggerCall generates a call that invokes the syscall a sleepable program
+// is attached to right after mapping the fault area afresh, or nil for other programs and
+// if the syscall is disabled.
+func (r *randGen) generateBpfFaultTriggerCall(s *state, ps *BpfProgState) *Call {
+	if !ps.Sec.Sleepable {
+		return nil
+	}
+	target := r.target.SyscallMap[ps.TrampolineSyscall()]
+	if target == nil || !s.brfCallEnabled(target.Name) || !s.brfCallEnabled("syz_bpf_prog_fault_trigger") {
+		return nil
+	}
+	meta := r.target.SyscallMap["syz_bpf_prog_fault_trigger"]
+	args := make([]Arg, len(meta.Args))
+	c := MakeCall(meta, nil)
+
+	nrArg := meta.Args[0]
+	args[0] = MakeConstArg(nrArg.Type, nrArg.Dir(DirIn), target.NR)
+
+	modeArg := meta.Args[1]
+	args[1], _ = r.generateArg(s, modeArg.Type, modeArg.Dir(DirIn))
+
+	c.Args = args
+	r.target.assignSizesCall(c)
+	return c
+}
+
+// generateBpfIterReadCalls generates a call that creates an iterator of the iterator program
+// referenced by progFd and reads it to the end, or nothing for other programs. Map iterators
+// walk the map of the program they are generated with, cgroup iterators the cgroup root.
+func (r *randGen) generateBpfIterReadCalls(s *state, ps *BpfProgState, progFd *ResultArg, mapFds []*ResultArg) []*Call {
+	if ps.iterCtx() == nil || !s.brfCallEnabled("syz_bpf_prog_iter_read") {
+		return nil
+	}
+	var calls []*Call
+	meta := r.target.SyscallMap["syz_bpf_prog_iter_read"]
+	args := make([]Arg, len(meta.Args))
+	c := MakeCall(meta, nil)
+
+	progArg := meta.Args[0]
+	args[0] = MakeResultArg(progArg.Type, progArg.Dir(DirIn), progFd, 0)
+
+	mapArg := meta.Args[1]
+	if i := ps.IterMap(); i != -1 && i < len(mapFds) {
+		args[1] = MakeResultArg(mapArg.Type, mapArg.Dir(DirIn), mapFds[i], 0)
+	} else {
+		args[1] = mapArg.DefaultArg(mapArg.Dir(DirIn))
+	}
+
+	cgroupArg := meta.Args[2]
+	args[2] = cgroupArg.DefaultArg(cgroupArg.Dir(DirIn))
+	if ps.IsCgroupIter() && s.brfCallEnabled("openat$cgroup_bpf_root") {
+		cgroupCalls := r.generateParticularCall(s, r.target.SyscallMap["openat$cgroup_bpf_root"])
+		for _, c := range cgroupCalls {
+			s.analyze(c)
+		}
+		calls = append(calls, cgroupCalls...)
+		cgroupFd := cgroupCalls[len(cgroupCalls)-1].Ret
+		args[2] = MakeResultArg(cgroupArg.Type, cgroupArg.Dir(DirIn), cgroupFd, 0)
+	}
+
+	orderArg := meta.Args[3]
+	args[3], _ = r.generateArg(s, orderArg.Type, orderArg.Dir(DirIn))
+
+	c.Args = args
+	r.target.assignSizesCall(c)
+	s.analyze(c)
+	return append(calls, c)
+}
+
+// generateBpfMapConsumeCalls generates async calls that consume the ringbuf and perf event array
+// maps of the program while it runs, or nothing if the program has no such maps.
+func (r *randGen) generateBpfMapConsumeCalls(s *state, ps *BpfProgState, mapFds []*ResultArg) []*Call {
+	if !s.brfCallEnabled("syz_bpf_map_consume") {
+		return nil
+	}
+	var calls []*Call
+	meta := r.target.SyscallMap["syz_bpf_map_consume"]
+	for _, i := range ps.OutputMaps() {
+		if i >= len(mapFds) {
+			continue
+		}
+		args := make([]Arg, len(meta.Args))
+		c := MakeCall(meta, nil)
+
+		mapArg := meta.Args[0]
+		args[0] = MakeResultArg(mapArg.Type, mapArg.Dir(DirIn), mapFds[i], 0)
+
+		for j, arg := range meta.Args[1:] {
+			args[j+1], _ = r.generateArg(s, arg.Type, arg.Dir(DirIn))
+		}
+
+		c.Args = args
+		c.Props.Async = true
+		r.target.assignSizesCall(c)
+		s.analyze(c)
+		calls = append(calls, c)
+	}
+	return calls
+}
+
+// generateBpfTimerTeardownCalls generates calls that free the timers of the program referenced
+// by progFd while it arms them: the elements of a map embedding timers are deleted or replaced,
+// and the program may be detached and unloaded, which frees the map if its fd is closed as well.
+// It generates nothing for programs without timers.
+func (r *randGen) generateBpfTimerTeardownCalls(s *state, ps *BpfProgState, progFd, linkFd *ResultArg,
+	mapFds []*ResultArg) []*Call {
+	timerMaps := ps.TimerMaps()
+	if len(timerMaps) == 0 || !s.brfCallEnabled("syz_bpf_timer_teardown") {
+		return nil
+	}
+	i := timerMaps[r.Intn(len(timerMaps))]
+	if i >= len(mapFds) {
+		return nil
+	}
+	var calls []*Call
+	meta := r.target.SyscallMap["syz_bpf_timer_teardown"]
+	args := make([]Arg, len(meta.Args))
+	c := MakeCall(meta, nil)
+
+	mapArg := meta.Args[0]
+	args[0] = MakeResultArg(mapArg.Type, mapArg.Dir(DirIn), mapFds[i], 0)
+
+	for j, arg := range meta.Args[1:] {
+		args[j+1], _ = r.generateArg(s, arg.Type, arg.Dir(DirIn))
+	}
+
+	c.Args = args
+	r.target.assignSizesCall(c)
+	s.analyze(c)
+	calls = append(calls, c)
+
+	if linkFd != nil && s.brfCallEnabled("bpf$LINK_DETACH") && r.bin() {
+		c := r.generateBpfLinkDetachCall(s, linkFd)
+		s.analyze(c)
+		calls = append(calls, c)
+	}
+	if s.brfCallEnabled("close") && r.bin() {
+		meta := r.target.SyscallMap["close"]
+		for _, fd := range []*ResultArg{linkFd, progFd} {
+			if fd == nil {
+				continue
+			}
+			c := MakeCall(meta, []Arg{MakeResultArg(meta.Args[0].Type, DirIn, fd, 0)})
+			s.analyze(c)
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
 func (r *randGen) generateBpfProgRunCntCall(s *state, ra *ResultArg) *Call {
 	meta := r.target.SyscallMap["syz_bpf_prog_run_cnt"]
 	args := make([]Arg, len(meta.Args))
@@ -849,6 +1456,10 @@ func (a *BufferType) generate(r *randGen, s *state, dir Dir) (arg Arg, calls []*
 			return MakeOutDataArg(a, dir, uint64(r.Intn(100))), nil
 		}
 		return MakeDataArg(a, dir, r.generateText(a.Text)), nil
+	case BufferBpfObj:
+		// Objects come from the BPF program generator, an empty one makes
+		// the executor open the object file by path.
+		return MakeDataArg(a, dir, nil), nil
 	default:
 		panic("unknown buffer kind")
 	}
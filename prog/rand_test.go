@@ -199,3 +199,286 @@ func TestTruncateToBitSize(t *testing.T) {
 		})
 	}
 }
+
+func TestGenerateBpfProgAttachCall(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	ps := &BpfProgState{Path: "./file0"}
+	modes := make(map[uint64]bool)
+	for i := 0; i < iters; i++ {
+		p, err := target.Deserialize([]byte(`syz_bpf_prog_open(&AUTO='./file0\x00')
+r0 = syz_bpf_prog_load(&AUTO='./file0\x00', &AUTO)
+`), NonStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := analyze(nil, nil, p, nil)
+		c := r.generateBpfProgAttachCall(s, ps, p.Calls[1].Ret)
+		modes[c.Args[2].(*ConstArg).Val] = true
+		p.Calls = append(p.Calls, c)
+		if err := p.validate(); err != nil {
+			t.Fatalf("invalid prog: %v\n%s", err, p.Serialize())
+		}
+	}
+	if !modes[0] || !modes[1] {
+		t.Fatalf("failed to generate both attach modes: %v", modes)
+	}
+}
+
+func TestGenerateBpfLinkCalls(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	ps := NewBpfProgState(brf, brf.progTypeMap["cg_sock_addr"], nil)
+	ps.Sec = SecDef{Sec: "cgroup/connect4"}
+	ps.Path = "./file0"
+	newPs := NewBpfProgState(brf, brf.progTypeMap["cg_sock_addr"], nil)
+	newPs.Sec = ps.Sec
+	newPs.Path = "./file1"
+	multi := target.constValue("BPF_F_ALLOW_MULTI")
+	replace := target.constValue("BPF_F_REPLACE")
+	for i := 0; i < iters; i++ {
+		// The program is attached without allow flags at level 1, so only level 0 is free.
+		p, err := target.Deserialize([]byte(`syz_bpf_prog_open(&AUTO='./file0\x00')
+r0 = syz_bpf_prog_load(&AUTO='./file0\x00', &AUTO)
+r1 = syz_bpf_prog_attach(&AUTO='./file0\x00', r0, 0x0)
+syz_bpf_prog_attach_cgroup(&AUTO='./file0\x00', r0, 0x1, 0x0, 0x0)
+syz_bpf_prog_open(&AUTO='./file1\x00')
+r2 = syz_bpf_prog_load(&AUTO='./file1\x00', &AUTO)
+`), NonStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		progFd, linkFd, newProgFd := p.Calls[1].Ret, p.Calls[2].Ret, p.Calls[5].Ret
+		s := analyze(nil, nil, p, nil)
+		calls := r.generateBpfCgroupReplaceCalls(s, ps, progFd, newPs, newProgFd, p.Calls)
+		if len(calls) != 2 {
+			t.Fatalf("generated %v cgroup replace calls, want 2", len(calls))
+		}
+		attach, repl := calls[0], calls[1]
+		if attach.Args[1].(*ResultArg).Res != progFd || attach.Args[3].(*ConstArg).Val != multi {
+			t.Fatalf("the program is not attached with multi first")
+		}
+		if repl.Args[1].(*ResultArg).Res != newProgFd || repl.Args[3].(*ConstArg).Val != multi|replace ||
+			repl.Args[4].(*ResultArg).Res != progFd {
+			t.Fatalf("the new program does not replace the program")
+		}
+		if attach.Args[2].(*ConstArg).Val != 0 || repl.Args[2].(*ConstArg).Val != 0 {
+			t.Fatalf("the program is replaced at level %v, want 0", attach.Args[2].(*ConstArg).Val)
+		}
+		p.Calls = append(p.Calls, calls...)
+		if calls := r.generateBpfCgroupReplaceCalls(s, ps, progFd, newPs, newProgFd, p.Calls); len(calls) != 0 {
+			t.Fatalf("generated %v cgroup replace calls with no free level", len(calls))
+		}
+		p.Calls = append(p.Calls,
+			r.generateBpfLinkUpdateCall(s, linkFd, newProgFd, progFd),
+			r.generateBpfLinkDetachCall(s, linkFd))
+		if err := p.validate(); err != nil {
+			t.Fatalf("invalid prog: %v\n%s", err, p.Serialize())
+		}
+		data := p.Serialize()
+		if _, err := target.Deserialize(data, NonStrict); err != nil {
+			t.Fatalf("failed to deserialize: %v\n%s", err, data)
+		}
+	}
+}
+
+func TestGenerateBpfPinCalls(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	for i := 0; i < iters; i++ {
+		p, err := target.Deserialize([]byte(`syz_bpf_prog_open(&AUTO='./file0\x00')
+r0 = syz_bpf_prog_load(&AUTO='./file0\x00', &AUTO)
+`), NonStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := analyze(nil, nil, p, nil)
+		calls := r.generateBpfPinCalls(s, p.Calls[1].Ret, brfResMapFds(p.Calls[1]))
+		if len(calls) < 3 {
+			t.Fatalf("generated %v calls, want at least 3", len(calls))
+		}
+		p.Calls = append(p.Calls, calls...)
+		if err := p.validate(); err != nil {
+			t.Fatalf("invalid prog: %v\n%s", err, p.Serialize())
+		}
+		if !bytes.Contains(p.Serialize(), []byte(brfBpffsDir+"/pin")) {
+			t.Fatalf("nothing is pinned:\n%s", p.Serialize())
+		}
+	}
+}
+
+func TestGenerateBpfMapConsumeCalls(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	ps := NewBpfProgState(brf, brf.progTypeMap["tc_cls"], nil)
+	ps.AddMap("BPF_MAP_TYPE_HASH", nil, "map_0", nil, nil, 16)
+	ps.AddMap("BPF_MAP_TYPE_RINGBUF", nil, "map_1", nil, nil, 4096)
+	ps.AddMap("BPF_MAP_TYPE_PERF_EVENT_ARRAY", nil, "map_2", nil, nil, 4)
+	for i := 0; i < iters; i++ {
+		p, err := target.Deserialize([]byte(`syz_bpf_prog_open(&AUTO='./file0\x00')
+r0 = syz_bpf_prog_load(&AUTO='./file0\x00', &AUTO)
+`), NonStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := analyze(nil, nil, p, nil)
+		mapFds := brfResMapFds(p.Calls[1])
+		calls := r.generateBpfMapConsumeCalls(s, ps, mapFds)
+		if len(calls) != 2 {
+			t.Fatalf("generated %v calls, want 2", len(calls))
+		}
+		for j, c := range calls {
+			if !c.Props.Async || c.Args[0].(*ResultArg).Res != mapFds[j+1] {
+				t.Fatalf("call %v does not consume map_%v asynchronously", j, j+1)
+			}
+		}
+		p.Calls = append(p.Calls, calls...)
+		if err := p.validate(); err != nil {
+			t.Fatalf("invalid prog: %v\n%s", err, p.Serialize())
+		}
+	}
+}
+
+func TestGenerateBpfFaultTriggerCall(t *testing.T) {
+	target, rs, _ := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	ps := NewBpfProgState(brf, brf.progTypeMap["tracing"], nil)
+	ps.Sec = SecDef{Sec: "fentry.s/", Sleepable: true}
+	ps.SecStr = "SEC(\"fentry.s/__x64_sys_getpgid\")"
+	getpgid := target.SyscallMap["getpgid"]
+	c := r.generateBpfFaultTriggerCall(analyze(nil, nil, &Prog{Target: target}, nil), ps)
+	if c == nil || c.Args[0].(*ConstArg).Val != getpgid.NR {
+		t.Fatalf("the fault trigger does not invoke getpgid: %+v", c)
+	}
+	allowed := false
+	for _, v := range c.Args[0].Type().(*FlagsType).Vals {
+		allowed = allowed || v == getpgid.NR
+	}
+	if !allowed {
+		t.Fatalf("getpgid is not in the syscalls the fault trigger accepts")
+	}
+
+	enabled := make(map[*Syscall]bool)
+	for _, meta := range target.Syscalls {
+		enabled[meta] = meta != getpgid
+	}
+	ct := target.BuildChoiceTable(nil, enabled)
+	if c := r.generateBpfFaultTriggerCall(analyze(ct, nil, &Prog{Target: target}, nil), ps); c != nil {
+		t.Fatalf("the fault trigger invokes disabled getpgid")
+	}
+}
+
+func TestGenerateBpfAsyncTriggerCalls(t *testing.T) {
+	target, rs, _ := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	for typ, sec := range map[string]string{"tc_cls": "tc", "cg_sock_addr": "cgroup/connect4"} {
+		ps := NewBpfProgState(brf, brf.progTypeMap[typ], nil)
+		ps.Sec = SecDef{Sec: sec}
+		ps.Path = "./file0"
+		p, err := target.Deserialize([]byte(`syz_bpf_prog_open(&AUTO='./file0\x00')
+r0 = syz_bpf_prog_load(&AUTO='./file0\x00', &AUTO)
+bpf$BPF_PROG_TEST_RUN(0xa, &AUTO={r0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0, 0x0}, 0x48)
+`), NonStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testRun := p.Calls[2]
+		calls := r.generateBpfAsyncTriggerCalls(analyze(nil, nil, p, nil), ps, testRun)
+		if typ == "tc_cls" {
+			if len(calls) != 0 || !testRun.Props.Async {
+				t.Fatalf("%v: the test run is not the async trigger: %+v", typ, calls)
+			}
+			continue
+		}
+		// The kernel cannot test run cgroup programs.
+		if len(calls) != 1 || calls[0].Meta.Name != "syz_bpf_cgroup_trigger" || !calls[0].Props.Async ||
+			brfCallPath(calls[0]) != ps.Path || testRun.Props.Async {
+			t.Fatalf("%v: the cgroup workload is not the async trigger: %+v", typ, calls)
+		}
+		p.Calls = append(p.Calls, calls...)
+		if err := p.validate(); err != nil {
+			t.Fatalf("invalid prog: %v\n%s", err, p.Serialize())
+		}
+	}
+}
+
+func TestGenerateBpfCgroupAttachCalls(t *testing.T) {
+	target, rs, iters := initTest(t)
+	r := newRand(target, rs)
+	brf := initTestBrf()
+	ps := NewBpfProgState(brf, brf.progTypeMap["cg_sock_addr"], nil)
+	ps.Sec = SecDef{Sec: "cgroup/connect4"}
+	ps.Path = "./file0"
+	compat := NewBpfProgState(brf, brf.progTypeMap["cg_sock_addr"], nil)
+	compat.Sec = ps.Sec
+	compat.Path = "./file1"
+	multi := target.constValue("BPF_F_ALLOW_MULTI")
+	replace := target.constValue("BPF_F_REPLACE")
+	stacked, replaced := false, false
+	for i := 0; i < iters; i++ {
+		p, err := target.Deserialize([]byte(`syz_bpf_prog_open(&AUTO='./file0\x00')
+r0 = syz_bpf_prog_load(&AUTO='./file0\x00', &AUTO)
+syz_bpf_prog_open(&AUTO='./file1\x00')
+r1 = syz_bpf_prog_load(&AUTO='./file1\x00', &AUTO)
+`), NonStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := analyze(nil, nil, p, nil)
+		progFd, compatFd := p.Calls[1].Ret, p.Calls[3].Ret
+		calls := r.generateBpfCgroupAttachCalls(s, ps, progFd, compat, compatFd)
+		prevLevel := int64(-1)
+		var prev *Call
+		for j, c := range calls {
+			level := int64(c.Args[2].(*ConstArg).Val)
+			flags := c.Args[3].(*ConstArg).Val
+			if level == 0 {
+				t.Fatalf("call %v attaches at the top level the attach call takes", j)
+			}
+			if c.Args[1].(*ResultArg).Res == compatFd {
+				if flags != multi {
+					t.Fatalf("call %v attaches the compatible program with flags 0x%x", j, flags)
+				}
+				prev = c
+				continue
+			}
+			if c.Args[1].(*ResultArg).Res != progFd {
+				t.Fatalf("call %v does not attach the program", j)
+			}
+			if flags&replace != 0 {
+				if prev == nil || prev.Args[1].(*ResultArg).Res != compatFd ||
+					int64(prev.Args[2].(*ConstArg).Val) != level || flags != multi|replace ||
+					c.Args[4].(*ResultArg).Res != compatFd {
+					t.Fatalf("call %v replaces a program not attached with multi at level %v", j, level)
+				}
+				replaced = true
+			} else if prev != nil && prev.Args[1].(*ResultArg).Res == compatFd {
+				t.Fatalf("call %v does not replace the compatible program attached before", j)
+			}
+			if level <= prevLevel {
+				t.Fatalf("call %v attaches at level %v after level %v", j, level, prevLevel)
+			}
+			prevLevel, prev = level, c
+		}
+		if prevLevel > 0 && len(calls) > 1 {
+			stacked = true
+		}
+		p.Calls = append(p.Calls, calls...)
+		if err := p.validate(); err != nil {
+			t.Fatalf("invalid prog: %v\n%s", err, p.Serialize())
+		}
+	}
+	if !stacked || !replaced {
+		t.Fatalf("failed to stack the program at several levels (%v) or to replace a program (%v)",
+			stacked, replaced)
+	}
+
+	tc := NewBpfProgState(brf, brf.progTypeMap["tc_cls"], nil)
+	if calls := r.generateBpfCgroupAttachCalls(nil, tc, nil, nil, nil); len(calls) != 0 {
+		t.Fatalf("generated %v cgroup attach calls for a tc program", len(calls))
+	}
+}
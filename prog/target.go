@@ -226,6 +226,16 @@ func (target *Target) DefaultChoiceTable() *ChoiceTable {
 	return target.defaultChoiceTable
 }
 
+// constValue returns the value of the named description constant, or 0 if there is none.
+func (target *Target) constValue(name string) uint64 {
+	for _, c := range target.Consts {
+		if c.Name == name {
+			return c.Value
+		}
+	}
+	return 0
+}
+
 func (target *Target) GetGlobs() map[string]bool {
 	globs := make(map[string]bool)
 	ForeachType(target.Syscalls, func(typ Type, ctx *TypeCtx) {
@@ -482,6 +482,7 @@ const (
 	BufferFilename
 	BufferText
 	BufferGlob
+	BufferBpfObj
 )
 
 type TextKind int
@@ -305,6 +305,22 @@ const (
 	BPF_FUNC_get_func_ip
 	BPF_FUNC_get_attach_cookie
 	BPF_FUNC_task_pt_regs
+	BPF_FUNC_copy_from_user_task
+	BPF_FUNC_kptr_xchg
+	BPF_FUNC_dynptr_from_mem
+	BPF_FUNC_ringbuf_reserve_dynptr
+	BPF_FUNC_ringbuf_submit_dynptr
+	BPF_FUNC_ringbuf_discard_dynptr
+	BPF_FUNC_dynptr_read
+	BPF_FUNC_dynptr_write
+	BPF_FUNC_dynptr_data
+	bpf_task_acquire
+	bpf_task_from_pid
+	bpf_task_release
+	bpf_cgroup_acquire
+	bpf_cgroup_ancestor
+	bpf_cgroup_from_id
+	bpf_cgroup_release
 	BPF_MAP_TYPE_HASH
 	BPF_MAP_TYPE_ARRAY
 	BPF_MAP_TYPE_PROG_ARRAY
@@ -548,6 +564,22 @@ var brfStatNames = [BrfStatCount]string{
 	BPF_FUNC_get_func_ip: "BPF_FUNC_get_func_ip",
 	BPF_FUNC_get_attach_cookie: "BPF_FUNC_get_attach_cookie",
 	BPF_FUNC_task_pt_regs: "BPF_FUNC_task_pt_regs",
+	BPF_FUNC_copy_from_user_task: "BPF_FUNC_copy_from_user_task",
+	BPF_FUNC_kptr_xchg: "BPF_FUNC_kptr_xchg",
+	BPF_FUNC_dynptr_from_mem: "BPF_FUNC_dynptr_from_mem",
+	BPF_FUNC_ringbuf_reserve_dynptr: "BPF_FUNC_ringbuf_reserve_dynptr",
+	BPF_FUNC_ringbuf_submit_dynptr: "BPF_FUNC_ringbuf_submit_dynptr",
+	BPF_FUNC_ringbuf_discard_dynptr: "BPF_FUNC_ringbuf_discard_dynptr",
+	BPF_FUNC_dynptr_read: "BPF_FUNC_dynptr_read",
+	BPF_FUNC_dynptr_write: "BPF_FUNC_dynptr_write",
+	BPF_FUNC_dynptr_data: "BPF_FUNC_dynptr_data",
+	bpf_task_acquire: "bpf_task_acquire",
+	bpf_task_from_pid: "bpf_task_from_pid",
+	bpf_task_release: "bpf_task_release",
+	bpf_cgroup_acquire: "bpf_cgroup_acquire",
+	bpf_cgroup_ancestor: "bpf_cgroup_ancestor",
+	bpf_cgroup_from_id: "bpf_cgroup_from_id",
+	bpf_cgroup_release: "bpf_cgroup_release",
 	BPF_MAP_TYPE_HASH: "BPF_MAP_TYPE_HASH",
 	BPF_MAP_TYPE_ARRAY: "BPF_MAP_TYPE_ARRAY",
 	BPF_MAP_TYPE_PROG_ARRAY: "BPF_MAP_TYPE_PROG_ARRAY",
@@ -783,6 +815,9 @@ func main() {
 
 	//fuzzer.disableBpfJIT()
 	prog.InitBrf(enableBrf)
+	if enableBrf && r.CheckResult.BrfFeatures != nil {
+		prog.Brf.Prune(r.CheckResult.BrfFeatures)
+	}
 
 	if r.CoverFilterBitmap != nil {
 		fuzzer.execOpts.Flags |= ipc.FlagEnableCoverageFilter
@@ -974,14 +1009,17 @@ func (fuzzer *Fuzzer) poll(needCandidates bool, stats map[string]uint64) bool {
 	return len(r.NewInputs) != 0 || len(r.Candidates) != 0 || maxSignal.Len() != 0
 }
 
-func (fuzzer *Fuzzer) sendInputToManager(inp rpctype.Input) {
+// sendInputToManager returns false if the manager dropped the input from the corpus.
+func (fuzzer *Fuzzer) sendInputToManager(inp rpctype.Input) bool {
 	a := &rpctype.NewInputArgs{
 		Name:  fuzzer.name,
 		Input: inp,
 	}
-	if err := fuzzer.manager.Call("Manager.NewInput", a, nil); err != nil {
+	r := &rpctype.NewInputRes{}
+	if err := fuzzer.manager.Call("Manager.NewInput", a, r); err != nil {
 		log.Fatalf("Manager.NewInput call failed: %v", err)
 	}
+	return !r.Dropped
 }
 
 func (fuzzer *Fuzzer) addInputFromAnotherFuzzer(inp rpctype.Input) {
@@ -1077,6 +1115,18 @@ func (fuzzer *Fuzzer) addInputToCorpus(p *prog.Prog, sign signal.Signal, sig has
 	}
 }
 
+// addDroppedSignal merges the signal of an input the manager dropped from the corpus, so that
+// the input is not triaged and sent again.
+func (fuzzer *Fuzzer) addDroppedSignal(sign signal.Signal) {
+	if sign.Empty() {
+		return
+	}
+	fuzzer.signalMu.Lock()
+	defer fuzzer.signalMu.Unlock()
+	fuzzer.corpusSignal.Merge(sign)
+	fuzzer.maxSignal.Merge(sign)
+}
+
 func (fuzzer *Fuzzer) snapshot() FuzzerSnapshot {
 	fuzzer.corpusMu.RLock()
 	defer fuzzer.corpusMu.RUnlock()
@@ -60,7 +60,7 @@ func newProc(fuzzer *Fuzzer, pid int) (*Proc, error) {
 }
 
 func (proc *Proc) updateBrfBpfStats(p *prog.Prog, info *ipc.ProgInfo) {
-	if len(p.Calls) < 3 || (p.Calls[0].Meta.Name != "syz_bpf_prog_open" && p.Calls[1].Meta.Name != "syz_bpf_prog_load" && p.Calls[2].Meta.Name != "syz_bpf_prog_attach")  {
+	if len(p.Calls) < 3 || (p.Calls[0].Meta.Name != "syz_bpf_prog_open" && p.Calls[1].Meta.Name != "syz_bpf_prog_load" && !prog.IsBrfAttachCall(p.Calls[2].Meta.Name))  {
 		return
 	}
 
@@ -107,19 +107,20 @@ func (proc *Proc) updateBrfBpfStats(p *prog.Prog, info *ipc.ProgInfo) {
 	}
 
 	pi := stringToBrfStat(ps.ProgTypeEnum())
-	if pi == 235 {
-		panic(fmt.Sprintf("prog %v\n", ps.ProgTypeEnum()))
-	}
-	for _, typ := range typs {
-		//log.Logf(3, "updateBpfStats pt")
-		atomic.AddUint64(&proc.fuzzer.brfStats[pi][typ], 1)
+	if pi < BrfStatCount {
+		for _, typ := range typs {
+			atomic.AddUint64(&proc.fuzzer.brfStats[pi][typ], 1)
+		}
+	} else {
+		log.Logf(1, "updateBpfStats unknown prog type %v", ps.ProgTypeEnum())
 	}
 	//log.Logf(3, "updateBpfStats ht %v", len(ps.Calls))
 	for _, h := range ps.Calls {
 		//log.Logf(3, "updateBpfStats ht")
 		hi := stringToBrfStat(h.Helper.Enum)
-		if hi == 235 {
-			panic(fmt.Sprintf("helper %v\n", h.Helper.Enum))
+		if hi == BrfStatCount {
+			log.Logf(1, "updateBpfStats unknown helper %v", h.Helper.Enum)
+			continue
 		}
 		for _, typ := range typs {
 		atomic.AddUint64(&proc.fuzzer.brfStats[hi][typ], 1)
@@ -133,8 +134,9 @@ func (proc *Proc) updateBrfBpfStats(p *prog.Prog, info *ipc.ProgInfo) {
 	for _, m := range ps.Maps {
 		//log.Logf(3, "updateBpfStats mt")
 		mi := stringToBrfStat(m.MapType)
-		if mi == 235 {
-			panic(fmt.Sprintf("map %v\n", m.MapType))
+		if mi == BrfStatCount {
+			log.Logf(1, "updateBpfStats unknown map type %v", m.MapType)
+			continue
 		}
 		for _, typ := range typs {
 		atomic.AddUint64(&proc.fuzzer.brfStats[mi][typ], 1)
@@ -303,7 +305,7 @@ func (proc *Proc) updateSyzBpfStats(p *prog.Prog, info *ipc.ProgInfo) {
 //		pe, he, me := prog.Brf.ResolveEnums(int(pv), int(hv), int(mv))
 		pe := prog.Brf.ProgTypeEnumToString(int(pv))
 		pi := stringToBrfStat(pe)
-		if pi < 235 {
+		if pi < BrfStatCount {
 			atomic.AddUint64(&proc.fuzzer.brfStats[pi][typ], 1)
 		} else {
 			log.Logf(1, "debug pv %v pi %v pe %v", pv, pi, pe)
@@ -311,7 +313,7 @@ func (proc *Proc) updateSyzBpfStats(p *prog.Prog, info *ipc.ProgInfo) {
 		for _, h := range hv {
 			he := prog.Brf.HelperEnumToString(int(pv), int(h))
 			hi := stringToBrfStat(he)
-			if hi < 235 {
+			if hi < BrfStatCount {
 				atomic.AddUint64(&proc.fuzzer.brfStats[hi][typ], 1)
 			} else {
 				log.Logf(1, "debug hv %v hi %v he %v", h, hi, he)
@@ -327,7 +329,7 @@ func (proc *Proc) updateSyzBpfStats(p *prog.Prog, info *ipc.ProgInfo) {
 		for _, m := range mv {
 			me := prog.Brf.MapTypeEnumToString(int(m))
 			mi := stringToBrfStat(me)
-			if mi < 235 {
+			if mi < BrfStatCount {
 				atomic.AddUint64(&proc.fuzzer.brfStats[mi][typ], 1)
 			} else {
 				log.Logf(1, "debug mv %v mi %v me %v", m, mi, me)
@@ -402,6 +404,22 @@ func (proc *Proc) loop() {
 	}
 }
 
+// bpfInfo returns the generation trace and the coverage categories of the BPF program opened by p.
+func bpfInfo(p *prog.Prog) ([]byte, []string) {
+	if len(p.Calls) == 0 || p.Calls[0].Meta.Name != "syz_bpf_prog_open" {
+		return nil, nil
+	}
+	path, ok := p.Calls[0].Args[0].(*prog.PointerArg)
+	if !ok || path.Res == nil {
+		return nil, nil
+	}
+	ps := prog.RestoreBpfSeedProg(prog.Brf, string(path.Res.(*prog.DataArg).Data()))
+	if ps == nil {
+		return nil, nil
+	}
+	return ps.FormatTrace(), ps.CoverCategories()
+}
+
 func (proc *Proc) triageInput(item *WorkTriage) {
 	log.Logf(1, "#%v: triaging type=%x", proc.pid, item.flags)
 
@@ -466,12 +484,23 @@ func (proc *Proc) triageInput(item *WorkTriage) {
 	sig := hash.Hash(data)
 
 	log.Logf(2, "added new input for %v to corpus:\n%s", logCallName, data)
-	proc.fuzzer.sendInputToManager(rpctype.Input{
-		Call:   callName,
-		Prog:   data,
-		Signal: inputSignal.Serialize(),
-		Cover:  inputCover.Serialize(),
-	})
+	var trace []byte
+	var categories []string
+	if prog.Brf.IsEnabled() {
+		trace, categories = bpfInfo(item.p)
+	}
+	if !proc.fuzzer.sendInputToManager(rpctype.Input{
+		Call:          callName,
+		Prog:          data,
+		Signal:        inputSignal.Serialize(),
+		Cover:         inputCover.Serialize(),
+		BpfTrace:      trace,
+		BpfCategories: categories,
+	}) {
+		log.Logf(2, "manager dropped the new input for %v", logCallName)
+		proc.fuzzer.addDroppedSignal(inputSignal)
+		return
+	}
 
 	proc.fuzzer.addInputToCorpus(item.p, inputSignal, sig)
 
@@ -591,6 +620,13 @@ func (proc *Proc) executeAndCollide(execOpts *ipc.ExecOpts, p *prog.Prog, flags
 }
 
 func (proc *Proc) randomCollide(origP *prog.Prog) *prog.Prog {
+	// Race the BPF program on several cpus and against map updates with a 33% probability.
+	if prog.Brf.IsEnabled() && proc.rnd.Intn(3) == 0 {
+		p, err := prog.BrfRaceCollide(origP, proc.rnd)
+		if err == nil {
+			return p
+		}
+	}
 	// Old-styl collide with a 33% probability.
 	if proc.rnd.Intn(3) == 0 {
 		p, err := prog.DoubleExecCollide(origP, proc.rnd)
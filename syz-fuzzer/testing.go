@@ -166,9 +166,22 @@ func checkMachine(args *checkArgs) (*rpctype.CheckArgs, error) {
 	if err := checkCalls(args, res); err != nil {
 		return nil, err
 	}
+	checkBrf(args, res)
 	return res, nil
 }
 
+// checkBrf probes the BPF program types, map types and helpers supported by the kernel
+// if the BPF runtime fuzzer is enabled.
+func checkBrf(args *checkArgs, res *rpctype.CheckArgs) {
+	for _, id := range res.EnabledCalls[args.sandbox] {
+		if args.target.Syscalls[id].Name == "syz_bpf_prog_open" {
+			res.BrfFeatures = prog.ProbeBpf(args.target, host.BpfProber{})
+			log.Logf(0, "brf: %v", res.BrfFeatures)
+			return
+		}
+	}
+}
+
 func checkCalls(args *checkArgs, res *rpctype.CheckArgs) error {
 	sandboxes := []string{args.sandbox}
 	if args.allSandboxes {
@@ -0,0 +1,212 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/syzkaller/pkg/ebpf"
+	"github.com/google/syzkaller/prog"
+)
+
+// bpfProgRe matches the objects of BPF programs in programs and crash logs.
+// The source (.c) and the model (.brf) of a program are next to its object.
+var bpfProgRe = regexp.MustCompile(`/mnt/bpf_prog/(prog_[0-9a-f]{16}_[A-Za-z0-9_]+)\.o`)
+
+var (
+	viewBrf     *prog.BpfRuntimeFuzzer
+	viewBrfOnce sync.Once
+)
+
+// bpfProgModels returns the fuzzer used to parse program models. It is not pruned to the
+// features of the kernel, so it knows every helper and program type a model may refer to.
+func bpfProgModels() *prog.BpfRuntimeFuzzer {
+	viewBrfOnce.Do(func() {
+		viewBrf = prog.NewBpfRuntimeFuzzer()
+		viewBrf.InitFromSrc(prog.HelperFuncMap, prog.ProgTypeMap, prog.CtxAccessMap, prog.RefFuncMap)
+	})
+	return viewBrf
+}
+
+// findBpfProgs returns the objects of the BPF programs that data refers to, in the order they appear.
+func findBpfProgs(data []byte) []string {
+	var res []string
+	seen := make(map[string]bool)
+	for _, match := range bpfProgRe.FindAll(data, -1) {
+		if path := string(match); !seen[path] {
+			seen[path] = true
+			res = append(res, path)
+		}
+	}
+	return res
+}
+
+// readBpfProg reads a BPF program from dir, the host directory shared with the VMs as /mnt/bpf_prog.
+// Files that cannot be read are reported in Errors, so the page shows whatever is left.
+func readBpfProg(dir, path string) *UIBpfProg {
+	bp := &UIBpfProg{Path: path}
+	match := bpfProgRe.FindStringSubmatch(path)
+	if match == nil || match[0] != path {
+		bp.Errors = append(bp.Errors, fmt.Sprintf("%v is not a BPF program object", path))
+		return bp
+	}
+	if dir == "" {
+		bp.Errors = append(bp.Errors, "brf_prog_dir is not set in the manager config")
+		return bp
+	}
+	brf := bpfProgModels()
+	base := filepath.Join(dir, match[1])
+	if src, err := ioutil.ReadFile(base + ".c"); err == nil {
+		bp.Source = string(src)
+	} else {
+		bp.Errors = append(bp.Errors, fmt.Sprintf("failed to read the source: %v", err))
+	}
+	if obj, err := ioutil.ReadFile(base + ".o"); err != nil {
+		bp.Errors = append(bp.Errors, fmt.Sprintf("failed to read the object: %v", err))
+	} else if bp.Funcs, err = ebpf.Disassemble(obj, brf.HelperName); err != nil {
+		bp.Errors = append(bp.Errors, fmt.Sprintf("failed to disassemble the object: %v", err))
+	}
+	model, err := ioutil.ReadFile(base + ".brf")
+	if err != nil {
+		bp.Errors = append(bp.Errors, fmt.Sprintf("failed to read the model: %v", err))
+		return bp
+	}
+	bp.Model = string(model)
+	s, err := brf.DeserializeBpfProgState(model)
+	if err != nil {
+		bp.Errors = append(bp.Errors, fmt.Sprintf("failed to parse the model: %v", err))
+		return bp
+	}
+	bp.ProgType = s.ProgTypeEnum()
+	bp.Section = s.SecStr
+	for _, category := range s.CoverCategories() {
+		if strings.HasPrefix(category, "helper:") {
+			bp.Helpers = append(bp.Helpers, strings.TrimPrefix(category, "helper:"))
+		}
+	}
+	structName := func(sd *prog.StructDef) string {
+		if sd == nil {
+			return ""
+		}
+		return fmt.Sprintf("%v (%v bytes)", sd.Name, sd.Size)
+	}
+	for _, m := range s.Maps {
+		um := UIBpfMap{
+			Name:       m.MapName,
+			Type:       m.MapType,
+			Key:        structName(m.Key),
+			Val:        structName(m.Val),
+			MaxEntries: m.MaxEntries,
+			Flags:      strings.Join(m.MapFlags, " | "),
+			Pinned:     m.Pinned,
+		}
+		if m.InnerMap != nil {
+			um.Inner = m.InnerMap.MapName
+		}
+		bp.Maps = append(bp.Maps, um)
+	}
+	return bp
+}
+
+// UIBpfProg is a BPF program generated by BRF.
+type UIBpfProg struct {
+	Path     string // path of the object in the VMs
+	ProgType string
+	Section  string
+	Helpers  []string
+	Maps     []UIBpfMap
+	Source   string
+	Funcs    []*ebpf.Func
+	Model    string
+	Errors   []string
+}
+
+type UIBpfMap struct {
+	Name       string
+	Type       string
+	Key        string
+	Val        string
+	MaxEntries int64
+	Flags      string
+	Inner      string
+	Pinned     bool
+}
+
+// bpfProgTemplate shows a UIBpfProg, pages that show programs include it.
+const bpfProgTemplate = `
+{{define "bpf_prog"}}
+<h3 id="{{.Path}}">{{.Path}}</h3>
+{{range $e := .Errors}}
+<div>{{$e}}</div>
+{{end}}
+{{if .ProgType}}
+<table class="list_table">
+	<caption>Program:</caption>
+	<tr>
+		<td class="stat_name">type</td>
+		<td class="stat_value">{{.ProgType}}</td>
+	</tr>
+	<tr>
+		<td class="stat_name">section</td>
+		<td class="stat_value">{{.Section}}</td>
+	</tr>
+	<tr>
+		<td class="stat_name">helpers</td>
+		<td class="stat_value">{{range $h := .Helpers}}{{$h}} {{end}}</td>
+	</tr>
+</table>
+{{end}}
+{{if .Maps}}
+<table class="list_table">
+	<caption>Maps:</caption>
+	<tr>
+		<th>Name</th>
+		<th>Type</th>
+		<th>Key</th>
+		<th>Value</th>
+		<th>Max entries</th>
+		<th>Flags</th>
+		<th>Inner map</th>
+		<th>Pinned</th>
+	</tr>
+	{{range $m := .Maps}}
+	<tr>
+		<td>{{$m.Name}}</td>
+		<td>{{$m.Type}}</td>
+		<td>{{$m.Key}}</td>
+		<td>{{$m.Val}}</td>
+		<td>{{$m.MaxEntries}}</td>
+		<td>{{$m.Flags}}</td>
+		<td>{{$m.Inner}}</td>
+		<td>{{if $m.Pinned}}yes{{end}}</td>
+	</tr>
+	{{end}}
+</table>
+{{end}}
+{{if .Source}}
+<details open>
+	<summary>Source</summary>
+	<pre>{{.Source}}</pre>
+</details>
+{{end}}
+{{range $f := .Funcs}}
+<details open>
+	<summary>Disassembly of {{$f.Name}} (section {{$f.Section}}, {{len $f.Insns}} instructions)</summary>
+	<pre>{{range $i := $f.Insns}}{{printf "%4d" $i.Pos}}: {{$i.Text}}
+{{end}}</pre>
+</details>
+{{end}}
+{{if .Model}}
+<details>
+	<summary>BRF model</summary>
+	<pre>{{.Model}}</pre>
+</details>
+{{end}}
+{{end}}
+`
@@ -0,0 +1,117 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFindBpfProgs(t *testing.T) {
+	data := []byte(`r0 = syz_bpf_prog_open(&(0x7f0000000000)='/mnt/bpf_prog/prog_00112233445566ff_tc_cls.o\x00')
+r1 = syz_bpf_prog_open(&(0x7f0000000100)='/mnt/bpf_prog/prog_0000000000000001_xdp.o\x00')
+r2 = syz_bpf_prog_open(&(0x7f0000000200)='/mnt/bpf_prog/prog_00112233445566ff_tc_cls.o\x00')
+r3 = syz_bpf_prog_open(&(0x7f0000000300)='/mnt/bpf_prog/prog_bad_xdp.o\x00')
+`)
+	want := []string{
+		"/mnt/bpf_prog/prog_00112233445566ff_tc_cls.o",
+		"/mnt/bpf_prog/prog_0000000000000001_xdp.o",
+	}
+	if got := findBpfProgs(data); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestReadBpfProg(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "prog_00112233445566ff_tc_cls")
+	const model = `version 4
+type tc_cls
+sec "tc" str="SEC(\"tc\")\n"
+var_id 2
+struct 0 name=uint32_t size=4 field_types=[uint32_t]
+struct 1 name=struct_1 struct=true size=12 field_types=[uint32_t, uint64_t]
+map map_0 type=BPF_MAP_TYPE_HASH flags=[BPF_F_NO_PREALLOC] key=0 val=1 max_entries=16
+call 0 helper=bpf_map_lookup_elem_proto ret=v1 ret_type="struct struct_1 *" map=map_0
+arg name="&map_0" type=ARG_CONST_MAP_PTR
+arg name="&v0" type=ARG_PTR_TO_MAP_KEY
+`
+	obj, err := ioutil.ReadFile(filepath.Join("..", "pkg", "ebpf", "testdata", "prog.o"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ext, data := range map[string][]byte{
+		".c":   []byte("int func(struct __sk_buff *ctx) { return 0; }\n"),
+		".o":   obj,
+		".brf": []byte(model),
+	} {
+		if err := ioutil.WriteFile(base+ext, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bp := readBpfProg(dir, "/mnt/bpf_prog/prog_00112233445566ff_tc_cls.o")
+	if len(bp.Errors) != 0 {
+		t.Fatalf("errors: %v", bp.Errors)
+	}
+	if bp.ProgType != "BPF_PROG_TYPE_SCHED_CLS" || bp.Section != "SEC(\"tc\")\n" {
+		t.Fatalf("program type %q, section %q", bp.ProgType, bp.Section)
+	}
+	if want := []string{"BPF_FUNC_map_lookup_elem"}; !reflect.DeepEqual(bp.Helpers, want) {
+		t.Fatalf("helpers %v, want %v", bp.Helpers, want)
+	}
+	wantMaps := []UIBpfMap{{
+		Name:       "map_0",
+		Type:       "BPF_MAP_TYPE_HASH",
+		Key:        "uint32_t (4 bytes)",
+		Val:        "struct_1 (12 bytes)",
+		MaxEntries: 16,
+		Flags:      "BPF_F_NO_PREALLOC",
+	}}
+	if !reflect.DeepEqual(bp.Maps, wantMaps) {
+		t.Fatalf("maps %+v, want %+v", bp.Maps, wantMaps)
+	}
+	if len(bp.Funcs) != 2 || bp.Funcs[1].Insns[4].Text != "(07) r2 += -4" {
+		t.Fatalf("bad disassembly: %+v", bp.Funcs)
+	}
+	buf := new(bytes.Buffer)
+	if err := bpfProgPageTemplate.Execute(buf, bp); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"BPF_MAP_TYPE_HASH", "call bpf_map_lookup_elem#1", "int func(struct __sk_buff *ctx)"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("no %q on the page:\n%s", want, buf.String())
+		}
+	}
+	buf.Reset()
+	input := &UIInputData{Sig: "sig", Prog: "r0 = syz_bpf_prog_open()", BpfProgs: []*UIBpfProg{bp}}
+	if err := inputTemplate.Execute(buf, input); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	crash := &UICrashType{
+		Crashes:  []*UICrash{{BpfProgs: []string{bp.Path}}},
+		BpfProgs: []*UIBpfProg{bp},
+	}
+	if err := crashTemplate.Execute(buf, crash); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "/bpfprog?path=") || !strings.Contains(buf.String(), "(95) exit") {
+		t.Errorf("crash page does not show the program:\n%s", buf.String())
+	}
+
+	// Missing files are reported, and paths out of the program directory are refused.
+	bp = readBpfProg(dir, "/mnt/bpf_prog/prog_0000000000000001_xdp.o")
+	if len(bp.Errors) != 3 {
+		t.Fatalf("errors for a missing program: %v", bp.Errors)
+	}
+	bp = readBpfProg(dir, "/mnt/bpf_prog/../../etc/prog_0000000000000001_xdp.o")
+	if len(bp.Errors) != 1 || bp.Source != "" {
+		t.Fatalf("read a program outside of the program directory: %+v", bp)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"github.com/google/syzkaller/pkg/cover"
+	"github.com/google/syzkaller/pkg/cover/backend"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+)
+
+// brfCoverClassifier maps coverage PCs to the classes of cfg.BrfCoverClasses,
+// so that verifier coverage can be told apart from runtime coverage.
+type brfCoverClassifier struct {
+	names     []string
+	pcs       map[uint64]int // index of the class of every PC in a class
+	totals    []int          // number of PCs in each class
+	verifier  int            // index of the "verifier" class, or -1
+	restorePC func(uint32) uint64
+}
+
+func makeBrfCoverClassifier(rg *cover.ReportGenerator, classes []mgrconfig.BrfCoverClass) (
+	*brfCoverClassifier, error) {
+	c := &brfCoverClassifier{
+		pcs:       make(map[uint64]int),
+		totals:    make([]int, len(classes)),
+		verifier:  -1,
+		restorePC: rg.RestorePC,
+	}
+	add := func(class int, filters []string, units []*backend.ObjectUnit) error {
+		res, err := compileRegexps(filters)
+		if err != nil {
+			return err
+		}
+		for _, unit := range units {
+			for _, re := range res {
+				if !re.MatchString(unit.Name) {
+					continue
+				}
+				for _, pc := range unit.PCs {
+					if _, ok := c.pcs[pc]; !ok {
+						c.pcs[pc] = class
+						c.totals[class]++
+					}
+				}
+				break
+			}
+		}
+		return nil
+	}
+	var symbols, units []*backend.ObjectUnit
+	for _, sym := range rg.Symbols {
+		symbols = append(symbols, &sym.ObjectUnit)
+	}
+	for _, unit := range rg.Units {
+		units = append(units, &unit.ObjectUnit)
+	}
+	// Classes are applied in order, so a PC belongs to the first class that matches it.
+	for i, class := range classes {
+		c.names = append(c.names, class.Name)
+		if class.Name == "verifier" {
+			c.verifier = i
+		}
+		if err := add(i, class.Functions, symbols); err != nil {
+			return nil, err
+		}
+		if err := add(i, class.Files, units); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// class returns the index of the class of a PC from fuzzer coverage, or -1.
+func (c *brfCoverClassifier) class(pc uint32) int {
+	if class, ok := c.pcs[c.restorePC(pc)]; ok {
+		return class
+	}
+	return -1
+}
+
+// verifierOnly returns whether cov adds coverage to corpus and all of it is in the verifier class.
+func (c *brfCoverClassifier) verifierOnly(corpus cover.Cover, cov []uint32) bool {
+	if c.verifier == -1 {
+		return false
+	}
+	newCover := false
+	for _, pc := range cov {
+		if _, ok := corpus[pc]; ok {
+			continue
+		}
+		if c.class(pc) != c.verifier {
+			return false
+		}
+		newCover = true
+	}
+	return newCover
+}
+
+func (mgr *Manager) initBrfCoverClasses() {
+	rg, err := getReportGenerator(mgr.cfg, mgr.modules)
+	if err != nil {
+		log.Logf(0, "failed to classify BPF coverage: %v", err)
+		return
+	}
+	c, err := makeBrfCoverClassifier(rg, mgr.cfg.BrfCoverClasses)
+	if err != nil {
+		log.Logf(0, "failed to classify BPF coverage: %v", err)
+		return
+	}
+	for i, name := range c.names {
+		log.Logf(0, "BPF coverage class %v: %v PCs", name, c.totals[i])
+	}
+	mgr.serv.setBrfCover(c)
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/syzkaller/pkg/cover"
+	"github.com/google/syzkaller/pkg/cover/backend"
+	"github.com/google/syzkaller/pkg/mgrconfig"
+)
+
+func TestBrfCoverClassifier(t *testing.T) {
+	unit := func(name string, pcs ...uint64) *backend.CompileUnit {
+		return &backend.CompileUnit{ObjectUnit: backend.ObjectUnit{Name: name, PCs: pcs}}
+	}
+	verifier := unit("kernel/bpf/verifier.c", 1, 2, 3)
+	core := unit("kernel/bpf/core.c", 10, 11)
+	helpers := unit("kernel/bpf/helpers.c", 20, 21)
+	rg := &cover.ReportGenerator{
+		Impl: &backend.Impl{
+			Units: []*backend.CompileUnit{verifier, core, helpers},
+			Symbols: []*backend.Symbol{
+				{ObjectUnit: backend.ObjectUnit{Name: "do_check", PCs: []uint64{1, 2, 3}}, Unit: verifier},
+				{ObjectUnit: backend.ObjectUnit{Name: "bpf_int_jit_compile", PCs: []uint64{10}}, Unit: core},
+				{ObjectUnit: backend.ObjectUnit{Name: "___bpf_prog_run", PCs: []uint64{11}}, Unit: core},
+				{ObjectUnit: backend.ObjectUnit{Name: "bpf_map_lookup_elem", PCs: []uint64{20, 21}}, Unit: helpers},
+			},
+			RestorePC: func(pc uint32) uint64 { return uint64(pc) },
+		},
+	}
+	classes := []mgrconfig.BrfCoverClass{
+		{Name: "verifier", Files: []string{"^kernel/bpf/verifier\\.c$"}},
+		{Name: "jit", Functions: []string{"jit"}},
+		{Name: "helpers", Files: []string{"^kernel/bpf/"}},
+	}
+	c, err := makeBrfCoverClassifier(rg, classes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The verifier class is applied first, so "helpers" only gets what is left of kernel/bpf/.
+	if want := []int{3, 1, 3}; !reflect.DeepEqual(c.totals, want) {
+		t.Fatalf("class totals %v, want %v", c.totals, want)
+	}
+	for pc, want := range map[uint32]int{1: 0, 10: 1, 11: 2, 20: 2, 100: -1} {
+		if got := c.class(pc); got != want {
+			t.Errorf("class of PC %v is %v, want %v", pc, got, want)
+		}
+	}
+
+	corpus := cover.Cover{}
+	corpus.Merge([]uint32{1, 10})
+	tests := []struct {
+		cov  []uint32
+		want bool
+	}{
+		{[]uint32{2, 3}, true},
+		{[]uint32{1, 2, 10}, true},
+		{[]uint32{2, 11}, false},
+		{[]uint32{2, 100}, false},
+		{[]uint32{1, 10}, false},
+		{nil, false},
+	}
+	for _, test := range tests {
+		if got := c.verifierOnly(corpus, test.cov); got != test.want {
+			t.Errorf("verifierOnly(%v) = %v, want %v", test.cov, got, test.want)
+		}
+	}
+
+	stats := new(Stats)
+	if res := stats.brfCoverClasses(); res != nil {
+		t.Fatalf("class stats %v before the classes are computed", res)
+	}
+	stats.setBrfCover(c, corpus)
+	stats.addBrfCover([]uint32{2, 20, 100})
+	want := []BrfCoverClassStat{{"verifier", 2, 3}, {"jit", 1, 1}, {"helpers", 1, 3}}
+	if got := stats.brfCoverClasses(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("class stats %+v, want %+v", got, want)
+	}
+}
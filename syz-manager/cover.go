@@ -10,6 +10,7 @@ import (
 	"github.com/google/syzkaller/pkg/host"
 	"github.com/google/syzkaller/pkg/log"
 	"github.com/google/syzkaller/pkg/mgrconfig"
+	"github.com/google/syzkaller/sys/targets"
 )
 
 var getReportGenerator = func() func(cfg *mgrconfig.Config,
@@ -34,3 +35,12 @@ func coverToPCs(rg *cover.ReportGenerator, cov []uint32) []uint64 {
 	}
 	return pcs
 }
+
+// brfCoverAreas are the parts of the BPF runtime that /brfcover attributes coverage in.
+func brfCoverAreas(target *targets.Target) []mgrconfig.Subsystem {
+	return []mgrconfig.Subsystem{
+		{Name: "kernel/bpf", Paths: []string{"kernel/bpf/"}},
+		{Name: "net/core/filter.c", Paths: []string{"net/core/filter.c"}},
+		{Name: "jit", Paths: []string{"arch/" + target.KernelHeaderArch + "/net/"}},
+	}
+}
@@ -37,6 +37,7 @@ func (mgr *Manager) initHTTP() {
 
 	mux.HandleFunc("/", mgr.httpSummary)
 	mux.HandleFunc("/brf", mgr.httpBpfRuntimeFuzzer)
+	mux.HandleFunc("/brf.json", mgr.httpBpfRuntimeFuzzerJSON)
 	mux.HandleFunc("/config", mgr.httpConfig)
 	mux.HandleFunc("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{}).ServeHTTP)
 	mux.HandleFunc("/syscalls", mgr.httpSyscalls)
@@ -46,6 +47,7 @@ func (mgr *Manager) initHTTP() {
 	mux.HandleFunc("/cover", mgr.httpCover)
 	mux.HandleFunc("/subsystemcover", mgr.httpSubsystemCover)
 	mux.HandleFunc("/modulecover", mgr.httpModuleCover)
+	mux.HandleFunc("/brfcover", mgr.httpBrfCover)
 	mux.HandleFunc("/prio", mgr.httpPrio)
 	mux.HandleFunc("/file", mgr.httpFile)
 	mux.HandleFunc("/report", mgr.httpReport)
@@ -55,6 +57,7 @@ func (mgr *Manager) initHTTP() {
 	mux.HandleFunc("/funccover", mgr.httpFuncCover)
 	mux.HandleFunc("/filecover", mgr.httpFileCover)
 	mux.HandleFunc("/input", mgr.httpInput)
+	mux.HandleFunc("/bpfprog", mgr.httpBpfProg)
 	// Browsers like to request this, without special handler this goes to / handler.
 	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {})
 
@@ -87,6 +90,21 @@ func (mgr *Manager) httpBpfRuntimeFuzzer(w http.ResponseWriter, r *http.Request)
 	executeTemplate(w, brfTemplate, &data)
 }
 
+func (mgr *Manager) httpBpfRuntimeFuzzerJSON(w http.ResponseWriter, r *http.Request) {
+	data := mgr.collectBrfStats()
+	mgr.mu.Lock()
+	data.Snapshots = mgr.brfSnapshots
+	mgr.mu.Unlock()
+	out, err := json.MarshalIndent(data, "", "\t")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode json: %v", err),
+			http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
+
 func (mgr *Manager) httpConfig(w http.ResponseWriter, r *http.Request) {
 	data, err := json.MarshalIndent(mgr.cfg, "", "\t")
 	if err != nil {
@@ -148,6 +166,19 @@ func (mgr *Manager) collectStats() []UIStat {
 			Link: "/cover?filter=yes",
 		})
 	}
+	for _, class := range mgr.stats.brfCoverClasses() {
+		stats = append(stats, UIStat{
+			Name:  "coverage: " + class.Name,
+			Value: fmt.Sprintf("%v / %v (%v%%)", class.Covered, class.Total, class.Percent()),
+			Link:  "/brf",
+		})
+	}
+	if mgr.cfg.BrfVerifierWeight < 100 {
+		stats = append(stats, UIStat{
+			Name:  "verifier-only inputs dropped",
+			Value: fmt.Sprint(mgr.stats.brfVerifierDropped.get()),
+		})
+	}
 	delete(rawStats, "signal")
 	delete(rawStats, "coverage")
 	delete(rawStats, "filtered coverage")
@@ -178,22 +209,30 @@ func (mgr *Manager) collectBrfStats() UIBrfSummaryData {
 	generals, progs, helpers, maps := mgr.stats.brf()
 	var stats UIBrfSummaryData
 	stats.Name = mgr.cfg.Name
-	for k, v := range generals {
-		stats.General = append(stats.General, UIBrfGeneralStat{k, *v})
-	}
-	for k, v := range progs {
-		stats.Progs = append(stats.Progs, UIBrfProgStat{k, *v})
-	}
-	for k, v := range helpers {
-		stats.Helpers = append(stats.Helpers, UIBrfHelperStat{k, *v})
-	}
-	for k, v := range maps {
-		stats.Maps = append(stats.Maps, UIBrfMapStat{k, *v})
+	stats.General = convertBrfStats(generals)
+	stats.Progs = convertBrfStats(progs)
+	stats.Helpers = convertBrfStats(helpers)
+	stats.Maps = convertBrfStats(maps)
+	stats.Cover = mgr.stats.brfCoverClasses()
+	stats.VerifierDropped = mgr.stats.brfVerifierDropped.get()
+	if mgr.checkResult != nil {
+		stats.Features = mgr.checkResult.BrfFeatures
 	}
 
 	return stats
 }
 
+func convertBrfStats(counts map[string]*[4]uint64) []UIBrfStat {
+	var stats []UIBrfStat
+	for k, v := range counts {
+		stats = append(stats, UIBrfStat{k, *v})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
 func convertStats(stats map[string]uint64, secs uint64) []UIStat {
 	var intStats []UIStat
 	for k, v := range stats {
@@ -218,9 +257,37 @@ func (mgr *Manager) httpCrash(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "failed to read crash info", http.StatusInternalServerError)
 		return
 	}
+	mgr.readCrashBpfProgs(crash)
 	executeTemplate(w, crashTemplate, crash)
 }
 
+// maxCrashLogBpfProgs is the number of BPF programs linked for every crash log,
+// the ones executed last before the crash.
+const maxCrashLogBpfProgs = 5
+
+// readCrashBpfProgs finds the BPF programs of the reproducer and the logs of a crash.
+func (mgr *Manager) readCrashBpfProgs(crash *UICrashType) {
+	repro, _ := ioutil.ReadFile(filepath.Join(mgr.crashdir, crash.ID, "repro.prog"))
+	for _, path := range findBpfProgs(repro) {
+		crash.BpfProgs = append(crash.BpfProgs, readBpfProg(mgr.cfg.BrfProgDir, path))
+	}
+	for _, c := range crash.Crashes {
+		data, err := ioutil.ReadFile(filepath.Join(mgr.cfg.Workdir, c.Log))
+		if err != nil {
+			continue
+		}
+		// Programs executed again before the crash are listed by their last execution.
+		matches := bpfProgRe.FindAll(data, -1)
+		seen := make(map[string]bool)
+		for i := len(matches) - 1; i >= 0 && len(c.BpfProgs) < maxCrashLogBpfProgs; i-- {
+			if path := string(matches[i]); !seen[path] {
+				seen[path] = true
+				c.BpfProgs = append(c.BpfProgs, path)
+			}
+		}
+	}
+}
+
 func (mgr *Manager) httpCorpus(w http.ResponseWriter, r *http.Request) {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -237,11 +304,17 @@ func (mgr *Manager) httpCorpus(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, fmt.Sprintf("failed to deserialize program: %v", err), http.StatusInternalServerError)
 			return
 		}
-		data.Inputs = append(data.Inputs, &UIInput{
+		uiInput := &UIInput{
 			Sig:   sig,
 			Short: p.String(),
 			Cover: len(inp.Cover),
-		})
+		}
+		for _, category := range inp.BpfCategories {
+			if strings.HasPrefix(category, "prog_type:") {
+				uiInput.BpfProgType = strings.TrimPrefix(category, "prog_type:")
+			}
+		}
+		data.Inputs = append(data.Inputs, uiInput)
 	}
 	sort.Slice(data.Inputs, func(i, j int) bool {
 		a, b := data.Inputs[i], data.Inputs[j]
@@ -278,6 +351,7 @@ const (
 	DoRawCoverFiles
 	DoRawCover
 	DoFilterPCs
+	DoBrfCover
 )
 
 func (mgr *Manager) httpCover(w http.ResponseWriter, r *http.Request) {
@@ -292,6 +366,10 @@ func (mgr *Manager) httpModuleCover(w http.ResponseWriter, r *http.Request) {
 	mgr.httpCoverCover(w, r, DoModuleCover, true)
 }
 
+func (mgr *Manager) httpBrfCover(w http.ResponseWriter, r *http.Request) {
+	mgr.httpCoverCover(w, r, DoBrfCover, false)
+}
+
 func (mgr *Manager) httpCoverCover(w http.ResponseWriter, r *http.Request, funcFlag int, isHTMLCover bool) {
 	if !mgr.cfg.Cover {
 		if isHTMLCover {
@@ -323,8 +401,9 @@ func (mgr *Manager) httpCoverCover(w http.ResponseWriter, r *http.Request, funcF
 	if sig := r.FormValue("input"); sig != "" {
 		inp := mgr.corpus[sig]
 		progs = append(progs, cover.Prog{
-			Data: string(inp.Prog),
-			PCs:  coverToPCs(rg, inp.Cover),
+			Data:       string(inp.Prog),
+			PCs:        coverToPCs(rg, inp.Cover),
+			Categories: inp.BpfCategories,
 		})
 	} else {
 		call := r.FormValue("call")
@@ -333,8 +412,9 @@ func (mgr *Manager) httpCoverCover(w http.ResponseWriter, r *http.Request, funcF
 				continue
 			}
 			progs = append(progs, cover.Prog{
-				Data: string(inp.Prog),
-				PCs:  coverToPCs(rg, inp.Cover),
+				Data:       string(inp.Prog),
+				PCs:        coverToPCs(rg, inp.Cover),
+				Categories: inp.BpfCategories,
 			})
 		}
 	}
@@ -358,6 +438,14 @@ func (mgr *Manager) httpCoverCover(w http.ResponseWriter, r *http.Request, funcF
 	} else if funcFlag == DoFilterPCs {
 		rg.DoFilterPCs(w, progs, coverFilter)
 		return
+	} else if funcFlag == DoBrfCover {
+		err := rg.DoCategoryCover(w, progs, coverFilter, brfCoverAreas(mgr.sysTarget), r.FormValue("category"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to generate coverage profile: %v", err), http.StatusInternalServerError)
+			return
+		}
+		runtime.GC()
+		return
 	}
 
 	do := rg.DoHTML
@@ -470,14 +558,25 @@ func (mgr *Manager) httpFile(w http.ResponseWriter, r *http.Request) {
 
 func (mgr *Manager) httpInput(w http.ResponseWriter, r *http.Request) {
 	mgr.mu.Lock()
-	defer mgr.mu.Unlock()
 	inp, ok := mgr.corpus[r.FormValue("sig")]
+	mgr.mu.Unlock()
 	if !ok {
 		http.Error(w, "can't find the input", http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Write(inp.Prog)
+	data := &UIInputData{
+		Sig:      r.FormValue("sig"),
+		Prog:     string(inp.Prog),
+		BpfTrace: string(inp.BpfTrace),
+	}
+	for _, path := range findBpfProgs(inp.Prog) {
+		data.BpfProgs = append(data.BpfProgs, readBpfProg(mgr.cfg.BrfProgDir, path))
+	}
+	executeTemplate(w, inputTemplate, data)
+}
+
+func (mgr *Manager) httpBpfProg(w http.ResponseWriter, r *http.Request) {
+	executeTemplate(w, bpfProgPageTemplate, readBpfProg(mgr.cfg.BrfProgDir, r.FormValue("path")))
 }
 
 func (mgr *Manager) httpReport(w http.ResponseWriter, r *http.Request) {
@@ -687,15 +786,17 @@ type UICrashType struct {
 	Count       int
 	Triaged     string
 	Crashes     []*UICrash
+	BpfProgs    []*UIBpfProg // programs of the reproducer
 }
 
 type UICrash struct {
-	Index  int
-	Time   time.Time
-	Active bool
-	Log    string
-	Report string
-	Tag    string
+	Index    int
+	Time     time.Time
+	Active   bool
+	Log      string
+	Report   string
+	Tag      string
+	BpfProgs []string // programs executed last before the crash
 }
 
 type UIStat struct {
@@ -717,37 +818,74 @@ type UICorpus struct {
 }
 
 type UIInput struct {
-	Sig   string
-	Short string
-	Cover int
+	Sig         string
+	Short       string
+	Cover       int
+	BpfProgType string
+}
+
+type UIInputData struct {
+	Sig      string
+	Prog     string
+	BpfTrace string
+	BpfProgs []*UIBpfProg
 }
 
 type UIBrfSummaryData struct {
 	Name    string
-	General []UIBrfGeneralStat
-	Progs   []UIBrfProgStat
-	Helpers []UIBrfHelperStat
-	Maps    []UIBrfMapStat
+	General []UIBrfStat
+	Progs   []UIBrfStat
+	Helpers []UIBrfStat
+	Maps    []UIBrfStat
+	// Corpus coverage in the classes of cfg.BrfCoverClasses.
+	Cover           []BrfCoverClassStat
+	VerifierDropped uint64
+	// Program types, map types and helpers supported by the kernel.
+	Features *prog.BpfFeatures
+	// Periodic snapshots of the counters, only filled in for /brf.json.
+	Snapshots []*BrfSnapshot `json:",omitempty"`
 }
 
-type UIBrfGeneralStat struct {
+type UIBrfStat struct {
 	Name  string
 	Count [4]uint64
 }
 
-type UIBrfMapStat struct {
-	Name  string
-	Count [4]uint64
+type UIBrfStatTable struct {
+	Caption string
+	Stats   []UIBrfStat
 }
 
-type UIBrfProgStat struct {
-	Name  string
-	Count [4]uint64
+// StatTables returns the counters of the program types, helpers and map types, which the
+// page shows in tables of the same form.
+func (d *UIBrfSummaryData) StatTables() []UIBrfStatTable {
+	return []UIBrfStatTable{
+		{"Program Types", d.Progs},
+		{"Helper Types", d.Helpers},
+		{"Map Types", d.Maps},
+	}
 }
 
-type UIBrfHelperStat struct {
-	Name  string
-	Count [4]uint64
+// LoadFail returns the percentage of failed loads. The verifier rejects most of them, but
+// the count also includes loads that fail before or after verification.
+func (s UIBrfStat) LoadFail() string {
+	return brfPercent(s.Count[1], s.Count[0]+s.Count[1])
+}
+
+// AttachFail returns the percentage of failed attaches.
+func (s UIBrfStat) AttachFail() string {
+	return brfPercent(s.Count[3], s.Count[2]+s.Count[3])
+}
+
+func (s BrfCoverClassStat) Percent() string {
+	return brfPercent(s.Covered, uint64(s.Total))
+}
+
+func brfPercent(n, total uint64) string {
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.1f", float64(n)*100/float64(total))
 }
 
 var summaryTemplate = html.CreatePage(`
@@ -818,10 +956,95 @@ var brfTemplate = html.CreatePage(`
 <head>
 	<title>{{.Name }} syzkaller</title>
 	{{HEAD}}
+	<script type="text/javascript" src="https://www.gstatic.com/charts/loader.js"></script>
+	<script type="text/javascript">
+		google.charts.load("current", {packages: ["corechart"]});
+		google.charts.setOnLoadCallback(loadBrfSnapshots);
+
+		var brfSnapshots = [];
+		// Each graph plots one value computed from the counter deltas between two snapshots.
+		var brfCharts = [
+			{id: "brf_load_chart", title: "Loads per minute",
+				value: function(d, mins) { return (d[0] + d[1]) / mins; }},
+			{id: "brf_load_fail_chart", title: "Load fail %",
+				value: function(d, mins) { return d[0] + d[1] ? d[1] * 100 / (d[0] + d[1]) : null; }},
+			{id: "brf_attach_chart", title: "Attach fail %",
+				value: function(d, mins) { return d[2] + d[3] ? d[3] * 100 / (d[2] + d[3]) : null; }},
+		];
+
+		function loadBrfSnapshots() {
+			fetch("/brf.json").then(function(r) { return r.json(); }).then(function(data) {
+				brfSnapshots = data.Snapshots || [];
+				drawBrfCharts();
+			});
+		}
+
+		function drawBrfCharts() {
+			if (brfSnapshots.length == 0)
+				return;
+			var category = document.getElementById("brf_category").value;
+			var filter = document.getElementById("brf_filter").value.toLowerCase();
+			var last = brfSnapshots[brfSnapshots.length - 1][category] || {};
+			var names = Object.keys(last).filter(function(n) { return n.toLowerCase().includes(filter); });
+			// Only plot the most loaded entries to keep the graphs readable.
+			names.sort(function(a, b) { return last[b][0] + last[b][1] - last[a][0] - last[a][1]; });
+			names = names.slice(0, 20);
+			var zero = [0, 0, 0, 0];
+			for (var c = 0; c < brfCharts.length; c++) {
+				var chart = brfCharts[c];
+				var data = new google.visualization.DataTable();
+				data.addColumn({type: "number", label: "minutes"});
+				for (var n = 0; n < names.length; n++)
+					data.addColumn({type: "number", label: names[n]});
+				var prev = {Uptime: 0};
+				for (var i = 0; i < brfSnapshots.length; i++) {
+					var snap = brfSnapshots[i];
+					var mins = (snap.Uptime - prev.Uptime) / 60;
+					if (mins > 0) {
+						var row = [snap.Uptime / 60];
+						for (var n = 0; n < names.length; n++) {
+							var cur = (snap[category] || {})[names[n]] || zero;
+							var old = (prev[category] || {})[names[n]] || zero;
+							row.push(chart.value(cur.map(function(v, j) { return v - old[j]; }), mins));
+						}
+						data.addRow(row);
+					}
+					prev = snap;
+				}
+				new google.visualization.LineChart(document.getElementById(chart.id)).
+					draw(data, {
+						title: chart.title,
+						width: "100%",
+						height: document.documentElement.clientHeight * 0.4,
+						legend: {position: "right"},
+						focusTarget: "category",
+						hAxis: {title: "minutes"},
+						chartArea: {left: "5%", top: "5%", width: "70%", height: "85%"}
+					});
+			}
+		}
+
+		function filterBrf(text) {
+			text = text.toLowerCase();
+			var tables = document.getElementsByClassName("brf_table");
+			for (var t = 0; t < tables.length; t++) {
+				var rows = tables[t].rows;
+				for (var i = 1; i < rows.length; i++) {
+					var name = rows[i].getElementsByTagName("td")[0].textContent.toLowerCase();
+					rows[i].style.display = name.includes(text) ? "" : "none";
+				}
+			}
+			drawBrfCharts();
+		}
+
+		function rateSort(v) { return v == "" ? 1 : floatSort(v); }
+	</script>
 </head>
 <body>
 <b>{{.Name }} syzkaller</b>
 <br>
+<a href="/brf.json">json</a> <a href="/brfcover">coverage by category</a>
+<br>
 
 <table class="list_table">
 	<caption>General:</caption>
@@ -842,63 +1065,116 @@ var brfTemplate = html.CreatePage(`
 	{{end}}
 </table>
 
+{{if $.Cover}}
 <table class="list_table">
-	<caption>Program Types:</caption>
+	<caption>Coverage Classes:</caption>
 	<tr>
-		<th>Name</th>
-		<th>Load success</th>
-		<th>Load fail</th>
-		<th>Attach success</th>
-		<th>Attach fail</th>
+		<th>Class</th>
+		<th>Covered PCs</th>
+		<th>Total PCs</th>
+		<th>%</th>
+	</tr>
+	{{range $c := $.Cover}}
+	<tr>
+		<td class="stat_name">{{$c.Name}}</td>
+		<td class="stat_value">{{$c.Covered}}</td>
+		<td class="stat_value">{{$c.Total}}</td>
+		<td class="stat_value">{{$c.Percent}}</td>
 	</tr>
-	{{range $s := $.Progs}}
+	{{end}}
+	<tr>
+		<td class="stat_name">verifier-only inputs dropped</td>
+		<td class="stat_value">{{$.VerifierDropped}}</td>
+		<td></td>
+		<td></td>
+	</tr>
+</table>
+{{end}}
+
+<div>
+	<select id="brf_category" onchange="drawBrfCharts()">
+		<option value="Progs">Program Types</option>
+		<option value="Helpers">Helper Types</option>
+		<option value="Maps">Map Types</option>
+	</select>
+	<input id="brf_filter" type="text" placeholder="filter" oninput="filterBrf(this.value)">
+</div>
+<div id="brf_load_chart" style="width:50%;display:inline-block;"></div>
+<div id="brf_load_fail_chart" style="width:50%;display:inline-block;"></div>
+<div id="brf_attach_chart" style="width:50%;display:inline-block;"></div>
+
+{{range $t := $.StatTables}}
+<table class="list_table brf_table">
+	<caption>{{$t.Caption}}:</caption>
+	<tr>
+		<th><a onclick="return sortTable(this, 'Name', textSort)" href="#">Name</a></th>
+		<th><a onclick="return sortTable(this, 'Load success', numSort)" href="#">Load success</a></th>
+		<th><a onclick="return sortTable(this, 'Load fail', numSort)" href="#">Load fail</a></th>
+		<th><a onclick="return sortTable(this, 'Load fail %', rateSort)" href="#">Load fail %</a></th>
+		<th><a onclick="return sortTable(this, 'Attach success', numSort)" href="#">Attach success</a></th>
+		<th><a onclick="return sortTable(this, 'Attach fail', numSort)" href="#">Attach fail</a></th>
+		<th><a onclick="return sortTable(this, 'Attach fail %', rateSort)" href="#">Attach fail %</a></th>
+	</tr>
+	{{range $s := $t.Stats}}
 	<tr>
 		<td class="stat_name">{{$s.Name}}</td>
-		{{range $c := $s.Count}}
-			<td class="stat_value">{{$c}}</td>
-		{{end}}
+		<td class="stat_value">{{index $s.Count 0}}</td>
+		<td class="stat_value">{{index $s.Count 1}}</td>
+		<td class="stat_value">{{$s.LoadFail}}</td>
+		<td class="stat_value">{{index $s.Count 2}}</td>
+		<td class="stat_value">{{index $s.Count 3}}</td>
+		<td class="stat_value">{{$s.AttachFail}}</td>
 	</tr>
 	{{end}}
 </table>
+{{end}}
 
+{{if $.Features}}
 <table class="list_table">
-	<caption>Helper Types:</caption>
+	<caption>Enabled Program Types:</caption>
 	<tr>
 		<th>Name</th>
-		<th>Load success</th>
-		<th>Load fail</th>
-		<th>Attach success</th>
-		<th>Attach fail</th>
+		<th>Status</th>
 	</tr>
-	{{range $s := $.Helpers}}
+	{{range $f := $.Features.ProgTypes}}
 	<tr>
-		<td class="stat_name">{{$s.Name}}</td>
-		{{range $c := $s.Count}}
-			<td class="stat_value">{{$c}}</td>
-		{{end}}
+		<td class="stat_name">{{$f.Name}}</td>
+		<td class="stat_value">{{if $f.Enabled}}enabled{{else}}{{$f.Reason}}{{end}}</td>
 	</tr>
 	{{end}}
 </table>
 
 <table class="list_table">
-	<caption>Map Types:</caption>
+	<caption>Enabled Helpers:</caption>
 	<tr>
 		<th>Name</th>
-		<th>Load success</th>
-		<th>Load fail</th>
-		<th>Attach success</th>
-		<th>Attach fail</th>
+		<th>Status</th>
+		<th>Disabled in</th>
 	</tr>
-	{{range $s := $.Maps}}
+	{{range $f := $.Features.Helpers}}
 	<tr>
-		<td class="stat_name">{{$s.Name}}</td>
-		{{range $c := $s.Count}}
-			<td class="stat_value">{{$c}}</td>
-		{{end}}
+		<td class="stat_name">{{$f.Name}}</td>
+		<td class="stat_value">{{if $f.Enabled}}enabled{{else}}{{$f.Reason}}{{end}}</td>
+		<td>{{range $pt := $f.DisabledIn}}{{$pt}} {{end}}</td>
 	</tr>
 	{{end}}
 </table>
 
+<table class="list_table">
+	<caption>Enabled Map Types:</caption>
+	<tr>
+		<th>Name</th>
+		<th>Status</th>
+	</tr>
+	{{range $f := $.Features.MapTypes}}
+	<tr>
+		<td class="stat_name">{{$f.Name}}</td>
+		<td class="stat_value">{{if $f.Enabled}}enabled{{else}}{{$f.Reason}}{{end}}</td>
+	</tr>
+	{{end}}
+</table>
+{{end}}
+
 </body></html>
 `)
 
@@ -952,6 +1228,7 @@ Report: <a href="/report?id={{.ID}}">{{.Triaged}}</a>
 		<th>Report</th>
 		<th>Time</th>
 		<th>Tag</th>
+		<th>BPF programs</th>
 	</tr>
 	{{range $c := $.Crashes}}
 	<tr>
@@ -964,11 +1241,59 @@ Report: <a href="/report?id={{.ID}}">{{.Triaged}}</a>
 		</td>
 		<td class="time {{if not $c.Active}}inactive{{end}}">{{formatTime $c.Time}}</td>
 		<td class="tag {{if not $c.Active}}inactive{{end}}" title="{{$c.Tag}}">{{formatTagHash $c.Tag}}</td>
+		<td>
+			{{range $p := $c.BpfProgs}}
+				<a href="/bpfprog?path={{$p}}">{{$p}}</a><br>
+			{{end}}
+		</td>
 	</tr>
 	{{end}}
 </table>
+
+{{if .BpfProgs}}
+<h2>BPF programs of the reproducer</h2>
+{{range $p := .BpfProgs}}
+{{template "bpf_prog" $p}}
+{{end}}
+{{end}}
 </body></html>
-`)
+` + bpfProgTemplate)
+
+var inputTemplate = html.CreatePage(`
+<!doctype html>
+<html>
+<head>
+	<title>syzkaller input {{.Sig}}</title>
+	{{HEAD}}
+</head>
+<body>
+<a href="/cover?input={{.Sig}}">coverage</a>
+<pre>{{.Prog}}</pre>
+
+{{range $p := .BpfProgs}}
+{{template "bpf_prog" $p}}
+{{end}}
+
+{{if .BpfTrace}}
+<details>
+	<summary>BPF program generation trace</summary>
+	<pre>{{.BpfTrace}}</pre>
+</details>
+{{end}}
+</body></html>
+` + bpfProgTemplate)
+
+var bpfProgPageTemplate = html.CreatePage(`
+<!doctype html>
+<html>
+<head>
+	<title>{{.Path}}</title>
+	{{HEAD}}
+</head>
+<body>
+{{template "bpf_prog" .}}
+</body></html>
+` + bpfProgTemplate)
 
 var corpusTemplate = html.CreatePage(`
 <!doctype html>
@@ -983,11 +1308,13 @@ var corpusTemplate = html.CreatePage(`
 	<caption>Corpus{{if $.Call}} for {{$.Call}}{{end}}:</caption>
 	<tr>
 		<th>Coverage</th>
+		<th>BPF program</th>
 		<th>Program</th>
 	</tr>
 	{{range $inp := $.Inputs}}
 	<tr>
 		<td><a href='/cover?input={{$inp.Sig}}'>{{$inp.Cover}}</a></td>
+		<td>{{if $inp.BpfProgType}}<a href="/input?sig={{$inp.Sig}}">{{$inp.BpfProgType}}</a>{{end}}</td>
 		<td><a href="/input?sig={{$inp.Sig}}">{{$inp.Short}}</a></td>
 	</tr>
 	{{end}}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -53,6 +54,8 @@ type Manager struct {
 	crashdir       string
 	serv           *RPCServer
 	corpusDB       *db.DB
+	bpfTraceDB     *db.DB
+	bpfCategoryDB  *db.DB
 	startTime      time.Time
 	firstConnect   time.Time
 	fuzzingTime    time.Duration
@@ -79,6 +82,7 @@ type Manager struct {
 	memoryLeakFrames map[string]bool
 	dataRaceFrames   map[string]bool
 	saturatedCalls   map[string]bool
+	brfSnapshots     []*BrfSnapshot // periodic copies of the BRF counters for the /brf graphs
 
 	needMoreRepros chan chan bool
 	hubReproQueue  chan *Crash
@@ -256,6 +260,8 @@ func RunManager(cfg *mgrconfig.Config) {
 		}()
 	}
 
+	go mgr.brfSnapshotLoop()
+
 	if mgr.dash != nil {
 		go mgr.dashboardReporter()
 	}
@@ -459,6 +465,26 @@ func (mgr *Manager) preloadCorpus() {
 	}
 	mgr.corpusDB = corpusDB
 
+	// Generation traces of BPF programs are keyed by the hash of the corpus entry.
+	bpfTraceDB, err := db.Open(filepath.Join(mgr.cfg.Workdir, "brf_trace.db"), true)
+	if err != nil {
+		if bpfTraceDB == nil {
+			log.Fatalf("failed to open BPF trace database: %v", err)
+		}
+		log.Logf(0, "read %v BPF traces and got error: %v", len(bpfTraceDB.Records), err)
+	}
+	mgr.bpfTraceDB = bpfTraceDB
+
+	// Coverage categories of BPF programs, newline-separated, keyed the same way.
+	bpfCategoryDB, err := db.Open(filepath.Join(mgr.cfg.Workdir, "brf_categories.db"), true)
+	if err != nil {
+		if bpfCategoryDB == nil {
+			log.Fatalf("failed to open BPF category database: %v", err)
+		}
+		log.Logf(0, "read %v BPF categories and got error: %v", len(bpfCategoryDB.Records), err)
+	}
+	mgr.bpfCategoryDB = bpfCategoryDB
+
 	if seedDir := filepath.Join(mgr.cfg.Syzkaller, "sys", mgr.cfg.TargetOS, "test"); osutil.IsExist(seedDir) {
 		seeds, err := ioutil.ReadDir(seedDir)
 		if err != nil {
@@ -1060,6 +1086,22 @@ func (mgr *Manager) minimizeCorpus() {
 		}
 	}
 	mgr.corpusDB.BumpVersion(currentDBVersion)
+	for key := range mgr.bpfTraceDB.Records {
+		if _, ok := mgr.corpusDB.Records[key]; !ok {
+			mgr.bpfTraceDB.Delete(key)
+		}
+	}
+	if err := mgr.bpfTraceDB.Flush(); err != nil {
+		log.Logf(0, "failed to save BPF trace database: %v", err)
+	}
+	for key := range mgr.bpfCategoryDB.Records {
+		if _, ok := mgr.corpusDB.Records[key]; !ok {
+			mgr.bpfCategoryDB.Delete(key)
+		}
+	}
+	if err := mgr.bpfCategoryDB.Flush(); err != nil {
+		log.Logf(0, "failed to save BPF category database: %v", err)
+	}
 }
 
 type CallCov struct {
@@ -1120,6 +1162,10 @@ func (mgr *Manager) fuzzerConnect(modules []host.KernelModule) (
 			log.Fatalf("failed to create coverage filter: %v", err)
 		}
 		mgr.modulesInitialized = true
+		if mgr.cfg.Cover {
+			// Building the report generator takes a while, don't hold up the fuzzer for it.
+			go mgr.initBrfCoverClasses()
+		}
 	}
 	return corpus, frames, mgr.coverFilter, mgr.coverFilterBitmap, nil
 }
@@ -1149,17 +1195,55 @@ func (mgr *Manager) newInput(inp rpctype.Input, sign signal.Signal) bool {
 		cov.Merge(old.Cover)
 		cov.Merge(inp.Cover)
 		old.Cover = cov.Serialize()
+		if len(old.BpfTrace) == 0 && len(inp.BpfTrace) != 0 {
+			old.BpfTrace = inp.BpfTrace
+			mgr.saveBpfTrace(sig, inp.BpfTrace)
+		}
+		if len(old.BpfCategories) == 0 && len(inp.BpfCategories) != 0 {
+			old.BpfCategories = inp.BpfCategories
+			mgr.saveBpfCategories(sig, inp.BpfCategories)
+		}
 		mgr.corpus[sig] = old
 	} else {
+		if len(inp.BpfTrace) == 0 {
+			// Inputs from the persistent corpus may be triaged by a fuzzer that
+			// does not have the BPF program model anymore.
+			inp.BpfTrace = mgr.bpfTraceDB.Records[sig].Val
+		}
+		if len(inp.BpfCategories) == 0 {
+			if val := mgr.bpfCategoryDB.Records[sig].Val; len(val) != 0 {
+				inp.BpfCategories = strings.Split(string(val), "\n")
+			}
+		}
 		mgr.corpus[sig] = inp
 		mgr.corpusDB.Save(sig, inp.Prog, 0)
 		if err := mgr.corpusDB.Flush(); err != nil {
 			log.Logf(0, "failed to save corpus database: %v", err)
 		}
+		if len(inp.BpfTrace) != 0 {
+			mgr.saveBpfTrace(sig, inp.BpfTrace)
+		}
+		if len(inp.BpfCategories) != 0 {
+			mgr.saveBpfCategories(sig, inp.BpfCategories)
+		}
 	}
 	return true
 }
 
+func (mgr *Manager) saveBpfTrace(sig string, trace []byte) {
+	mgr.bpfTraceDB.Save(sig, trace, 0)
+	if err := mgr.bpfTraceDB.Flush(); err != nil {
+		log.Logf(0, "failed to save BPF trace database: %v", err)
+	}
+}
+
+func (mgr *Manager) saveBpfCategories(sig string, categories []string) {
+	mgr.bpfCategoryDB.Save(sig, []byte(strings.Join(categories, "\n")), 0)
+	if err := mgr.bpfCategoryDB.Flush(); err != nil {
+		log.Logf(0, "failed to save BPF category database: %v", err)
+	}
+}
+
 func (mgr *Manager) candidateBatch(size int) []rpctype.Candidate {
 	mgr.mu.Lock()
 	defer mgr.mu.Unlock()
@@ -35,6 +35,7 @@ type RPCServer struct {
 	maxSignal     signal.Signal
 	corpusSignal  signal.Signal
 	corpusCover   cover.Cover
+	brfCover      *brfCoverClassifier
 	rotator       *prog.Rotator
 	rnd           *rand.Rand
 	checkFailures int
@@ -239,6 +240,9 @@ func (serv *RPCServer) Check(a *rpctype.CheckArgs, r *int) error {
 	for _, feat := range a.Features.Supported() {
 		log.Logf(0, "%-24v: %v", feat.Name, feat.Reason)
 	}
+	if a.BrfFeatures != nil {
+		log.Logf(0, "%-24v: %v", "brf", a.BrfFeatures)
+	}
 	serv.mgr.machineChecked(a, serv.targetEnabledSyscalls)
 	a.DisabledCalls = nil
 	serv.checkResult = a
@@ -246,7 +250,7 @@ func (serv *RPCServer) Check(a *rpctype.CheckArgs, r *int) error {
 	return nil
 }
 
-func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
+func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *rpctype.NewInputRes) error {
 	inputSignal := a.Signal.Deserialize()
 	log.Logf(4, "new input from %v for syscall %v (signal=%v, cover=%v)",
 		a.Name, a.Call, inputSignal.Len(), len(a.Cover))
@@ -269,6 +273,13 @@ func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
 	if !genuine && !rotated {
 		return nil
 	}
+	if serv.brfCover != nil && serv.cfg.BrfVerifierWeight < 100 &&
+		serv.brfCover.verifierOnly(serv.corpusCover, a.Cover) &&
+		serv.rnd.Intn(100) >= serv.cfg.BrfVerifierWeight {
+		serv.stats.brfVerifierDropped.inc()
+		r.Dropped = true
+		return nil
+	}
 	if !serv.mgr.newInput(a.Input, inputSignal) {
 		return nil
 	}
@@ -278,6 +289,7 @@ func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
 	}
 	diff := serv.corpusCover.MergeDiff(a.Cover)
 	serv.stats.corpusCover.set(len(serv.corpusCover))
+	serv.stats.addBrfCover(diff)
 	if len(diff) != 0 && serv.coverFilter != nil {
 		// Note: ReportGenerator is already initialized if coverFilter is enabled.
 		rg, err := getReportGenerator(serv.cfg, serv.modules)
@@ -312,6 +324,13 @@ func (serv *RPCServer) NewInput(a *rpctype.NewInputArgs, r *int) error {
 	return nil
 }
 
+func (serv *RPCServer) setBrfCover(c *brfCoverClassifier) {
+	serv.mu.Lock()
+	defer serv.mu.Unlock()
+	serv.brfCover = c
+	serv.stats.setBrfCover(c, serv.corpusCover)
+}
+
 func (serv *RPCServer) Poll(a *rpctype.PollArgs, r *rpctype.PollRes) error {
 	serv.stats.mergeNamed(a.Stats)
 
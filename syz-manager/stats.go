@@ -5,9 +5,16 @@ package main
 
 import (
 //	"fmt"
+	"encoding/json"
+	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
+	"time"
 
+	"github.com/google/syzkaller/pkg/cover"
+	"github.com/google/syzkaller/pkg/log"
+	"github.com/google/syzkaller/pkg/osutil"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 )
@@ -33,13 +40,23 @@ type Stats struct {
 	corpusCoverFiltered Stat
 	corpusSignal        Stat
 	maxSignal           Stat
+	brfVerifierDropped  Stat
 
 	mu         sync.Mutex
 	namedStats map[string]uint64
 	brfStats   map[string]uint64
+	brfCover   *brfCoverClassifier
+	brfCovered []uint64 // corpus coverage PCs in each class of brfCover
 	haveHub    bool
 }
 
+// BrfCoverClassStat is the corpus coverage in one class of cfg.BrfCoverClasses.
+type BrfCoverClassStat struct {
+	Name    string
+	Covered uint64
+	Total   int
+}
+
 func (mgr *Manager) initStats() {
 	// Prometheus Instrumentation https://prometheus.io/docs/guides/go-application .
 	prometheus.Register(promauto.NewGaugeFunc(prometheus.GaugeOpts{
@@ -60,6 +77,129 @@ func (mgr *Manager) initStats() {
 	},
 		func() float64 { return float64(mgr.stats.crashes.get()) },
 	))
+	prometheus.Register(brfCollector{mgr.stats})
+}
+
+// brfCollector exports the BRF counters merged from the fuzzers.
+// They are read on every scrape, so it does not keep a copy of them.
+type brfCollector struct {
+	stats *Stats
+}
+
+// brfOutcomes are the outcome labels of the counters of program types, helpers and map types.
+var brfOutcomes = [4]string{"loaded", "load_fail", "attached", "attach_fail"}
+
+var (
+	brfProgramsDesc = prometheus.NewDesc("brf_programs_total",
+		"BPF programs by program type and outcome", []string{"prog_type", "outcome"}, nil)
+	brfHelperDesc = prometheus.NewDesc("brf_helper_total",
+		"Helper calls in BPF programs by helper and outcome", []string{"helper", "outcome"}, nil)
+	brfMapDesc = prometheus.NewDesc("brf_map_total",
+		"Maps used by BPF programs by map type and outcome", []string{"map_type", "outcome"}, nil)
+)
+
+// brfGeneralMetrics maps the general BRF counters to metrics. Index 0 of a counter is
+// a sum and index 1 is a maximum.
+var brfGeneralMetrics = []struct {
+	stat  string
+	index int
+	typ   prometheus.ValueType
+	desc  *prometheus.Desc
+}{
+	{"BPF_BRF_NINSN", 0, prometheus.CounterValue, prometheus.NewDesc("brf_insns_total",
+		"Instructions in loaded BPF programs", nil, nil)},
+	{"BPF_BRF_NINSN", 1, prometheus.GaugeValue, prometheus.NewDesc("brf_max_insns",
+		"Most instructions in a loaded BPF program", nil, nil)},
+	{"BPF_BRF_NFUNC", 0, prometheus.CounterValue, prometheus.NewDesc("brf_helper_calls_total",
+		"Helper calls in generated BPF programs", nil, nil)},
+	{"BPF_BRF_NFUNC", 1, prometheus.GaugeValue, prometheus.NewDesc("brf_max_helper_calls",
+		"Most helper calls in a generated BPF program", nil, nil)},
+	{"BPF_BRF_NMAP", 0, prometheus.CounterValue, prometheus.NewDesc("brf_maps_total",
+		"Maps of generated BPF programs", nil, nil)},
+	{"BPF_BRF_NMAP", 1, prometheus.GaugeValue, prometheus.NewDesc("brf_max_maps",
+		"Most maps of a generated BPF program", nil, nil)},
+	{"BPF_BRF_NRUN", 0, prometheus.CounterValue, prometheus.NewDesc("brf_not_run_total",
+		"Tests whose BPF program never ran", nil, nil)},
+	{"BPF_BRF_NRUN", 1, prometheus.GaugeValue, prometheus.NewDesc("brf_max_runs",
+		"Most runs of the BPF program of a test", nil, nil)},
+}
+
+func (c brfCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- brfProgramsDesc
+	ch <- brfHelperDesc
+	ch <- brfMapDesc
+	for _, m := range brfGeneralMetrics {
+		ch <- m.desc
+	}
+}
+
+func (c brfCollector) Collect(ch chan<- prometheus.Metric) {
+	generals, progs, helpers, maps := c.stats.brf()
+	collect := func(desc *prometheus.Desc, counts map[string]*[4]uint64) {
+		for name, v := range counts {
+			for i, outcome := range brfOutcomes {
+				ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue,
+					float64(v[i]), name, outcome)
+			}
+		}
+	}
+	collect(brfProgramsDesc, progs)
+	collect(brfHelperDesc, helpers)
+	collect(brfMapDesc, maps)
+	for _, m := range brfGeneralMetrics {
+		var v uint64
+		if counts := generals[m.stat]; counts != nil {
+			v = counts[m.index]
+		}
+		ch <- prometheus.MustNewConstMetric(m.desc, m.typ, float64(v))
+	}
+}
+
+const (
+	// How often the BRF counters are appended to brf_stats.json in the workdir.
+	brfSnapshotPeriod = 5 * time.Minute
+	// Once the in-memory history grows past this, every other snapshot is dropped.
+	maxBrfSnapshots = 1000
+)
+
+func (mgr *Manager) brfSnapshotLoop() {
+	f, err := os.OpenFile(filepath.Join(mgr.cfg.Workdir, "brf_stats.json"),
+		os.O_WRONLY|os.O_CREATE|os.O_APPEND, osutil.DefaultFilePerm)
+	if err != nil {
+		log.Fatalf("failed to open brf stats file: %v", err)
+	}
+	for {
+		time.Sleep(brfSnapshotPeriod)
+		mgr.mu.Lock()
+		if mgr.firstConnect.IsZero() {
+			mgr.mu.Unlock()
+			continue
+		}
+		snap := mgr.stats.brfSnapshot(time.Since(mgr.firstConnect))
+		mgr.brfSnapshots = append(mgr.brfSnapshots, snap)
+		if len(mgr.brfSnapshots) > maxBrfSnapshots {
+			mgr.brfSnapshots = thinBrfSnapshots(mgr.brfSnapshots)
+		}
+		mgr.mu.Unlock()
+
+		data, err := json.Marshal(snap)
+		if err != nil {
+			log.Fatalf("failed to serialize brf stats: %v", err)
+		}
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			log.Fatalf("failed to write brf stats: %v", err)
+		}
+	}
+}
+
+// thinBrfSnapshots halves the resolution of the history. The counters are cumulative,
+// so the rates between the remaining snapshots stay correct. The latest one is always kept.
+func thinBrfSnapshots(snaps []*BrfSnapshot) []*BrfSnapshot {
+	var res []*BrfSnapshot
+	for i := (len(snaps) - 1) % 2; i < len(snaps); i += 2 {
+		res = append(res, snaps[i])
+	}
+	return res
 }
 
 func (stats *Stats) all() map[string]uint64 {
@@ -93,7 +233,33 @@ func (stats *Stats) all() map[string]uint64 {
 	return m
 }
 
+// BrfSnapshot is a copy of the cumulative BRF counters taken at one point of the run.
+// The counters of program types, helpers and map types are indexed by
+// loaded, load fail, attached and attach fail.
+type BrfSnapshot struct {
+	Time    time.Time
+	Uptime  uint64 // seconds since the first fuzzer connected
+	General map[string]*[4]uint64
+	Progs   map[string]*[4]uint64
+	Helpers map[string]*[4]uint64
+	Maps    map[string]*[4]uint64
+}
+
+func (stats *Stats) brfSnapshot(uptime time.Duration) *BrfSnapshot {
+	generals, progs, helpers, maps := stats.brf()
+	return &BrfSnapshot{
+		Time:    time.Now(),
+		Uptime:  uint64(uptime / time.Second),
+		General: generals,
+		Progs:   progs,
+		Helpers: helpers,
+		Maps:    maps,
+	}
+}
+
 func (stats *Stats) brf() (map[string]*[4]uint64, map[string]*[4]uint64, map[string]*[4]uint64, map[string]*[4]uint64) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
 	generals := make(map[string]*[4]uint64)
 	progs := make(map[string]*[4]uint64)
 	helpers := make(map[string]*[4]uint64)
@@ -123,7 +289,7 @@ func (stats *Stats) brf() (map[string]*[4]uint64, map[string]*[4]uint64, map[str
 				progs[key] = new([4]uint64)
 			}
 			(*progs[key])[typ] = v
-		} else if k[0:8] == "BPF_FUNC" {
+		} else if k[0:8] == "BPF_FUNC" || k[0:4] == "bpf_" {
 			if _, ok := helpers[key]; !ok {
 				helpers[key] = new([4]uint64)
 			}
@@ -138,6 +304,46 @@ func (stats *Stats) brf() (map[string]*[4]uint64, map[string]*[4]uint64, map[str
 	return generals, progs, helpers, maps
 }
 
+// setBrfCover starts counting corpus coverage in the classes of c.
+func (stats *Stats) setBrfCover(c *brfCoverClassifier, corpusCover cover.Cover) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	stats.brfCover = c
+	stats.brfCovered = make([]uint64, len(c.names))
+	for pc := range corpusCover {
+		if class := c.class(pc); class != -1 {
+			stats.brfCovered[class]++
+		}
+	}
+}
+
+func (stats *Stats) addBrfCover(pcs []uint32) {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.brfCover == nil {
+		return
+	}
+	for _, pc := range pcs {
+		if class := stats.brfCover.class(pc); class != -1 {
+			stats.brfCovered[class]++
+		}
+	}
+}
+
+// brfCoverClasses returns the corpus coverage in each class, or nil until the classes are computed.
+func (stats *Stats) brfCoverClasses() []BrfCoverClassStat {
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	if stats.brfCover == nil {
+		return nil
+	}
+	var res []BrfCoverClassStat
+	for i, name := range stats.brfCover.names {
+		res = append(res, BrfCoverClassStat{name, stats.brfCovered[i], stats.brfCover.totals[i]})
+	}
+	return res
+}
+
 func (stats *Stats) mergeNamed(named map[string]uint64) {
 	stats.mu.Lock()
 	defer stats.mu.Unlock()
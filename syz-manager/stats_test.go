@@ -0,0 +1,110 @@
+// Copyright 2024 syzkaller project authors. All rights reserved.
+// Use of this source code is governed by Apache 2 LICENSE that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestBrfSnapshot(t *testing.T) {
+	stats := new(Stats)
+	stats.mergeNamed(map[string]uint64{
+		"BPF_PROG_TYPE_XDP_0":        3,
+		"BPF_PROG_TYPE_XDP_1":        1,
+		"BPF_FUNC_map_lookup_elem_3": 2,
+		"BPF_MAP_TYPE_HASH_0":        5,
+		"BPF_BRF_NINSN_1":            40,
+	})
+	stats.mergeNamed(map[string]uint64{
+		"BPF_PROG_TYPE_XDP_1": 1,
+		"BPF_BRF_NINSN_1":     20,
+	})
+	snap := stats.brfSnapshot(90 * time.Second)
+	if snap.Uptime != 90 {
+		t.Fatalf("uptime %v, want 90", snap.Uptime)
+	}
+	if got, want := *snap.Progs["BPF_PROG_TYPE_XDP"], [4]uint64{3, 2, 0, 0}; got != want {
+		t.Fatalf("prog counters %v, want %v", got, want)
+	}
+	if got, want := *snap.Helpers["BPF_FUNC_map_lookup_elem"], [4]uint64{0, 0, 0, 2}; got != want {
+		t.Fatalf("helper counters %v, want %v", got, want)
+	}
+	if got, want := *snap.Maps["BPF_MAP_TYPE_HASH"], [4]uint64{5, 0, 0, 0}; got != want {
+		t.Fatalf("map counters %v, want %v", got, want)
+	}
+	// The second general counter is a maximum, not a sum.
+	if got, want := *snap.General["BPF_BRF_NINSN"], [4]uint64{0, 40, 0, 0}; got != want {
+		t.Fatalf("general counters %v, want %v", got, want)
+	}
+}
+
+func TestThinBrfSnapshots(t *testing.T) {
+	for n := 1; n <= 6; n++ {
+		var snaps []*BrfSnapshot
+		for i := 0; i < n; i++ {
+			snaps = append(snaps, &BrfSnapshot{Uptime: uint64(i)})
+		}
+		res := thinBrfSnapshots(snaps)
+		if len(res) != (n+1)/2 {
+			t.Fatalf("thinned %v snapshots to %v", n, len(res))
+		}
+		if res[len(res)-1] != snaps[n-1] {
+			t.Fatalf("thinning %v snapshots dropped the latest one", n)
+		}
+		for i := 1; i < len(res); i++ {
+			if res[i].Uptime != res[i-1].Uptime+2 {
+				t.Fatalf("thinning %v snapshots kept uptimes %v and %v",
+					n, res[i-1].Uptime, res[i].Uptime)
+			}
+		}
+	}
+}
+
+func TestBrfCollector(t *testing.T) {
+	stats := new(Stats)
+	stats.mergeNamed(map[string]uint64{
+		"BPF_PROG_TYPE_XDP_0":        3,
+		"BPF_PROG_TYPE_XDP_3":        1,
+		"BPF_FUNC_map_lookup_elem_1": 2,
+		"BPF_BRF_NINSN_1":            40,
+		"BPF_BRF_NRUN_0":             7,
+	})
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(brfCollector{stats})
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			name := family.GetName()
+			for _, label := range metric.GetLabel() {
+				name += " " + label.GetName() + "=" + label.GetValue()
+			}
+			got[name] = metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+		}
+	}
+	want := map[string]float64{
+		"brf_programs_total outcome=loaded prog_type=BPF_PROG_TYPE_XDP":      3,
+		"brf_programs_total outcome=load_fail prog_type=BPF_PROG_TYPE_XDP":   0,
+		"brf_programs_total outcome=attach_fail prog_type=BPF_PROG_TYPE_XDP": 1,
+		"brf_helper_total helper=BPF_FUNC_map_lookup_elem outcome=load_fail": 2,
+		"brf_max_insns":     40,
+		"brf_insns_total":   0,
+		"brf_not_run_total": 7,
+		"brf_max_maps":      0,
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%v = %v, want %v", name, got[name], v)
+		}
+	}
+	if _, ok := got["brf_map_total map_type=BPF_MAP_TYPE_HASH outcome=loaded"]; ok {
+		t.Errorf("exported a map type that was never used")
+	}
+}